@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"Golem/internal/storage/backup"
+	"Golem/internal/storage/migrations"
+)
+
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	dbPath := flags.String("db", filepath.Join("data", "golem.db"), "path to golem.db")
+	output := flags.String("o", "", "output file (default golem-<timestamp>.db in the current directory)")
+	flags.Parse(args)
+
+	if *output == "" {
+		*output = backup.FileName(time.Now())
+	}
+	if _, err := os.Stat(*dbPath); err != nil {
+		return fmt.Errorf("cannot back up %s: %v", *dbPath, err)
+	}
+
+	db, err := sql.Open("sqlite3", *dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := backup.Create(db, *output); err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s to %s\n", *dbPath, *output)
+	return nil
+}
+
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbPath := flags.String("db", filepath.Join("data", "golem.db"), "path to golem.db")
+	verifyOnly := flags.Bool("verify", false, "only check the backup, do not restore it")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: golem restore [-db path] [-verify] backup.db")
+		fmt.Fprintln(os.Stderr, "\nStop the server before restoring.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	src := flags.Arg(0)
+
+	version, err := backup.Verify(src)
+	if err != nil {
+		return fmt.Errorf("refusing to restore %s: %v", src, err)
+	}
+	fmt.Printf("%s passed the integrity check (schema version %d, latest %d)\n", src, version, migrations.Latest())
+	if *verifyOnly {
+		return nil
+	}
+
+	previous, err := backup.Restore(src, *dbPath)
+	if err != nil {
+		return err
+	}
+	if previous != "" {
+		fmt.Printf("Previous database saved as %s\n", previous)
+	}
+	fmt.Printf("Restored %s to %s\n", src, *dbPath)
+	return nil
+}
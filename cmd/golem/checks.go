@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"Golem/internal/manifest"
+)
+
+func runChecks(args []string) error {
+	flags := flag.NewFlagSet("checks", flag.ExitOnError)
+	server := flags.String("server", getEnv("GOLEM_SERVER", "http://localhost:8899"), "Golem server URL")
+	file := flags.String("f", "", "manifest to apply, - for stdin")
+	output := flags.String("o", "", "file to export to (default stdout)")
+	format := flags.String("format", "yaml", "export format: yaml or json")
+	dryRun := flags.Bool("dry-run", false, "show what apply would change without changing it")
+	prune := flags.Bool("prune", false, "delete checks that are not in the manifest")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: golem checks apply -f checks.yaml [-dry-run] [-prune] [-server url]")
+		fmt.Fprintln(os.Stderr, "       golem checks export [-format yaml|json] [-o file] [-server url]")
+		fmt.Fprintln(os.Stderr, "\nGOLEM_TOKEN, if set, is sent as a bearer token.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	// Allow flags after the action as well.
+	action := flags.Arg(0)
+	flags.Parse(flags.Args()[1:])
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	switch action {
+	case "apply":
+		if *file == "" {
+			flags.Usage()
+			os.Exit(2)
+		}
+		return applyChecks(*server, *file, *dryRun, *prune)
+	case "export":
+		return exportChecks(*server, *format, *output)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+func applyChecks(server, file string, dryRun, prune bool) error {
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// Validate locally first so mistakes are reported without a round trip.
+	m, err := manifest.Parse(in)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	body, err := manifest.Marshal(m, "json")
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("dry_run", fmt.Sprint(dryRun))
+	query.Set("prune", fmt.Sprint(prune))
+	resp, err := apiRequest("POST", server+"/api/health-checks/import?"+query.Encode(), "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		DryRun bool `json:"dry_run"`
+		manifest.Plan
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tNAME\tCHANGES")
+	for _, c := range result.Changes {
+		if c.Action == manifest.ActionUnchanged {
+			continue
+		}
+		fields := make([]string, 0, len(c.Changes))
+		for _, change := range c.Changes {
+			fields = append(fields, fmt.Sprintf("%s: %s -> %s", change.Field, formatValue(change.Field, change.Old), formatValue(change.Field, change.New)))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Action, c.Name, strings.Join(fields, ", "))
+	}
+	w.Flush()
+
+	s := result.Summary
+	if result.DryRun {
+		fmt.Printf("Dry run: %d to create, %d to update, %d to delete, %d unchanged\n", s.Create, s.Update, s.Delete, s.Unchanged)
+	} else {
+		fmt.Printf("%d created, %d updated, %d deleted, %d unchanged\n", s.Create, s.Update, s.Delete, s.Unchanged)
+	}
+	return nil
+}
+
+func exportChecks(server, format, output string) error {
+	resp, err := apiRequest("GET", server+"/api/health-checks/export?format="+url.QueryEscape(format), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+// formatValue prints a diffed config value; durations arrive as nanoseconds.
+func formatValue(field string, v interface{}) string {
+	if ns, ok := v.(float64); ok && (field == "interval" || field == "timeout") {
+		return time.Duration(ns).String()
+	}
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprint(v)
+}
+
+// apiRequest calls the Golem API and turns non-2xx responses into errors.
+func apiRequest(method, target, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token := os.Getenv("GOLEM_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %v", target, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, target, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// commands are the subcommands accepted in place of starting the server.
+var commands = map[string]command{
+	"backup":  {"write a consistent copy of golem.db, even while the server runs", runBackup},
+	"checks":  {"apply or export health check manifests through the API", runChecks},
+	"migrate": {"show, apply or revert golem.db schema migrations", runMigrate},
+	"restore": {"verify a backup and swap it in as golem.db", runRestore},
+	"user":    {"create a user directly in golem.db, e.g. the first admin", runUser},
+}
+
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd.run(args)
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: golem [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\nWithout a command the monitoring server is started.\n\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].usage)
+	}
+}
@@ -8,16 +8,33 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"Golem/internal/api"
+	"Golem/internal/audit"
 	"Golem/internal/auth"
 	"Golem/internal/collector"
+	"Golem/internal/docker"
+	"Golem/internal/mail"
+	"Golem/internal/statuspage"
 	"Golem/internal/storage"
+	"Golem/internal/storage/backup"
+	"Golem/internal/storage/migrations"
+	"Golem/internal/storage/tsdb"
+	"Golem/internal/systemd"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -34,38 +51,345 @@ func main() {
 		log.Fatalf("Failed to create data directory: %v", err)
 	}
 
-	// Initialize SQLite storage for metrics and health checks
+	// Open golem.db (users, and metrics and health checks with the sqlite
+	// backend) and bring its schema up to date before anything uses it
 	dbPath := filepath.Join(dataDir, "golem.db")
-	metricStorage, err := storage.NewSQLiteStorage(dbPath)
+	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
-		log.Fatalf("Failed to initialize SQLite storage: %v", err)
+		log.Fatalf("Failed to open SQLite DB: %v", err)
 	}
-	defer metricStorage.Close()
+	defer db.Close()
 
-	// Initialize SQLite DB for users (reuse golem.db)
-	db, err := sql.Open("sqlite3", dbPath)
+	applied, err := migrations.Up(db)
 	if err != nil {
-		log.Fatalf("Failed to open SQLite DB for users: %v", err)
+		log.Fatalf("Failed to migrate %s: %v", dbPath, err)
+	}
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	log.Printf("Database schema at version %d", migrations.Latest())
+
+	// Initialize the configured storage backend for metrics and health checks
+	backend := getEnv("GOLEM_STORAGE", "sqlite")
+	dsn := getEnv("GOLEM_STORAGE_DSN", dbPath)
+	backendStorage, err := storage.Open(backend, dsn)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", backend, err)
+	}
+	defer backendStorage.Close()
+	log.Printf("Using %s storage backend", backend)
+
+	// Metrics can optionally be kept in the embedded TSDB instead
+	var metricStorage storage.MetricStorage = backendStorage
+	if getEnv("GOLEM_METRICS_STORAGE", backend) == "tsdb" {
+		retention, err := time.ParseDuration(getEnv("GOLEM_TSDB_RETENTION", tsdb.DefaultRetention.String()))
+		if err != nil {
+			log.Fatalf("Invalid GOLEM_TSDB_RETENTION: %v", err)
+		}
+		tsdbDir := getEnv("GOLEM_TSDB_DIR", filepath.Join(dataDir, "tsdb"))
+		db, err := tsdb.Open(tsdbDir, tsdb.Options{Retention: retention})
+		if err != nil {
+			log.Fatalf("Failed to open TSDB: %v", err)
+		}
+		defer db.Close()
+		metricStorage = db
+		log.Printf("Storing metrics in TSDB at %s (retention %v)", tsdbDir, retention)
 	}
-	defer db.Close()
 
 	userStorage, err := auth.NewSQLiteUserStorage(db)
 	if err != nil {
 		log.Fatalf("Failed to initialize user storage: %v", err)
 	}
+	if userStorage.Policy, err = passwordPolicyFromEnv(); err != nil {
+		log.Fatalf("Invalid password policy: %v", err)
+	}
+	if breached := userStorage.Policy.Breached; breached != nil {
+		if n := breached.Len(); n >= 0 {
+			log.Printf("Rejecting %d breached passwords", n)
+		} else {
+			log.Printf("Rejecting passwords in the breached password hash list")
+		}
+	}
+
+	roleStorage, err := auth.NewSQLiteRoleStorage(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize role storage: %v", err)
+	}
+	teamStorage, err := auth.NewSQLiteTeamStorage(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize team storage: %v", err)
+	}
+	// GOLEM_ANONYMOUS_ROLE grants requests without a token that role's permissions
+	authorizer := &auth.Authorizer{Roles: roleStorage, Teams: teamStorage, AnonymousRole: auth.Role(getEnv("GOLEM_ANONYMOUS_ROLE", ""))}
+	if authorizer.AnonymousRole != "" {
+		if exists, err := authorizer.RoleExists(authorizer.AnonymousRole); err != nil || !exists {
+			log.Fatalf("Invalid GOLEM_ANONYMOUS_ROLE %q: role not found", authorizer.AnonymousRole)
+		}
+		log.Printf("Requests without a token have the %s role", authorizer.AnonymousRole)
+	}
+
+	invitationStorage, err := auth.NewSQLiteInvitationStorage(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize invitation storage: %v", err)
+	}
+	policy, err := auth.ParseRegistrationPolicy(getEnv("GOLEM_REGISTRATION", string(auth.RegistrationInvite)))
+	if err != nil {
+		log.Fatalf("Invalid GOLEM_REGISTRATION: %v", err)
+	}
+	registration := &auth.Registration{
+		Policy:      policy,
+		Invitations: invitationStorage,
+		Domains:     auth.ParseDomains(getEnv("GOLEM_REGISTRATION_DOMAINS", "")),
+	}
+	log.Printf("Registration is %s", policy)
+
+	// Until the first user exists, a one-time setup token creates the first admin
+	setupToken, err := registration.StartSetup(userStorage)
+	if err != nil {
+		log.Fatalf("Failed to check for users: %v", err)
+	}
+	if setupToken != "" {
+		log.Printf("No users exist. Create the first admin with POST /api/auth/setup and setup token %s", setupToken)
+		log.Printf("or run: golem user create -admin -username <name> -email <email>")
+	}
+
+	// Password logins ask for a TOTP code from users who set one up, and
+	// from every user of a role that requires it
+	mfaStorage, err := auth.NewSQLiteMFAStorage(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize MFA storage: %v", err)
+	}
+	mfa := &auth.MFA{Store: mfaStorage, Issuer: getEnv("GOLEM_MFA_ISSUER", "Golem")}
+
+	// Failed logins back off exponentially and lock out the username or
+	// client address for a while; every attempt is recorded
+	loginStorage, err := auth.NewSQLiteLoginStorage(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize login storage: %v", err)
+	}
+	guard := &auth.LoginGuard{Store: loginStorage, User: auth.DefaultUserLockout, IP: auth.DefaultIPLockout}
+	if guard.User.LockoutAttempts, err = strconv.Atoi(getEnv("GOLEM_LOCKOUT_ATTEMPTS", strconv.Itoa(guard.User.LockoutAttempts))); err != nil {
+		log.Fatalf("Invalid GOLEM_LOCKOUT_ATTEMPTS: %v", err)
+	}
+	if guard.IP.LockoutAttempts, err = strconv.Atoi(getEnv("GOLEM_LOCKOUT_IP_ATTEMPTS", strconv.Itoa(guard.IP.LockoutAttempts))); err != nil {
+		log.Fatalf("Invalid GOLEM_LOCKOUT_IP_ATTEMPTS: %v", err)
+	}
+	if guard.User.LockoutDuration, err = time.ParseDuration(getEnv("GOLEM_LOCKOUT_DURATION", guard.User.LockoutDuration.String())); err != nil {
+		log.Fatalf("Invalid GOLEM_LOCKOUT_DURATION: %v", err)
+	}
+	auditLog, err := audit.NewSQLiteStorage(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize audit log: %v", err)
+	}
+	trustedProxies, err := auth.ParseTrustedProxies(getEnv("GOLEM_TRUSTED_PROXIES", ""))
+	if err != nil {
+		log.Fatalf("Invalid GOLEM_TRUSTED_PROXIES: %v", err)
+	}
+
+	// Links in emails and the iss claim of tokens point here
+	baseURL := getEnv("GOLEM_BASE_URL", "http://localhost:8899")
+
+	// Password reset and email verification links are mailed when
+	// GOLEM_SMTP_ADDR is set
+	var accountMail *auth.AccountMail
+	if smtpAddr := getEnv("GOLEM_SMTP_ADDR", ""); smtpAddr != "" {
+		tokenStorage, err := auth.NewSQLiteUserTokenStorage(db)
+		if err != nil {
+			log.Fatalf("Failed to initialize token storage: %v", err)
+		}
+		tlsMode := getEnv("GOLEM_SMTP_TLS", mail.TLSStartTLS)
+		if tlsMode != mail.TLSStartTLS && tlsMode != mail.TLSImplicit && tlsMode != mail.TLSNone {
+			log.Fatalf("Invalid GOLEM_SMTP_TLS %q (want starttls, tls or none)", tlsMode)
+		}
+		accountMail = &auth.AccountMail{
+			Tokens: tokenStorage,
+			Mailer: &mail.SMTPMailer{
+				Addr:     smtpAddr,
+				Username: getEnv("GOLEM_SMTP_USERNAME", ""),
+				Password: getEnv("GOLEM_SMTP_PASSWORD", ""),
+				From:     getEnv("GOLEM_SMTP_FROM", "Golem <golem@localhost>"),
+				TLS:      tlsMode,
+			},
+			BaseURL: baseURL,
+		}
+		log.Printf("Mailing password reset and verification links through %s", smtpAddr)
+	}
+
+	// Users from single sign-on and LDAP are linked to their external account
+	identityStorage, err := auth.NewSQLiteIdentityStorage(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize identity storage: %v", err)
+	}
+
+	// Single sign-on is enabled by GOLEM_OIDC_ISSUER
+	var oidcOption api.Option
+	if issuer := getEnv("GOLEM_OIDC_ISSUER", ""); issuer != "" {
+		mapping, err := auth.ParseRoleMapping(getEnv("GOLEM_OIDC_ROLE_MAPPING", ""))
+		if err != nil {
+			log.Fatalf("Invalid GOLEM_OIDC_ROLE_MAPPING: %v", err)
+		}
+		// Users in no mapped group get the default role; "none" refuses them
+		defaultRole := auth.Role(getEnv("GOLEM_OIDC_DEFAULT_ROLE", string(auth.RoleViewer)))
+		if defaultRole == "none" {
+			defaultRole = ""
+		}
+		provider := auth.NewOIDCProvider(auth.OIDCConfig{
+			Name:         getEnv("GOLEM_OIDC_NAME", "SSO"),
+			Issuer:       issuer,
+			ClientID:     getEnv("GOLEM_OIDC_CLIENT_ID", "golem"),
+			ClientSecret: getEnv("GOLEM_OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("GOLEM_OIDC_REDIRECT_URL", "http://localhost:8899/api/auth/oidc/callback"),
+			Scopes:       strings.Fields(getEnv("GOLEM_OIDC_SCOPES", "openid profile email")),
+			GroupsClaim:  getEnv("GOLEM_OIDC_GROUPS_CLAIM", "groups"),
+			RoleMapping:  mapping,
+			DefaultRole:  defaultRole,
+		}, nil)
+		oidcOption = api.WithOIDC(provider, identityStorage)
+		log.Printf("Single sign-on with %s enabled", issuer)
+	}
+
+	// LDAP login is enabled by GOLEM_LDAP_URL. Local users can still log in
+	// with a password, so an admin can get in when the directory is down.
+	var authenticators []auth.Authenticator
+	if ldapURL := getEnv("GOLEM_LDAP_URL", ""); ldapURL != "" {
+		mapping, err := auth.ParseRoleMapping(getEnv("GOLEM_LDAP_ROLE_MAPPING", ""))
+		if err != nil {
+			log.Fatalf("Invalid GOLEM_LDAP_ROLE_MAPPING: %v", err)
+		}
+		defaultRole := auth.Role(getEnv("GOLEM_LDAP_DEFAULT_ROLE", string(auth.RoleViewer)))
+		if defaultRole == "none" {
+			defaultRole = ""
+		}
+		ldap, err := auth.NewLDAPAuthenticator(auth.LDAPConfig{
+			URL:                ldapURL,
+			StartTLS:           getEnv("GOLEM_LDAP_START_TLS", "") == "true",
+			CAFile:             getEnv("GOLEM_LDAP_CA_FILE", ""),
+			InsecureSkipVerify: getEnv("GOLEM_LDAP_INSECURE_SKIP_VERIFY", "") == "true",
+			BindDN:             getEnv("GOLEM_LDAP_BIND_DN", ""),
+			BindPassword:       getEnv("GOLEM_LDAP_BIND_PASSWORD", ""),
+			BaseDN:             getEnv("GOLEM_LDAP_BASE_DN", ""),
+			UserFilter:         getEnv("GOLEM_LDAP_USER_FILTER", ""),
+			UsernameAttribute:  getEnv("GOLEM_LDAP_USERNAME_ATTRIBUTE", ""),
+			EmailAttribute:     getEnv("GOLEM_LDAP_EMAIL_ATTRIBUTE", ""),
+			GroupAttribute:     getEnv("GOLEM_LDAP_GROUP_ATTRIBUTE", ""),
+			GroupBaseDN:        getEnv("GOLEM_LDAP_GROUP_BASE_DN", ""),
+			GroupFilter:        getEnv("GOLEM_LDAP_GROUP_FILTER", ""),
+			RoleMapping:        mapping,
+			DefaultRole:        defaultRole,
+		}, &auth.Provisioner{Users: userStorage, Identities: identityStorage, Authorizer: authorizer})
+		if err != nil {
+			log.Fatalf("Invalid LDAP configuration: %v", err)
+		}
+		authenticators = []auth.Authenticator{ldap, &auth.LocalAuthenticator{Users: userStorage}}
+		log.Printf("LDAP login with %s enabled", ldapURL)
+	}
 
-	// JWT secret and duration (should be from env in production)
-	jwtSecret := "supersecretkey" // TODO: use os.Getenv in production
+	// Session tokens are signed with keys kept in golem.db. A new key is
+	// published an hour before it starts signing, and the old one verifies
+	// for a token lifetime after.
 	tokenDuration := 24 * time.Hour
-	jwtService := auth.NewJWTService(jwtSecret, tokenDuration)
+	keyStorage, err := auth.NewSQLiteKeyStorage(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize key storage: %v", err)
+	}
+	algorithm, err := auth.ParseSigningAlgorithm(getEnv("GOLEM_JWT_ALGORITHM", auth.AlgEdDSA))
+	if err != nil {
+		log.Fatalf("Invalid GOLEM_JWT_ALGORITHM: %v", err)
+	}
+	rotateEvery, err := time.ParseDuration(getEnv("GOLEM_JWT_ROTATE", "720h"))
+	if err != nil {
+		log.Fatalf("Invalid GOLEM_JWT_ROTATE: %v", err)
+	}
+	keys := &auth.KeyRing{
+		Store:       keyStorage,
+		Algorithm:   algorithm,
+		RotateEvery: rotateEvery,
+		PrePublish:  time.Hour,
+		Overlap:     tokenDuration + time.Hour,
+	}
+	if err := keys.Load(); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	go keys.Start(ctx)
+	jwtService := auth.NewJWTServiceWithKeys(keys, tokenDuration)
+	jwtService.Issuer = getEnv("GOLEM_JWT_ISSUER", baseURL)
 
-	collector := collector.NewCollector(metricStorage)
+	cgroupMode, err := collector.ParseCgroupMode(getEnv("GOLEM_CGROUPS", string(collector.CgroupsContainers)))
+	if err != nil {
+		log.Fatalf("Invalid GOLEM_CGROUPS: %v", err)
+	}
+	// Containers are listed and named, and docker checks run, when the
+	// Docker socket is there.
+	var dockerClient *docker.Client
+	if socket := getEnv("GOLEM_DOCKER_SOCKET", docker.DefaultSocket); socket != "" {
+		if _, err := os.Stat(socket); err == nil {
+			dockerClient = docker.NewClient(socket)
+		}
+	}
+	// Units are recorded, and systemd checks run, on hosts booted with
+	// systemd or with GOLEM_SYSTEMCTL set.
+	var systemdClient *systemd.Client
+	if systemctl := os.Getenv("GOLEM_SYSTEMCTL"); systemctl != "" {
+		systemdClient = systemd.NewClient(systemctl)
+	} else if systemd.Booted() {
+		systemdClient = systemd.NewClient("systemctl")
+	}
+	var systemdUnits []string
+	if units := getEnv("GOLEM_SYSTEMD_UNITS", "*.service"); units != "off" {
+		systemdUnits = strings.FieldsFunc(units, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	collector := collector.NewCollector(metricStorage,
+		collector.WithCgroups(getEnv("GOLEM_CGROUP_ROOT", "/sys/fs/cgroup"), cgroupMode, dockerClient),
+		collector.WithDocker(dockerClient),
+		collector.WithSystemd(systemdClient, systemdUnits...))
 	go collector.Start(ctx, 5*time.Second)
 
-	healthCheckCollector := collector.NewHealthCheckCollector(metricStorage)
+	healthCheckCollector := collector.NewHealthCheckCollector(backendStorage)
 	go healthCheckCollector.Start(ctx)
 
-	apiServer := api.NewServer(metricStorage, metricStorage, healthCheckCollector, userStorage, jwtService)
+	// Scheduled backups of golem.db are enabled by GOLEM_BACKUP_DIR
+	if backupDir := getEnv("GOLEM_BACKUP_DIR", ""); backupDir != "" {
+		interval, err := time.ParseDuration(getEnv("GOLEM_BACKUP_INTERVAL", "24h"))
+		if err != nil {
+			log.Fatalf("Invalid GOLEM_BACKUP_INTERVAL: %v", err)
+		}
+		keep, err := strconv.Atoi(getEnv("GOLEM_BACKUP_KEEP", "7"))
+		if err != nil {
+			log.Fatalf("Invalid GOLEM_BACKUP_KEEP: %v", err)
+		}
+		scheduler := &backup.Scheduler{DB: db, Dir: backupDir, Keep: keep}
+		go scheduler.Start(ctx, interval)
+		log.Printf("Backing up golem.db to %s every %v, keeping %d", backupDir, interval, keep)
+	}
+
+	statusStorage, err := statuspage.NewSQLiteStorage(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize status page storage: %v", err)
+	}
+	statusPage := &statuspage.Service{Store: statusStorage, Checks: backendStorage}
+	go statusPage.Start(ctx, time.Minute)
+
+	options := []api.Option{
+		api.WithBackupDB(db),
+		api.WithStatusPage(statusPage),
+		api.WithAuthorizer(authorizer),
+		api.WithRegistration(registration),
+		api.WithMFA(mfa),
+		api.WithLoginGuard(guard),
+		api.WithLoginEvents(loginStorage),
+		api.WithTrustedProxies(trustedProxies),
+		api.WithAuditLog(auditLog),
+	}
+	if accountMail != nil {
+		options = append(options, api.WithAccountMail(accountMail))
+	}
+	if oidcOption != nil {
+		options = append(options, oidcOption)
+	}
+	if authenticators != nil {
+		options = append(options, api.WithAuthenticators(authenticators...))
+	}
+	apiServer := api.NewServer(metricStorage, backendStorage, healthCheckCollector, userStorage, jwtService, options...)
 	server := &http.Server{
 		Addr:    ":8899",
 		Handler: apiServer.Router(),
@@ -100,3 +424,10 @@ func main() {
 
 	log.Println("Server gracefully stopped")
 }
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	osuser "os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"Golem/internal/audit"
+	"Golem/internal/auth"
+)
+
+func runUser(args []string) error {
+	flags := flag.NewFlagSet("user", flag.ExitOnError)
+	dbPath := flags.String("db", filepath.Join("data", "golem.db"), "path to golem.db")
+	username := flags.String("username", "", "username")
+	email := flags.String("email", "", "email address")
+	role := flags.String("role", string(auth.RoleViewer), "role of the new user")
+	admin := flags.Bool("admin", false, "create an admin, same as -role admin")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: golem user create [-admin] [-role role] -username name -email address [-db path]")
+		fmt.Fprintln(os.Stderr, "       golem user unlock -username name [-db path]")
+		fmt.Fprintln(os.Stderr, "\nThe password is read from GOLEM_PASSWORD, or from the first line of stdin.")
+		fmt.Fprintln(os.Stderr, "It must satisfy GOLEM_PASSWORD_MIN_LENGTH and GOLEM_BREACHED_PASSWORDS_FILE.")
+		fmt.Fprintln(os.Stderr, "unlock lets a user log in again after too many failed logins.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	// Allow flags after the action as well.
+	action := flags.Arg(0)
+	flags.Parse(flags.Args()[1:])
+	if flags.NArg() != 0 || (action != "create" && action != "unlock") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if action == "unlock" {
+		return unlockUser(*dbPath, *username)
+	}
+	if *admin {
+		*role = string(auth.RoleAdmin)
+	}
+
+	password := os.Getenv("GOLEM_PASSWORD")
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read password: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	create := &auth.UserCreate{Username: *username, Email: *email, Password: password, Role: auth.Role(*role)}
+	if err := auth.ValidateNewUser(create); err != nil {
+		return err
+	}
+
+	// This may run before the server has ever started
+	if err := os.MkdirAll(filepath.Dir(*dbPath), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %v", err)
+	}
+	db, err := sql.Open("sqlite3", *dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	users, err := auth.NewSQLiteUserStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize user storage: %v", err)
+	}
+	if users.Policy, err = passwordPolicyFromEnv(); err != nil {
+		return fmt.Errorf("invalid password policy: %v", err)
+	}
+	roles, err := auth.NewSQLiteRoleStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize role storage: %v", err)
+	}
+	authorizer := &auth.Authorizer{Roles: roles}
+	if exists, err := authorizer.RoleExists(create.Role); err != nil || !exists {
+		return fmt.Errorf("unknown role %q", create.Role)
+	}
+
+	user, err := users.CreateUser(create)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %v", err)
+	}
+	fmt.Printf("Created %s %s (%s)\n", user.Role, user.Username, user.ID)
+	return recordCLIChange(db, "user.create", "user", user.ID, nil, audit.Snapshot(user))
+}
+
+// recordCLIChange adds a change made with golem user to the audit log, with
+// the operating system account that ran it as the actor
+func recordCLIChange(db *sql.DB, action, target, id string, before, after interface{}) error {
+	log, err := audit.NewSQLiteStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize audit log: %v", err)
+	}
+	e := &audit.Event{ActorType: audit.ActorCLI, Action: action, TargetType: target, TargetID: id}
+	if u, err := osuser.Current(); err == nil {
+		e.Actor = u.Username
+	}
+	e.SetChange(audit.Diff(before, after))
+	if err := log.Record(e); err != nil {
+		return fmt.Errorf("failed to record %s in the audit log: %v", action, err)
+	}
+	return nil
+}
+
+// passwordPolicyFromEnv reads GOLEM_PASSWORD_MIN_LENGTH and
+// GOLEM_BREACHED_PASSWORDS_FILE, shared by the server and golem user
+func passwordPolicyFromEnv() (*auth.PasswordPolicy, error) {
+	policy := &auth.PasswordPolicy{}
+	minLength, err := strconv.Atoi(getEnv("GOLEM_PASSWORD_MIN_LENGTH", "8"))
+	if err != nil || minLength < 1 {
+		return nil, fmt.Errorf("GOLEM_PASSWORD_MIN_LENGTH must be a positive number")
+	}
+	policy.MinLength = minLength
+	if path := getEnv("GOLEM_BREACHED_PASSWORDS_FILE", ""); path != "" {
+		if policy.Breached, err = auth.LoadBreachedPasswords(path); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+func unlockUser(dbPath, username string) error {
+	if username == "" {
+		return fmt.Errorf("-username is required")
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	logins, err := auth.NewSQLiteLoginStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize login storage: %v", err)
+	}
+	if err := logins.ResetThrottle(auth.UserThrottleKey(username)); err != nil {
+		return fmt.Errorf("failed to unlock %s: %v", username, err)
+	}
+	fmt.Printf("Unlocked %s\n", username)
+	return recordCLIChange(db, "lockout.delete", "lockout", auth.UserThrottleKey(username), nil, nil)
+}
@@ -0,0 +1,196 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"Golem/internal/auth"
+	"Golem/internal/mail/mailtest"
+)
+
+const testPassword = "Us3rPassw0rd!x"
+
+// call sends a JSON request to the server as the holder of token, or
+// anonymously if token is empty
+func call(t *testing.T, server *testServer, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var data strings.Builder
+	if body != nil {
+		if err := json.NewEncoder(&data).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(data.String()))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+func createUser(t *testing.T, server *testServer, username string) *auth.User {
+	t.Helper()
+	user, err := server.Users.CreateUser(&auth.UserCreate{Username: username, Email: username + "@example.com", Password: testPassword, Role: auth.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// waitForMail waits for the nth message, counting from one, since mail is
+// sent in the background
+func waitForMail(t *testing.T, server *testServer, n int) *mailtest.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if messages := server.Mail.Messages(); len(messages) >= n {
+			return messages[n-1]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d messages, want %d", len(server.Mail.Messages()), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var linkToken = regexp.MustCompile(`/#(reset|verify)=(\S+)`)
+
+// tokenFromMail returns the token of the link with purpose in msg
+func tokenFromMail(t *testing.T, msg *mailtest.Message, purpose string) string {
+	t.Helper()
+	match := linkToken.FindStringSubmatch(msg.Body)
+	if match == nil || match[1] != purpose {
+		t.Fatalf("no %s link in %q", purpose, msg.Body)
+	}
+	return match[2]
+}
+
+func TestPasswordReset(t *testing.T) {
+	server := newTestServer(t)
+	createUser(t, server, "alice")
+
+	if rec := call(t, server, "POST", "/api/auth/password/forgot", "", auth.ForgotPasswordRequest{Email: "alice@example.com"}); rec.Code != http.StatusAccepted {
+		t.Fatalf("forgot: got %d: %s", rec.Code, rec.Body)
+	}
+	msg := waitForMail(t, server, 1)
+	if len(msg.To) != 1 || msg.To[0] != "alice@example.com" {
+		t.Errorf("reset link sent to %v", msg.To)
+	}
+	token := tokenFromMail(t, msg, "reset")
+
+	if rec := call(t, server, "POST", "/api/auth/password/reset", "", auth.ResetPasswordRequest{Token: token, Password: "short"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("weak password: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	// A weak password does not use up the link
+	if rec := call(t, server, "POST", "/api/auth/password/reset", "", auth.ResetPasswordRequest{Token: token, Password: "N3wPassw0rd!x"}); rec.Code != http.StatusNoContent {
+		t.Fatalf("reset: got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, server, "POST", "/api/auth/password/reset", "", auth.ResetPasswordRequest{Token: token, Password: "Oth3rPassw0rd!x"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("second use of the link: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if rec := call(t, server, "POST", "/api/auth/login", "", auth.LoginRequest{Username: "alice", Password: "N3wPassw0rd!x"}); rec.Code != http.StatusOK {
+		t.Errorf("login with the new password: got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, server, "POST", "/api/auth/login", "", auth.LoginRequest{Username: "alice", Password: testPassword}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login with the old password: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	if msg := waitForMail(t, server, 2); msg.Subject != "Your Golem password was changed" {
+		t.Errorf("got %q after the reset, want the notice that the password changed", msg.Subject)
+	}
+	user, err := server.Users.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.EmailVerified {
+		t.Errorf("following the reset link did not verify the address")
+	}
+}
+
+func TestPasswordResetDoesNotRevealAccounts(t *testing.T) {
+	server := newTestServer(t)
+	createUser(t, server, "alice")
+
+	for _, req := range []auth.ForgotPasswordRequest{{Email: "nobody@example.com"}, {Username: "nobody"}} {
+		if rec := call(t, server, "POST", "/api/auth/password/forgot", "", req); rec.Code != http.StatusAccepted {
+			t.Errorf("%+v: got %d, want %d", req, rec.Code, http.StatusAccepted)
+		}
+	}
+	// Mail is sent in the background, so wait for a known user's link
+	// before checking that nothing else arrived
+	call(t, server, "POST", "/api/auth/password/forgot", "", auth.ForgotPasswordRequest{Username: "alice"})
+	waitForMail(t, server, 1)
+	time.Sleep(50 * time.Millisecond)
+	if n := len(server.Mail.Messages()); n != 1 {
+		t.Errorf("got %d messages, want only alice's", n)
+	}
+}
+
+func TestPasswordResetLimit(t *testing.T) {
+	server := newTestServer(t)
+	createUser(t, server, "alice")
+
+	for i := 0; i < 5; i++ {
+		call(t, server, "POST", "/api/auth/password/forgot", "", auth.ForgotPasswordRequest{Username: "alice"})
+	}
+	waitForMail(t, server, 3)
+	time.Sleep(50 * time.Millisecond)
+	if n := len(server.Mail.Messages()); n != 3 {
+		t.Errorf("got %d messages, want 3 an hour", n)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	server := newTestServer(t)
+	user := createUser(t, server, "alice")
+	token, _, err := server.JWT.GenerateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := call(t, server, "POST", "/api/auth/email/verification", token, nil); rec.Code >= 300 {
+		t.Fatalf("resend: got %d: %s", rec.Code, rec.Body)
+	}
+	link := tokenFromMail(t, waitForMail(t, server, 1), "verify")
+
+	if rec := call(t, server, "POST", "/api/auth/email/verify", "", auth.VerifyEmailRequest{Token: link}); rec.Code != http.StatusNoContent {
+		t.Fatalf("verify: got %d: %s", rec.Code, rec.Body)
+	}
+	if user, err := server.Users.GetUserByID(user.ID); err != nil || !user.EmailVerified {
+		t.Errorf("address not verified: %v", err)
+	}
+	if rec := call(t, server, "POST", "/api/auth/email/verification", token, nil); rec.Code != http.StatusConflict {
+		t.Errorf("resend once verified: got %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestVerifyEmailAfterChange(t *testing.T) {
+	server := newTestServer(t)
+	user := createUser(t, server, "alice")
+	token, _, err := server.JWT.GenerateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call(t, server, "POST", "/api/auth/email/verification", token, nil)
+	link := tokenFromMail(t, waitForMail(t, server, 1), "verify")
+
+	email := "alice@example.org"
+	if _, err := server.Users.UpdateUser(user.ID, &auth.UserUpdate{Email: &email}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := call(t, server, "POST", "/api/auth/email/verify", "", auth.VerifyEmailRequest{Token: link}); rec.Code != http.StatusBadRequest {
+		t.Errorf("link for the old address: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if user, err := server.Users.GetUserByID(user.ID); err != nil || user.EmailVerified {
+		t.Errorf("new address verified with a link sent to the old one")
+	}
+}
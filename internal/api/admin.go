@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"Golem/internal/storage/backup"
+)
+
+func (s *Server) downloadBackup(w http.ResponseWriter, r *http.Request) {
+	if s.backupDB == nil {
+		http.Error(w, "Backups are not available", http.StatusNotFound)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "golem-backup-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := backup.FileName(time.Now())
+	path := filepath.Join(dir, name)
+	if err := backup.Create(s.backupDB, path); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(w, r, name, time.Now(), f)
+}
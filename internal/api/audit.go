@@ -0,0 +1,368 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Golem/internal/audit"
+	"Golem/internal/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// auditSpec names the change a route makes. Target is the type of object
+// changed; Self routes change the caller's own account.
+type auditSpec struct {
+	Action string
+	Target string
+	Self   bool
+}
+
+// auditActions are the routes recorded in the audit log, by method and path.
+// TestRoutePermissions fails for a route that changes state and is not
+// listed here or in unauditedRoutes in server_test.go.
+var auditActions = map[string]auditSpec{
+	"POST /api/health-checks":        {"check.create", "check", false},
+	"PUT /api/health-checks/{id}":    {"check.update", "check", false},
+	"DELETE /api/health-checks/{id}": {"check.delete", "check", false},
+	"POST /api/health-checks/bulk":   {"check.bulk", "check", false},
+	"POST /api/health-checks/import": {"check.import", "check", false},
+
+	"POST /api/auth/register":              {"user.register", "user", false},
+	"POST /api/auth/setup":                 {"user.setup", "user", false},
+	"POST /api/auth/users":                 {"user.create", "user", false},
+	"PUT /api/auth/users/{id}":             {"user.update", "user", false},
+	"DELETE /api/auth/users/{id}":          {"user.delete", "user", false},
+	"POST /api/auth/users/{id}/unlock":     {"user.unlock", "user", false},
+	"POST /api/auth/password/reset":        {"user.password_reset", "user", false},
+	"POST /api/auth/email/verify":          {"user.email_verify", "user", false},
+	"DELETE /api/auth/users/{id}/mfa":      {"mfa.reset", "mfa", false},
+	"POST /api/auth/mfa/confirm":           {"mfa.enable", "mfa", true},
+	"POST /api/auth/mfa/disable":           {"mfa.disable", "mfa", true},
+	"POST /api/auth/mfa/recovery-codes":    {"mfa.recovery_codes", "mfa", true},
+	"PUT /api/auth/mfa/policy":             {"mfa_policy.update", "mfa_policy", false},
+	"POST /api/auth/roles":                 {"role.create", "role", false},
+	"PUT /api/auth/roles/{name}":           {"role.update", "role", false},
+	"DELETE /api/auth/roles/{name}":        {"role.delete", "role", false},
+	"DELETE /api/auth/lockouts/{key}":      {"lockout.delete", "lockout", false},
+	"POST /api/auth/invitations":           {"invitation.create", "invitation", false},
+	"DELETE /api/auth/invitations/{id}":    {"invitation.delete", "invitation", false},
+	"POST /api/admin/signing-keys/rotate":  {"signing_key.rotate", "signing_key", false},
+	"DELETE /api/admin/signing-keys/{kid}": {"signing_key.delete", "signing_key", false},
+
+	"POST /api/teams":                         {"team.create", "team", false},
+	"PUT /api/teams/{team}":                   {"team.update", "team", false},
+	"DELETE /api/teams/{team}":                {"team.delete", "team", false},
+	"PUT /api/teams/{team}/members/{user}":    {"team.member_set", "team", false},
+	"DELETE /api/teams/{team}/members/{user}": {"team.member_remove", "team", false},
+
+	"PUT /api/admin/status-page":             {"status_page.update", "status_page", false},
+	"POST /api/admin/incidents":              {"incident.create", "incident", false},
+	"DELETE /api/admin/incidents/{id}":       {"incident.delete", "incident", false},
+	"POST /api/admin/incidents/{id}/updates": {"incident.update", "incident", false},
+}
+
+// maxAuditBody is the largest response kept to describe a created object
+const maxAuditBody = 1 << 20
+
+// auditRecorder keeps the status and body of a response
+type auditRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     []byte
+	overflow bool
+}
+
+func (rec *auditRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *auditRecorder) Write(p []byte) (int, error) {
+	if len(rec.body)+len(p) <= maxAuditBody {
+		rec.body = append(rec.body, p...)
+	} else {
+		rec.overflow = true
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// audited records every call of next in the audit log, with the state of
+// the target before and after a successful call
+func (s *Server) audited(spec auditSpec, perm auth.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.GetUserFromContext(r.Context())
+		id := auditPathID(r)
+		if spec.Self && claims != nil {
+			id = claims.UserID
+		}
+		before, loaded := s.auditState(spec.Target, id)
+
+		rec := &auditRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		e := &audit.Event{
+			Time:       time.Now(),
+			ActorType:  audit.ActorAnonymous,
+			Action:     spec.Action,
+			TargetType: spec.Target,
+			TargetID:   id,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     rec.status,
+			IP:         auth.ClientIP(r, s.trustedProxies),
+			UserAgent:  r.UserAgent(),
+		}
+		if claims != nil {
+			e.ActorType = audit.ActorUser
+			e.ActorID = claims.UserID
+			e.Actor = claims.Username
+			e.Role = string(claims.Role)
+		} else if perm != public {
+			e.Role = string(s.authorizer.AnonymousRole)
+		}
+
+		if rec.status < 300 {
+			var after interface{}
+			if loaded {
+				after, _ = s.auditState(spec.Target, id)
+			} else if r.Method != http.MethodDelete && !rec.overflow {
+				after = audit.Decode(rec.body)
+			}
+			before, after = audit.Diff(before, after)
+			collection := spec.Target == "check" || spec.Target == "signing_key"
+			if e.TargetID == "" && (collection || !loaded) {
+				e.TargetID, before, after = auditTarget(before, after, collection)
+			}
+			e.SetChange(before, after)
+		}
+
+		if err := s.auditLog.Record(e); err != nil {
+			log.Printf("Failed to record %s by %q in the audit log: %v", e.Action, e.Actor, err)
+		}
+	})
+}
+
+// auditPathID returns the route variable naming the target, if any
+func auditPathID(r *http.Request) string {
+	vars := mux.Vars(r)
+	for _, name := range []string{"id", "name", "key", "kid", "team"} {
+		if v, ok := vars[name]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// auditTarget finds the ID of a target created or changed by a request
+// that does not name it. A collection reduced by Diff is keyed by ID; when
+// only one member changed, the change is narrowed down to that member.
+func auditTarget(before, after interface{}, collection bool) (string, interface{}, interface{}) {
+	if collection {
+		b, _ := before.(map[string]interface{})
+		a, _ := after.(map[string]interface{})
+		keys := map[string]bool{}
+		for k := range b {
+			keys[k] = true
+		}
+		for k := range a {
+			keys[k] = true
+		}
+		if len(keys) != 1 {
+			return "", before, after
+		}
+		for k := range keys {
+			before, after = audit.Diff(b[k], a[k])
+			return k, before, after
+		}
+	}
+	obj, ok := after.(map[string]interface{})
+	if !ok {
+		return "", before, after
+	}
+	if user, ok := obj["user"].(map[string]interface{}); ok {
+		obj = user
+	}
+	for _, field := range []string{"id", "name"} {
+		if v, ok := obj[field].(string); ok {
+			return v, before, after
+		}
+	}
+	return "", before, after
+}
+
+// auditState returns a snapshot of a target for the audit log, and whether
+// targets of this type can be looked up at all. Checks and signing keys
+// without an ID are snapshotted as a whole, keyed by ID. A target that does
+// not exist is nil.
+func (s *Server) auditState(target, id string) (interface{}, bool) {
+	switch target {
+	case "check":
+		if id != "" {
+			config, err := s.healthCheckStorage.GetHealthCheckConfig(id)
+			if err != nil {
+				return nil, true
+			}
+			return audit.Snapshot(config), true
+		}
+		configs, err := s.healthCheckStorage.GetAllHealthCheckConfigs()
+		if err != nil {
+			return nil, true
+		}
+		byID := map[string]interface{}{}
+		for _, config := range configs {
+			byID[config.ID] = config
+		}
+		return audit.Snapshot(byID), true
+	case "user":
+		if id == "" {
+			return nil, false
+		}
+		user, err := s.userStorage.GetUserByID(id)
+		if err != nil {
+			return nil, true
+		}
+		return audit.Snapshot(user), true
+	case "mfa":
+		user, err := s.userStorage.GetUserByID(id)
+		if err != nil || s.mfa == nil {
+			return nil, true
+		}
+		status, err := s.mfa.Status(user)
+		if err != nil {
+			return nil, true
+		}
+		return audit.Snapshot(status), true
+	case "mfa_policy":
+		roles, err := s.mfa.Store.RequiredRoles()
+		if err != nil {
+			return nil, true
+		}
+		return audit.Snapshot(auth.MFAPolicy{RequiredRoles: roles}), true
+	case "role":
+		if id == "" || s.authorizer.Roles == nil {
+			return nil, false
+		}
+		role, err := s.authorizer.Roles.GetRole(auth.Role(id))
+		if err != nil {
+			return nil, true
+		}
+		return audit.Snapshot(role), true
+	case "signing_key":
+		byID := map[string]interface{}{}
+		for _, key := range s.jwtService.Keys().Keys() {
+			byID[key.ID] = key
+		}
+		if id != "" {
+			key, ok := byID[id]
+			if !ok {
+				return nil, true
+			}
+			return audit.Snapshot(key), true
+		}
+		return audit.Snapshot(byID), true
+	case "team":
+		if id == "" || s.authorizer.Teams == nil {
+			return nil, false
+		}
+		team, err := s.teamSnapshot(id)
+		if err != nil {
+			return nil, true
+		}
+		return audit.Snapshot(team), true
+	case "status_page":
+		if s.statusPage == nil {
+			return nil, false
+		}
+		config, err := s.statusPage.Store.GetConfig()
+		if err != nil {
+			return nil, true
+		}
+		return audit.Snapshot(config), true
+	case "incident":
+		if id == "" || s.statusPage == nil {
+			return nil, false
+		}
+		incident, err := s.statusPage.Store.GetIncident(id)
+		if err != nil {
+			return nil, true
+		}
+		return audit.Snapshot(incident), true
+	}
+	return nil, false
+}
+
+// auditFilter reads the filters shared by the audit list and export. It
+// writes an error response when it returns false.
+func auditFilter(w http.ResponseWriter, r *http.Request, limit int) (audit.Filter, bool) {
+	q := r.URL.Query()
+	f := audit.Filter{
+		Actor:      q.Get("actor"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		IP:         q.Get("ip"),
+		Limit:      limit,
+	}
+	for name, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return f, false
+			}
+			*t = parsed
+		}
+	}
+	if v := q.Get("before"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 1 {
+			http.Error(w, "before must be an event ID", http.StatusBadRequest)
+			return f, false
+		}
+		f.BeforeID = id
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || (limit > 0 && n > 1000) {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return f, false
+		}
+		f.Limit = n
+	}
+	return f, true
+}
+
+// listAudit returns audit events, newest first. Pass the smallest ID seen
+// as before to get the next page.
+func (s *Server) listAudit(w http.ResponseWriter, r *http.Request) {
+	f, ok := auditFilter(w, r, 100)
+	if !ok {
+		return
+	}
+	events, err := s.auditLog.List(f)
+	if err != nil {
+		http.Error(w, "Failed to list audit events", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// exportAudit streams every matching audit event as JSON lines, oldest first
+func (s *Server) exportAudit(w http.ResponseWriter, r *http.Request) {
+	f, ok := auditFilter(w, r, 0)
+	if !ok {
+		return
+	}
+	name := "golem-audit-" + time.Now().UTC().Format("20060102-150405") + ".jsonl"
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	enc := json.NewEncoder(w)
+	if err := s.auditLog.Each(f, func(e *audit.Event) error { return enc.Encode(e) }); err != nil {
+		log.Printf("Failed to export the audit log: %v", err)
+	}
+}
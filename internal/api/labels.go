@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"Golem/internal/auth"
+	"Golem/internal/metrics"
+	"Golem/internal/storage"
+)
+
+type checkHistory struct {
+	ID      string                            `json:"id"`
+	Name    string                            `json:"name"`
+	Labels  map[string]string                 `json:"labels,omitempty"`
+	History []metrics.HealthCheckHistoryEntry `json:"history"`
+}
+
+type bulkRequest struct {
+	Selector string `json:"selector"`
+	Action   string `json:"action"`
+}
+
+type bulkResponse struct {
+	Action  string   `json:"action"`
+	Matched int      `json:"matched"`
+	Checks  []string `json:"checks"`
+}
+
+// selectHealthChecks returns the configs in checks matching selector. It
+// writes an error response when it returns false.
+func (s *Server) selectHealthChecks(w http.ResponseWriter, checks storage.HealthCheckStorage, selector string) ([]metrics.HealthCheckConfig, bool) {
+	sel, err := metrics.ParseSelector(selector)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	configs, err := checks.GetAllHealthCheckConfigs()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get health checks: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	matched := configs[:0]
+	for _, config := range configs {
+		if sel.Matches(config.Labels) {
+			matched = append(matched, config)
+		}
+	}
+	return matched, true
+}
+
+func (s *Server) getHealthChecksHistory(w http.ResponseWriter, r *http.Request) {
+	duration := 24 * time.Hour
+
+	durationParam := r.URL.Query().Get("duration")
+	if durationParam != "" {
+		parsedDuration, err := time.ParseDuration(durationParam)
+		if err == nil {
+			duration = parsedDuration
+		}
+	}
+
+	checks, _, ok := s.checks(w, r, auth.PermChecksRead)
+	if !ok {
+		return
+	}
+	configs, ok := s.selectHealthChecks(w, checks, r.URL.Query().Get("selector"))
+	if !ok {
+		return
+	}
+
+	histories := make([]checkHistory, 0, len(configs))
+	for _, config := range configs {
+		history, err := checks.GetHealthCheckHistory(config.ID, duration)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get health check history: %v", err), http.StatusInternalServerError)
+			return
+		}
+		histories = append(histories, checkHistory{ID: config.ID, Name: config.Name, Labels: config.Labels, History: history})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(histories)
+}
+
+func (s *Server) getHealthCheckGroups(w http.ResponseWriter, r *http.Request) {
+	checks, _, ok := s.checks(w, r, auth.PermChecksRead)
+	if !ok {
+		return
+	}
+	configs, ok := s.selectHealthChecks(w, checks, r.URL.Query().Get("selector"))
+	if !ok {
+		return
+	}
+
+	results, err := checks.GetAllHealthCheckResults()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get health checks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]metrics.HealthCheckResult, len(results))
+	for _, result := range results {
+		byID[result.ID] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics.GroupHealthChecks(configs, byID, r.URL.Query().Get("by")))
+}
+
+func (s *Server) bulkHealthChecks(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Action != "enable" && req.Action != "disable" && req.Action != "delete" {
+		http.Error(w, "action must be enable, disable or delete", http.StatusBadRequest)
+		return
+	}
+	// An empty selector matches every check, which is never what a bulk
+	// delete meant.
+	if req.Selector == "" {
+		http.Error(w, "selector is required", http.StatusBadRequest)
+		return
+	}
+
+	// Only checks the caller may change are selected.
+	checks, _, ok := s.checks(w, r, auth.PermChecksWrite)
+	if !ok {
+		return
+	}
+	configs, ok := s.selectHealthChecks(w, checks, req.Selector)
+	if !ok {
+		return
+	}
+
+	resp := bulkResponse{Action: req.Action, Matched: len(configs), Checks: []string{}}
+	for _, config := range configs {
+		var err error
+		switch req.Action {
+		case "enable", "disable":
+			config.Enabled = req.Action == "enable"
+			err = s.healthCheckCollector.UpdateHealthCheck(config)
+		case "delete":
+			err = s.healthCheckCollector.DeleteHealthCheck(config.ID)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to %s %s: %v", req.Action, config.ID, err), http.StatusInternalServerError)
+			return
+		}
+		resp.Checks = append(resp.Checks, config.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"Golem/internal/auth"
+	"Golem/internal/manifest"
+	"Golem/internal/metrics"
+)
+
+const maxManifestSize = 10 << 20
+
+type importResponse struct {
+	DryRun bool `json:"dry_run"`
+	manifest.Plan
+}
+
+func (s *Server) exportHealthChecks(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+
+	checks, _, ok := s.checks(w, r, auth.PermChecksRead)
+	if !ok {
+		return
+	}
+	configs, err := checks.GetAllHealthCheckConfigs()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get health checks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if team, ok := r.URL.Query()["team"]; ok {
+		configs = inTeam(configs, team[0])
+	}
+
+	data, err := manifest.Marshal(manifest.Export(configs), format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/yaml")
+	}
+	w.Write(data)
+}
+
+func (s *Server) importHealthChecks(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	prune, _ := strconv.ParseBool(r.URL.Query().Get("prune"))
+
+	m, err := manifest.Parse(http.MaxBytesReader(w, r.Body, maxManifestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The manifest is matched against, and may prune, only the checks the
+	// caller may change: those of ?team= if given.
+	checks, scope, ok := s.checks(w, r, auth.PermChecksWrite)
+	if !ok {
+		return
+	}
+	configs, err := checks.GetAllHealthCheckConfigs()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get health checks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	team := defaultTeam(scope)
+	if v, ok := r.URL.Query()["team"]; ok {
+		team = v[0]
+		configs = inTeam(configs, team)
+	}
+	checked := map[string]bool{}
+	for i := range m.Checks {
+		if m.Checks[i].Team == "" {
+			m.Checks[i].Team = team
+		}
+		if t := m.Checks[i].Team; !checked[t] {
+			if !s.checkTeam(w, scope, t) {
+				return
+			}
+			checked[t] = true
+		}
+	}
+
+	plan, err := manifest.NewPlan(configs, m, prune)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if !dryRun {
+		if err := plan.Apply(s.healthCheckCollector); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(importResponse{DryRun: dryRun, Plan: plan})
+}
+
+// inTeam returns the configs of team; "" selects checks without a team
+func inTeam(configs []metrics.HealthCheckConfig, team string) []metrics.HealthCheckConfig {
+	return slices.DeleteFunc(configs, func(config metrics.HealthCheckConfig) bool {
+		return config.Team != team
+	})
+}
@@ -0,0 +1,154 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Golem/internal/auth"
+)
+
+// oidcLogin starts a login at Golem, signs in as user at the identity
+// provider and returns Golem's response to the callback. tamper, if not nil,
+// can change the callback request before it is sent.
+func oidcLogin(t *testing.T, server *testServer, redirect, user string, tamper func(*http.Request)) *httptest.ResponseRecorder {
+	t.Helper()
+	router := server.Router()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/auth/oidc/login?redirect="+url.QueryEscape(redirect), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: got %d: %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rec.Header().Get("Location") + "&login_hint=" + url.QueryEscape(user))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatalf("identity provider did not redirect back: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", callback.RequestURI(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	if tamper != nil {
+		tamper(req)
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// tokenFromRedirect reads the session token from the fragment of a callback
+// redirect
+func tokenFromRedirect(t *testing.T, server *testServer, rec *httptest.ResponseRecorder) (string, *auth.Claims) {
+	t.Helper()
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback: got %d: %s", rec.Code, rec.Body)
+	}
+	path, fragment, _ := strings.Cut(rec.Header().Get("Location"), "#")
+	values, err := url.ParseQuery(fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := server.JWT.ValidateToken(values.Get("token"))
+	if err != nil {
+		t.Fatalf("callback token: %v", err)
+	}
+	return path, claims
+}
+
+func TestOIDCLogin(t *testing.T) {
+	server := newTestServer(t)
+
+	path, claims := tokenFromRedirect(t, server, oidcLogin(t, server, "/checks", "alice", nil))
+	if path != "/checks" {
+		t.Errorf("redirected to %q, want /checks", path)
+	}
+	if claims.Username != "alice" || claims.Role != auth.RoleAdmin {
+		t.Errorf("signed in as %s with role %s, want alice with admin", claims.Username, claims.Role)
+	}
+
+	// Signing in again finds the user provisioned the first time
+	_, again := tokenFromRedirect(t, server, oidcLogin(t, server, "/", "alice", nil))
+	if again.UserID != claims.UserID {
+		t.Errorf("second login is user %s, want %s", again.UserID, claims.UserID)
+	}
+}
+
+func TestOIDCLoginWithoutMappedGroup(t *testing.T) {
+	server := newTestServer(t)
+
+	rec := oidcLogin(t, server, "/", "bob", nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+}
+
+func TestOIDCLoginStaysLocal(t *testing.T) {
+	server := newTestServer(t)
+
+	for _, redirect := range []string{"//evil.example", "https://evil.example/", `/\evil.example`} {
+		path, _ := tokenFromRedirect(t, server, oidcLogin(t, server, redirect, "alice", nil))
+		if path != "/" {
+			t.Errorf("redirect %q: sent to %q, want /", redirect, path)
+		}
+	}
+}
+
+func TestOIDCCallbackNeedsStartingBrowser(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := map[string]func(*http.Request){
+		"no cookie": func(r *http.Request) { r.Header.Del("Cookie") },
+		"other state": func(r *http.Request) {
+			q := r.URL.Query()
+			q.Set("state", "other")
+			r.URL.RawQuery = q.Encode()
+		},
+		"tampered cookie": func(r *http.Request) {
+			cookie, _ := r.Cookie("golem_oidc_state")
+			value := []byte(cookie.Value)
+			value[len(value)/2] ^= 1
+			r.Header.Del("Cookie")
+			r.AddCookie(&http.Cookie{Name: cookie.Name, Value: string(value)})
+		},
+		"cookie of another login": func(r *http.Request) {
+			rec := httptest.NewRecorder()
+			server.Router().ServeHTTP(rec, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+			r.Header.Del("Cookie")
+			for _, cookie := range rec.Result().Cookies() {
+				r.AddCookie(cookie)
+			}
+		},
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := oidcLogin(t, server, "/", "alice", tamper)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("got %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackReplay(t *testing.T) {
+	server := newTestServer(t)
+
+	var replay *http.Request
+	tokenFromRedirect(t, server, oidcLogin(t, server, "/", "alice", func(r *http.Request) { replay = r.Clone(r.Context()) }))
+
+	rec := httptest.NewRecorder()
+	server.Router().ServeHTTP(rec, replay)
+	if rec.Code == http.StatusFound {
+		t.Errorf("replayed callback signed in again")
+	}
+}
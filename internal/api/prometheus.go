@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Golem/internal/auth"
+	"Golem/internal/metrics"
+	"Golem/internal/promql"
+	"Golem/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// The handlers in this file implement the subset of the Prometheus HTTP API
+// that Grafana's Prometheus datasource relies on.
+
+type promResponse struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+type promQueryData struct {
+	ResultType promql.ValueType `json:"resultType"`
+	Result     promql.Value     `json:"result"`
+}
+
+func writePromData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promResponse{Status: "success", Data: data})
+}
+
+func writePromError(w http.ResponseWriter, status int, errorType string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(promResponse{Status: "error", ErrorType: errorType, Error: err.Error()})
+}
+
+// promQueryable returns the series the caller may query: host metrics and
+// the health checks in their read scope. It writes an error response when it
+// returns false.
+func (s *Server) promQueryable(w http.ResponseWriter, r *http.Request) (promql.Queryable, bool) {
+	scope, err := s.checkScope(r, auth.PermChecksRead)
+	if err != nil {
+		writePromError(w, http.StatusInternalServerError, "internal", fmt.Errorf("failed to check permissions: %v", err))
+		return nil, false
+	}
+	return &promql.StorageQueryable{Metrics: s.storage, Checks: storage.Scoped(s.healthCheckStorage, scope)}, true
+}
+
+func (s *Server) promInstantQuery(w http.ResponseWriter, r *http.Request) {
+	ts := time.Now()
+	if v := r.FormValue("time"); v != "" {
+		t, err := parsePromTime(v)
+		if err != nil {
+			writePromError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("invalid parameter \"time\": %v", err))
+			return
+		}
+		ts = t
+	}
+
+	queryable, ok := s.promQueryable(w, r)
+	if !ok {
+		return
+	}
+	result, err := promql.NewEngine(queryable).Instant(r.FormValue("query"), ts)
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+
+	writePromData(w, promQueryData{ResultType: result.Type(), Result: result})
+}
+
+func (s *Server) promRangeQuery(w http.ResponseWriter, r *http.Request) {
+	start, err := parsePromTime(r.FormValue("start"))
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("invalid parameter \"start\": %v", err))
+		return
+	}
+	end, err := parsePromTime(r.FormValue("end"))
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("invalid parameter \"end\": %v", err))
+		return
+	}
+	step, err := parsePromDuration(r.FormValue("step"))
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("invalid parameter \"step\": %v", err))
+		return
+	}
+	if end.Sub(start)/step > 11000 {
+		writePromError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)"))
+		return
+	}
+
+	queryable, ok := s.promQueryable(w, r)
+	if !ok {
+		return
+	}
+	result, err := promql.NewEngine(queryable).Range(r.FormValue("query"), start, end, step)
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+
+	writePromData(w, promQueryData{ResultType: promql.ValueTypeMatrix, Result: result})
+}
+
+func (s *Server) promSeries(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	start, end := promTimeRange(r)
+
+	if len(r.Form["match[]"]) == 0 {
+		writePromError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("no match[] parameter provided"))
+		return
+	}
+
+	seen := make(map[string]bool)
+	result := []metrics.Labels{}
+	for _, match := range r.Form["match[]"] {
+		matchers, err := promql.ParseSeriesSelector(match)
+		if err != nil {
+			writePromError(w, http.StatusBadRequest, "bad_data", err)
+			return
+		}
+		queryable, ok := s.promQueryable(w, r)
+		if !ok {
+			return
+		}
+		series, err := queryable.Select(start, end, matchers)
+		if err != nil {
+			writePromError(w, http.StatusInternalServerError, "execution", err)
+			return
+		}
+		for _, s := range series {
+			if key := s.Labels.Key(); !seen[key] {
+				seen[key] = true
+				result = append(result, s.Labels)
+			}
+		}
+	}
+
+	writePromData(w, result)
+}
+
+func (s *Server) promLabels(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	start, end := promTimeRange(r)
+
+	matchers, err := promMatchers(r)
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+
+	queryable, ok := s.promQueryable(w, r)
+	if !ok {
+		return
+	}
+	names, err := promql.LabelNames(queryable, start, end, matchers)
+	if err != nil {
+		writePromError(w, http.StatusInternalServerError, "execution", err)
+		return
+	}
+
+	writePromData(w, names)
+}
+
+func (s *Server) promLabelValues(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	start, end := promTimeRange(r)
+
+	matchers, err := promMatchers(r)
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+
+	queryable, ok := s.promQueryable(w, r)
+	if !ok {
+		return
+	}
+	values, err := promql.LabelValues(queryable, mux.Vars(r)["name"], start, end, matchers)
+	if err != nil {
+		writePromError(w, http.StatusInternalServerError, "execution", err)
+		return
+	}
+
+	writePromData(w, values)
+}
+
+func (s *Server) promMetadata(w http.ResponseWriter, r *http.Request) {
+	writePromData(w, map[string]interface{}{})
+}
+
+func (s *Server) promBuildInfo(w http.ResponseWriter, r *http.Request) {
+	writePromData(w, map[string]string{
+		"version":   "2.40.0",
+		"revision":  "golem",
+		"branch":    "golem",
+		"goVersion": "",
+	})
+}
+
+// promMatchers combines all match[] selectors into one matcher list, or
+// selects every golem_ series when none are given.
+func promMatchers(r *http.Request) ([]*promql.Matcher, error) {
+	var matchers []*promql.Matcher
+	for _, match := range r.Form["match[]"] {
+		m, err := promql.ParseSeriesSelector(match)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m...)
+	}
+	if len(matchers) == 0 {
+		m, _ := promql.NewMatcher(promql.MatchRegexp, metrics.MetricNameLabel, "golem_.+")
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func promTimeRange(r *http.Request) (time.Time, time.Time) {
+	end := time.Now()
+	if t, err := parsePromTime(r.FormValue("end")); err == nil {
+		end = t
+	}
+	start := end.Add(-time.Hour)
+	if t, err := parsePromTime(r.FormValue("start")); err == nil {
+		start = t
+	}
+	return start, end
+}
+
+func parsePromTime(s string) (time.Time, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(math.Round(frac*1000))*int64(time.Millisecond)), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+func parsePromDuration(s string) (time.Duration, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		if d <= 0 {
+			return 0, fmt.Errorf("zero or negative query resolution step widths are not accepted")
+		}
+		return checkPromStep(time.Duration(d * float64(time.Second)))
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return checkPromStep(d)
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+}
+
+// checkPromStep refuses steps shorter than the millisecond timestamps step
+// through
+func checkPromStep(d time.Duration) (time.Duration, error) {
+	if d < time.Millisecond {
+		return 0, fmt.Errorf("query resolution step widths below 1ms are not accepted")
+	}
+	return d, nil
+}
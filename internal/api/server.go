@@ -1,14 +1,19 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"time"
 
+	"Golem/internal/audit"
 	"Golem/internal/auth"
 	"Golem/internal/collector"
 	"Golem/internal/metrics"
+	"Golem/internal/query"
+	"Golem/internal/statuspage"
 	"Golem/internal/storage"
 
 	"github.com/gorilla/mux"
@@ -19,46 +24,278 @@ type Server struct {
 	healthCheckStorage   storage.HealthCheckStorage
 	healthCheckCollector *collector.HealthCheckCollector
 
-	userStorage auth.UserStorage
-	jwtService  *auth.JWTService
-	authHandler *auth.Handler
+	userStorage    auth.UserStorage
+	jwtService     *auth.JWTService
+	authHandler    *auth.Handler
+	authorizer     *auth.Authorizer
+	registration   *auth.Registration
+	oidc           *auth.OIDCProvider
+	identities     auth.IdentityStorage
+	authenticators []auth.Authenticator
+	mfa            *auth.MFA
+	loginGuard     *auth.LoginGuard
+	loginEvents    auth.LoginEventStorage
+	trustedProxies []netip.Prefix
+	accountMail    *auth.AccountMail
+	auditLog       audit.Storage
+	policies       []RoutePolicy
+
+	backupDB   *sql.DB
+	statusPage *statuspage.Service
 }
 
-func NewServer(storage storage.MetricStorage, healthCheckStorage storage.HealthCheckStorage, healthCheckCollector *collector.HealthCheckCollector, userStorage auth.UserStorage, jwtService *auth.JWTService) *Server {
-	return &Server{
+// Option configures optional Server features.
+type Option func(*Server)
+
+// WithBackupDB enables /api/admin/backup, which streams a consistent copy of db.
+func WithBackupDB(db *sql.DB) Option {
+	return func(s *Server) {
+		s.backupDB = db
+	}
+}
+
+// WithStatusPage serves the public status page, badges and incident feeds,
+// and the admin API that configures them.
+func WithStatusPage(service *statuspage.Service) Option {
+	return func(s *Server) {
+		s.statusPage = service
+	}
+}
+
+// WithAuthorizer resolves custom roles and the anonymous role. Without it
+// only the built-in roles are known and every protected route needs a token.
+func WithAuthorizer(authorizer *auth.Authorizer) Option {
+	return func(s *Server) {
+		s.authorizer = authorizer
+	}
+}
+
+// WithRegistration sets the self-registration policy, invitations and the
+// first-run setup token. Without it registration is disabled.
+func WithRegistration(registration *auth.Registration) Option {
+	return func(s *Server) {
+		s.registration = registration
+	}
+}
+
+// WithOIDC enables single sign-on with provider. Users are provisioned on
+// first sign-in and linked to their provider account in identities.
+func WithOIDC(provider *auth.OIDCProvider, identities auth.IdentityStorage) Option {
+	return func(s *Server) {
+		s.oidc = provider
+		s.identities = identities
+	}
+}
+
+// WithAuthenticators sets the password login chain, tried in order. Without
+// it only local users can log in with a password.
+func WithAuthenticators(authenticators ...auth.Authenticator) Option {
+	return func(s *Server) {
+		s.authenticators = authenticators
+	}
+}
+
+// WithMFA enables TOTP two-factor authentication for password logins.
+func WithMFA(mfa *auth.MFA) Option {
+	return func(s *Server) {
+		s.mfa = mfa
+	}
+}
+
+// WithLoginGuard slows down and temporarily locks out repeated failed logins.
+func WithLoginGuard(guard *auth.LoginGuard) Option {
+	return func(s *Server) {
+		s.loginGuard = guard
+	}
+}
+
+// WithLoginEvents records every login attempt and serves them at /api/auth/logins.
+func WithLoginEvents(events auth.LoginEventStorage) Option {
+	return func(s *Server) {
+		s.loginEvents = events
+	}
+}
+
+// WithTrustedProxies believes X-Forwarded-For from these addresses when
+// finding the client address of a login.
+func WithTrustedProxies(proxies []netip.Prefix) Option {
+	return func(s *Server) {
+		s.trustedProxies = proxies
+	}
+}
+
+// WithAccountMail mails password reset and email verification links.
+func WithAccountMail(m *auth.AccountMail) Option {
+	return func(s *Server) {
+		s.accountMail = m
+	}
+}
+
+// WithAuditLog records configuration and user-management changes in log and
+// serves them at /api/audit.
+func WithAuditLog(log audit.Storage) Option {
+	return func(s *Server) {
+		s.auditLog = log
+	}
+}
+
+func NewServer(storage storage.MetricStorage, healthCheckStorage storage.HealthCheckStorage, healthCheckCollector *collector.HealthCheckCollector, userStorage auth.UserStorage, jwtService *auth.JWTService, opts ...Option) *Server {
+	s := &Server{
 		storage:              storage,
 		healthCheckStorage:   healthCheckStorage,
 		healthCheckCollector: healthCheckCollector,
 		userStorage:          userStorage,
 		jwtService:           jwtService,
-		authHandler:          &auth.Handler{UserStore: userStorage, JWTService: jwtService},
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.authorizer == nil {
+		s.authorizer = &auth.Authorizer{}
+	}
+	if s.registration == nil {
+		s.registration = &auth.Registration{Policy: auth.RegistrationDisabled}
+	}
+	s.authHandler = &auth.Handler{
+		UserStore:      userStorage,
+		JWTService:     jwtService,
+		Authorizer:     s.authorizer,
+		Registration:   s.registration,
+		OIDC:           s.oidc,
+		Identities:     s.identities,
+		Authenticators: s.authenticators,
+		MFA:            s.mfa,
+		Guard:          s.loginGuard,
+		LoginEvents:    s.loginEvents,
+		TrustedProxies: s.trustedProxies,
+		AccountMail:    s.accountMail,
+	}
+	return s
 }
 
 func (s *Server) Router() http.Handler {
 	r := mux.NewRouter()
+	s.policies = nil
 
 	// Auth routes
-	r.HandleFunc("/api/auth/register", s.authHandler.RegisterHandler).Methods("POST")
-	r.HandleFunc("/api/auth/login", s.authHandler.LoginHandler).Methods("POST")
-
-	// User management (admin only)
-	userSubrouter := r.PathPrefix("/api/auth/users").Subrouter()
-	userSubrouter.Use(auth.JWTAuthMiddleware(s.jwtService))
-	userSubrouter.Use(auth.RequireRoleMiddleware(auth.RoleAdmin))
-	userSubrouter.HandleFunc("", s.authHandler.ListUsersHandler).Methods("GET")
-	userSubrouter.HandleFunc("/{id}", s.authHandler.UpdateUserHandler).Methods("PUT")
-	userSubrouter.HandleFunc("/{id}", s.authHandler.DeleteUserHandler).Methods("DELETE")
-
-	r.HandleFunc("/api/metrics", s.getLatestMetrics).Methods("GET")
-	r.HandleFunc("/api/metrics/history", s.getMetricsHistory).Methods("GET")
-
-	r.HandleFunc("/api/health-checks", s.getHealthChecks).Methods("GET")
-	r.HandleFunc("/api/health-checks", s.createHealthCheck).Methods("POST")
-	r.HandleFunc("/api/health-checks/{id}", s.getHealthCheck).Methods("GET")
-	r.HandleFunc("/api/health-checks/{id}", s.updateHealthCheck).Methods("PUT")
-	r.HandleFunc("/api/health-checks/{id}", s.deleteHealthCheck).Methods("DELETE")
-	r.HandleFunc("/api/health-checks/{id}/history", s.getHealthCheckHistory).Methods("GET")
+	s.handle(r, "/api/auth/register", public, s.authHandler.RegisterHandler, "POST")
+	s.handle(r, "/api/auth/login", public, s.authHandler.LoginHandler, "POST")
+	s.handle(r, "/api/auth/setup", public, s.authHandler.SetupStatusHandler, "GET")
+	s.handle(r, "/api/auth/setup", public, s.authHandler.SetupHandler, "POST")
+	s.handle(r, "/.well-known/jwks.json", public, s.authHandler.JWKSHandler, "GET")
+	if s.oidc != nil {
+		s.handle(r, "/api/auth/oidc", public, s.authHandler.OIDCInfoHandler, "GET")
+		s.handle(r, "/api/auth/oidc/login", public, s.authHandler.OIDCLoginHandler, "GET")
+		s.handle(r, "/api/auth/oidc/callback", public, s.authHandler.OIDCCallbackHandler, "GET")
+	}
+
+	if s.accountMail != nil {
+		s.handle(r, "/api/auth/password/forgot", public, s.authHandler.ForgotPasswordHandler, "POST")
+		s.handle(r, "/api/auth/password/reset", public, s.authHandler.ResetPasswordHandler, "POST")
+		s.handle(r, "/api/auth/email/verify", public, s.authHandler.VerifyEmailHandler, "POST")
+		s.handle(r, "/api/auth/email/verification", auth.PermAccount, s.authHandler.ResendVerificationHandler, "POST")
+	}
+
+	if s.mfa != nil {
+		s.handle(r, "/api/auth/login/mfa", public, s.authHandler.LoginMFAHandler, "POST")
+		s.handle(r, "/api/auth/login/mfa/enroll", public, s.authHandler.LoginMFAEnrollHandler, "POST")
+		s.handle(r, "/api/auth/mfa", auth.PermAccount, s.authHandler.MFAStatusHandler, "GET")
+		s.handle(r, "/api/auth/mfa/enroll", auth.PermAccount, s.authHandler.EnrollMFAHandler, "POST")
+		s.handle(r, "/api/auth/mfa/confirm", auth.PermAccount, s.authHandler.ConfirmMFAHandler, "POST")
+		s.handle(r, "/api/auth/mfa/recovery-codes", auth.PermAccount, s.authHandler.RegenerateRecoveryCodesHandler, "POST")
+		s.handle(r, "/api/auth/mfa/disable", auth.PermAccount, s.authHandler.DisableMFAHandler, "POST")
+		s.handle(r, "/api/auth/mfa/policy", auth.PermUsersAdmin, s.authHandler.GetMFAPolicyHandler, "GET")
+		s.handle(r, "/api/auth/mfa/policy", auth.PermUsersAdmin, s.authHandler.UpdateMFAPolicyHandler, "PUT")
+		s.handle(r, "/api/auth/users/{id}/mfa", auth.PermUsersAdmin, s.authHandler.ResetUserMFAHandler, "DELETE")
+	}
+
+	// User and role management
+	s.handle(r, "/api/auth/users", auth.PermUsersAdmin, s.authHandler.ListUsersHandler, "GET")
+	s.handle(r, "/api/auth/users", auth.PermUsersAdmin, s.authHandler.CreateUserHandler, "POST")
+	s.handle(r, "/api/auth/users/{id}", auth.PermUsersAdmin, s.authHandler.UpdateUserHandler, "PUT")
+	s.handle(r, "/api/auth/users/{id}", auth.PermUsersAdmin, s.authHandler.DeleteUserHandler, "DELETE")
+	if s.authorizer.Roles != nil {
+		s.handle(r, "/api/auth/roles", auth.PermUsersAdmin, s.authHandler.ListRolesHandler, "GET")
+		s.handle(r, "/api/auth/roles", auth.PermUsersAdmin, s.authHandler.CreateRoleHandler, "POST")
+		s.handle(r, "/api/auth/roles/{name}", auth.PermUsersAdmin, s.authHandler.UpdateRoleHandler, "PUT")
+		s.handle(r, "/api/auth/roles/{name}", auth.PermUsersAdmin, s.authHandler.DeleteRoleHandler, "DELETE")
+	}
+	if s.loginGuard != nil {
+		s.handle(r, "/api/auth/lockouts", auth.PermUsersAdmin, s.authHandler.ListLockoutsHandler, "GET")
+		s.handle(r, "/api/auth/lockouts/{key}", auth.PermUsersAdmin, s.authHandler.DeleteLockoutHandler, "DELETE")
+		s.handle(r, "/api/auth/users/{id}/unlock", auth.PermUsersAdmin, s.authHandler.UnlockUserHandler, "POST")
+	}
+	if s.loginEvents != nil {
+		s.handle(r, "/api/auth/logins", auth.PermUsersAdmin, s.authHandler.ListLoginsHandler, "GET")
+	}
+	if s.registration.Invitations != nil {
+		s.handle(r, "/api/auth/invitations", auth.PermUsersAdmin, s.authHandler.ListInvitationsHandler, "GET")
+		s.handle(r, "/api/auth/invitations", auth.PermUsersAdmin, s.authHandler.CreateInvitationHandler, "POST")
+		s.handle(r, "/api/auth/invitations/{id}", auth.PermUsersAdmin, s.authHandler.DeleteInvitationHandler, "DELETE")
+	}
+	if s.authorizer.Teams != nil {
+		// Team admins manage their own teams; the handlers check membership.
+		s.handle(r, "/api/teams", auth.PermAccount, s.listTeams, "GET")
+		s.handle(r, "/api/teams", auth.PermUsersAdmin, s.createTeam, "POST")
+		s.handle(r, "/api/teams/{team}", auth.PermAccount, s.getTeam, "GET")
+		s.handle(r, "/api/teams/{team}", auth.PermAccount, s.updateTeam, "PUT")
+		s.handle(r, "/api/teams/{team}", auth.PermUsersAdmin, s.deleteTeam, "DELETE")
+		s.handle(r, "/api/teams/{team}/members", auth.PermAccount, s.listTeamMembers, "GET")
+		s.handle(r, "/api/teams/{team}/members/{user}", auth.PermAccount, s.setTeamMember, "PUT")
+		s.handle(r, "/api/teams/{team}/members/{user}", auth.PermAccount, s.removeTeamMember, "DELETE")
+	}
+
+	// Administration
+	s.handle(r, "/api/admin/backup", auth.PermSystemAdmin, s.downloadBackup, "GET")
+	if s.auditLog != nil {
+		s.handle(r, "/api/audit", auth.PermSystemAdmin, s.listAudit, "GET")
+		s.handle(r, "/api/audit/export", auth.PermSystemAdmin, s.exportAudit, "GET")
+	}
+	if s.jwtService.Keys().Rotatable() {
+		s.handle(r, "/api/admin/signing-keys", auth.PermSystemAdmin, s.authHandler.ListSigningKeysHandler, "GET")
+		s.handle(r, "/api/admin/signing-keys/rotate", auth.PermSystemAdmin, s.authHandler.RotateSigningKeyHandler, "POST")
+		s.handle(r, "/api/admin/signing-keys/{kid}", auth.PermSystemAdmin, s.authHandler.DeleteSigningKeyHandler, "DELETE")
+	}
+	s.handle(r, "/api/admin/status-page", auth.PermStatusWrite, s.getStatusPageConfig, "GET")
+	s.handle(r, "/api/admin/status-page", auth.PermStatusWrite, s.updateStatusPageConfig, "PUT")
+	s.handle(r, "/api/admin/incidents", auth.PermStatusWrite, s.listIncidents, "GET")
+	s.handle(r, "/api/admin/incidents", auth.PermStatusWrite, s.createIncident, "POST")
+	s.handle(r, "/api/admin/incidents/{id}", auth.PermStatusWrite, s.getIncident, "GET")
+	s.handle(r, "/api/admin/incidents/{id}", auth.PermStatusWrite, s.deleteIncident, "DELETE")
+	s.handle(r, "/api/admin/incidents/{id}/updates", auth.PermStatusWrite, s.addIncidentUpdate, "POST")
+
+	// Public status page (no authentication)
+	s.handle(r, "/status", public, s.getStatusPage, "GET")
+	s.handle(r, "/status/feed.json", public, s.getStatusFeedJSON, "GET")
+	s.handle(r, "/status/feed.rss", public, s.getStatusFeedRSS, "GET")
+	s.handle(r, "/api/status", public, s.getStatusSummary, "GET")
+	s.handle(r, "/badge/{id}.svg", public, s.getStatusBadge, "GET")
+
+	s.handle(r, "/api/metrics", auth.PermMetricsRead, s.getLatestMetrics, "GET")
+	s.handle(r, "/api/metrics/history", auth.PermMetricsRead, s.getMetricsHistory, "GET")
+	s.handle(r, "/api/metrics/query", auth.PermMetricsRead, s.queryMetrics, "GET")
+
+	s.handle(r, "/api/health-checks", auth.PermChecksRead, s.getHealthChecks, "GET")
+	s.handle(r, "/api/health-checks", auth.PermChecksWrite, s.createHealthCheck, "POST")
+	s.handle(r, "/api/health-checks/export", auth.PermChecksRead, s.exportHealthChecks, "GET")
+	s.handle(r, "/api/health-checks/history", auth.PermChecksRead, s.getHealthChecksHistory, "GET")
+	s.handle(r, "/api/health-checks/groups", auth.PermChecksRead, s.getHealthCheckGroups, "GET")
+	s.handle(r, "/api/health-checks/bulk", auth.PermChecksWrite, s.bulkHealthChecks, "POST")
+	s.handle(r, "/api/health-checks/import", auth.PermChecksWrite, s.importHealthChecks, "POST")
+	s.handle(r, "/api/health-checks/{id}", auth.PermChecksRead, s.getHealthCheck, "GET")
+	s.handle(r, "/api/health-checks/{id}", auth.PermChecksWrite, s.updateHealthCheck, "PUT")
+	s.handle(r, "/api/health-checks/{id}", auth.PermChecksWrite, s.deleteHealthCheck, "DELETE")
+	s.handle(r, "/api/health-checks/{id}/history", auth.PermChecksRead, s.getHealthCheckHistory, "GET")
+	s.handle(r, "/api/health-checks/{id}/revisions", auth.PermChecksRead, s.getHealthCheckRevisions, "GET")
+
+	// Prometheus-compatible query API
+	s.handle(r, "/api/v1/query", auth.PermMetricsRead, s.promInstantQuery, "GET", "POST")
+	s.handle(r, "/api/v1/query_range", auth.PermMetricsRead, s.promRangeQuery, "GET", "POST")
+	s.handle(r, "/api/v1/series", auth.PermMetricsRead, s.promSeries, "GET", "POST")
+	s.handle(r, "/api/v1/labels", auth.PermMetricsRead, s.promLabels, "GET", "POST")
+	s.handle(r, "/api/v1/label/{name}/values", auth.PermMetricsRead, s.promLabelValues, "GET")
+	s.handle(r, "/api/v1/metadata", auth.PermMetricsRead, s.promMetadata, "GET")
+	s.handle(r, "/api/v1/status/buildinfo", auth.PermMetricsRead, s.promBuildInfo, "GET")
 
 	fs := http.FileServer(http.Dir("web/static"))
 	r.PathPrefix("/").Handler(fs)
@@ -66,6 +303,44 @@ func (s *Server) Router() http.Handler {
 	return r
 }
 
+// RoutePolicy is the permission required to call one method on one route,
+// and the action it is recorded as in the audit log, if any.
+type RoutePolicy struct {
+	Method     string
+	Path       string
+	Permission auth.Permission
+	Audit      string
+}
+
+// public marks routes that need no token.
+const public auth.Permission = ""
+
+// handle registers handler on r, behind the permission check unless perm is
+// public, and records the route's policy. Calls of routes in auditActions
+// are written to the audit log, if there is one.
+func (s *Server) handle(r *mux.Router, path string, perm auth.Permission, handler http.HandlerFunc, methods ...string) {
+	var h http.Handler = handler
+	var action string
+	if spec, ok := auditActions[methods[0]+" "+path]; ok && len(methods) == 1 && s.auditLog != nil {
+		h = s.audited(spec, perm, h)
+		action = spec.Action
+	}
+	if perm != public {
+		h = auth.RequirePermissionMiddleware(s.jwtService, s.authorizer, perm)(h)
+	}
+	r.Handle(path, h).Methods(methods...)
+	for _, method := range methods {
+		s.policies = append(s.policies, RoutePolicy{Method: method, Path: path, Permission: perm, Audit: action})
+	}
+}
+
+// RoutePolicies returns the policy of every API route, in registration order.
+// Static files, served for any other path, are public.
+func (s *Server) RoutePolicies() []RoutePolicy {
+	s.Router()
+	return s.policies
+}
+
 func (s *Server) getLatestMetrics(w http.ResponseWriter, r *http.Request) {
 	metrics, err := s.storage.GetLatestMetrics()
 	if err != nil {
@@ -98,13 +373,53 @@ func (s *Server) getMetricsHistory(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(metrics)
 }
 
+func (s *Server) queryMetrics(w http.ResponseWriter, r *http.Request) {
+	req, err := query.ParseRequest(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshots, err := s.storage.GetMetricsRange(req.From, req.To)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(query.Execute(snapshots, req))
+}
+
 func (s *Server) getHealthChecks(w http.ResponseWriter, r *http.Request) {
-	results, err := s.healthCheckStorage.GetAllHealthCheckResults()
+	checks, _, ok := s.checks(w, r, auth.PermChecksRead)
+	if !ok {
+		return
+	}
+	configs, ok := s.selectHealthChecks(w, checks, r.URL.Query().Get("selector"))
+	if !ok {
+		return
+	}
+
+	results, err := checks.GetAllHealthCheckResults()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get health checks: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	selected := make(map[string]metrics.HealthCheckConfig, len(configs))
+	for _, config := range configs {
+		selected[config.ID] = config
+	}
+	filtered := make([]metrics.HealthCheckResult, 0, len(results))
+	for _, result := range results {
+		if config, ok := selected[result.ID]; ok {
+			result.Labels = config.Labels
+			result.Team = config.Team
+			filtered = append(filtered, result)
+		}
+	}
+	results = filtered
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
 }
@@ -113,11 +428,19 @@ func (s *Server) getHealthCheck(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	result, err := s.healthCheckStorage.GetHealthCheckResult(id)
+	checks, _, ok := s.checks(w, r, auth.PermChecksRead)
+	if !ok {
+		return
+	}
+	result, err := checks.GetHealthCheckResult(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if config, err := checks.GetHealthCheckConfig(id); err == nil {
+		result.Labels = config.Labels
+		result.Team = config.Team
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
@@ -143,6 +466,22 @@ func (s *Server) createHealthCheck(w http.ResponseWriter, r *http.Request) {
 		config.ID = fmt.Sprintf("check_%d", time.Now().UnixNano())
 	}
 
+	_, scope, ok := s.checks(w, r, auth.PermChecksWrite)
+	if !ok {
+		return
+	}
+	if config.Team == "" {
+		config.Team = defaultTeam(scope)
+	}
+	if !s.checkTeam(w, scope, config.Team) {
+		return
+	}
+	// A check of another team may not be replaced by reusing its ID.
+	if existing, err := s.healthCheckStorage.GetHealthCheckConfig(config.ID); err == nil && !scope.Allows(existing.Team) {
+		http.Error(w, fmt.Sprintf("Health check ID %q is taken", config.ID), http.StatusConflict)
+		return
+	}
+
 	config.Enabled = true
 	config.CreatedAt = time.Now()
 	config.UpdatedAt = time.Now()
@@ -153,6 +492,11 @@ func (s *Server) createHealthCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Storage assigns the revision and keeps an existing creation time.
+	if stored, err := s.healthCheckStorage.GetHealthCheckConfig(config.ID); err == nil {
+		config = stored
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(config)
@@ -170,6 +514,23 @@ func (s *Server) updateHealthCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	checks, scope, ok := s.checks(w, r, auth.PermChecksWrite)
+	if !ok {
+		return
+	}
+	existing, err := checks.GetHealthCheckConfig(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// A check stays in its team unless another is given.
+	if config.Team == "" {
+		config.Team = existing.Team
+	}
+	if config.Team != existing.Team && !s.checkTeam(w, scope, config.Team) {
+		return
+	}
+
 	config.ID = id
 	config.UpdatedAt = time.Now()
 
@@ -179,6 +540,10 @@ func (s *Server) updateHealthCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if stored, err := s.healthCheckStorage.GetHealthCheckConfig(id); err == nil {
+		config = stored
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(config)
 }
@@ -187,6 +552,15 @@ func (s *Server) deleteHealthCheck(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	checks, _, ok := s.checks(w, r, auth.PermChecksWrite)
+	if !ok {
+		return
+	}
+	if _, err := checks.GetHealthCheckConfig(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
 	err := s.healthCheckCollector.DeleteHealthCheck(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -210,7 +584,11 @@ func (s *Server) getHealthCheckHistory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	history, err := s.healthCheckStorage.GetHealthCheckHistory(id, duration)
+	checks, _, ok := s.checks(w, r, auth.PermChecksRead)
+	if !ok {
+		return
+	}
+	history, err := checks.GetHealthCheckHistory(id, duration)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get health check history: %v", err), http.StatusInternalServerError)
 		return
@@ -219,3 +597,26 @@ func (s *Server) getHealthCheckHistory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(history)
 }
+
+func (s *Server) getHealthCheckRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	checks, _, ok := s.checks(w, r, auth.PermChecksRead)
+	if !ok {
+		return
+	}
+	revisions, err := checks.GetHealthCheckRevisions(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Revisions are newest first; diff each against the one before it.
+	for i := 0; i+1 < len(revisions); i++ {
+		revisions[i].Changes = revisions[i].Config.Diff(revisions[i+1].Config)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
@@ -0,0 +1,229 @@
+package api_test
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"Golem/internal/api"
+	"Golem/internal/audit"
+	"Golem/internal/auth"
+	"Golem/internal/auth/oidctest"
+	"Golem/internal/collector"
+	"Golem/internal/mail"
+	"Golem/internal/mail/mailtest"
+	"Golem/internal/statuspage"
+	"Golem/internal/storage"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// routeGrants is the documented permission set of each role the route matrix
+// is checked against. It is written out here rather than taken from the auth
+// package so that a change to a built-in role shows up as a failure.
+var routeGrants = map[auth.Role][]auth.Permission{
+	auth.RoleViewer: {auth.PermMetricsRead, auth.PermChecksRead},
+	auth.RoleUser:   {auth.PermMetricsRead, auth.PermChecksRead, auth.PermChecksWrite},
+	auth.RoleAdmin:  auth.AllPermissions,
+	"status-editor": {auth.PermStatusWrite},
+}
+
+// publicRoutes are the only routes that may be called without a token.
+var publicRoutes = []string{
+	"POST /api/auth/register",
+	"POST /api/auth/login",
+	"POST /api/auth/login/mfa",
+	"POST /api/auth/login/mfa/enroll",
+	"POST /api/auth/password/forgot",
+	"POST /api/auth/password/reset",
+	"POST /api/auth/email/verify",
+	"GET /api/auth/setup",
+	"POST /api/auth/setup",
+	"GET /.well-known/jwks.json",
+	"GET /api/auth/oidc",
+	"GET /api/auth/oidc/login",
+	"GET /api/auth/oidc/callback",
+	"GET /status",
+	"GET /status/feed.json",
+	"GET /status/feed.rss",
+	"GET /api/status",
+	"GET /badge/{id}.svg",
+}
+
+// unauditedRoutes change state but are not recorded in the audit log. Login
+// attempts have their own trail, and the rest change nothing an admin
+// configured.
+var unauditedRoutes = []string{
+	"POST /api/auth/login",
+	"POST /api/auth/login/mfa",
+	"POST /api/auth/login/mfa/enroll",
+	"POST /api/auth/password/forgot",
+	"POST /api/auth/email/verification",
+	"POST /api/auth/mfa/enroll",
+}
+
+var pathVar = regexp.MustCompile(`\{[^}]+\}`)
+
+// testServer is a server with every optional feature on, backed by a
+// throwaway golem.db, a mail stand-in and an identity provider stand-in
+type testServer struct {
+	*api.Server
+	JWT   *auth.JWTService
+	Mail  *mailtest.Server
+	IdP   *oidctest.Provider
+	Users *auth.SQLiteUserStorage
+	Roles *auth.SQLiteRoleStorage
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "golem.db"))
+	must(err)
+	t.Cleanup(func() { db.Close() })
+
+	userStorage, err := auth.NewSQLiteUserStorage(db)
+	must(err)
+	roleStorage, err := auth.NewSQLiteRoleStorage(db)
+	must(err)
+	teamStorage, err := auth.NewSQLiteTeamStorage(db)
+	must(err)
+	invitationStorage, err := auth.NewSQLiteInvitationStorage(db)
+	must(err)
+	identityStorage, err := auth.NewSQLiteIdentityStorage(db)
+	must(err)
+	mfaStorage, err := auth.NewSQLiteMFAStorage(db)
+	must(err)
+	loginStorage, err := auth.NewSQLiteLoginStorage(db)
+	must(err)
+	tokenStorage, err := auth.NewSQLiteUserTokenStorage(db)
+	must(err)
+	statusStorage, err := statuspage.NewSQLiteStorage(db)
+	must(err)
+	auditLog, err := audit.NewSQLiteStorage(db)
+	must(err)
+	keyStorage, err := auth.NewSQLiteKeyStorage(db)
+	must(err)
+
+	smtpServer := &mailtest.Server{}
+	smtpAddr, err := smtpServer.Listen("127.0.0.1:0")
+	must(err)
+	t.Cleanup(func() { smtpServer.Close() })
+
+	idp, err := oidctest.New("golem", "secret",
+		oidctest.User{Subject: "1", Username: "alice", Email: "alice@example.com", Groups: []string{"golem-admins"}},
+		oidctest.User{Subject: "2", Username: "bob", Email: "bob@example.com"})
+	must(err)
+	idpServer := httptest.NewServer(idp)
+	t.Cleanup(idpServer.Close)
+	idp.Issuer = idpServer.URL
+
+	backend, err := storage.Open("memory", "")
+	must(err)
+	t.Cleanup(func() { backend.Close() })
+
+	keys := &auth.KeyRing{Store: keyStorage, Algorithm: auth.AlgEdDSA, Overlap: time.Minute}
+	must(keys.Load())
+	jwtService := auth.NewJWTServiceWithKeys(keys, time.Minute)
+
+	server := api.NewServer(backend, backend, collector.NewHealthCheckCollector(backend), userStorage, jwtService,
+		api.WithBackupDB(db),
+		api.WithStatusPage(&statuspage.Service{Store: statusStorage, Checks: backend}),
+		api.WithAuthorizer(&auth.Authorizer{Roles: roleStorage, Teams: teamStorage}),
+		api.WithRegistration(&auth.Registration{Policy: auth.RegistrationOpen, Invitations: invitationStorage}),
+		api.WithOIDC(auth.NewOIDCProvider(auth.OIDCConfig{
+			Issuer:       idp.Issuer,
+			ClientID:     "golem",
+			ClientSecret: "secret",
+			RedirectURL:  "http://golem.test/api/auth/oidc/callback",
+			RoleMapping:  []auth.GroupRole{{Group: "golem-admins", Role: auth.RoleAdmin}},
+		}, nil), identityStorage),
+		api.WithMFA(&auth.MFA{Store: mfaStorage}),
+		api.WithLoginGuard(&auth.LoginGuard{Store: loginStorage, User: auth.DefaultUserLockout, IP: auth.DefaultIPLockout}),
+		api.WithLoginEvents(loginStorage),
+		api.WithAuditLog(auditLog),
+		api.WithAccountMail(&auth.AccountMail{Tokens: tokenStorage, Mailer: &mail.SMTPMailer{Addr: smtpAddr, TLS: mail.TLSNone}}))
+	return &testServer{Server: server, JWT: jwtService, Mail: smtpServer, IdP: idp, Users: userStorage, Roles: roleStorage}
+}
+
+// TestRoutePermissions calls every route as each role and checks the
+// response against the route's permission: 401 without a token, 403 for a
+// role without the permission, and anything else for one with it.
+func TestRoutePermissions(t *testing.T) {
+	server := newTestServer(t)
+	if _, err := server.Roles.SaveRole(&auth.CustomRole{Name: "status-editor", Permissions: routeGrants["status-editor"]}); err != nil {
+		t.Fatal(err)
+	}
+	router := server.Router()
+
+	roles := []auth.Role{"", auth.RoleViewer, auth.RoleUser, auth.RoleAdmin, "status-editor"}
+	tokens := map[auth.Role]string{}
+	for _, role := range roles[1:] {
+		token, _, err := server.JWT.GenerateToken(&auth.User{ID: "routes-" + string(role), Username: string(role), Role: role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[role] = token
+	}
+
+	for _, policy := range server.RoutePolicies() {
+		route := policy.Method + " " + policy.Path
+		isPublic := policy.Permission == ""
+		if isPublic && !slices.Contains(publicRoutes, route) {
+			t.Errorf("%s: public but not in the list of public routes", route)
+		}
+		// The Prometheus API accepts POST for queries too long for a URL.
+		writes := policy.Method != "GET" && !strings.HasPrefix(policy.Path, "/api/v1/")
+		if writes && strings.HasSuffix(string(policy.Permission), ":read") {
+			t.Errorf("%s: writes with %s", route, policy.Permission)
+		}
+		if writes && policy.Audit == "" && !slices.Contains(unauditedRoutes, route) {
+			t.Errorf("%s: writes but is not in the audit log", route)
+		}
+
+		for _, role := range roles {
+			req := httptest.NewRequest(policy.Method, pathVar.ReplaceAllString(policy.Path, "x"), nil)
+			if role != "" {
+				req.Header.Set("Authorization", "Bearer "+tokens[role])
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			want := "allow"
+			switch {
+			case isPublic:
+			case role == "":
+				want = "401"
+			case policy.Permission == auth.PermAccount:
+			case !slices.Contains(routeGrants[role], policy.Permission):
+				want = "403"
+			}
+			got := "allow"
+			if rec.Code == http.StatusUnauthorized || rec.Code == http.StatusForbidden {
+				got = map[int]string{http.StatusUnauthorized: "401", http.StatusForbidden: "403"}[rec.Code]
+			}
+			if got != want {
+				t.Errorf("%s as %s: got %d, want %s", route, roleLabel(role), rec.Code, want)
+			}
+		}
+	}
+}
+
+func roleLabel(role auth.Role) string {
+	if role == "" {
+		return "anonymous"
+	}
+	return string(role)
+}
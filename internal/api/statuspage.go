@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"Golem/internal/statuspage"
+
+	"github.com/gorilla/mux"
+)
+
+// statusPageEnabled writes a 404 when the server has no status page.
+func (s *Server) statusPageEnabled(w http.ResponseWriter) bool {
+	if s.statusPage == nil {
+		http.Error(w, "Status page is not available", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// baseURL is the scheme and host the request was made to, for links in feeds.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) getStatusPage(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	summary, err := s.statusPage.Summary(time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build status page: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := statuspage.Render(&buf, summary); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to render status page: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) getStatusSummary(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	summary, err := s.statusPage.Summary(time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build status page: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+func (s *Server) getStatusFeedJSON(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	config, incidents, err := s.statusPage.FeedIncidents(time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get incidents: %v", err), http.StatusInternalServerError)
+		return
+	}
+	data, err := statuspage.JSONFeed(config, incidents, baseURL(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/feed+json")
+	w.Write(data)
+}
+
+func (s *Server) getStatusFeedRSS(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	config, incidents, err := s.statusPage.FeedIncidents(time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get incidents: %v", err), http.StatusInternalServerError)
+		return
+	}
+	data, err := statuspage.RSSFeed(config, incidents, baseURL(r), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write(data)
+}
+
+func (s *Server) getStatusBadge(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	name, status, ok, err := s.statusPage.Badge(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Badge not found", http.StatusNotFound)
+		return
+	}
+	if label := r.URL.Query().Get("label"); label != "" {
+		name = label
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "max-age=60")
+	w.Write(statuspage.Badge(name, status))
+}
+
+func (s *Server) getStatusPageConfig(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	config, err := s.statusPage.Store.GetConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config)
+}
+
+func (s *Server) updateStatusPageConfig(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	var config statuspage.Config
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := config.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.statusPage.Store.SaveConfig(config); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.getStatusPageConfig(w, r)
+}
+
+func (s *Server) listIncidents(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	incidents, err := s.statusPage.Store.ListIncidents(time.Time{}, 500)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(incidents)
+}
+
+func (s *Server) getIncident(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	incident, err := s.statusPage.Store.GetIncident(mux.Vars(r)["id"])
+	if err == statuspage.ErrIncidentNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(incident)
+}
+
+func (s *Server) createIncident(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	var create statuspage.IncidentCreate
+	if err := json.NewDecoder(r.Body).Decode(&create); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := create.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	incident, err := s.statusPage.Store.CreateIncident(create, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(incident)
+}
+
+func (s *Server) addIncidentUpdate(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	var update statuspage.IncidentUpdateCreate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := update.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	incident, err := s.statusPage.Store.AddIncidentUpdate(mux.Vars(r)["id"], update, time.Now())
+	if err == statuspage.ErrIncidentNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(incident)
+}
+
+func (s *Server) deleteIncident(w http.ResponseWriter, r *http.Request) {
+	if !s.statusPageEnabled(w) {
+		return
+	}
+
+	err := s.statusPage.Store.DeleteIncident(mux.Vars(r)["id"])
+	if err == statuspage.ErrIncidentNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,434 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"Golem/internal/auth"
+	"Golem/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// checkScope returns the teams whose checks the caller may use with perm:
+// checks without a team if their role grants perm, and the teams whose
+// role for them grants it. System admins, and every caller when teams are
+// not enabled, may use every check.
+func (s *Server) checkScope(r *http.Request, perm auth.Permission) (storage.Scope, error) {
+	if s.authorizer.Teams == nil {
+		return storage.Scope{All: true}, nil
+	}
+	claims := auth.GetUserFromContext(r.Context())
+	role := s.authorizer.AnonymousRole
+	if claims != nil {
+		role = claims.Role
+	}
+	if admin, err := s.authorizer.Allowed(role, auth.PermSystemAdmin); err != nil || admin {
+		return storage.Scope{All: admin}, err
+	}
+
+	shared, err := s.authorizer.Allowed(role, perm)
+	if err != nil {
+		return storage.Scope{}, err
+	}
+	scope := storage.Scope{Shared: shared}
+	if claims == nil {
+		return scope, nil
+	}
+	memberships, err := s.authorizer.Teams.Memberships(claims.UserID)
+	if err != nil {
+		return storage.Scope{}, err
+	}
+	for _, m := range memberships {
+		if auth.TeamGrants(m.Role, perm) {
+			scope.Teams = append(scope.Teams, m.Team)
+		}
+	}
+	return scope, nil
+}
+
+// checks returns the health checks the caller may use with perm. It writes
+// an error response when it returns false.
+func (s *Server) checks(w http.ResponseWriter, r *http.Request, perm auth.Permission) (storage.HealthCheckStorage, storage.Scope, bool) {
+	scope, err := s.checkScope(r, perm)
+	if err != nil {
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return nil, scope, false
+	}
+	return storage.Scoped(s.healthCheckStorage, scope), scope, true
+}
+
+// checkTeam checks that the caller may put a check in team, and that it
+// exists. It writes an error response when it returns false.
+func (s *Server) checkTeam(w http.ResponseWriter, scope storage.Scope, team string) bool {
+	if !scope.Allows(team) {
+		if team == "" {
+			http.Error(w, "You may only add checks to your teams; set team", http.StatusForbidden)
+		} else {
+			http.Error(w, fmt.Sprintf("You may not change checks of team %q", team), http.StatusForbidden)
+		}
+		return false
+	}
+	if team == "" {
+		return true
+	}
+	if s.authorizer.Teams == nil {
+		http.Error(w, "Teams are not enabled", http.StatusBadRequest)
+		return false
+	}
+	if _, err := s.authorizer.Teams.GetTeam(team); err != nil {
+		if errors.Is(err, auth.ErrTeamNotFound) {
+			http.Error(w, fmt.Sprintf("Unknown team %q", team), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to get team", http.StatusInternalServerError)
+		}
+		return false
+	}
+	return true
+}
+
+// defaultTeam is the team of a new check that names none: the caller's
+// only team when they cannot add shared checks
+func defaultTeam(scope storage.Scope) string {
+	if !scope.All && !scope.Shared && len(scope.Teams) == 1 {
+		return scope.Teams[0]
+	}
+	return ""
+}
+
+// teamRole returns the caller's role in team, or "" if they are not a member
+func (s *Server) teamRole(r *http.Request, team string) (auth.TeamRole, error) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		return "", nil
+	}
+	memberships, err := s.authorizer.Teams.Memberships(claims.UserID)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range memberships {
+		if m.Team == team {
+			return m.Role, nil
+		}
+	}
+	return "", nil
+}
+
+// teamAccess reports whether the caller manages every team, and their role in
+// team. It writes an error response and returns false if the team does not
+// exist or the caller is neither a member nor a user admin.
+func (s *Server) teamAccess(w http.ResponseWriter, r *http.Request, team string) (bool, auth.TeamRole, bool) {
+	claims := auth.GetUserFromContext(r.Context())
+	usersAdmin, err := s.authorizer.Allowed(claims.Role, auth.PermUsersAdmin)
+	if err != nil {
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return false, "", false
+	}
+	role, err := s.teamRole(r, team)
+	if err != nil {
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return false, "", false
+	}
+	if !usersAdmin && role == "" {
+		http.Error(w, auth.ErrTeamNotFound.Error(), http.StatusNotFound)
+		return false, "", false
+	}
+	if _, err := s.authorizer.Teams.GetTeam(team); err != nil {
+		if errors.Is(err, auth.ErrTeamNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to get team", http.StatusInternalServerError)
+		}
+		return false, "", false
+	}
+	return usersAdmin, role, true
+}
+
+// listTeams returns every team to user admins, and the caller's own teams,
+// with their role in each, to everyone else
+func (s *Server) listTeams(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetUserFromContext(r.Context())
+	usersAdmin, err := s.authorizer.Allowed(claims.Role, auth.PermUsersAdmin)
+	if err != nil {
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return
+	}
+	teams, err := s.authorizer.Teams.ListTeams()
+	if err != nil {
+		http.Error(w, "Failed to list teams", http.StatusInternalServerError)
+		return
+	}
+	memberships, err := s.authorizer.Teams.Memberships(claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to list teams", http.StatusInternalServerError)
+		return
+	}
+	roles := make(map[string]auth.TeamRole, len(memberships))
+	for _, m := range memberships {
+		roles[m.Team] = m.Role
+	}
+
+	listed := []*auth.Team{}
+	for _, team := range teams {
+		team.Role = roles[team.Name]
+		if usersAdmin || team.Role != "" {
+			listed = append(listed, team)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listed)
+}
+
+func (s *Server) createTeam(w http.ResponseWriter, r *http.Request) {
+	var team auth.Team
+	if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := team.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := s.authorizer.Teams.CreateTeam(&team)
+	if errors.Is(err, auth.ErrTeamExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create team", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) getTeam(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["team"]
+	if _, _, ok := s.teamAccess(w, r, name); !ok {
+		return
+	}
+	team, err := s.authorizer.Teams.GetTeam(name)
+	if err != nil {
+		http.Error(w, "Failed to get team", http.StatusInternalServerError)
+		return
+	}
+	team.Role, _ = s.teamRole(r, name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(team)
+}
+
+// updateTeam changes a team's description (user admins and team admins)
+func (s *Server) updateTeam(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["team"]
+	usersAdmin, role, ok := s.teamAccess(w, r, name)
+	if !ok {
+		return
+	}
+	if !usersAdmin && role != auth.TeamAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var team auth.Team
+	if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	team.Name = name
+	updated, err := s.authorizer.Teams.UpdateTeam(&team)
+	if err != nil {
+		http.Error(w, "Failed to update team", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// deleteTeam deletes a team that owns no checks
+func (s *Server) deleteTeam(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["team"]
+	configs, err := s.healthCheckStorage.GetAllHealthCheckConfigs()
+	if err != nil {
+		http.Error(w, "Failed to get health checks", http.StatusInternalServerError)
+		return
+	}
+	owned := 0
+	for _, config := range configs {
+		if config.Team == name {
+			owned++
+		}
+	}
+	if owned > 0 {
+		http.Error(w, fmt.Sprintf("team owns %d checks; move or delete them first", owned), http.StatusConflict)
+		return
+	}
+	err = s.authorizer.Teams.DeleteTeam(name)
+	if errors.Is(err, auth.ErrTeamNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete team", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listTeamMembers(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["team"]
+	if _, _, ok := s.teamAccess(w, r, name); !ok {
+		return
+	}
+	members, err := s.authorizer.Teams.ListMembers(name)
+	if err != nil {
+		http.Error(w, "Failed to list team members", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+type teamMemberRequest struct {
+	Role auth.TeamRole `json:"role"`
+}
+
+// setTeamMember adds a user, given by ID or username, to a team or changes
+// their role in it (user admins and team admins)
+func (s *Server) setTeamMember(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["team"]
+	usersAdmin, role, ok := s.teamAccess(w, r, name)
+	if !ok {
+		return
+	}
+	if !usersAdmin && role != auth.TeamAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req teamMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !auth.ValidTeamRole(req.Role) {
+		http.Error(w, "role must be admin, editor or viewer", http.StatusBadRequest)
+		return
+	}
+	user, ok := s.teamMemberUser(w, mux.Vars(r)["user"])
+	if !ok {
+		return
+	}
+	if req.Role != auth.TeamAdmin && !s.keepsTeamAdmin(w, name, user.ID, usersAdmin) {
+		return
+	}
+	if err := s.authorizer.Teams.SetMember(name, user.ID, req.Role); err != nil {
+		http.Error(w, "Failed to add team member", http.StatusInternalServerError)
+		return
+	}
+	members, err := s.authorizer.Teams.ListMembers(name)
+	if err != nil {
+		http.Error(w, "Failed to list team members", http.StatusInternalServerError)
+		return
+	}
+	i := slices.IndexFunc(members, func(m *auth.TeamMember) bool { return m.UserID == user.ID })
+	if i < 0 {
+		http.Error(w, auth.ErrMemberNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members[i])
+}
+
+// removeTeamMember removes a user from a team (user admins, team admins, and
+// members leaving)
+func (s *Server) removeTeamMember(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["team"]
+	usersAdmin, role, ok := s.teamAccess(w, r, name)
+	if !ok {
+		return
+	}
+	user, ok := s.teamMemberUser(w, mux.Vars(r)["user"])
+	if !ok {
+		return
+	}
+	self := user.ID == auth.GetUserFromContext(r.Context()).UserID
+	if !usersAdmin && role != auth.TeamAdmin && !self {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !s.keepsTeamAdmin(w, name, user.ID, usersAdmin) {
+		return
+	}
+	err := s.authorizer.Teams.RemoveMember(name, user.ID)
+	if errors.Is(err, auth.ErrMemberNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to remove team member", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// teamMemberUser looks up a user by ID or username. It writes an error
+// response when it returns false.
+func (s *Server) teamMemberUser(w http.ResponseWriter, idOrName string) (*auth.User, bool) {
+	user, err := s.userStorage.GetUserByID(idOrName)
+	if err != nil {
+		user, err = s.userStorage.GetUserByUsername(idOrName)
+	}
+	if err != nil {
+		http.Error(w, auth.ErrUserNotFound.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
+
+// keepsTeamAdmin refuses, unless the caller is a user admin, to leave a team
+// without an admin by demoting or removing userID. It writes an error
+// response when it returns false.
+func (s *Server) keepsTeamAdmin(w http.ResponseWriter, team, userID string, usersAdmin bool) bool {
+	if usersAdmin {
+		return true
+	}
+	members, err := s.authorizer.Teams.ListMembers(team)
+	if err != nil {
+		http.Error(w, "Failed to list team members", http.StatusInternalServerError)
+		return false
+	}
+	for _, m := range members {
+		if m.Role == auth.TeamAdmin && m.UserID != userID {
+			return true
+		}
+	}
+	for _, m := range members {
+		if m.UserID == userID && m.Role == auth.TeamAdmin {
+			http.Error(w, "a team needs at least one admin", http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+// teamSnapshot is a team and its members, for the audit log
+func (s *Server) teamSnapshot(name string) (interface{}, error) {
+	team, err := s.authorizer.Teams.GetTeam(name)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.authorizer.Teams.ListMembers(name)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]auth.TeamRole, len(members))
+	for _, m := range members {
+		roles[m.Username] = m.Role
+	}
+	return struct {
+		*auth.Team
+		MemberRoles map[string]auth.TeamRole `json:"member_roles"`
+	}{team, roles}, nil
+}
@@ -0,0 +1,145 @@
+// Package audit keeps an append-only log of configuration and
+// user-management changes: who changed what, from where, and how.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// Actor types
+const (
+	ActorUser      = "user"
+	ActorAnonymous = "anonymous"
+	ActorCLI       = "cli"
+)
+
+// Event records one change. Before and After hold only the fields that
+// changed, or the whole object when it was created or deleted.
+type Event struct {
+	ID         int64           `json:"id"`
+	Time       time.Time       `json:"time"`
+	ActorType  string          `json:"actor_type"`
+	ActorID    string          `json:"actor_id,omitempty"`
+	Actor      string          `json:"actor,omitempty"`
+	Role       string          `json:"role,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Method     string          `json:"method,omitempty"`
+	Path       string          `json:"path,omitempty"`
+	Status     int             `json:"status,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+}
+
+// redacted are the fields never written to the log, at any depth
+var redacted = map[string]bool{
+	"password":       true,
+	"password_hash":  true,
+	"token":          true,
+	"setup_token":    true,
+	"mfa_token":      true,
+	"secret":         true,
+	"otpauth_uri":    true,
+	"recovery_codes": true,
+	"key_data":       true,
+}
+
+// Snapshot returns v as generic JSON with secrets redacted, or nil if v
+// cannot be encoded
+func Snapshot(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return Decode(data)
+}
+
+// Decode parses a JSON document with secrets redacted, or returns nil if it
+// is not JSON
+func Decode(data []byte) interface{} {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil
+	}
+	return redact(v)
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if redacted[k] {
+				v[k] = "[redacted]"
+			} else {
+				v[k] = redact(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+	return v
+}
+
+// Diff reduces two snapshots of the same object to the fields that differ.
+// Objects are compared field by field at the top level; anything else is
+// returned unchanged when it differs. A side with nothing left is nil.
+func Diff(before, after interface{}) (interface{}, interface{}) {
+	b, bok := before.(map[string]interface{})
+	a, aok := after.(map[string]interface{})
+	if !bok || !aok {
+		if reflect.DeepEqual(before, after) {
+			return nil, nil
+		}
+		return before, after
+	}
+	changedBefore := map[string]interface{}{}
+	changedAfter := map[string]interface{}{}
+	for k, v := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(v, av) {
+			changedBefore[k] = v
+		}
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || !reflect.DeepEqual(v, bv) {
+			changedAfter[k] = v
+		}
+	}
+	return nilIfEmpty(changedBefore), nilIfEmpty(changedAfter)
+}
+
+func nilIfEmpty(m map[string]interface{}) interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// SetChange stores before and after on e, usually reduced by Diff first
+func (e *Event) SetChange(before, after interface{}) {
+	e.Before = encode(before)
+	e.After = encode(after)
+}
+
+func encode(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
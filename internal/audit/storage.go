@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"Golem/internal/storage/migrations"
+)
+
+// Filter selects audit events. Actor matches the actor's ID or name. A zero
+// Limit returns every match.
+type Filter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	IP         string
+	Since      time.Time
+	Until      time.Time
+	// BeforeID pages backwards through List
+	BeforeID int64
+	Limit    int
+}
+
+// Storage is the audit log. It has no way to change or remove an event.
+type Storage interface {
+	Record(e *Event) error
+	// List returns the events matching f, newest first
+	List(f Filter) ([]*Event, error)
+	// Each calls fn with the events matching f, oldest first, stopping at
+	// the first error
+	Each(f Filter, fn func(*Event) error) error
+}
+
+// SQLiteStorage implements Storage in golem.db. Triggers reject updates and
+// deletes of recorded events.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(db *sql.DB) (*SQLiteStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteStorage{db: db}, nil
+}
+
+const eventColumns = "id, time, actor_type, actor_id, actor, role, action, target_type, target_id, method, path, status, ip, user_agent, before_json, after_json"
+
+// Record appends e to the log and sets its ID
+func (s *SQLiteStorage) Record(e *Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	res, err := s.db.Exec(
+		"INSERT INTO audit_log (time, actor_type, actor_id, actor, role, action, target_type, target_id, method, path, status, ip, user_agent, before_json, after_json) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.Time.UTC(), e.ActorType, e.ActorID, e.Actor, e.Role, e.Action, e.TargetType, e.TargetID,
+		e.Method, e.Path, e.Status, e.IP, e.UserAgent, nullJSON(e.Before), nullJSON(e.After),
+	)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+// List returns the events matching f, newest first
+func (s *SQLiteStorage) List(f Filter) ([]*Event, error) {
+	events := []*Event{}
+	err := s.query(f, "DESC", func(e *Event) error {
+		events = append(events, e)
+		return nil
+	})
+	return events, err
+}
+
+// Each calls fn with the events matching f, oldest first
+func (s *SQLiteStorage) Each(f Filter, fn func(*Event) error) error {
+	return s.query(f, "ASC", fn)
+}
+
+func (s *SQLiteStorage) query(f Filter, order string, fn func(*Event) error) error {
+	query := "SELECT " + eventColumns + " FROM audit_log"
+	var where []string
+	var args []interface{}
+	if f.Actor != "" {
+		where = append(where, "(actor_id = ? OR actor = ?)")
+		args = append(args, f.Actor, f.Actor)
+	}
+	if f.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.TargetType != "" {
+		where = append(where, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		where = append(where, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.IP != "" {
+		where = append(where, "ip = ?")
+		args = append(args, f.IP)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, f.Until.UTC())
+	}
+	if f.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, f.BeforeID)
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id " + order
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &Event{}
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.Time, &e.ActorType, &e.ActorID, &e.Actor, &e.Role, &e.Action, &e.TargetType, &e.TargetID,
+			&e.Method, &e.Path, &e.Status, &e.IP, &e.UserAgent, &before, &after); err != nil {
+			return err
+		}
+		if before.Valid {
+			e.Before = []byte(before.String)
+		}
+		if after.Valid {
+			e.After = []byte(after.String)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func nullJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
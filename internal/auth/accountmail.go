@@ -0,0 +1,408 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"Golem/internal/mail"
+	"Golem/internal/storage/migrations"
+
+	"github.com/google/uuid"
+)
+
+var ErrUserTokenInvalid = errors.New("link is invalid, expired or already used")
+
+// Purposes of user tokens
+const (
+	TokenPasswordReset = "password_reset"
+	TokenVerifyEmail   = "verify_email"
+)
+
+// UserToken is a single-use token mailed to a user
+type UserToken struct {
+	ID      string
+	UserID  string
+	Purpose string
+	// Email is the address the token was sent to
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	// Token is only set when the token is created
+	Token string
+}
+
+// UserTokenStorage defines the interface for user token storage
+type UserTokenStorage interface {
+	CreateUserToken(t *UserToken) error
+	// ConsumeUserToken marks an unused, unexpired token with purpose used
+	// and returns it, or ErrUserTokenInvalid
+	ConsumeUserToken(token, purpose string, now time.Time) (*UserToken, error)
+	// ReleaseUserToken makes a consumed token usable again
+	ReleaseUserToken(id string) error
+	// CountUserTokens counts the tokens created for a user since a time
+	CountUserTokens(userID, purpose string, since time.Time) (int, error)
+	DeleteUserTokens(userID, purpose string) error
+}
+
+// SQLiteUserTokenStorage implements UserTokenStorage using SQLite
+type SQLiteUserTokenStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteUserTokenStorage creates a new SQLiteUserTokenStorage instance
+func NewSQLiteUserTokenStorage(db *sql.DB) (*SQLiteUserTokenStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteUserTokenStorage{db: db}, nil
+}
+
+// CreateUserToken generates the token of t and stores a hash of it
+func (s *SQLiteUserTokenStorage) CreateUserToken(t *UserToken) error {
+	token, err := NewToken()
+	if err != nil {
+		return err
+	}
+	t.ID = uuid.New().String()
+	t.Token = token
+	t.CreatedAt = time.Now().UTC()
+	t.ExpiresAt = t.ExpiresAt.UTC()
+	_, err = s.db.Exec(`
+		INSERT INTO user_tokens (id, token_hash, user_id, purpose, email, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, t.ID, hashToken(token), t.UserID, t.Purpose, t.Email, t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %v", err)
+	}
+	return nil
+}
+
+// ConsumeUserToken uses the token in a single statement, so it can only be
+// used once even by concurrent requests
+func (s *SQLiteUserTokenStorage) ConsumeUserToken(token, purpose string, now time.Time) (*UserToken, error) {
+	now = now.UTC()
+	t := &UserToken{}
+	err := s.db.QueryRow(`
+		UPDATE user_tokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING id, user_id, purpose, email, created_at, expires_at
+	`, now, hashToken(token), purpose, now).Scan(&t.ID, &t.UserID, &t.Purpose, &t.Email, &t.CreatedAt, &t.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ReleaseUserToken makes a consumed token usable again
+func (s *SQLiteUserTokenStorage) ReleaseUserToken(id string) error {
+	_, err := s.db.Exec("UPDATE user_tokens SET used_at = NULL WHERE id = ?", id)
+	return err
+}
+
+// CountUserTokens counts the tokens created for a user since a time
+func (s *SQLiteUserTokenStorage) CountUserTokens(userID, purpose string, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM user_tokens WHERE user_id = ? AND purpose = ? AND created_at > ?",
+		userID, purpose, since.UTC(),
+	).Scan(&n)
+	return n, err
+}
+
+// DeleteUserTokens deletes the tokens of a user with purpose, and expired
+// tokens of everyone
+func (s *SQLiteUserTokenStorage) DeleteUserTokens(userID, purpose string) error {
+	_, err := s.db.Exec(
+		"DELETE FROM user_tokens WHERE (user_id = ? AND purpose = ?) OR expires_at < ?",
+		userID, purpose, time.Now().UTC().Add(-24*time.Hour),
+	)
+	return err
+}
+
+// AccountMail sends password reset and email verification links
+type AccountMail struct {
+	Tokens UserTokenStorage
+	Mailer mail.Mailer
+	// BaseURL is where users open Golem, e.g. https://golem.example.com
+	BaseURL string
+	// ResetTTL and VerifyTTL default to an hour and two days
+	ResetTTL  time.Duration
+	VerifyTTL time.Duration
+}
+
+// tokensPerHour limits the links mailed to one user, so the endpoints
+// cannot be used to flood an inbox
+const tokensPerHour = 3
+
+// ForgotPasswordRequest asks for a reset link by email address or username
+type ForgotPasswordRequest struct {
+	Email    string `json:"email,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// ResetPasswordRequest sets a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// VerifyEmailRequest verifies an email address with a verification token
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// send mails a link with a new token to user in the background. It returns
+// false if the user has been sent too many links lately.
+func (m *AccountMail) send(user *User, purpose string) (bool, error) {
+	n, err := m.Tokens.CountUserTokens(user.ID, purpose, time.Now().Add(-time.Hour))
+	if err != nil {
+		return false, err
+	}
+	if n >= tokensPerHour {
+		return false, nil
+	}
+
+	ttl, fragment := m.VerifyTTL, "verify"
+	if ttl == 0 {
+		ttl = 48 * time.Hour
+	}
+	if purpose == TokenPasswordReset {
+		ttl, fragment = m.ResetTTL, "reset"
+		if ttl == 0 {
+			ttl = time.Hour
+		}
+	}
+	t := &UserToken{UserID: user.ID, Purpose: purpose, Email: user.Email, ExpiresAt: time.Now().Add(ttl)}
+	if err := m.Tokens.CreateUserToken(t); err != nil {
+		return false, err
+	}
+	// The token is in the fragment so it is not sent to the server, or to
+	// anyone else in a Referer header, when the link is opened
+	link := strings.TrimRight(m.BaseURL, "/") + "/#" + fragment + "=" + t.Token
+
+	msg := &mail.Message{To: user.Email}
+	if purpose == TokenPasswordReset {
+		msg.Subject = "Reset your Golem password"
+		msg.Body = fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your Golem account. To choose a new\npassword, open this link within %s:\n\n%s\n\nIf it was not you, ignore this email and your password stays the same.\n",
+			user.Username, humanDuration(ttl), link)
+	} else {
+		msg.Subject = "Verify your email address for Golem"
+		msg.Body = fmt.Sprintf("Hi %s,\n\nTo confirm that this is your email address, open this link within %s:\n\n%s\n",
+			user.Username, humanDuration(ttl), link)
+	}
+	m.deliver(msg)
+	return true, nil
+}
+
+// humanDuration formats d for an email, e.g. "2 hours"
+func humanDuration(d time.Duration) string {
+	n, unit := int(d/time.Minute), "minute"
+	if d >= time.Hour && d%time.Hour == 0 {
+		n, unit = int(d/time.Hour), "hour"
+	}
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// deliver sends msg in the background, so responses take the same time
+// whether or not mail was sent
+func (m *AccountMail) deliver(msg *mail.Message) {
+	go func() {
+		if err := m.Mailer.Send(context.Background(), msg); err != nil {
+			log.Printf("Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// SendVerification mails an email verification link to user, if they have
+// an unverified address
+func (h *Handler) SendVerification(user *User) {
+	if h.AccountMail == nil || user.EmailVerified || !strings.Contains(user.Email, "@") {
+		return
+	}
+	if _, err := h.AccountMail.send(user, TokenVerifyEmail); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Username, err)
+	}
+}
+
+// passwordResettable reports whether user signs in with a Golem password.
+// Users provisioned by single sign-on or LDAP change it there.
+func (h *Handler) passwordResettable(user *User) (bool, error) {
+	if !user.IsActive {
+		return false, nil
+	}
+	if h.Identities == nil {
+		return true, nil
+	}
+	linked, err := h.Identities.HasIdentity(user.ID)
+	return !linked, err
+}
+
+// ForgotPasswordHandler mails a password reset link. It answers the same
+// whether or not the account exists, so it cannot be used to find accounts.
+func (h *Handler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" && req.Username == "" {
+		http.Error(w, "email or username is required", http.StatusBadRequest)
+		return
+	}
+
+	var user *User
+	var err error
+	if req.Email != "" {
+		user, err = h.UserStore.GetUserByEmail(req.Email)
+	} else {
+		user, err = h.UserStore.GetUserByUsername(req.Username)
+	}
+	if err != nil && err != ErrUserNotFound {
+		http.Error(w, "Failed to look up user", http.StatusInternalServerError)
+		return
+	}
+	if user != nil && strings.Contains(user.Email, "@") {
+		if ok, err := h.passwordResettable(user); err != nil {
+			log.Printf("Failed to check identities of %s: %v", user.Username, err)
+		} else if ok {
+			if sent, err := h.AccountMail.send(user, TokenPasswordReset); err != nil {
+				log.Printf("Failed to send password reset to %s: %v", user.Username, err)
+			} else if !sent {
+				log.Printf("Not sending another password reset to %s this hour", user.Username)
+			}
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPasswordHandler sets a new password with a token from
+// ForgotPasswordHandler
+func (h *Handler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tokens := h.AccountMail.Tokens
+	t, err := tokens.ConsumeUserToken(req.Token, TokenPasswordReset, time.Now())
+	if err == ErrUserTokenInvalid {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check token", http.StatusInternalServerError)
+		return
+	}
+	user, err := h.UserStore.GetUserByID(t.UserID)
+	if err == ErrUserNotFound {
+		http.Error(w, ErrUserTokenInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to look up user", http.StatusInternalServerError)
+		return
+	}
+	if ok, err := h.passwordResettable(user); err != nil || !ok {
+		http.Error(w, ErrUserTokenInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err = h.UserStore.UpdateUser(user.ID, &UserUpdate{Password: &req.Password})
+	if err != nil {
+		// Let the user try again with a better password
+		if err := tokens.ReleaseUserToken(t.ID); err != nil {
+			log.Printf("Failed to release password reset token: %v", err)
+		}
+		if errors.Is(err, ErrWeakPassword) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to set password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tokens.DeleteUserTokens(user.ID, TokenPasswordReset); err != nil {
+		log.Printf("Failed to delete password reset tokens of %s: %v", user.Username, err)
+	}
+	// Following the link proves the address, and the password is no longer
+	// the one being guessed
+	if _, err := h.UserStore.MarkEmailVerified(user.ID, t.Email); err != nil {
+		log.Printf("Failed to mark email of %s verified: %v", user.Username, err)
+	}
+	if h.Guard != nil {
+		if err := h.Guard.Succeed(user.Username); err != nil {
+			log.Printf("Failed to unlock %s: %v", user.Username, err)
+		}
+	}
+	h.AccountMail.deliver(&mail.Message{
+		To:      user.Email,
+		Subject: "Your Golem password was changed",
+		Body:    fmt.Sprintf("Hi %s,\n\nThe password of your Golem account was just reset. If it was not you,\ncontact your Golem administrator.\n", user.Username),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmailHandler marks an email address verified with a token from
+// SendVerification
+func (h *Handler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	t, err := h.AccountMail.Tokens.ConsumeUserToken(req.Token, TokenVerifyEmail, time.Now())
+	if err == ErrUserTokenInvalid {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check token", http.StatusInternalServerError)
+		return
+	}
+	verified, err := h.UserStore.MarkEmailVerified(t.UserID, t.Email)
+	if err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+	if !verified {
+		http.Error(w, "the email address was changed after this link was sent", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerificationHandler mails the current user a new verification link
+func (h *Handler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.EmailVerified {
+		http.Error(w, "email address is already verified", http.StatusConflict)
+		return
+	}
+	sent, err := h.AccountMail.send(user, TokenVerifyEmail)
+	if err != nil {
+		http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+	if !sent {
+		http.Error(w, "too many verification emails, try again later", http.StatusTooManyRequests)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
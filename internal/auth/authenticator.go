@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrNoRole             = errors.New("you are not in any group that may use Golem")
+	ErrUserDisabled       = errors.New("account is disabled")
+)
+
+// Authenticator checks a username and password against one source of
+// accounts. It returns ErrInvalidCredentials when the source does not know
+// the user or the password is wrong, so that the next source is tried.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*User, error)
+}
+
+// LocalAuthenticator checks passwords stored in UserStorage
+type LocalAuthenticator struct {
+	Users UserStorage
+}
+
+// Name identifies the authenticator in logs
+func (a *LocalAuthenticator) Name() string {
+	return "local"
+}
+
+// Authenticate checks the user's bcrypt password hash
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	user, err := a.Users.GetUserByUsername(username)
+	if err == ErrUserNotFound {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckPassword(password, user.PasswordHash); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !user.IsActive {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
+
+// ExternalIdentity is a user vouched for by an identity provider or directory
+type ExternalIdentity struct {
+	Subject  string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// MapRole returns the role of the first mapping whose group the user is in,
+// or defaultRole. Groups match case-insensitively.
+func MapRole(mapping []GroupRole, defaultRole Role, groups []string) (Role, bool) {
+	for _, m := range mapping {
+		for _, group := range groups {
+			if strings.EqualFold(group, m.Group) {
+				return m.Role, true
+			}
+		}
+	}
+	return defaultRole, defaultRole != ""
+}
+
+// Provisioner keeps local users in step with external accounts
+type Provisioner struct {
+	Users      UserStorage
+	Identities IdentityStorage
+	Authorizer *Authorizer
+}
+
+// Provision returns the user linked to identity at provider, creating one
+// on first sign-in. The role is updated to role on every sign-in.
+func (p *Provisioner) Provision(provider string, identity *ExternalIdentity, role Role) (*User, error) {
+	if p.Authorizer != nil {
+		if exists, err := p.Authorizer.RoleExists(role); err != nil || !exists {
+			return nil, fmt.Errorf("mapped role %q does not exist", role)
+		}
+	}
+
+	userID, err := p.Identities.GetIdentityUser(provider, identity.Subject)
+	if err != nil && err != ErrIdentityNotFound {
+		return nil, err
+	}
+	if err == nil {
+		user, err := p.Users.GetUserByID(userID)
+		switch {
+		case err == nil:
+			if !user.IsActive {
+				return nil, ErrUserDisabled
+			}
+			if user.Role != role {
+				return p.Users.UpdateUser(user.ID, &UserUpdate{Role: &role})
+			}
+			return user, nil
+		case err != ErrUserNotFound:
+			return nil, err
+		}
+		// The user was deleted; provision a new one
+	}
+
+	// Accounts created here cannot sign in with a password
+	password, err := NewToken()
+	if err != nil {
+		return nil, err
+	}
+	var user *User
+	for _, username := range provisionUsernames(identity) {
+		user, err = p.Users.CreateUser(&UserCreate{Username: username, Email: identity.Email, Password: password, Role: role})
+		if err != ErrUserAlreadyExists {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Identities.LinkIdentity(provider, identity.Subject, user.ID); err != nil {
+		p.Users.DeleteUser(user.ID)
+		return nil, err
+	}
+	return user, nil
+}
+
+// provisionUsernames are the usernames to try for a new user, best first.
+// Local users are never taken over by an external user with the same name.
+func provisionUsernames(identity *ExternalIdentity) []string {
+	var names []string
+	if identity.Username != "" {
+		names = append(names, identity.Username)
+	}
+	if local, _, ok := strings.Cut(identity.Email, "@"); ok && local != "" {
+		names = append(names, local)
+	}
+	sum := sha256.Sum256([]byte(identity.Subject))
+	suffix := base64.RawURLEncoding.EncodeToString(sum[:])[:8]
+	for _, name := range append([]string{}, names...) {
+		names = append(names, name+"-"+suffix)
+	}
+	return append(names, "user-"+suffix)
+}
@@ -1,30 +1,145 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/netip"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Handler struct {
-	UserStore  UserStorage
-	JWTService *JWTService
+	UserStore    UserStorage
+	JWTService   *JWTService
+	Authorizer   *Authorizer
+	Registration *Registration
+	OIDC         *OIDCProvider
+	Identities   IdentityStorage
+	// Authenticators are tried in order by LoginHandler; without any, only
+	// local passwords are checked
+	Authenticators []Authenticator
+	// MFA, if set, asks password logins for a second factor
+	MFA *MFA
+	// Guard, if set, slows down and locks out repeated failed logins
+	Guard *LoginGuard
+	// LoginEvents, if set, records every login attempt
+	LoginEvents LoginEventStorage
+	// TrustedProxies may set X-Forwarded-For
+	TrustedProxies []netip.Prefix
+	// AccountMail, if set, mails password reset and email verification links
+	AccountMail *AccountMail
 }
 
-// RegisterHandler handles user registration
+func (h *Handler) provisioner() *Provisioner {
+	return &Provisioner{Users: h.UserStore, Identities: h.Identities, Authorizer: h.Authorizer}
+}
+
+// RegisterHandler handles self-registration under the registration policy.
+// New users are viewers unless they register with an invitation.
 func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	var req UserCreate
+	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	user, err := h.UserStore.CreateUser(&req)
+	reg := h.Registration
+	if reg.Policy == RegistrationDisabled {
+		http.Error(w, ErrRegistrationDisabled.Error(), http.StatusForbidden)
+		return
+	}
+
+	create := &UserCreate{Username: req.Username, Email: req.Email, Password: req.Password, Role: RoleViewer}
+	if err := ValidateNewUser(create); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var inv *Invitation
+	if req.Invitation != "" {
+		if reg.Invitations == nil {
+			http.Error(w, ErrInvitationInvalid.Error(), http.StatusBadRequest)
+			return
+		}
+		var err error
+		inv, err = reg.Invitations.GetInvitationByToken(req.Invitation)
+		if err == ErrInvitationNotFound || (err == nil && !inv.Usable(time.Now())) {
+			http.Error(w, ErrInvitationInvalid.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to look up invitation", http.StatusInternalServerError)
+			return
+		}
+		if inv.Email != "" && !strings.EqualFold(inv.Email, req.Email) {
+			http.Error(w, "invitation is for a different email address", http.StatusForbidden)
+			return
+		}
+		create.Role = inv.Role
+	} else if reg.Policy == RegistrationInvite {
+		http.Error(w, ErrInvitationRequired.Error(), http.StatusForbidden)
+		return
+	}
+	// An invitation for a specific address overrides the domain allowlist
+	if (inv == nil || inv.Email == "") && !reg.DomainAllowed(req.Email) {
+		http.Error(w, ErrDomainNotAllowed.Error(), http.StatusForbidden)
+		return
+	}
+
+	user, err := h.UserStore.CreateUser(create)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if inv != nil {
+		if err := reg.Invitations.RedeemInvitation(inv.ID, user.ID, time.Now()); err != nil {
+			// Another registration used the invitation first
+			h.UserStore.DeleteUser(user.ID)
+			http.Error(w, ErrInvitationInvalid.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	h.SendVerification(user)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// SetupStatusHandler reports whether the first admin still has to be created
+func (h *Handler) SetupStatusHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"setup_required": h.Registration.SetupPending(),
+		"registration":   h.Registration.Policy,
+	})
+}
+
+// SetupHandler creates the first admin with the one-time setup token
+func (h *Handler) SetupHandler(w http.ResponseWriter, r *http.Request) {
+	var req SetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	create := &UserCreate{Username: req.Username, Email: req.Email, Password: req.Password, Role: RoleAdmin}
+	if err := ValidateNewUser(create); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := h.Registration.CompleteSetup(h.UserStore, req.Token, create)
+	switch err {
+	case nil:
+	case ErrSetupComplete:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case ErrInvalidSetupToken:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
 }
@@ -36,15 +151,84 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	user, err := h.UserStore.GetUserByUsername(req.Username)
-	if err != nil || !user.IsActive {
+	// Blocked logins are refused before the password is checked, so guessing
+	// costs the attacker time rather than the server CPU. The attempt is
+	// reserved while it is checked, so parallel guesses wait their turn.
+	ip := ClientIP(r, h.TrustedProxies)
+	release := func() {}
+	if h.Guard != nil {
+		throttle, err := h.Guard.Reserve(req.Username, ip)
+		if err != nil {
+			http.Error(w, "Failed to check login attempts", http.StatusInternalServerError)
+			return
+		}
+		if throttle != nil {
+			outcome := LoginThrottled
+			if throttle.Locked {
+				outcome = LoginLockedOut
+			}
+			h.recordLogin(r, "password", req.Username, nil, outcome)
+			throttled(w, throttle)
+			return
+		}
+		release = func() {
+			if err := h.Guard.Release(req.Username, ip); err != nil {
+				log.Printf("Failed to release login attempt of %q: %v", req.Username, err)
+			}
+		}
+	}
+
+	user, err := h.authenticate(r.Context(), req.Username, req.Password)
+	switch err {
+	case nil:
+	case ErrNoRole:
+		release()
+		h.recordLogin(r, "password", req.Username, nil, LoginNoRole)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case ErrUserDisabled:
+		release()
+		h.recordLogin(r, "password", req.Username, nil, LoginDisabled)
 		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
-	}
-	if err := CheckPassword(req.Password, user.PasswordHash); err != nil {
+	default:
+		h.recordLogin(r, "password", req.Username, nil, LoginInvalidCredentials)
+		if h.Guard != nil {
+			if err := h.Guard.Fail(req.Username, ip); err != nil {
+				log.Printf("Failed to record failed login of %q: %v", req.Username, err)
+			}
+		}
 		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
+	release()
+	if h.Guard != nil {
+		if err := h.Guard.Succeed(req.Username); err != nil {
+			log.Printf("Failed to reset failed logins of %q: %v", req.Username, err)
+		}
+	}
+	if h.MFA != nil {
+		purpose, err := h.MFA.loginStep(user)
+		if err != nil {
+			http.Error(w, "Failed to check two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+		if purpose != "" {
+			token, claims, err := h.JWTService.GenerateScopedToken(user, purpose, mfaTokenTTL)
+			if err != nil {
+				http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+				return
+			}
+			method := "totp"
+			if purpose == mfaPurposeEnroll {
+				method = "enroll"
+			}
+			h.recordLogin(r, "password", req.Username, user, LoginMFARequired)
+			json.NewEncoder(w).Encode(MFAChallenge{MFARequired: method, MFAToken: token, ExpiresAt: claims.ExpiresAt.Unix()})
+			return
+		}
+	}
+	h.recordLogin(r, "password", req.Username, user, LoginSuccess)
 	h.UserStore.UpdateLastLogin(user.ID)
 	token, expiresAt, err := h.JWTService.GenerateToken(user)
 	if err != nil {
@@ -59,6 +243,56 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// CreateUserHandler creates a user with a role the caller's role covers (admin only)
+func (h *Handler) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req UserCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = RoleViewer
+	}
+	if err := ValidateNewUser(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.roleExists(w, req.Role) || !h.mayAssign(w, r, req.Role) {
+		return
+	}
+	user, err := h.UserStore.CreateUser(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// authenticate tries each authenticator until one accepts the password.
+// A source that fails, such as an unreachable directory, is skipped so that
+// local break-glass accounts keep working.
+func (h *Handler) authenticate(ctx context.Context, username, password string) (*User, error) {
+	authenticators := h.Authenticators
+	if len(authenticators) == 0 {
+		authenticators = []Authenticator{&LocalAuthenticator{Users: h.UserStore}}
+	}
+	for _, a := range authenticators {
+		user, err := a.Authenticate(ctx, username, password)
+		switch err {
+		case nil:
+			return user, nil
+		case ErrInvalidCredentials:
+			continue
+		case ErrNoRole, ErrUserDisabled:
+			return nil, err
+		default:
+			log.Printf("%s authentication failed for %q: %v", a.Name(), username, err)
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
 // ListUsersHandler returns all users (admin only)
 func (h *Handler) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
 	users, err := h.UserStore.ListUsers()
@@ -77,17 +311,29 @@ func (h *Handler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if !h.mayManage(w, r, id) {
+		return
+	}
+	if req.Role != nil && (!h.roleExists(w, *req.Role) || !h.mayAssign(w, r, *req.Role)) {
+		return
+	}
 	user, err := h.UserStore.UpdateUser(id, &req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.Email != nil {
+		h.SendVerification(user)
+	}
 	json.NewEncoder(w).Encode(user)
 }
 
 // DeleteUserHandler deletes a user (admin only)
 func (h *Handler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimPrefix(r.URL.Path, "/api/auth/users/")
+	if !h.mayManage(w, r, id) {
+		return
+	}
 	if err := h.UserStore.DeleteUser(id); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -95,6 +341,221 @@ func (h *Handler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ListRolesHandler returns the built-in and custom roles (admin only)
+func (h *Handler) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	custom, err := h.Authorizer.Roles.ListRoles()
+	if err != nil {
+		http.Error(w, "Failed to list roles", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(append(BuiltinRoles(), custom...))
+}
+
+// CreateRoleHandler defines a custom role (admin only)
+func (h *Handler) CreateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var role CustomRole
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := role.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.mayGrant(w, r, role.Permissions) {
+		return
+	}
+	if _, err := h.Authorizer.Roles.GetRole(role.Name); err == nil {
+		http.Error(w, "role already exists", http.StatusConflict)
+		return
+	}
+	saved, err := h.Authorizer.Roles.SaveRole(&role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved)
+}
+
+// UpdateRoleHandler replaces the description and permissions of a custom role (admin only)
+func (h *Handler) UpdateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := Role(strings.TrimPrefix(r.URL.Path, "/api/auth/roles/"))
+	if IsBuiltinRole(name) {
+		http.Error(w, ErrRoleBuiltin.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := h.Authorizer.Roles.GetRole(name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !h.mayAssign(w, r, name) {
+		return
+	}
+	var role CustomRole
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	role.Name = name
+	if err := role.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.mayGrant(w, r, role.Permissions) {
+		return
+	}
+	saved, err := h.Authorizer.Roles.SaveRole(&role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(saved)
+}
+
+// DeleteRoleHandler deletes a custom role that no user has (admin only)
+func (h *Handler) DeleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := Role(strings.TrimPrefix(r.URL.Path, "/api/auth/roles/"))
+	if IsBuiltinRole(name) {
+		http.Error(w, ErrRoleBuiltin.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.mayAssign(w, r, name) {
+		return
+	}
+	users, err := h.UserStore.ListUsers()
+	if err != nil {
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+	for _, user := range users {
+		if user.Role == name {
+			http.Error(w, ErrRoleInUse.Error(), http.StatusConflict)
+			return
+		}
+	}
+	if err := h.Authorizer.Roles.DeleteRole(name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListInvitationsHandler returns all invitations (admin only)
+func (h *Handler) ListInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.Registration.Invitations.ListInvitations()
+	if err != nil {
+		http.Error(w, "Failed to list invitations", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// CreateInvitationHandler issues an invitation token (admin only). The token
+// is only returned in this response.
+func (h *Handler) CreateInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var req InvitationCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = RoleViewer
+	}
+	if !h.roleExists(w, req.Role) || !h.mayAssign(w, r, req.Role) {
+		return
+	}
+	expiresIn := 72 * time.Hour
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			http.Error(w, "expires_in must be a positive duration such as 72h", http.StatusBadRequest)
+			return
+		}
+		expiresIn = d
+	}
+
+	now := time.Now()
+	inv := &Invitation{Email: req.Email, Role: req.Role, CreatedAt: now, ExpiresAt: now.Add(expiresIn)}
+	if claims := GetUserFromContext(r.Context()); claims != nil {
+		inv.CreatedBy = claims.Username
+	}
+	if err := h.Registration.Invitations.CreateInvitation(inv); err != nil {
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inv)
+}
+
+// DeleteInvitationHandler revokes an invitation (admin only)
+func (h *Handler) DeleteInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/auth/invitations/")
+	if err := h.Registration.Invitations.DeleteInvitation(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// roleExists writes a 400 if role is neither built in nor defined
+func (h *Handler) roleExists(w http.ResponseWriter, role Role) bool {
+	exists, err := h.Authorizer.RoleExists(role)
+	if err != nil {
+		http.Error(w, "Failed to look up role", http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		http.Error(w, ErrRoleNotFound.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// callerRole is the role of the signed-in user, or the anonymous role
+func (h *Handler) callerRole(r *http.Request) Role {
+	if claims := GetUserFromContext(r.Context()); claims != nil {
+		return claims.Role
+	}
+	return h.Authorizer.AnonymousRole
+}
+
+// mayGrant writes a 403 unless the caller's role grants every one of perms,
+// so that holding users:admin never leads to more than the caller has
+func (h *Handler) mayGrant(w http.ResponseWriter, r *http.Request, perms []Permission) bool {
+	ok, err := h.Authorizer.GrantsAll(h.callerRole(r), perms)
+	if err != nil {
+		http.Error(w, "Failed to look up role", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		http.Error(w, ErrRoleOutranks.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// mayAssign writes a 403 unless the caller's role covers role
+func (h *Handler) mayAssign(w http.ResponseWriter, r *http.Request, role Role) bool {
+	perms, err := h.Authorizer.Permissions(role)
+	if err != nil {
+		http.Error(w, "Failed to look up role", http.StatusInternalServerError)
+		return false
+	}
+	return h.mayGrant(w, r, perms)
+}
+
+// mayManage writes a 404 for an unknown user, and a 403 unless the caller's
+// role covers the user's
+func (h *Handler) mayManage(w http.ResponseWriter, r *http.Request, id string) bool {
+	user, err := h.UserStore.GetUserByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return false
+	}
+	return h.mayAssign(w, r, user.Role)
+}
+
 // CheckPassword compares a plaintext password with a hash
 func CheckPassword(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"Golem/internal/storage/migrations"
+)
+
+var ErrIdentityNotFound = errors.New("identity not linked")
+
+// IdentityStorage links users to accounts at external identity providers
+type IdentityStorage interface {
+	GetIdentityUser(provider, subject string) (string, error)
+	LinkIdentity(provider, subject, userID string) error
+	UnlinkIdentity(provider, subject string) error
+	// HasIdentity reports whether a user is linked to any provider
+	HasIdentity(userID string) (bool, error)
+}
+
+// SQLiteIdentityStorage implements IdentityStorage using SQLite
+type SQLiteIdentityStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteIdentityStorage creates a new SQLiteIdentityStorage instance
+func NewSQLiteIdentityStorage(db *sql.DB) (*SQLiteIdentityStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteIdentityStorage{db: db}, nil
+}
+
+// GetIdentityUser returns the ID of the user linked to subject at provider
+func (s *SQLiteIdentityStorage) GetIdentityUser(provider, subject string) (string, error) {
+	var userID string
+	err := s.db.QueryRow("SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?", provider, subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrIdentityNotFound
+	}
+	return userID, err
+}
+
+// LinkIdentity links subject at provider to a user
+func (s *SQLiteIdentityStorage) LinkIdentity(provider, subject, userID string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_identities (provider, subject, user_id, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (provider, subject) DO UPDATE SET user_id = excluded.user_id
+	`, provider, subject, userID, time.Now())
+	return err
+}
+
+// UnlinkIdentity removes a link
+func (s *SQLiteIdentityStorage) UnlinkIdentity(provider, subject string) error {
+	_, err := s.db.Exec("DELETE FROM user_identities WHERE provider = ? AND subject = ?", provider, subject)
+	return err
+}
+
+// HasIdentity reports whether a user is linked to any provider
+func (s *SQLiteIdentityStorage) HasIdentity(userID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM user_identities WHERE user_id = ?)", userID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"Golem/internal/storage/migrations"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationInvalid  = errors.New("invitation is invalid, expired or already used")
+)
+
+// Invitation lets one person register with a preset role
+type Invitation struct {
+	ID        string     `json:"id"`
+	Email     string     `json:"email,omitempty"`
+	Role      Role       `json:"role"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    string     `json:"used_by,omitempty"`
+
+	// Token is only set when the invitation is created
+	Token string `json:"token,omitempty"`
+}
+
+// InvitationCreate represents the data needed to create an invitation
+type InvitationCreate struct {
+	Email     string `json:"email,omitempty"`
+	Role      Role   `json:"role"`
+	ExpiresIn string `json:"expires_in,omitempty"`
+}
+
+// Usable reports whether the invitation can still be redeemed at now
+func (i *Invitation) Usable(now time.Time) bool {
+	return i.UsedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// InvitationStorage defines the interface for invitation storage
+type InvitationStorage interface {
+	CreateInvitation(inv *Invitation) error
+	GetInvitationByToken(token string) (*Invitation, error)
+	RedeemInvitation(id, userID string, now time.Time) error
+	ListInvitations() ([]*Invitation, error)
+	DeleteInvitation(id string) error
+}
+
+// SQLiteInvitationStorage implements InvitationStorage using SQLite
+type SQLiteInvitationStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteInvitationStorage creates a new SQLiteInvitationStorage instance
+func NewSQLiteInvitationStorage(db *sql.DB) (*SQLiteInvitationStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteInvitationStorage{db: db}, nil
+}
+
+// NewToken returns a random URL-safe token
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateInvitation stores inv, generating its ID and token
+func (s *SQLiteInvitationStorage) CreateInvitation(inv *Invitation) error {
+	token, err := NewToken()
+	if err != nil {
+		return err
+	}
+	inv.ID = uuid.New().String()
+	inv.Token = token
+	// Times are stored in UTC so that expires_at compares correctly as text
+	inv.CreatedAt = inv.CreatedAt.UTC()
+	inv.ExpiresAt = inv.ExpiresAt.UTC()
+
+	_, err = s.db.Exec(`
+		INSERT INTO invitations (id, token_hash, email, role, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, inv.ID, hashToken(token), inv.Email, inv.Role, inv.CreatedBy, inv.CreatedAt, inv.ExpiresAt)
+	return err
+}
+
+// GetInvitationByToken retrieves an invitation by its token
+func (s *SQLiteInvitationStorage) GetInvitationByToken(token string) (*Invitation, error) {
+	inv, err := scanInvitation(s.db.QueryRow(`
+		SELECT id, email, role, created_by, created_at, expires_at, used_at, used_by
+		FROM invitations WHERE token_hash = ?
+	`, hashToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvitationNotFound
+	}
+	return inv, err
+}
+
+// RedeemInvitation marks an unused, unexpired invitation as used by userID
+func (s *SQLiteInvitationStorage) RedeemInvitation(id, userID string, now time.Time) error {
+	now = now.UTC()
+	result, err := s.db.Exec(`
+		UPDATE invitations SET used_at = ?, used_by = ?
+		WHERE id = ? AND used_at IS NULL AND expires_at > ?
+	`, now, userID, id, now)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrInvitationInvalid
+	}
+	return nil
+}
+
+// ListInvitations returns all invitations, newest first
+func (s *SQLiteInvitationStorage) ListInvitations() ([]*Invitation, error) {
+	rows, err := s.db.Query(`
+		SELECT id, email, role, created_by, created_at, expires_at, used_at, used_by
+		FROM invitations ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// DeleteInvitation revokes an invitation
+func (s *SQLiteInvitationStorage) DeleteInvitation(id string) error {
+	result, err := s.db.Exec("DELETE FROM invitations WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+func scanInvitation(row rowScanner) (*Invitation, error) {
+	inv := &Invitation{}
+	var usedAt sql.NullTime
+	err := row.Scan(&inv.ID, &inv.Email, &inv.Role, &inv.CreatedBy, &inv.CreatedAt, &inv.ExpiresAt, &usedAt, &inv.UsedBy)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		inv.UsedAt = &usedAt.Time
+	}
+	return inv, nil
+}
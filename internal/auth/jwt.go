@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var (
@@ -20,23 +21,57 @@ type Claims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
 	Role     Role   `json:"role"`
+	// Purpose is empty for session tokens. Tokens for a step of the login,
+	// like entering an MFA code, cannot be used as sessions.
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // JWTService handles JWT token operations
 type JWTService struct {
-	secretKey     []byte
+	keys          *KeyRing
 	tokenDuration time.Duration
+	// Issuer, if set, is the iss claim of new tokens and required of
+	// validated ones
+	Issuer string
 }
 
-// NewJWTService creates a new JWTService instance
+// NewJWTService creates a JWTService signing with a fixed HS256 secret
 func NewJWTService(secretKey string, tokenDuration time.Duration) *JWTService {
 	return &JWTService{
-		secretKey:     []byte(secretKey),
+		keys:          staticKeyRing([]byte(secretKey)),
 		tokenDuration: tokenDuration,
 	}
 }
 
+// NewJWTServiceWithKeys creates a JWTService signing with the active key of
+// a loaded key ring
+func NewJWTServiceWithKeys(keys *KeyRing, tokenDuration time.Duration) *JWTService {
+	return &JWTService{
+		keys:          keys,
+		tokenDuration: tokenDuration,
+	}
+}
+
+// Keys returns the key ring that signs and verifies tokens
+func (s *JWTService) Keys() *KeyRing {
+	return s.keys
+}
+
+// sign signs claims with the active key, naming it in the kid header
+func (s *JWTService) sign(claims *Claims) (string, error) {
+	key, err := s.keys.Signing()
+	if err != nil {
+		return "", err
+	}
+	claims.Issuer = s.Issuer
+	token := jwt.NewWithClaims(key.method(), claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.private)
+}
+
 // GenerateToken generates a new JWT token for a user
 func (s *JWTService) GenerateToken(user *User) (string, int64, error) {
 	expiresAt := time.Now().Add(s.tokenDuration)
@@ -51,8 +86,7 @@ func (s *JWTService) GenerateToken(user *User) (string, int64, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
-	tokenString, err := token.SignedString(s.secretKey)
+	tokenString, err := s.sign(&claims)
 	if err != nil {
 		return "", 0, err
 	}
@@ -60,14 +94,48 @@ func (s *JWTService) GenerateToken(user *User) (string, int64, error) {
 	return tokenString, expiresAt.Unix(), nil
 }
 
-// ValidateToken validates a JWT token and returns the claims
+// GenerateScopedToken generates a short-lived token that is only accepted by
+// ValidateScopedToken with the same purpose
+func (s *JWTService) GenerateScopedToken(user *User, purpose string, ttl time.Duration) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Purpose:  purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	tokenString, err := s.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, claims, nil
+}
+
+// ValidateToken validates a session token and returns the claims
 func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
+	return s.ValidateScopedToken(tokenString, "")
+}
+
+// ValidateScopedToken validates a token issued for purpose
+func (s *JWTService) ValidateScopedToken(tokenString, purpose string) (*Claims, error) {
+	var opts []jwt.ParserOption
+	if s.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.Issuer))
+	}
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys.Verifying(kid)
+		// The key decides the algorithm, never the token
+		if !ok || token.Method.Alg() != key.Algorithm {
 			return nil, ErrInvalidToken
 		}
-		return s.secretKey, nil
-	})
+		return key.verifyKey(), nil
+	}, opts...)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -77,7 +145,7 @@ func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	}
 
 	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims.Purpose != purpose {
 		return nil, ErrInvalidToken
 	}
 
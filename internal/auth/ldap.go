@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig configures authentication against an LDAP or Active Directory server
+type LDAPConfig struct {
+	// URL is ldap://host:389 or ldaps://host:636
+	URL      string
+	StartTLS bool
+	// CAFile verifies the server certificate; the system roots are used
+	// when it is empty
+	CAFile             string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+
+	// BindDN and BindPassword are the service account that searches for
+	// users; leave empty to search anonymously
+	BindDN       string
+	BindPassword string
+
+	BaseDN string
+	// UserFilter finds the user; {username} is replaced with the escaped
+	// login name
+	UserFilter        string
+	UsernameAttribute string
+	EmailAttribute    string
+	// GroupAttribute lists the user's groups on the user entry, like memberOf
+	GroupAttribute string
+	// GroupBaseDN, if set, also searches for groups with GroupFilter, where
+	// {dn} is the user's DN and {username} the login name
+	GroupBaseDN string
+	GroupFilter string
+
+	// RoleMapping matches groups by DN or by CN
+	RoleMapping []GroupRole
+	DefaultRole Role
+}
+
+// LDAPAuthenticator checks passwords by binding as the user
+type LDAPAuthenticator struct {
+	config      LDAPConfig
+	tlsConfig   *tls.Config
+	provisioner *Provisioner
+}
+
+// NewLDAPAuthenticator creates an authenticator that provisions users with p
+func NewLDAPAuthenticator(config LDAPConfig, p *Provisioner) (*LDAPAuthenticator, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("LDAP URL must be ldap://host:port or ldaps://host:port")
+	}
+	if config.BaseDN == "" {
+		return nil, fmt.Errorf("LDAP base DN is required")
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(&(objectClass=person)(uid={username}))"
+	}
+	if config.UsernameAttribute == "" {
+		config.UsernameAttribute = "uid"
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.GroupFilter == "" {
+		config.GroupFilter = "(|(member={dn})(uniqueMember={dn})(memberUid={username}))"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in LDAP CA file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &LDAPAuthenticator{config: config, tlsConfig: tlsConfig, provisioner: p}, nil
+}
+
+// Name identifies the authenticator in logs
+func (a *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+// Authenticate finds the user with the service account, binds as them to
+// check the password, maps their groups to a role and provisions a local user
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	// An empty password would be an unauthenticated bind, which many
+	// servers accept without checking anything
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := a.bindService(conn); err != nil {
+		return nil, err
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.config.Timeout.Seconds()), false,
+		strings.ReplaceAll(a.config.UserFilter, "{username}", ldap.EscapeFilter(username)),
+		[]string{a.config.UsernameAttribute, a.config.EmailAttribute, a.config.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for user: %v", err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+	default:
+		return nil, fmt.Errorf("more than one entry matches %q", username)
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind as user: %v", err)
+	}
+
+	groups := entry.GetAttributeValues(a.config.GroupAttribute)
+	if a.config.GroupBaseDN != "" {
+		// Search for groups as the service account, which may see more
+		if err := a.bindService(conn); err != nil {
+			return nil, err
+		}
+		filter := strings.NewReplacer("{dn}", ldap.EscapeFilter(entry.DN), "{username}", ldap.EscapeFilter(username)).Replace(a.config.GroupFilter)
+		result, err := conn.Search(ldap.NewSearchRequest(
+			a.config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(a.config.Timeout.Seconds()), false,
+			filter, []string{"cn"}, nil,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("failed to search for groups: %v", err)
+		}
+		for _, group := range result.Entries {
+			groups = append(groups, group.DN)
+		}
+	}
+
+	role, ok := MapRole(a.config.RoleMapping, a.config.DefaultRole, groupNames(groups))
+	if !ok {
+		return nil, ErrNoRole
+	}
+	identity := &ExternalIdentity{
+		Subject:  strings.ToLower(entry.DN),
+		Username: entry.GetAttributeValue(a.config.UsernameAttribute),
+		Email:    entry.GetAttributeValue(a.config.EmailAttribute),
+		Groups:   groups,
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	return a.provisioner.Provision("ldap", identity, role)
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: a.config.Timeout}
+	conn, err := ldap.DialURL(a.config.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(a.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %v", err)
+	}
+	conn.SetTimeout(a.config.Timeout)
+	if a.config.StartTLS {
+		if err := conn.StartTLS(a.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) bindService(conn *ldap.Conn) error {
+	if a.config.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+		return fmt.Errorf("failed to bind as %s: %v", a.config.BindDN, err)
+	}
+	return nil
+}
+
+// groupNames returns each group DN and its CN, so mappings can use either
+func groupNames(groups []string) []string {
+	names := make([]string, 0, 2*len(groups))
+	for _, group := range groups {
+		names = append(names, group)
+		dn, err := ldap.ParseDN(group)
+		if err != nil || len(dn.RDNs) == 0 {
+			continue
+		}
+		for _, attr := range dn.RDNs[0].Attributes {
+			if strings.EqualFold(attr.Type, "cn") {
+				names = append(names, attr.Value)
+			}
+		}
+	}
+	return names
+}
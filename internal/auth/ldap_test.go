@@ -0,0 +1,207 @@
+package auth_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"Golem/internal/auth"
+	"Golem/internal/auth/ldaptest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const baseDN = "dc=example,dc=com"
+
+// newDirectory serves a directory with a service account and these users:
+// alice in golem-admins through memberOf, carol in golem-users only as a
+// member of the group entry, and bob in no group
+func newDirectory(t *testing.T) string {
+	t.Helper()
+	dir := &ldaptest.Server{Entries: []ldaptest.Entry{
+		{
+			DN:         "cn=golem," + baseDN,
+			Password:   "golem",
+			Attributes: map[string][]string{"objectClass": {"applicationProcess"}, "cn": {"golem"}},
+		},
+		{
+			DN:       "uid=alice,ou=people," + baseDN,
+			Password: "alice-secret",
+			Attributes: map[string][]string{
+				"objectClass": {"person", "inetOrgPerson"},
+				"uid":         {"alice"},
+				"mail":        {"alice@example.com"},
+				"memberOf":    {"cn=golem-admins,ou=groups," + baseDN},
+			},
+		},
+		{
+			DN:         "uid=bob,ou=people," + baseDN,
+			Password:   "bob-secret",
+			Attributes: map[string][]string{"objectClass": {"person"}, "uid": {"bob"}},
+		},
+		{
+			DN:         "uid=carol,ou=people," + baseDN,
+			Password:   "carol-secret",
+			Attributes: map[string][]string{"objectClass": {"person"}, "uid": {"carol"}},
+		},
+		{
+			DN: "cn=golem-admins,ou=groups," + baseDN,
+			Attributes: map[string][]string{
+				"objectClass": {"groupOfNames"},
+				"cn":          {"golem-admins"},
+				"member":      {"uid=alice,ou=people," + baseDN},
+			},
+		},
+		{
+			DN: "cn=golem-users,ou=groups," + baseDN,
+			Attributes: map[string][]string{
+				"objectClass": {"groupOfNames"},
+				"cn":          {"golem-users"},
+				"member":      {"uid=carol,ou=people," + baseDN},
+			},
+		},
+	}}
+	addr, err := dir.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dir.Close() })
+	return "ldap://" + addr
+}
+
+func newProvisioner(t *testing.T) *auth.Provisioner {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "golem.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	users, err := auth.NewSQLiteUserStorage(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, err := auth.NewSQLiteIdentityStorage(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &auth.Provisioner{Users: users, Identities: identities}
+}
+
+func newLDAPAuthenticator(t *testing.T, config auth.LDAPConfig) *auth.LDAPAuthenticator {
+	t.Helper()
+	config.URL = newDirectory(t)
+	config.BaseDN = baseDN
+	config.BindDN = "cn=golem," + baseDN
+	config.BindPassword = "golem"
+	a, err := auth.NewLDAPAuthenticator(config, newProvisioner(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	a := newLDAPAuthenticator(t, auth.LDAPConfig{
+		RoleMapping: []auth.GroupRole{{Group: "golem-admins", Role: auth.RoleAdmin}},
+		DefaultRole: auth.RoleViewer,
+	})
+
+	user, err := a.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.com" || user.Role != auth.RoleAdmin {
+		t.Errorf("got %s <%s> with role %s, want alice <alice@example.com> with admin", user.Username, user.Email, user.Role)
+	}
+
+	again, err := a.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second login is user %s, want %s", again.ID, user.ID)
+	}
+
+	bob, err := a.Authenticate(context.Background(), "bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Role != auth.RoleViewer {
+		t.Errorf("bob has role %s, want the default %s", bob.Role, auth.RoleViewer)
+	}
+}
+
+func TestLDAPAuthenticateRefuses(t *testing.T) {
+	a := newLDAPAuthenticator(t, auth.LDAPConfig{
+		RoleMapping: []auth.GroupRole{{Group: "golem-admins", Role: auth.RoleAdmin}},
+	})
+
+	tests := []struct {
+		username, password string
+		want               error
+	}{
+		{"alice", "wrong", auth.ErrInvalidCredentials},
+		{"alice", "", auth.ErrInvalidCredentials},
+		{"nobody", "alice-secret", auth.ErrInvalidCredentials},
+		// Filter syntax in the name must not match other entries
+		{"*", "alice-secret", auth.ErrInvalidCredentials},
+		{"al*", "alice-secret", auth.ErrInvalidCredentials},
+		{"bob", "bob-secret", auth.ErrNoRole},
+	}
+	for _, tt := range tests {
+		if _, err := a.Authenticate(context.Background(), tt.username, tt.password); err != tt.want {
+			t.Errorf("%s/%s: got %v, want %v", tt.username, tt.password, err, tt.want)
+		}
+	}
+}
+
+func TestLDAPGroupSearch(t *testing.T) {
+	a := newLDAPAuthenticator(t, auth.LDAPConfig{
+		GroupBaseDN: "ou=groups," + baseDN,
+		// Mapping by DN as well as by CN
+		RoleMapping: []auth.GroupRole{
+			{Group: "golem-admins", Role: auth.RoleAdmin},
+			{Group: "cn=golem-users,ou=groups," + baseDN, Role: auth.RoleUser},
+		},
+	})
+
+	for username, want := range map[string]auth.Role{"alice": auth.RoleAdmin, "carol": auth.RoleUser} {
+		user, err := a.Authenticate(context.Background(), username, username+"-secret")
+		if err != nil {
+			t.Errorf("%s: %v", username, err)
+			continue
+		}
+		if user.Role != want {
+			t.Errorf("%s has role %s, want %s", username, user.Role, want)
+		}
+	}
+}
+
+func TestLDAPRoleFollowsGroups(t *testing.T) {
+	url := newDirectory(t)
+	p := newProvisioner(t)
+	login := func(mapping []auth.GroupRole) *auth.User {
+		t.Helper()
+		a, err := auth.NewLDAPAuthenticator(auth.LDAPConfig{
+			URL: url, BaseDN: baseDN, BindDN: "cn=golem," + baseDN, BindPassword: "golem",
+			RoleMapping: mapping, DefaultRole: auth.RoleViewer,
+		}, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := a.Authenticate(context.Background(), "alice", "alice-secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+
+	if user := login([]auth.GroupRole{{Group: "golem-admins", Role: auth.RoleAdmin}}); user.Role != auth.RoleAdmin {
+		t.Fatalf("got role %s, want admin", user.Role)
+	}
+	// Taking the group out of the mapping demotes the user at the next login
+	if user := login(nil); user.Role != auth.RoleViewer {
+		t.Errorf("got role %s, want viewer", user.Role)
+	}
+}
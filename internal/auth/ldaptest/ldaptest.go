@@ -0,0 +1,361 @@
+// Package ldaptest implements a minimal in-process LDAP server for trying
+// out and testing Golem's LDAP authentication without a real directory.
+//
+// It supports simple bind, search with and, or, not, equality, presence and
+// substring filters, and StartTLS when TLSConfig is set. Typical use from a
+// test:
+//
+//	dir := &ldaptest.Server{Entries: []ldaptest.Entry{{
+//		DN:       "uid=alice,ou=people,dc=example,dc=com",
+//		Password: "secret",
+//		Attributes: map[string][]string{"objectClass": {"person"}, "uid": {"alice"}},
+//	}}}
+//	addr, _ := dir.Listen("127.0.0.1:0")
+//	defer dir.Close()
+package ldaptest
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Entry is a directory entry. Password, if set, lets clients bind as DN.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is the LDAP server
+type Server struct {
+	Entries []Entry
+	// TLSConfig enables the StartTLS extended operation
+	TLSConfig *tls.Config
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+}
+
+const (
+	resultSuccess             = 0
+	resultProtocolError       = 2
+	resultNoSuchObject        = 32
+	resultInvalidCredentials  = 49
+	resultUnwillingToPerform  = 53
+	startTLSOID               = "1.3.6.1.4.1.1466.20037"
+	scopeBaseObject           = 0
+	scopeSingleLevel          = 1
+	filterAnd                 = 0
+	filterOr                  = 1
+	filterNot                 = 2
+	filterEqualityMatch       = 3
+	filterSubstrings          = 4
+	filterPresent             = 7
+	substringInitial          = 0
+	substringAny              = 1
+	substringFinal            = 2
+	contextSimpleAuthenticate = 0
+)
+
+// Listen starts serving on addr and returns the address it listens on
+func (s *Server) Listen(addr string) (string, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.listener = l
+	s.conns = map[net.Conn]struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return l.Addr().String(), nil
+}
+
+// Close stops the server and closes open connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			conn.Write(response(id, ldap.ApplicationBindResponse, s.bind(op)).Bytes())
+		case ldap.ApplicationSearchRequest:
+			for _, entry := range s.search(id, op) {
+				conn.Write(entry.Bytes())
+			}
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationAbandonRequest:
+		case ldap.ApplicationExtendedRequest:
+			if len(op.Children) == 0 || str(op.Children[0]) != startTLSOID || s.TLSConfig == nil {
+				conn.Write(response(id, ldap.ApplicationExtendedResponse, resultProtocolError).Bytes())
+				continue
+			}
+			resp := response(id, ldap.ApplicationExtendedResponse, resultSuccess)
+			resp.Children[1].AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 10, startTLSOID, "responseName"))
+			conn.Write(resp.Bytes())
+
+			tlsConn := tls.Server(conn, s.TLSConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.conns[tlsConn] = struct{}{}
+			s.mu.Unlock()
+			conn = tlsConn
+		default:
+			// Other operations are not supported; the server is read-only
+			conn.Write(response(id, op.Tag+1, resultUnwillingToPerform).Bytes())
+		}
+	}
+}
+
+// response builds an LDAPResult message
+func response(id int64, tag ber.Tag, code int) *ber.Packet {
+	packet := ber.NewSequence("LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	packet.AppendChild(result)
+	return packet
+}
+
+func str(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	return p.Data.String()
+}
+
+func (s *Server) bind(op *ber.Packet) int {
+	if len(op.Children) < 3 || op.Children[2].Tag != contextSimpleAuthenticate {
+		return resultProtocolError
+	}
+	name, password := str(op.Children[1]), str(op.Children[2])
+	if name == "" && password == "" {
+		return resultSuccess
+	}
+	entry := s.find(name)
+	if entry == nil || entry.Password == "" || entry.Password != password {
+		return resultInvalidCredentials
+	}
+	return resultSuccess
+}
+
+func (s *Server) find(dn string) *Entry {
+	want, err := ldap.ParseDN(dn)
+	if err != nil {
+		return nil
+	}
+	for i := range s.Entries {
+		if got, err := ldap.ParseDN(s.Entries[i].DN); err == nil && got.EqualFold(want) {
+			return &s.Entries[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) search(id int64, op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{response(id, ldap.ApplicationSearchResultDone, resultProtocolError)}
+	}
+	base, err := ldap.ParseDN(str(op.Children[0]))
+	if err != nil {
+		return []*ber.Packet{response(id, ldap.ApplicationSearchResultDone, resultNoSuchObject)}
+	}
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var attrs []string
+	for _, attr := range op.Children[7].Children {
+		attrs = append(attrs, str(attr))
+	}
+
+	var packets []*ber.Packet
+	for _, entry := range s.Entries {
+		dn, err := ldap.ParseDN(entry.DN)
+		if err != nil {
+			continue
+		}
+		switch scope {
+		case scopeBaseObject:
+			if !dn.EqualFold(base) {
+				continue
+			}
+		case scopeSingleLevel:
+			if !base.AncestorOfFold(dn) || len(dn.RDNs) != len(base.RDNs)+1 {
+				continue
+			}
+		default:
+			if !dn.EqualFold(base) && !base.AncestorOfFold(dn) {
+				continue
+			}
+		}
+		if !matches(entry, filter) {
+			continue
+		}
+		packets = append(packets, searchEntry(id, entry, attrs))
+	}
+	return append(packets, response(id, ldap.ApplicationSearchResultDone, resultSuccess))
+}
+
+func searchEntry(id int64, entry Entry, attrs []string) *ber.Packet {
+	packet := ber.NewSequence("LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "objectName"))
+	list := ber.NewSequence("attributes")
+	for name, values := range entry.Attributes {
+		if !wanted(name, attrs) {
+			continue
+		}
+		attr := ber.NewSequence("attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	result.AppendChild(list)
+	packet.AppendChild(result)
+	return packet
+}
+
+func wanted(name string, attrs []string) bool {
+	if len(attrs) == 0 {
+		return true
+	}
+	for _, attr := range attrs {
+		if attr == "*" || strings.EqualFold(attr, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func values(entry Entry, name string) []string {
+	for attr, values := range entry.Attributes {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func matches(entry Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case filterAnd:
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range filter.Children {
+			if matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return len(filter.Children) == 1 && !matches(entry, filter.Children[0])
+	case filterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		want := str(filter.Children[1])
+		for _, value := range values(entry, str(filter.Children[0])) {
+			if strings.EqualFold(value, want) {
+				return true
+			}
+		}
+		return false
+	case filterPresent:
+		return len(values(entry, filter.Data.String())) > 0
+	case filterSubstrings:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, value := range values(entry, str(filter.Children[0])) {
+			if matchSubstrings(strings.ToLower(value), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func matchSubstrings(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		sub := strings.ToLower(part.Data.String())
+		switch part.Tag {
+		case substringInitial:
+			if !strings.HasPrefix(value, sub) {
+				return false
+			}
+			value = value[len(sub):]
+		case substringAny:
+			i := strings.Index(value, sub)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(sub):]
+		case substringFinal:
+			if !strings.HasSuffix(value, sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
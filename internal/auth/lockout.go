@@ -0,0 +1,395 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"Golem/internal/storage/migrations"
+)
+
+// LockoutPolicy controls how failed logins slow down and lock out a
+// username or client address
+type LockoutPolicy struct {
+	// FreeAttempts failures are allowed before backoff starts
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts. It
+	// doubles with each further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAttempts failures lock logins out for LockoutDuration; zero
+	// disables lockout
+	LockoutAttempts int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+var (
+	// DefaultUserLockout applies to each username
+	DefaultUserLockout = LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAttempts: 10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	// DefaultIPLockout applies to each client address. It is looser than
+	// DefaultUserLockout since many users can share an address.
+	DefaultIPLockout = LockoutPolicy{
+		FreeAttempts:    10,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAttempts: 100,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+)
+
+// delay returns how long to block after the given number of failures
+func (p LockoutPolicy) delay(failures int) (time.Duration, bool) {
+	if p.LockoutAttempts > 0 && failures >= p.LockoutAttempts {
+		return p.LockoutDuration, true
+	}
+	if failures <= p.FreeAttempts {
+		return 0, false
+	}
+	d := float64(p.BaseDelay) * math.Pow(2, float64(failures-p.FreeAttempts-1))
+	if d > float64(p.MaxDelay) {
+		return p.MaxDelay, false
+	}
+	return time.Duration(d), false
+}
+
+// Throttle is the failed login state of a username or client address
+type Throttle struct {
+	Key          string    `json:"key"`
+	Failures     int       `json:"failures"`
+	LastFailure  time.Time `json:"last_failure"`
+	BlockedUntil time.Time `json:"blocked_until"`
+	Locked       bool      `json:"locked"`
+}
+
+// UserThrottleKey is the throttle key of a username
+func UserThrottleKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+// IPThrottleKey is the throttle key of a client address
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginThrottleStorage defines the interface for failed login tracking
+type LoginThrottleStorage interface {
+	// Reserve counts an attempt in progress for key, unless key is blocked,
+	// or another attempt is in progress and the failures so far and in
+	// progress are more than free. It reports whether the attempt was
+	// reserved; it stays reserved until AddFailure or Release, or until
+	// the given time.
+	Reserve(key string, now time.Time, window time.Duration, free int, until time.Time) (bool, error)
+	// Release ends an attempt reserved for key without a failure
+	Release(key string) error
+	// AddFailure counts a failure for key, forgetting failures before
+	// now-window, ends the attempt reserved for it and returns the number
+	// of failures
+	AddFailure(key string, now time.Time, window time.Duration) (int, error)
+	// Block blocks key until the given time, unless it already is for longer
+	Block(key string, until time.Time, locked bool) error
+	GetThrottles(keys ...string) ([]*Throttle, error)
+	// ListThrottles returns the keys blocked after the given time
+	ListThrottles(blockedAfter time.Time) ([]*Throttle, error)
+	ResetThrottle(key string) error
+}
+
+// LoginGuard slows down and locks out repeated failed logins
+type LoginGuard struct {
+	Store LoginThrottleStorage
+	User  LockoutPolicy
+	IP    LockoutPolicy
+}
+
+// attemptTimeout is how long a reserved attempt counts as in progress if
+// it is never released, such as when Golem stops while checking it
+const attemptTimeout = time.Minute
+
+type guardKey struct {
+	key    string
+	policy LockoutPolicy
+}
+
+func (g *LoginGuard) keys(username, ip string) []guardKey {
+	return []guardKey{{UserThrottleKey(username), g.User}, {IPThrottleKey(ip), g.IP}}
+}
+
+// Reserve claims an attempt to log in as username from ip, or returns the
+// throttle blocking it. The block is checked and the attempt counted in one
+// statement, so parallel attempts cannot all get past the backoff before
+// the first of them fails; once past the free attempts, one attempt at a
+// time is checked. A reserved attempt ends with Fail or Release.
+func (g *LoginGuard) Reserve(username, ip string) (*Throttle, error) {
+	now := time.Now().UTC()
+	var reserved []string
+	for _, k := range g.keys(username, ip) {
+		ok, err := g.Store.Reserve(k.key, now, k.policy.Window, k.policy.FreeAttempts, now.Add(attemptTimeout))
+		if err == nil && ok {
+			reserved = append(reserved, k.key)
+			continue
+		}
+		for _, key := range reserved {
+			if err := g.Store.Release(key); err != nil {
+				return nil, err
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return g.blocking(k, now)
+	}
+	return nil, nil
+}
+
+// blocking returns the throttle of a key that refused an attempt
+func (g *LoginGuard) blocking(k guardKey, now time.Time) (*Throttle, error) {
+	throttles, err := g.Store.GetThrottles(k.key)
+	if err != nil {
+		return nil, err
+	}
+	t := &Throttle{Key: k.key}
+	if len(throttles) > 0 {
+		t = throttles[0]
+	}
+	if !t.BlockedUntil.After(now) {
+		// Refused while another attempt is checked, which may fail
+		d, _ := k.policy.delay(t.Failures + 1)
+		t.BlockedUntil = now.Add(max(d, time.Second))
+	}
+	return t, nil
+}
+
+// Fail records that the attempt reserved to log in as username from ip
+// failed
+func (g *LoginGuard) Fail(username, ip string) error {
+	now := time.Now().UTC()
+	for _, k := range g.keys(username, ip) {
+		failures, err := g.Store.AddFailure(k.key, now, k.policy.Window)
+		if err != nil {
+			return err
+		}
+		if d, locked := k.policy.delay(failures); d > 0 {
+			if err := g.Store.Block(k.key, now.Add(d), locked); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Release ends the attempt reserved to log in as username from ip without
+// counting a failure
+func (g *LoginGuard) Release(username, ip string) error {
+	for _, k := range g.keys(username, ip) {
+		if err := g.Store.Release(k.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Succeed forgets failed logins as username. Failures from the address are
+// kept, so one good account does not reset guessing at others.
+func (g *LoginGuard) Succeed(username string) error {
+	return g.Store.ResetThrottle(UserThrottleKey(username))
+}
+
+// SQLiteLoginStorage implements LoginThrottleStorage and LoginEventStorage
+// using SQLite
+type SQLiteLoginStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteLoginStorage creates a new SQLiteLoginStorage instance
+func NewSQLiteLoginStorage(db *sql.DB) (*SQLiteLoginStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteLoginStorage{db: db}, nil
+}
+
+// Reserve checks and counts the attempt in a single statement; when the
+// attempt is refused the upsert changes nothing and returns no row
+func (s *SQLiteLoginStorage) Reserve(key string, now time.Time, window time.Duration, free int, until time.Time) (bool, error) {
+	now = now.UTC()
+	forgetBefore := now.Add(-window)
+	var pending int
+	err := s.db.QueryRow(`
+		INSERT INTO login_throttle (key, failures, last_failure, blocked_until, locked, pending, pending_until)
+		VALUES (?, 0, ?, ?, 0, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			pending = CASE WHEN login_throttle.pending_until < ? THEN 1 ELSE login_throttle.pending + 1 END,
+			pending_until = excluded.pending_until
+		WHERE login_throttle.blocked_until <= ? AND (
+			login_throttle.pending = 0 OR login_throttle.pending_until < ? OR
+			CASE WHEN login_throttle.last_failure < ? THEN 0 ELSE login_throttle.failures END + login_throttle.pending <= ?
+		)
+		RETURNING pending
+	`, key, time.Time{}, time.Time{}, until.UTC(), now, now, now, forgetBefore, free).Scan(&pending)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve login attempt: %v", err)
+	}
+	return true, nil
+}
+
+// Release ends a reserved attempt, and forgets key if nothing else is
+// remembered about it
+func (s *SQLiteLoginStorage) Release(key string) error {
+	if _, err := s.db.Exec("UPDATE login_throttle SET pending = MAX(pending - 1, 0) WHERE key = ?", key); err != nil {
+		return fmt.Errorf("failed to release login attempt: %v", err)
+	}
+	_, err := s.db.Exec("DELETE FROM login_throttle WHERE key = ? AND pending = 0 AND failures = 0", key)
+	return err
+}
+
+// AddFailure counts a failure for key in a single statement, so concurrent
+// attempts are all counted
+func (s *SQLiteLoginStorage) AddFailure(key string, now time.Time, window time.Duration) (int, error) {
+	now = now.UTC()
+	forgetBefore := now.Add(-window)
+	var failures int
+	err := s.db.QueryRow(`
+		INSERT INTO login_throttle (key, failures, last_failure, blocked_until, locked) VALUES (?, 1, ?, ?, 0)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttle.last_failure < ? THEN 1 ELSE login_throttle.failures + 1 END,
+			locked = CASE WHEN login_throttle.last_failure < ? THEN 0 ELSE login_throttle.locked END,
+			last_failure = excluded.last_failure,
+			pending = MAX(login_throttle.pending - 1, 0)
+		RETURNING failures
+	`, key, now, now, forgetBefore, forgetBefore).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %v", err)
+	}
+	return failures, nil
+}
+
+// Block extends the block on key
+func (s *SQLiteLoginStorage) Block(key string, until time.Time, locked bool) error {
+	until = until.UTC()
+	_, err := s.db.Exec(`
+		UPDATE login_throttle SET blocked_until = ?, locked = locked OR ?
+		WHERE key = ? AND blocked_until < ?
+	`, until, locked, key, until)
+	return err
+}
+
+// GetThrottles returns the throttles of the keys that have one
+func (s *SQLiteLoginStorage) GetThrottles(keys ...string) ([]*Throttle, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	return s.queryThrottles(
+		"SELECT key, failures, last_failure, blocked_until, locked FROM login_throttle WHERE key IN (?"+strings.Repeat(", ?", len(keys)-1)+")",
+		args...,
+	)
+}
+
+// ListThrottles returns the keys blocked after the given time, longest first
+func (s *SQLiteLoginStorage) ListThrottles(blockedAfter time.Time) ([]*Throttle, error) {
+	return s.queryThrottles(
+		"SELECT key, failures, last_failure, blocked_until, locked FROM login_throttle WHERE blocked_until > ? ORDER BY blocked_until DESC",
+		blockedAfter.UTC(),
+	)
+}
+
+func (s *SQLiteLoginStorage) queryThrottles(query string, args ...interface{}) ([]*Throttle, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	throttles := []*Throttle{}
+	for rows.Next() {
+		t := &Throttle{}
+		if err := rows.Scan(&t.Key, &t.Failures, &t.LastFailure, &t.BlockedUntil, &t.Locked); err != nil {
+			return nil, err
+		}
+		throttles = append(throttles, t)
+	}
+	return throttles, rows.Err()
+}
+
+// ResetThrottle forgets the failures of key
+func (s *SQLiteLoginStorage) ResetThrottle(key string) error {
+	_, err := s.db.Exec("DELETE FROM login_throttle WHERE key = ?", key)
+	return err
+}
+
+// throttled writes a 429 for a login blocked by t
+func throttled(w http.ResponseWriter, t *Throttle) {
+	wait := time.Until(t.BlockedUntil)
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	msg := "Too many failed logins, try again in %v"
+	if t.Locked {
+		msg = "Logins are locked after too many failures, try again in %v"
+	}
+	http.Error(w, fmt.Sprintf(msg, wait.Round(time.Second)), http.StatusTooManyRequests)
+}
+
+// ListLockoutsHandler returns the usernames and addresses that cannot log
+// in at the moment (admin only)
+func (h *Handler) ListLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	throttles, err := h.Guard.Store.ListThrottles(time.Now())
+	if err != nil {
+		http.Error(w, "Failed to list lockouts", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(throttles)
+}
+
+// DeleteLockoutHandler unblocks a username ("user:<name>") or client
+// address ("ip:<addr>") (admin only)
+func (h *Handler) DeleteLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/api/auth/lockouts/")
+	if !strings.HasPrefix(key, "user:") && !strings.HasPrefix(key, "ip:") {
+		http.Error(w, "lockout key must start with user: or ip:", http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(key, "user:") {
+		key = UserThrottleKey(strings.TrimPrefix(key, "user:"))
+	}
+	if err := h.Guard.Store.ResetThrottle(key); err != nil {
+		http.Error(w, "Failed to remove lockout", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockUserHandler lets a user log in again after failed logins (admin only)
+func (h *Handler) UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/auth/users/"), "/unlock")
+	if !h.mayManage(w, r, id) {
+		return
+	}
+	user, err := h.UserStore.GetUserByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := h.Guard.Succeed(user.Username); err != nil {
+		http.Error(w, "Failed to unlock user", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package auth_test
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"Golem/internal/auth"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newLoginGuard(t *testing.T) *auth.LoginGuard {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "golem.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := auth.NewSQLiteLoginStorage(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &auth.LoginGuard{Store: store, User: auth.DefaultUserLockout, IP: auth.DefaultIPLockout}
+}
+
+func TestLoginGuardParallelAttempts(t *testing.T) {
+	guard := newLoginGuard(t)
+
+	// Every attempt is reserved before any of them fails, as when an
+	// attacker sends a burst of guesses
+	var (
+		mu       sync.Mutex
+		reserved int
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			throttle, err := guard.Reserve("alice", "192.0.2.1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if throttle == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if free := auth.DefaultUserLockout.FreeAttempts; reserved != free+1 {
+		t.Fatalf("%d parallel attempts reserved, want %d", reserved, free+1)
+	}
+
+	for i := 0; i < reserved; i++ {
+		if err := guard.Fail("alice", "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	throttle, err := guard.Reserve("alice", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if throttle == nil || !throttle.BlockedUntil.After(time.Now()) {
+		t.Errorf("attempt after %d failures not blocked: %+v", reserved, throttle)
+	}
+}
+
+func TestLoginGuardRelease(t *testing.T) {
+	guard := newLoginGuard(t)
+
+	for i := 0; i < 10; i++ {
+		throttle, err := guard.Reserve("alice", "192.0.2.1")
+		if err != nil || throttle != nil {
+			t.Fatalf("attempt %d: got %+v, %v", i, throttle, err)
+		}
+		if err := guard.Release("alice", "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Refused by the address after an attempt was reserved for the user,
+	// which must not be left reserved
+	for i := 0; i < auth.DefaultIPLockout.FreeAttempts+1; i++ {
+		if throttle, err := guard.Reserve(fmt.Sprintf("user%d", i), "192.0.2.2"); err != nil || throttle != nil {
+			t.Fatalf("attempt %d from 192.0.2.2: got %+v, %v", i, throttle, err)
+		}
+	}
+	if throttle, err := guard.Reserve("carol", "192.0.2.2"); err != nil || throttle == nil {
+		t.Fatalf("attempt from a busy address: got %+v, %v", throttle, err)
+	}
+	for i := 0; i < auth.DefaultUserLockout.FreeAttempts+1; i++ {
+		if throttle, err := guard.Reserve("carol", "192.0.2.3"); err != nil || throttle != nil {
+			t.Fatalf("attempt %d as carol: got %+v, %v", i, throttle, err)
+		}
+	}
+}
+
+func TestLoginStorageReservationExpires(t *testing.T) {
+	guard := newLoginGuard(t)
+	store := guard.Store
+	now := time.Now().UTC()
+	policy := auth.DefaultUserLockout
+
+	for i := 0; i < policy.FreeAttempts+1; i++ {
+		if ok, err := store.Reserve("user:alice", now, policy.Window, policy.FreeAttempts, now.Add(time.Minute)); err != nil || !ok {
+			t.Fatalf("attempt %d: got %v, %v", i, ok, err)
+		}
+	}
+	if ok, _ := store.Reserve("user:alice", now, policy.Window, policy.FreeAttempts, now.Add(time.Minute)); ok {
+		t.Errorf("reserved more attempts than are free")
+	}
+	// Attempts never released, as when Golem stopped while checking them
+	later := now.Add(2 * time.Minute)
+	if ok, err := store.Reserve("user:alice", later, policy.Window, policy.FreeAttempts, later.Add(time.Minute)); err != nil || !ok {
+		t.Errorf("attempt after the reservations expired: got %v, %v", ok, err)
+	}
+}
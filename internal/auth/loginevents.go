@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoginOutcome is the result of a login attempt
+type LoginOutcome string
+
+const (
+	LoginSuccess            LoginOutcome = "success"
+	LoginMFARequired        LoginOutcome = "mfa_required"
+	LoginInvalidCredentials LoginOutcome = "invalid_credentials"
+	LoginThrottled          LoginOutcome = "throttled"
+	LoginLockedOut          LoginOutcome = "locked_out"
+	LoginNoRole             LoginOutcome = "no_role"
+	LoginDisabled           LoginOutcome = "disabled"
+	LoginInvalidMFACode     LoginOutcome = "invalid_mfa_code"
+)
+
+// LoginEvent records a login attempt. Method is "password", "mfa" for the
+// second step of a password login, or "oidc".
+type LoginEvent struct {
+	ID        int64        `json:"id"`
+	Time      time.Time    `json:"time"`
+	Method    string       `json:"method"`
+	Username  string       `json:"username"`
+	UserID    string       `json:"user_id,omitempty"`
+	IP        string       `json:"ip"`
+	UserAgent string       `json:"user_agent,omitempty"`
+	Outcome   LoginOutcome `json:"outcome"`
+}
+
+// LoginEventFilter selects login events, newest first
+type LoginEventFilter struct {
+	Username string
+	IP       string
+	Outcome  LoginOutcome
+	Since    time.Time
+	Limit    int
+}
+
+// LoginEventStorage defines the interface for the login audit trail
+type LoginEventStorage interface {
+	RecordLogin(e *LoginEvent) error
+	ListLogins(f LoginEventFilter) ([]*LoginEvent, error)
+}
+
+// RecordLogin appends e to the audit trail
+func (s *SQLiteLoginStorage) RecordLogin(e *LoginEvent) error {
+	res, err := s.db.Exec(
+		"INSERT INTO login_events (time, method, username, user_id, ip, user_agent, outcome) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		e.Time.UTC(), e.Method, e.Username, e.UserID, e.IP, e.UserAgent, e.Outcome,
+	)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListLogins returns the events matching f, newest first
+func (s *SQLiteLoginStorage) ListLogins(f LoginEventFilter) ([]*LoginEvent, error) {
+	query := "SELECT id, time, method, username, user_id, ip, user_agent, outcome FROM login_events"
+	var where []string
+	var args []interface{}
+	if f.Username != "" {
+		where = append(where, "username = ?")
+		args = append(args, f.Username)
+	}
+	if f.IP != "" {
+		where = append(where, "ip = ?")
+		args = append(args, f.IP)
+	}
+	if f.Outcome != "" {
+		where = append(where, "outcome = ?")
+		args = append(args, f.Outcome)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*LoginEvent{}
+	for rows.Next() {
+		e := &LoginEvent{}
+		if err := rows.Scan(&e.ID, &e.Time, &e.Method, &e.Username, &e.UserID, &e.IP, &e.UserAgent, &e.Outcome); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// recordLogin adds a login attempt to the audit trail, if there is one
+func (h *Handler) recordLogin(r *http.Request, method, username string, user *User, outcome LoginOutcome) {
+	if h.LoginEvents == nil {
+		return
+	}
+	e := &LoginEvent{
+		Time:      time.Now(),
+		Method:    method,
+		Username:  username,
+		IP:        ClientIP(r, h.TrustedProxies),
+		UserAgent: r.UserAgent(),
+		Outcome:   outcome,
+	}
+	if user != nil {
+		e.UserID = user.ID
+		e.Username = user.Username
+	}
+	if err := h.LoginEvents.RecordLogin(e); err != nil {
+		log.Printf("Failed to record login of %q: %v", username, err)
+	}
+}
+
+// ListLoginsHandler returns login attempts, newest first, filtered by
+// username, ip, outcome and since (RFC 3339) (admin only)
+func (h *Handler) ListLoginsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := LoginEventFilter{
+		Username: q.Get("username"),
+		IP:       q.Get("ip"),
+		Outcome:  LoginOutcome(q.Get("outcome")),
+		Limit:    100,
+	}
+	if s := q.Get("since"); s != "" {
+		since, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		f.Since = since
+	}
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		f.Limit = limit
+	}
+	events, err := h.LoginEvents.ListLogins(f)
+	if err != nil {
+		http.Error(w, "Failed to list logins", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,812 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"Golem/internal/storage/migrations"
+)
+
+var (
+	ErrMFANotEnrolled  = errors.New("two-factor authentication is not set up")
+	ErrMFAEnabled      = errors.New("two-factor authentication is already enabled")
+	ErrMFARequired     = errors.New("your role requires two-factor authentication")
+	ErrInvalidMFACode  = errors.New("invalid code")
+	ErrTooManyAttempts = errors.New("too many invalid codes, try again in a few minutes")
+)
+
+const (
+	// mfaTokenTTL is how long a user has to enter a code after the password
+	mfaTokenTTL = 5 * time.Minute
+	// mfaMaxAttempts is the number of wrong codes a user may enter within
+	// mfaTokenTTL of the last one. Getting a new MFA token does not reset it.
+	mfaMaxAttempts = 5
+	// recoveryCodeCount is the number of recovery codes issued at a time
+	recoveryCodeCount = 10
+
+	mfaPurposeVerify = "mfa"
+	mfaPurposeEnroll = "mfa-enroll"
+)
+
+var totpCodePattern = regexp.MustCompile(`^[0-9]{6}$`)
+
+// TOTPFactor is a user's authenticator app
+type TOTPFactor struct {
+	UserID    string
+	Secret    string
+	Enabled   bool
+	LastStep  int64
+	CreatedAt time.Time
+	EnabledAt *time.Time
+}
+
+// MFAEnrollment is returned when a user starts setting up an authenticator app
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFAStatus describes a user's two-factor authentication
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	Required               bool       `json:"required"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// MFAPolicy lists the roles that must use two-factor authentication
+type MFAPolicy struct {
+	RequiredRoles []Role `json:"required_roles"`
+}
+
+// MFAChallenge is the login response when a code is needed. Method is
+// "totp" when the user must enter a code, or "enroll" when their role
+// requires MFA and they must set up an authenticator app first.
+type MFAChallenge struct {
+	MFARequired string `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+// MFALoginRequest completes a login with a TOTP or recovery code
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// MFACodeRequest carries a code from the user's authenticator app
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAStorage defines the interface for TOTP factor storage
+type MFAStorage interface {
+	GetFactor(userID string) (*TOTPFactor, error)
+	// SaveFactor stores a pending factor, replacing any existing one
+	SaveFactor(userID, secret string) error
+	// EnableFactor enables a pending factor with step as its last used step
+	EnableFactor(userID string, step int64, recoveryCodes []string) error
+	// UseStep records step as used, failing if it or a later one was
+	UseStep(userID string, step int64) (bool, error)
+	DeleteFactor(userID string) error
+	ReplaceRecoveryCodes(userID string, codes []string) error
+	UseRecoveryCode(userID, code string) (bool, error)
+	CountRecoveryCodes(userID string) (int, error)
+	RequiredRoles() ([]Role, error)
+	SetRequiredRoles(roles []Role) error
+}
+
+// SQLiteMFAStorage implements MFAStorage using SQLite
+type SQLiteMFAStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteMFAStorage creates a new SQLiteMFAStorage instance
+func NewSQLiteMFAStorage(db *sql.DB) (*SQLiteMFAStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteMFAStorage{db: db}, nil
+}
+
+// GetFactor retrieves the user's factor
+func (s *SQLiteMFAStorage) GetFactor(userID string) (*TOTPFactor, error) {
+	f := &TOTPFactor{UserID: userID}
+	var enabledAt sql.NullTime
+	err := s.db.QueryRow(
+		"SELECT secret, enabled, last_step, created_at, enabled_at FROM user_mfa WHERE user_id = ?", userID,
+	).Scan(&f.Secret, &f.Enabled, &f.LastStep, &f.CreatedAt, &enabledAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		f.EnabledAt = &enabledAt.Time
+	}
+	return f, nil
+}
+
+// SaveFactor stores a pending factor and removes any recovery codes
+func (s *SQLiteMFAStorage) SaveFactor(userID, secret string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO user_mfa (user_id, secret, enabled, last_step, created_at) VALUES (?, ?, 0, 0, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, enabled = 0, last_step = 0,
+			created_at = excluded.created_at, enabled_at = NULL
+	`, userID, secret, time.Now().UTC()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EnableFactor enables a pending factor and stores its recovery codes
+func (s *SQLiteMFAStorage) EnableFactor(userID string, step int64, recoveryCodes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"UPDATE user_mfa SET enabled = 1, enabled_at = ?, last_step = ? WHERE user_id = ? AND enabled = 0",
+		time.Now().UTC(), step, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMFANotEnrolled
+	}
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseStep records step as the last used step if it is newer
+func (s *SQLiteMFAStorage) UseStep(userID string, step int64) (bool, error) {
+	res, err := s.db.Exec(
+		"UPDATE user_mfa SET last_step = ? WHERE user_id = ? AND enabled = 1 AND last_step < ?", step, userID, step,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DeleteFactor removes the user's factor and recovery codes
+func (s *SQLiteMFAStorage) DeleteFactor(userID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes replaces the user's recovery codes
+func (s *SQLiteMFAStorage) ReplaceRecoveryCodes(userID string, codes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID string, codes []string) error {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if _, err := tx.Exec(
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hashToken(normalizeRecoveryCode(code)),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks code as used if it is one of the user's unused codes
+func (s *SQLiteMFAStorage) UseRecoveryCode(userID, code string) (bool, error) {
+	res, err := s.db.Exec(
+		"UPDATE mfa_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), userID, hashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes
+func (s *SQLiteMFAStorage) CountRecoveryCodes(userID string) (int, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&n)
+	return n, err
+}
+
+// RequiredRoles returns the roles that must use MFA
+func (s *SQLiteMFAStorage) RequiredRoles() ([]Role, error) {
+	rows, err := s.db.Query("SELECT role FROM mfa_required_roles ORDER BY role")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// SetRequiredRoles replaces the roles that must use MFA
+func (s *SQLiteMFAStorage) SetRequiredRoles(roles []Role) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mfa_required_roles"); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO mfa_required_roles (role) VALUES (?)", role); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MFA enforces TOTP two-factor authentication on password logins
+type MFA struct {
+	Store MFAStorage
+	// Issuer names Golem in authenticator apps
+	Issuer string
+
+	mu       sync.Mutex
+	failures map[string]mfaFailures
+}
+
+type mfaFailures struct {
+	count   int
+	expires time.Time
+}
+
+// Required reports whether role must use MFA
+func (m *MFA) Required(role Role) (bool, error) {
+	roles, err := m.Store.RequiredRoles()
+	if err != nil {
+		return false, err
+	}
+	for _, r := range roles {
+		if r == role {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Status returns the user's MFA status
+func (m *MFA) Status(user *User) (*MFAStatus, error) {
+	required, err := m.Required(user.Role)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{Required: required}
+	factor, err := m.Store.GetFactor(user.ID)
+	if err == ErrMFANotEnrolled || (err == nil && !factor.Enabled) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Enabled = true
+	status.EnabledAt = factor.EnabledAt
+	status.RecoveryCodesRemaining, err = m.Store.CountRecoveryCodes(user.ID)
+	return status, err
+}
+
+// Enroll starts setting up an authenticator app for user. The factor is
+// pending until Confirm is called with a code from it.
+func (m *MFA) Enroll(user *User) (*MFAEnrollment, error) {
+	factor, err := m.Store.GetFactor(user.ID)
+	if err != nil && err != ErrMFANotEnrolled {
+		return nil, err
+	}
+	if err == nil && factor.Enabled {
+		return nil, ErrMFAEnabled
+	}
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Store.SaveFactor(user.ID, secret); err != nil {
+		return nil, err
+	}
+	return &MFAEnrollment{Secret: secret, URI: TOTPURI(m.issuer(), user.Username, secret)}, nil
+}
+
+// Confirm enables the user's pending factor if code is valid and returns
+// new recovery codes
+func (m *MFA) Confirm(userID, code string) ([]string, error) {
+	factor, err := m.Store.GetFactor(userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor.Enabled {
+		return nil, ErrMFAEnabled
+	}
+	step, ok := ValidateTOTP(factor.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Store.EnableFactor(userID, step, codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP code, or a recovery code which is then used up
+func (m *MFA) Verify(userID, code string) error {
+	factor, err := m.Store.GetFactor(userID)
+	if err != nil {
+		return err
+	}
+	if !factor.Enabled {
+		return ErrMFANotEnrolled
+	}
+	code = strings.TrimSpace(code)
+	if totpCodePattern.MatchString(code) {
+		step, ok := ValidateTOTP(factor.Secret, code, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		// A code cannot be used twice, even within its period
+		used, err := m.Store.UseStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	used, err := m.Store.UseRecoveryCode(userID, code)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (m *MFA) RegenerateRecoveryCodes(userID string) ([]string, error) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Store.ReplaceRecoveryCodes(userID, codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// loginStep returns the purpose of the token a user logging in with a
+// password gets instead of a session, or "" if they need no second factor
+func (m *MFA) loginStep(user *User) (string, error) {
+	factor, err := m.Store.GetFactor(user.ID)
+	if err != nil && err != ErrMFANotEnrolled {
+		return "", err
+	}
+	if err == nil && factor.Enabled {
+		return mfaPurposeVerify, nil
+	}
+	required, err := m.Required(user.Role)
+	if err != nil || !required {
+		return "", err
+	}
+	return mfaPurposeEnroll, nil
+}
+
+// allowAttempt reports whether the user may try another code
+func (m *MFA) allowAttempt(userID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.failures[userID]
+	return f.count < mfaMaxAttempts || time.Now().After(f.expires)
+}
+
+// fail records a wrong code from the user
+func (m *MFA) fail(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.failures == nil {
+		m.failures = map[string]mfaFailures{}
+	}
+	for id, f := range m.failures {
+		if now.After(f.expires) {
+			delete(m.failures, id)
+		}
+	}
+	f := m.failures[userID]
+	f.count++
+	f.expires = now.Add(mfaTokenTTL)
+	m.failures[userID] = f
+}
+
+func (m *MFA) issuer() string {
+	if m.Issuer == "" {
+		return "Golem"
+	}
+	return m.Issuer
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns random codes like abcd-efgh-ijkl-mnop (80 bits)
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// LoginMFAHandler completes a password login with a TOTP or recovery code.
+// After enrolling at login, the first code also enables the factor and the
+// response includes the new recovery codes.
+func (h *Handler) LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	claims, user, ok := h.mfaLogin(w, req.MFAToken, mfaPurposeVerify, mfaPurposeEnroll)
+	if !ok {
+		return
+	}
+	if !h.MFA.allowAttempt(user.ID) {
+		h.recordLogin(r, "mfa", user.Username, user, LoginThrottled)
+		http.Error(w, ErrTooManyAttempts.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	var recoveryCodes []string
+	var err error
+	if claims.Purpose == mfaPurposeEnroll {
+		recoveryCodes, err = h.MFA.Confirm(user.ID, req.Code)
+	} else {
+		err = h.MFA.Verify(user.ID, req.Code)
+	}
+	switch err {
+	case nil:
+	case ErrInvalidMFACode:
+		h.MFA.fail(user.ID)
+		h.recordLogin(r, "mfa", user.Username, user, LoginInvalidMFACode)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case ErrMFANotEnrolled, ErrMFAEnabled:
+		if err == ErrMFANotEnrolled && claims.Purpose == mfaPurposeEnroll {
+			http.Error(w, "Set up an authenticator app with /api/auth/login/mfa/enroll first", http.StatusConflict)
+			return
+		}
+		// The factor was reset or set up elsewhere since the password was checked
+		http.Error(w, "Two-factor authentication changed, log in again", http.StatusUnauthorized)
+		return
+	default:
+		http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		return
+	}
+
+	h.recordLogin(r, "mfa", user.Username, user, LoginSuccess)
+	h.UserStore.UpdateLastLogin(user.ID)
+	token, expiresAt, err := h.JWTService.GenerateToken(user)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(LoginResponse{
+		Token:         token,
+		User:          *user,
+		ExpiresAt:     expiresAt,
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// LoginMFAEnrollHandler starts setting up an authenticator app for a user
+// whose role requires MFA, before they have a session
+func (h *Handler) LoginMFAEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	_, user, ok := h.mfaLogin(w, req.MFAToken, mfaPurposeEnroll)
+	if !ok {
+		return
+	}
+	h.enroll(w, user)
+}
+
+// mfaLogin validates a login step token with one of purposes and returns
+// its claims and current user
+func (h *Handler) mfaLogin(w http.ResponseWriter, token string, purposes ...string) (*Claims, *User, bool) {
+	var claims *Claims
+	err := ErrInvalidToken
+	for _, purpose := range purposes {
+		if claims, err = h.JWTService.ValidateScopedToken(token, purpose); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA token, log in again", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	user, err := h.UserStore.GetUserByID(claims.UserID)
+	if err == ErrUserNotFound || (err == nil && !user.IsActive) {
+		http.Error(w, "Invalid or expired MFA token, log in again", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to look up user", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return claims, user, true
+}
+
+// MFAStatusHandler returns the current user's MFA status
+func (h *Handler) MFAStatusHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	status, err := h.MFA.Status(user)
+	if err != nil {
+		http.Error(w, "Failed to get two-factor authentication status", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// EnrollMFAHandler starts setting up an authenticator app for the current
+// user. It is enabled by ConfirmMFAHandler.
+func (h *Handler) EnrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	h.enroll(w, user)
+}
+
+func (h *Handler) enroll(w http.ResponseWriter, user *User) {
+	enrollment, err := h.MFA.Enroll(user)
+	if err == ErrMFAEnabled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to set up two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// ConfirmMFAHandler enables the current user's pending factor with a code
+// from it and returns their recovery codes
+func (h *Handler) ConfirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	codes, err := h.MFA.Confirm(user.ID, req.Code)
+	switch err {
+	case nil:
+	case ErrInvalidMFACode:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case ErrMFANotEnrolled, ErrMFAEnabled:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodesHandler replaces the current user's recovery codes
+func (h *Handler) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok || !h.verifyMFA(w, user, req.Code) {
+		return
+	}
+	codes, err := h.MFA.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// DisableMFAHandler removes the current user's factor, unless their role
+// requires MFA
+func (h *Handler) DisableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	required, err := h.MFA.Required(user.Role)
+	if err != nil {
+		http.Error(w, "Failed to check two-factor authentication policy", http.StatusInternalServerError)
+		return
+	}
+	if required {
+		http.Error(w, ErrMFARequired.Error(), http.StatusForbidden)
+		return
+	}
+	if !h.verifyMFA(w, user, req.Code) {
+		return
+	}
+	if err := h.MFA.Store.DeleteFactor(user.ID); err != nil {
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyMFA writes an error unless code is valid for the user's factor
+func (h *Handler) verifyMFA(w http.ResponseWriter, user *User, code string) bool {
+	if !h.MFA.allowAttempt(user.ID) {
+		http.Error(w, ErrTooManyAttempts.Error(), http.StatusTooManyRequests)
+		return false
+	}
+	switch err := h.MFA.Verify(user.ID, code); err {
+	case nil:
+		return true
+	case ErrInvalidMFACode:
+		h.MFA.fail(user.ID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case ErrMFANotEnrolled:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// ResetUserMFAHandler removes a user's factor so they can set it up again,
+// e.g. after losing their phone and recovery codes (admin only)
+func (h *Handler) ResetUserMFAHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/auth/users/"), "/mfa")
+	if !h.mayManage(w, r, id) {
+		return
+	}
+	if err := h.MFA.Store.DeleteFactor(id); err != nil {
+		http.Error(w, "Failed to reset two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMFAPolicyHandler returns the roles that must use MFA (admin only)
+func (h *Handler) GetMFAPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.MFA.Store.RequiredRoles()
+	if err != nil {
+		http.Error(w, "Failed to get two-factor authentication policy", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(MFAPolicy{RequiredRoles: roles})
+}
+
+// UpdateMFAPolicyHandler sets the roles that must use MFA (admin only).
+// Their users must set up MFA the next time they log in with a password.
+func (h *Handler) UpdateMFAPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var req MFAPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for _, role := range req.RequiredRoles {
+		if !h.roleExists(w, role) {
+			return
+		}
+	}
+	if err := h.MFA.Store.SetRequiredRoles(req.RequiredRoles); err != nil {
+		http.Error(w, "Failed to update two-factor authentication policy", http.StatusInternalServerError)
+		return
+	}
+	h.GetMFAPolicyHandler(w, r)
+}
+
+// currentUser looks up the user of the request's session token
+func (h *Handler) currentUser(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	claims := GetUserFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	user, err := h.UserStore.GetUserByID(claims.UserID)
+	if err == ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to look up user", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
@@ -55,6 +55,54 @@ func RequireRoleMiddleware(roles ...Role) func(http.Handler) http.Handler {
 	}
 }
 
+// RequirePermissionMiddleware authenticates the request and enforces that
+// the user's role grants perm. Requests without a token are checked against
+// the authorizer's anonymous role, if any.
+func RequirePermissionMiddleware(jwtService *JWTService, authz *Authorizer, perm Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := authz.AnonymousRole
+			var claims *Claims
+
+			header := r.Header.Get("Authorization")
+			if header != "" {
+				if !strings.HasPrefix(header, "Bearer ") {
+					http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+					return
+				}
+				var err error
+				claims, err = jwtService.ValidateToken(strings.TrimPrefix(header, "Bearer "))
+				if err != nil {
+					http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+					return
+				}
+				role = claims.Role
+				r = r.WithContext(context.WithValue(r.Context(), ContextUserKey, claims))
+			} else if role == "" || perm == PermAccount {
+				http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+				return
+			}
+
+			var allowed bool
+			var err error
+			if claims != nil {
+				allowed, err = authz.AllowedUser(claims, perm)
+			} else {
+				allowed, err = authz.Allowed(role, perm)
+			}
+			if err != nil {
+				http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetUserFromContext retrieves Claims from context
 func GetUserFromContext(ctx context.Context) *Claims {
 	claims, _ := ctx.Value(ContextUserKey).(*Claims)
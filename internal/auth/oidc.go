@@ -0,0 +1,463 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrOIDCLoginExpired = errors.New("login expired or was already completed, please sign in again")
+
+// GroupRole maps members of an identity provider group to a role
+type GroupRole struct {
+	Group string
+	Role  Role
+}
+
+// OIDCConfig configures login with an OpenID Connect provider
+type OIDCConfig struct {
+	// Name is shown on the login button
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is Golem's /api/auth/oidc/callback as the provider reaches it
+	RedirectURL string
+	Scopes      []string
+	// GroupsClaim names the ID token claim listing the user's groups; a
+	// dotted path such as realm_access.roles reads a nested claim
+	GroupsClaim string
+	// RoleMapping is checked in order and the first group the user is in
+	// decides the role; users in none get DefaultRole, or are refused if it
+	// is empty
+	RoleMapping []GroupRole
+	DefaultRole Role
+}
+
+// ParseRoleMapping parses "group=role,other=role"
+func ParseRoleMapping(s string) ([]GroupRole, error) {
+	var mapping []GroupRole
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(group) == "" || strings.TrimSpace(role) == "" {
+			return nil, fmt.Errorf("invalid role mapping %q, want group=role", entry)
+		}
+		mapping = append(mapping, GroupRole{Group: strings.TrimSpace(group), Role: Role(strings.TrimSpace(role))})
+	}
+	return mapping, nil
+}
+
+// OIDCProvider runs the authorization code flow with PKCE against one provider
+type OIDCProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	// aead seals logins in progress into the state cookie, so nothing is
+	// kept here for logins that never come back
+	aead cipher.AEAD
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      *remoteKeySet
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcLogin is a login that was sent to the provider and has not come back
+type oidcLogin struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	Redirect string `json:"redirect"`
+	Expires  int64  `json:"expires"`
+}
+
+const oidcLoginTimeout = 10 * time.Minute
+
+// NewOIDCProvider creates a provider. Discovery happens on first use, so
+// Golem starts even while the provider is unreachable.
+func NewOIDCProvider(config OIDCConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.Name == "" {
+		config.Name = "SSO"
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
+	// A new key on every start only fails logins in progress during a restart
+	key := make([]byte, 32)
+	rand.Read(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &OIDCProvider{config: config, client: client, aead: aead}
+}
+
+// Name is the provider's display name
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+// Issuer identifies the provider
+func (p *OIDCProvider) Issuer() string {
+	return p.config.Issuer
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, *remoteKeySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, p.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch OIDC discovery document: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to fetch OIDC discovery document: %s", resp.Status)
+	}
+
+	var d oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode OIDC discovery document: %v", err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.config.Issuer {
+		return nil, nil, fmt.Errorf("OIDC issuer mismatch: configured %s, provider says %s", p.config.Issuer, d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, nil, fmt.Errorf("OIDC discovery document is missing endpoints")
+	}
+	p.discovery = &d
+	p.keys = &remoteKeySet{url: d.JWKSURI, client: p.client}
+	return p.discovery, p.keys, nil
+}
+
+// AuthCodeURL starts a login. It returns the login sealed for the caller to
+// bind to the browser, and the provider URL to send the browser to. redirect
+// is where to go in Golem after signing in.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, redirect string) (string, string, error) {
+	d, _, err := p.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	login := &oidcLogin{Redirect: redirect, Expires: time.Now().Add(oidcLoginTimeout).Unix()}
+	for _, token := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		if *token, err = NewToken(); err != nil {
+			return "", "", err
+		}
+	}
+	sealed, err := p.seal(login)
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return sealed, d.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// seal encrypts login, so the browser can carry it but not read or change it
+func (p *OIDCProvider) seal(login *oidcLogin) (string, error) {
+	plain, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(p.aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// open decrypts a login sealed by this provider that has not expired
+func (p *OIDCProvider) open(sealed string) (*oidcLogin, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(data) < p.aead.NonceSize() {
+		return nil, false
+	}
+	n := p.aead.NonceSize()
+	plain, err := p.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return nil, false
+	}
+	var login oidcLogin
+	if err := json.Unmarshal(plain, &login); err != nil || time.Now().Unix() > login.Expires {
+		return nil, false
+	}
+	return &login, true
+}
+
+// Exchange completes the login sealed by AuthCodeURL that the provider
+// answered with state: it redeems code and validates the ID token. It
+// returns the identity and the redirect passed to AuthCodeURL.
+func (p *OIDCProvider) Exchange(ctx context.Context, sealed, state, code string) (*ExternalIdentity, string, error) {
+	login, ok := p.open(sealed)
+	if !ok || subtle.ConstantTimeCompare([]byte(login.State), []byte(state)) != 1 {
+		return nil, "", ErrOIDCLoginExpired
+	}
+
+	d, keys, err := p.discover(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {login.Verifier},
+		"client_id":     {p.config.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to redeem authorization code: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, "", fmt.Errorf("failed to decode token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to redeem authorization code: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, "", fmt.Errorf("token response has no id_token")
+	}
+
+	identity, err := p.validateIDToken(ctx, d, keys, tokens.IDToken, login.Nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	return identity, login.Redirect, nil
+}
+
+func (p *OIDCProvider) validateIDToken(ctx context.Context, d *oidcDiscovery, keys *remoteKeySet, raw, nonce string) (*ExternalIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("invalid ID token: nonce mismatch")
+	}
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.config.ClientID {
+			return nil, fmt.Errorf("invalid ID token: issued to %q", azp)
+		}
+	}
+
+	identity := &ExternalIdentity{}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("invalid ID token: no subject")
+	}
+	identity.Username, _ = claims["preferred_username"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Groups = stringsClaim(claims, p.config.GroupsClaim)
+	return identity, nil
+}
+
+// stringsClaim reads a claim that is a string or list of strings, following
+// a dotted path into nested objects
+func stringsClaim(claims map[string]interface{}, path string) []string {
+	var value interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Role maps the user's groups to a role
+func (p *OIDCProvider) Role(groups []string) (Role, bool) {
+	return MapRole(p.config.RoleMapping, p.config.DefaultRole, groups)
+}
+
+const oidcStateCookie = "golem_oidc_state"
+
+// OIDCInfoHandler tells the login page that SSO is available
+func (h *Handler) OIDCInfoHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"name":      h.OIDC.Name(),
+		"login_url": "/api/auth/oidc/login",
+	})
+}
+
+// OIDCLoginHandler sends the browser to the identity provider
+func (h *Handler) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	sealed, authURL, err := h.OIDC.AuthCodeURL(r.Context(), localRedirect(r.URL.Query().Get("redirect")))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start sign-in: %v", err), http.StatusBadGateway)
+		return
+	}
+	// The state cookie ties the callback to the browser that started the
+	// login, and carries the PKCE verifier and nonce back to it
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    sealed,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler completes the login, provisions the user on first
+// sign-in and hands Golem's own token to the web app
+func (h *Handler) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1})
+
+	if errCode := query.Get("error"); errCode != "" {
+		http.Error(w, fmt.Sprintf("Sign-in failed: %s %s", errCode, query.Get("error_description")), http.StatusUnauthorized)
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || query.Get("state") == "" {
+		http.Error(w, ErrOIDCLoginExpired.Error(), http.StatusBadRequest)
+		return
+	}
+
+	identity, redirect, err := h.OIDC.Exchange(r.Context(), cookie.Value, query.Get("state"), query.Get("code"))
+	if err == ErrOIDCLoginExpired {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.recordLogin(r, "oidc", "", nil, LoginInvalidCredentials)
+		http.Error(w, fmt.Sprintf("Sign-in failed: %v", err), http.StatusUnauthorized)
+		return
+	}
+	role, ok := h.OIDC.Role(identity.Groups)
+	if !ok {
+		h.recordLogin(r, "oidc", identity.Username, nil, LoginNoRole)
+		http.Error(w, ErrNoRole.Error(), http.StatusForbidden)
+		return
+	}
+	user, err := h.provisioner().Provision(h.OIDC.Issuer(), identity, role)
+	if err == ErrUserDisabled {
+		h.recordLogin(r, "oidc", identity.Username, nil, LoginDisabled)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to provision user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.recordLogin(r, "oidc", identity.Username, user, LoginSuccess)
+	h.UserStore.UpdateLastLogin(user.ID)
+	token, _, err := h.JWTService.GenerateToken(user)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	// The fragment is not sent to servers or kept in logs
+	http.Redirect(w, r, redirect+"#token="+url.QueryEscape(token), http.StatusFound)
+}
+
+// localRedirect only allows paths on this server, so the login cannot be
+// used to send tokens elsewhere
+func localRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.ContainsAny(redirect, "\\#") {
+		return "/"
+	}
+	return redirect
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrWeakPassword is wrapped by the errors of PasswordPolicy.Check
+var ErrWeakPassword = errors.New("weak password")
+
+// bcrypt ignores everything after 72 bytes
+const maxPasswordBytes = 72
+
+// PasswordPolicy is checked whenever a password is set
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters, 8 if zero
+	MinLength int
+	// Breached, if set, rejects passwords known from data breaches
+	Breached *BreachedPasswords
+}
+
+// DefaultPasswordPolicy is used when a store has no policy
+var DefaultPasswordPolicy = &PasswordPolicy{MinLength: 8}
+
+// Check returns an error wrapping ErrWeakPassword if password may not be
+// used by username
+func (p *PasswordPolicy) Check(username, password string) error {
+	minLength := p.MinLength
+	if minLength == 0 {
+		minLength = 8
+	}
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, minLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: must be at most %d bytes", ErrWeakPassword, maxPasswordBytes)
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return fmt.Errorf("%w: must not contain the username", ErrWeakPassword)
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("failed to check breached passwords: %v", err)
+		}
+		if breached {
+			return fmt.Errorf("%w: it appears in a list of breached passwords", ErrWeakPassword)
+		}
+	}
+	return nil
+}
+
+// BreachedPasswords is a local list of passwords that must not be used. The
+// file is either a list of SHA-1 hashes sorted by hash, one per line and
+// optionally followed by ":count" as in the Have I Been Pwned downloads, or
+// a list of plain passwords. Hash lists are searched on disk so they can be
+// large; plain lists are loaded into memory.
+type BreachedPasswords struct {
+	file   *os.File
+	size   int64
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+// LoadBreachedPasswords opens the breached password list at path
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open breached password list: %v", err)
+	}
+
+	first, _ := bufio.NewReader(f).ReadString('\n')
+	if isHashLine(first) {
+		return &BreachedPasswords{file: f, size: info.Size()}, nil
+	}
+
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	b := &BreachedPasswords{hashes: map[[sha1.Size]byte]struct{}{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			b.hashes[sha1.Sum([]byte(line))] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %v", err)
+	}
+	return b, nil
+}
+
+// Len returns the number of plain passwords loaded, or -1 for a hash list
+func (b *BreachedPasswords) Len() int {
+	if b.hashes == nil {
+		return -1
+	}
+	return len(b.hashes)
+}
+
+// Contains reports whether password is on the list
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	if b.hashes != nil {
+		_, ok := b.hashes[sum]
+		return ok, nil
+	}
+	return b.search([]byte(strings.ToUpper(hex.EncodeToString(sum[:]))))
+}
+
+// search binary searches the sorted hash file for the line starting with
+// target, by byte offset since lines differ in length
+func (b *BreachedPasswords) search(target []byte) (bool, error) {
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, next, err := b.lineFrom(mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+		if len(line) < len(target) {
+			// A blank or short line, such as a trailing newline
+			lo = next
+			continue
+		}
+		switch bytes.Compare(bytes.ToUpper(line[:len(target)]), target) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = next
+		default:
+			hi = start
+		}
+	}
+	return false, nil
+}
+
+// lineFrom returns the first line starting at or after off, its start and
+// the start of the line after it
+func (b *BreachedPasswords) lineFrom(off int64) (int64, []byte, int64, error) {
+	start := off
+	if off > 0 {
+		start = off - 1
+	}
+	r := bufio.NewReader(io.NewSectionReader(b.file, start, b.size-start))
+	if off > 0 {
+		// Skip the rest of the line containing off-1
+		skipped, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return b.size, nil, b.size, nil
+		}
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		start += int64(len(skipped))
+	}
+	line, err := r.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return 0, nil, 0, err
+	}
+	return start, bytes.TrimRight(line, "\r\n"), start + int64(len(line)), nil
+}
+
+// isHashLine reports whether line is a SHA-1 hash, optionally with a count
+func isHashLine(line string) bool {
+	line = strings.TrimRight(line, "\r\n")
+	hash, _, _ := strings.Cut(line, ":")
+	if len(hash) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Permission is an action a role may perform
+type Permission string
+
+const (
+	PermMetricsRead Permission = "metrics:read"
+	PermChecksRead  Permission = "checks:read"
+	PermChecksWrite Permission = "checks:write"
+	PermStatusWrite Permission = "status:write"
+	PermUsersAdmin  Permission = "users:admin"
+	PermSystemAdmin Permission = "system:admin"
+
+	// PermAccount is held by every signed-in user, whatever their role, to
+	// manage their own account. Anonymous requests never have it, and it
+	// cannot be granted to a role.
+	PermAccount Permission = "account"
+)
+
+// AllPermissions lists every permission, in display order
+var AllPermissions = []Permission{
+	PermMetricsRead,
+	PermChecksRead,
+	PermChecksWrite,
+	PermStatusWrite,
+	PermUsersAdmin,
+	PermSystemAdmin,
+}
+
+// builtinRoles are always defined and cannot be changed
+var builtinRoles = map[Role][]Permission{
+	RoleAdmin:  AllPermissions,
+	RoleUser:   {PermMetricsRead, PermChecksRead, PermChecksWrite},
+	RoleViewer: {PermMetricsRead, PermChecksRead},
+}
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleBuiltin  = errors.New("built-in roles cannot be changed")
+	ErrRoleInUse    = errors.New("role is assigned to users")
+	// ErrRoleOutranks is returned when a role or user has a permission the
+	// caller's role lacks
+	ErrRoleOutranks = errors.New("role grants permissions you do not have")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+// CustomRole is a role defined by an admin
+type CustomRole struct {
+	Name        Role         `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Permissions []Permission `json:"permissions"`
+	Builtin     bool         `json:"builtin"`
+	CreatedAt   time.Time    `json:"created_at,omitempty"`
+	UpdatedAt   time.Time    `json:"updated_at,omitempty"`
+}
+
+// Validate checks the role name and permissions
+func (r *CustomRole) Validate() error {
+	if !roleNamePattern.MatchString(string(r.Name)) {
+		return fmt.Errorf("role name must be 2-50 lowercase letters, digits, '-' or '_', starting with a letter")
+	}
+	if IsBuiltinRole(r.Name) {
+		return ErrRoleBuiltin
+	}
+	for _, p := range r.Permissions {
+		if !slices.Contains(AllPermissions, p) {
+			return fmt.Errorf("unknown permission %q", p)
+		}
+	}
+	return nil
+}
+
+// IsBuiltinRole reports whether role is admin, user or viewer
+func IsBuiltinRole(role Role) bool {
+	_, ok := builtinRoles[role]
+	return ok
+}
+
+// BuiltinRoles returns the built-in roles as CustomRole values for listing
+func BuiltinRoles() []*CustomRole {
+	roles := make([]*CustomRole, 0, len(builtinRoles))
+	for _, name := range []Role{RoleAdmin, RoleUser, RoleViewer} {
+		roles = append(roles, &CustomRole{Name: name, Permissions: builtinRoles[name], Builtin: true})
+	}
+	return roles
+}
+
+// Authorizer resolves roles to permissions
+type Authorizer struct {
+	Roles RoleStorage
+	// AnonymousRole, if set, applies to requests without a token
+	AnonymousRole Role
+	// Teams, if set, lets team members use the check routes their team
+	// role allows, whatever their own role
+	Teams TeamStorage
+}
+
+// Permissions returns the permissions granted to role
+func (a *Authorizer) Permissions(role Role) ([]Permission, error) {
+	if perms, ok := builtinRoles[role]; ok {
+		return perms, nil
+	}
+	if a.Roles == nil || role == "" {
+		return nil, nil
+	}
+	custom, err := a.Roles.GetRole(role)
+	if err == ErrRoleNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return custom.Permissions, nil
+}
+
+// Allowed reports whether role grants perm
+func (a *Authorizer) Allowed(role Role, perm Permission) (bool, error) {
+	if perm == PermAccount {
+		return role != "", nil
+	}
+	perms, err := a.Permissions(role)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(perms, perm), nil
+}
+
+// AllowedUser reports whether the signed-in user's role, or their role in
+// any of their teams, grants perm. Which checks they may then see or change
+// is up to the route.
+func (a *Authorizer) AllowedUser(claims *Claims, perm Permission) (bool, error) {
+	allowed, err := a.Allowed(claims.Role, perm)
+	if err != nil || allowed || a.Teams == nil {
+		return allowed, err
+	}
+	memberships, err := a.Teams.Memberships(claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range memberships {
+		if TeamGrants(m.Role, perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GrantsAll reports whether role grants every one of perms
+func (a *Authorizer) GrantsAll(role Role, perms []Permission) (bool, error) {
+	granted, err := a.Permissions(role)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range perms {
+		if !slices.Contains(granted, p) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Covers reports whether role grants every permission of other, so that a
+// holder of role may assign other and manage the users that have it
+func (a *Authorizer) Covers(role, other Role) (bool, error) {
+	perms, err := a.Permissions(other)
+	if err != nil {
+		return false, err
+	}
+	return a.GrantsAll(role, perms)
+}
+
+// RoleExists reports whether role is built in or defined
+func (a *Authorizer) RoleExists(role Role) (bool, error) {
+	if IsBuiltinRole(role) {
+		return true, nil
+	}
+	if a.Roles == nil {
+		return false, nil
+	}
+	_, err := a.Roles.GetRole(role)
+	if err == ErrRoleNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
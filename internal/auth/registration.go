@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// RegistrationPolicy controls who may register through the API
+type RegistrationPolicy string
+
+const (
+	// RegistrationDisabled only lets admins create users
+	RegistrationDisabled RegistrationPolicy = "disabled"
+	// RegistrationInvite requires an invitation token
+	RegistrationInvite RegistrationPolicy = "invite"
+	// RegistrationOpen lets anyone register as a viewer, or with an invitation's role
+	RegistrationOpen RegistrationPolicy = "open"
+)
+
+var (
+	ErrRegistrationDisabled = errors.New("registration is disabled")
+	ErrInvitationRequired   = errors.New("registration requires an invitation")
+	ErrDomainNotAllowed     = errors.New("email domain is not allowed to register")
+	ErrSetupComplete        = errors.New("setup is already complete")
+	ErrInvalidSetupToken    = errors.New("invalid setup token")
+)
+
+// ParseRegistrationPolicy parses disabled, invite or open
+func ParseRegistrationPolicy(s string) (RegistrationPolicy, error) {
+	switch policy := RegistrationPolicy(s); policy {
+	case RegistrationDisabled, RegistrationInvite, RegistrationOpen:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown registration policy %q (want disabled, invite or open)", s)
+}
+
+// Registration holds the self-registration policy and the first-run setup token
+type Registration struct {
+	Policy      RegistrationPolicy
+	Invitations InvitationStorage
+	// Domains, if set, restricts open registration and invitations without
+	// an email address to these email domains
+	Domains []string
+
+	mu         sync.Mutex
+	setupToken string
+}
+
+// ParseDomains splits a comma-separated list of email domains
+func ParseDomains(s string) []string {
+	var domains []string
+	for _, domain := range strings.Split(s, ",") {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// DomainAllowed reports whether email's domain is in the allowlist
+func (r *Registration) DomainAllowed(email string) bool {
+	if len(r.Domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range r.Domains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// StartSetup generates a one-time setup token if no users exist yet. It
+// returns "" once the first user has been created.
+func (r *Registration) StartSetup(users UserStorage) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, err := users.ListUsers()
+	if err != nil {
+		return "", err
+	}
+	if len(existing) > 0 {
+		r.setupToken = ""
+		return "", nil
+	}
+	token, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+	r.setupToken = token
+	return token, nil
+}
+
+// SetupPending reports whether a setup token is waiting to be used
+func (r *Registration) SetupPending() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.setupToken != ""
+}
+
+// CompleteSetup creates the first admin if token matches and there are
+// still no users, then invalidates the token
+func (r *Registration) CompleteSetup(users UserStorage, token string, req *UserCreate) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.setupToken == "" {
+		return nil, ErrSetupComplete
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(r.setupToken)) != 1 {
+		return nil, ErrInvalidSetupToken
+	}
+	existing, err := users.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		r.setupToken = ""
+		return nil, ErrSetupComplete
+	}
+
+	req.Role = RoleAdmin
+	user, err := users.CreateUser(req)
+	if err != nil {
+		return nil, err
+	}
+	r.setupToken = ""
+	return user, nil
+}
+
+// ValidateNewUser checks the fields every new account needs. The password
+// is checked against the PasswordPolicy of the user store.
+func ValidateNewUser(req *UserCreate) error {
+	if n := len(req.Username); n < 3 || n > 50 {
+		return fmt.Errorf("username must be 3-50 characters")
+	}
+	if !strings.Contains(req.Email, "@") {
+		return fmt.Errorf("a valid email address is required")
+	}
+	return nil
+}
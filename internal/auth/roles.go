@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"Golem/internal/storage/migrations"
+)
+
+// RoleStorage defines the interface for custom role storage
+type RoleStorage interface {
+	ListRoles() ([]*CustomRole, error)
+	GetRole(name Role) (*CustomRole, error)
+	SaveRole(role *CustomRole) (*CustomRole, error)
+	DeleteRole(name Role) error
+}
+
+// SQLiteRoleStorage implements RoleStorage using SQLite
+type SQLiteRoleStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteRoleStorage creates a new SQLiteRoleStorage instance
+func NewSQLiteRoleStorage(db *sql.DB) (*SQLiteRoleStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteRoleStorage{db: db}, nil
+}
+
+// ListRoles returns all custom roles sorted by name
+func (s *SQLiteRoleStorage) ListRoles() ([]*CustomRole, error) {
+	rows, err := s.db.Query("SELECT name, description, permissions, created_at, updated_at FROM roles ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*CustomRole{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// GetRole retrieves a custom role by name
+func (s *SQLiteRoleStorage) GetRole(name Role) (*CustomRole, error) {
+	role, err := scanRole(s.db.QueryRow(
+		"SELECT name, description, permissions, created_at, updated_at FROM roles WHERE name = ?", name,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	return role, err
+}
+
+// SaveRole creates or replaces a custom role
+func (s *SQLiteRoleStorage) SaveRole(role *CustomRole) (*CustomRole, error) {
+	if role.Permissions == nil {
+		role.Permissions = []Permission{}
+	}
+	perms, err := json.Marshal(role.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = s.db.Exec(`
+		INSERT INTO roles (name, description, permissions, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			description = excluded.description, permissions = excluded.permissions, updated_at = excluded.updated_at
+	`, role.Name, role.Description, string(perms), now, now)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRole(role.Name)
+}
+
+// DeleteRole deletes a custom role
+func (s *SQLiteRoleStorage) DeleteRole(name Role) error {
+	result, err := s.db.Exec("DELETE FROM roles WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRole(row rowScanner) (*CustomRole, error) {
+	role := &CustomRole{}
+	var perms string
+	if err := row.Scan(&role.Name, &role.Description, &perms, &role.CreatedAt, &role.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(perms), &role.Permissions); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
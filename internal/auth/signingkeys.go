@@ -0,0 +1,570 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"Golem/internal/storage/migrations"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithms of signing keys
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrSigningKeyActive   = errors.New("cannot delete the key that is signing tokens; rotate first")
+	ErrKeysNotRotatable   = errors.New("signing keys are not stored and cannot be rotated")
+)
+
+// ParseSigningAlgorithm parses HS256, RS256 or EdDSA
+func ParseSigningAlgorithm(s string) (string, error) {
+	switch s {
+	case AlgHS256, AlgRS256, AlgEdDSA:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown signing algorithm %q (want EdDSA, RS256 or HS256)", s)
+}
+
+// SigningKey signs tokens from ActiveAt until a newer key is active, and
+// verifies them until ExpiresAt
+type SigningKey struct {
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	CreatedAt time.Time  `json:"created_at"`
+	ActiveAt  time.Time  `json:"active_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Status is "pending", "active" or "retiring", as of listing
+	Status string `json:"status,omitempty"`
+
+	// private is an ed25519.PrivateKey, *rsa.PrivateKey or []byte secret
+	private interface{}
+}
+
+// GenerateSigningKey creates a key for alg with a random ID
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	k := &SigningKey{ID: hex.EncodeToString(id), Algorithm: alg, CreatedAt: time.Now().UTC()}
+	var err error
+	switch alg {
+	case AlgEdDSA:
+		_, k.private, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		k.private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgHS256:
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		k.private = secret
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %v", err)
+	}
+	return k, nil
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodHS256
+}
+
+// verifyKey is the key that checks signatures
+func (k *SigningKey) verifyKey() interface{} {
+	switch key := k.private.(type) {
+	case ed25519.PrivateKey:
+		return key.Public()
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	}
+	return k.private
+}
+
+// JWK returns the public key, or false for a shared secret
+func (k *SigningKey) JWK() (JWK, bool) {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Algorithm}
+	switch key := k.private.(type) {
+	case ed25519.PrivateKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	case *rsa.PrivateKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// marshal encodes the private key, as PKCS #8 for key pairs
+func (k *SigningKey) marshal() ([]byte, error) {
+	if secret, ok := k.private.([]byte); ok {
+		return secret, nil
+	}
+	return x509.MarshalPKCS8PrivateKey(k.private)
+}
+
+func (k *SigningKey) unmarshal(data []byte) error {
+	if k.Algorithm == AlgHS256 {
+		k.private = data
+		return nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse signing key %s: %v", k.ID, err)
+	}
+	switch key.(type) {
+	case ed25519.PrivateKey, *rsa.PrivateKey:
+	default:
+		return fmt.Errorf("signing key %s has an unsupported type", k.ID)
+	}
+	k.private = key
+	return nil
+}
+
+// KeyStorage defines the interface for signing key storage
+type KeyStorage interface {
+	ListSigningKeys() ([]*SigningKey, error)
+	CreateSigningKey(k *SigningKey) error
+	SetSigningKeyExpiry(kid string, expiresAt time.Time) error
+	DeleteSigningKey(kid string) error
+}
+
+// SQLiteKeyStorage implements KeyStorage using SQLite
+type SQLiteKeyStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteKeyStorage creates a new SQLiteKeyStorage instance
+func NewSQLiteKeyStorage(db *sql.DB) (*SQLiteKeyStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteKeyStorage{db: db}, nil
+}
+
+// ListSigningKeys returns all keys, oldest first
+func (s *SQLiteKeyStorage) ListSigningKeys() ([]*SigningKey, error) {
+	rows, err := s.db.Query("SELECT kid, algorithm, key_data, created_at, active_at, expires_at FROM signing_keys ORDER BY active_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*SigningKey
+	for rows.Next() {
+		k := &SigningKey{}
+		var data []byte
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Algorithm, &data, &k.CreatedAt, &k.ActiveAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		if err := k.unmarshal(data); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// CreateSigningKey stores k with its private key
+func (s *SQLiteKeyStorage) CreateSigningKey(k *SigningKey) error {
+	data, err := k.marshal()
+	if err != nil {
+		return err
+	}
+	var expiresAt interface{}
+	if k.ExpiresAt != nil {
+		expiresAt = k.ExpiresAt.UTC()
+	}
+	_, err = s.db.Exec(
+		"INSERT INTO signing_keys (kid, algorithm, key_data, created_at, active_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		k.ID, k.Algorithm, data, k.CreatedAt.UTC(), k.ActiveAt.UTC(), expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store signing key: %v", err)
+	}
+	return nil
+}
+
+// SetSigningKeyExpiry sets when a key stops verifying tokens
+func (s *SQLiteKeyStorage) SetSigningKeyExpiry(kid string, expiresAt time.Time) error {
+	_, err := s.db.Exec("UPDATE signing_keys SET expires_at = ? WHERE kid = ?", expiresAt.UTC(), kid)
+	return err
+}
+
+// DeleteSigningKey deletes a key
+func (s *SQLiteKeyStorage) DeleteSigningKey(kid string) error {
+	result, err := s.db.Exec("DELETE FROM signing_keys WHERE kid = ?", kid)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSigningKeyNotFound
+	}
+	return nil
+}
+
+// KeyRing holds the keys that sign and verify tokens and rotates them. A new
+// key is published in the JWKS PrePublish before it starts signing, so that
+// verifiers caching the JWKS know it, and the key it replaces keeps verifying
+// for Overlap, so that tokens it signed stay valid until they expire.
+type KeyRing struct {
+	Store     KeyStorage
+	Algorithm string
+	// RotateEvery is how long a key signs; zero only rotates on request
+	RotateEvery time.Duration
+	PrePublish  time.Duration
+	// Overlap should be at least the lifetime of a token
+	Overlap time.Duration
+
+	mu   sync.RWMutex
+	keys []*SigningKey
+	// now is the clock, time.Now unless a test sets it
+	now func() time.Time
+}
+
+func (r *KeyRing) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// staticKeyRing verifies and signs with one shared secret that never rotates
+func staticKeyRing(secret []byte) *KeyRing {
+	return &KeyRing{Algorithm: AlgHS256, keys: []*SigningKey{{Algorithm: AlgHS256, private: secret}}}
+}
+
+// Load reads the stored keys, creating the first key, or rotating right
+// away if the algorithm was changed
+func (r *KeyRing) Load() error {
+	keys, err := r.Store.ListSigningKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %v", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Algorithm == "" {
+		r.Algorithm = AlgEdDSA
+	}
+	r.keys = keys
+	now := r.clock()
+	if err := r.removeExpired(now); err != nil {
+		return err
+	}
+	if k := r.signing(now); k == nil || k.Algorithm != r.Algorithm {
+		_, err := r.rotate(now, true)
+		return err
+	}
+	return nil
+}
+
+// Start checks once a minute whether the key is due for rotation
+func (r *KeyRing) Start(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Maintain(r.clock()); err != nil {
+				log.Printf("Failed to rotate signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// Maintain deletes expired keys and schedules the next key when the active
+// one has signed for RotateEvery
+func (r *KeyRing) Maintain(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.removeExpired(now); err != nil {
+		return err
+	}
+	if r.RotateEvery == 0 || r.pending(now) != nil {
+		return nil
+	}
+	active := r.signing(now)
+	if active != nil && now.Before(active.ActiveAt.Add(r.RotateEvery-r.PrePublish)) {
+		return nil
+	}
+	k, err := r.rotate(now, false)
+	if err != nil {
+		return err
+	}
+	log.Printf("Signing key %s is published and will sign tokens from %s", k.ID, k.ActiveAt.Format(time.RFC3339))
+	return nil
+}
+
+// Rotate creates a new key. It signs right away if immediate, or after
+// PrePublish otherwise. Older keys keep verifying for Overlap after that.
+func (r *KeyRing) Rotate(immediate bool) (*SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate(r.clock(), immediate)
+}
+
+func (r *KeyRing) rotate(now time.Time, immediate bool) (*SigningKey, error) {
+	if r.Store == nil {
+		return nil, ErrKeysNotRotatable
+	}
+	now = now.UTC()
+	k, err := GenerateSigningKey(r.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	k.ActiveAt = now
+	if !immediate {
+		k.ActiveAt = now.Add(r.PrePublish)
+	}
+
+	var kept []*SigningKey
+	for _, old := range r.keys {
+		// A key scheduled earlier would take over from the new one
+		if old.ActiveAt.After(now) {
+			if err := r.Store.DeleteSigningKey(old.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		expiresAt := k.ActiveAt.Add(r.Overlap)
+		if old.ExpiresAt == nil || old.ExpiresAt.After(expiresAt) {
+			if err := r.Store.SetSigningKeyExpiry(old.ID, expiresAt); err != nil {
+				return nil, err
+			}
+			old.ExpiresAt = &expiresAt
+		}
+		kept = append(kept, old)
+	}
+	if err := r.Store.CreateSigningKey(k); err != nil {
+		return nil, err
+	}
+	r.keys = append(kept, k)
+	return k, nil
+}
+
+// Delete revokes a key that is not signing, invalidating the tokens it signed
+func (r *KeyRing) Delete(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Store == nil {
+		return ErrKeysNotRotatable
+	}
+	if k := r.signing(r.clock()); k != nil && k.ID == kid {
+		return ErrSigningKeyActive
+	}
+	if err := r.Store.DeleteSigningKey(kid); err != nil {
+		return err
+	}
+	for i, k := range r.keys {
+		if k.ID == kid {
+			r.keys = append(r.keys[:i:i], r.keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *KeyRing) removeExpired(now time.Time) error {
+	var kept []*SigningKey
+	for _, k := range r.keys {
+		if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+			if r.Store != nil {
+				if err := r.Store.DeleteSigningKey(k.ID); err != nil && err != ErrSigningKeyNotFound {
+					return err
+				}
+			}
+			continue
+		}
+		kept = append(kept, k)
+	}
+	r.keys = kept
+	return nil
+}
+
+// signing returns the newest key active at now
+func (r *KeyRing) signing(now time.Time) *SigningKey {
+	var active *SigningKey
+	for _, k := range r.keys {
+		if !k.ActiveAt.After(now) && (active == nil || k.ActiveAt.After(active.ActiveAt)) {
+			active = k
+		}
+	}
+	return active
+}
+
+// pending returns a key that is published but not signing yet
+func (r *KeyRing) pending(now time.Time) *SigningKey {
+	for _, k := range r.keys {
+		if k.ActiveAt.After(now) {
+			return k
+		}
+	}
+	return nil
+}
+
+// Signing returns the key to sign new tokens with
+func (r *KeyRing) Signing() (*SigningKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if k := r.signing(r.clock()); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("no signing key is active")
+}
+
+// Verifying returns the key with kid if it may verify tokens
+func (r *KeyRing) Verifying(kid string) (*SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.clock()
+	for _, k := range r.keys {
+		if k.ID == kid && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt)) {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// Keys lists the keys without their key material, oldest first
+func (r *KeyRing) Keys() []SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.clock()
+	active := r.signing(now)
+	keys := make([]SigningKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		listed := *k
+		listed.private = nil
+		switch {
+		case k == active:
+			listed.Status = "active"
+		case k.ActiveAt.After(now):
+			listed.Status = "pending"
+		default:
+			listed.Status = "retiring"
+		}
+		keys = append(keys, listed)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ActiveAt.Before(keys[j].ActiveAt) })
+	return keys
+}
+
+// JWKS returns the public keys of the key pairs that verify tokens,
+// including a key that has not started signing yet
+func (r *KeyRing) JWKS() JWKS {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range r.keys {
+		if jwk, ok := k.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// Rotatable reports whether the keys are stored and can be rotated
+func (r *KeyRing) Rotatable() bool {
+	return r.Store != nil
+}
+
+// RotateRequest asks for a new signing key
+type RotateRequest struct {
+	// Immediate signs with the new key right away instead of after the
+	// pre-publish period, e.g. when a key may have leaked
+	Immediate bool `json:"immediate"`
+}
+
+// JWKSHandler serves the public keys that verify Golem tokens
+func (h *Handler) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=900")
+	json.NewEncoder(w).Encode(h.JWTService.Keys().JWKS())
+}
+
+// ListSigningKeysHandler lists the signing keys (system admin only)
+func (h *Handler) ListSigningKeysHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(h.JWTService.Keys().Keys())
+}
+
+// RotateSigningKeyHandler creates a new signing key (system admin only)
+func (h *Handler) RotateSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req RotateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	k, err := h.JWTService.Keys().Rotate(req.Immediate)
+	if err != nil {
+		http.Error(w, "Failed to rotate signing key", http.StatusInternalServerError)
+		return
+	}
+	listed := *k
+	listed.private = nil
+	listed.Status = "pending"
+	if req.Immediate {
+		listed.Status = "active"
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(listed)
+}
+
+// DeleteSigningKeyHandler revokes a signing key, invalidating the tokens it
+// signed (system admin only)
+func (h *Handler) DeleteSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	kid := strings.TrimPrefix(r.URL.Path, "/api/admin/signing-keys/")
+	switch err := h.JWTService.Keys().Delete(kid); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case ErrSigningKeyNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case ErrSigningKeyActive:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to delete signing key", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testClock is a fixed time that tests move by hand
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time { return c.t }
+
+func newKeyStorage(t *testing.T) *SQLiteKeyStorage {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "golem.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := NewSQLiteKeyStorage(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func newKeyRing(t *testing.T, store KeyStorage, alg string, clock *testClock) *KeyRing {
+	t.Helper()
+	r := &KeyRing{Store: store, Algorithm: alg, RotateEvery: 24 * time.Hour, PrePublish: time.Hour, Overlap: 2 * time.Hour, now: clock.now}
+	if err := r.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func inJWKS(r *KeyRing, kid string) bool {
+	for _, jwk := range r.JWKS().Keys {
+		if jwk.KeyID == kid {
+			return true
+		}
+	}
+	return false
+}
+
+func TestKeyRingRotationSchedule(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &testClock{start}
+	store := newKeyStorage(t)
+	r := newKeyRing(t, store, AlgEdDSA, clock)
+	tokens := NewJWTServiceWithKeys(r, time.Hour)
+
+	first, err := r.Signing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := tokens.GenerateToken(&User{ID: "u1", Username: "alice", Role: RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.t = start.Add(22 * time.Hour)
+	if err := r.Maintain(clock.t); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Keys()); n != 1 {
+		t.Fatalf("%d keys before the next one is due, want 1", n)
+	}
+
+	// PrePublish before the key has signed for RotateEvery, the next one is
+	// published without signing
+	clock.t = start.Add(23 * time.Hour)
+	if err := r.Maintain(clock.t); err != nil {
+		t.Fatal(err)
+	}
+	keys := r.Keys()
+	if len(keys) != 2 || keys[1].Status != "pending" || !keys[1].ActiveAt.Equal(start.Add(24*time.Hour)) {
+		t.Fatalf("after 23h: got keys %+v, want the next pending from 24h", keys)
+	}
+	next := keys[1]
+	if !inJWKS(r, next.ID) {
+		t.Errorf("pending key %s is not in the JWKS", next.ID)
+	}
+	if k, _ := r.Signing(); k.ID != first.ID {
+		t.Errorf("pending key signs before it is active")
+	}
+	clock.t = start.Add(23*time.Hour + 30*time.Minute)
+	if err := r.Maintain(clock.t); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Keys()); n != 2 {
+		t.Errorf("%d keys while one is pending, want 2", n)
+	}
+
+	// The next key signs, and the first verifies for Overlap more
+	clock.t = start.Add(24 * time.Hour)
+	if k, _ := r.Signing(); k.ID != next.ID {
+		t.Errorf("signing with %s at 24h, want %s", k.ID, next.ID)
+	}
+	clock.t = start.Add(26*time.Hour - time.Second)
+	if err := r.Maintain(clock.t); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.ValidateToken(token); err != nil {
+		t.Errorf("token of the previous key within the overlap: %v", err)
+	}
+	if !inJWKS(r, first.ID) {
+		t.Errorf("previous key left the JWKS within the overlap")
+	}
+
+	clock.t = start.Add(26 * time.Hour)
+	if err := r.Maintain(clock.t); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.ValidateToken(token); err == nil {
+		t.Errorf("token of the previous key verified after the overlap")
+	}
+	if inJWKS(r, first.ID) {
+		t.Errorf("previous key is still in the JWKS after the overlap")
+	}
+	stored, err := store.ListSigningKeys()
+	if err != nil || len(stored) != 1 || stored[0].ID != next.ID {
+		t.Errorf("stored keys after the overlap: %v, %v; want only %s", stored, err, next.ID)
+	}
+}
+
+func TestKeyRingAlgorithmChange(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &testClock{start}
+	store := newKeyStorage(t)
+	old, err := newKeyRing(t, store, AlgEdDSA, clock).Signing()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.t = start.Add(time.Hour)
+	r := newKeyRing(t, store, AlgHS256, clock)
+	k, err := r.Signing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Algorithm != AlgHS256 || !k.ActiveAt.Equal(clock.t) {
+		t.Errorf("after changing the algorithm: signing with %s from %v, want HS256 from %v", k.Algorithm, k.ActiveAt, clock.t)
+	}
+	if v, ok := r.Verifying(old.ID); !ok || v.ExpiresAt == nil || !v.ExpiresAt.Equal(clock.t.Add(r.Overlap)) {
+		t.Errorf("EdDSA key after the change: got %+v, %v; want it verifying until %v", v, ok, clock.t.Add(r.Overlap))
+	}
+
+	// Loading again with the same algorithm keeps the key
+	if again, _ := newKeyRing(t, store, AlgHS256, clock).Signing(); again.ID != k.ID {
+		t.Errorf("reloading rotated from %s to %s", k.ID, again.ID)
+	}
+}
+
+func TestKeyRingDelete(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &testClock{start}
+	r := newKeyRing(t, newKeyStorage(t), AlgEdDSA, clock)
+	old, _ := r.Signing()
+	clock.t = start.Add(time.Hour)
+	next, err := r.Rotate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Delete(next.ID); err != ErrSigningKeyActive {
+		t.Errorf("deleting the active key: got %v, want %v", err, ErrSigningKeyActive)
+	}
+	if err := r.Delete("missing"); err != ErrSigningKeyNotFound {
+		t.Errorf("deleting an unknown key: got %v, want %v", err, ErrSigningKeyNotFound)
+	}
+	if err := r.Delete(old.ID); err != nil {
+		t.Fatalf("deleting the retiring key: %v", err)
+	}
+	if _, ok := r.Verifying(old.ID); ok {
+		t.Errorf("deleted key still verifies")
+	}
+}
@@ -3,8 +3,11 @@ package auth
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
+	"Golem/internal/storage/migrations"
+
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -24,30 +27,23 @@ type UserStorage interface {
 	DeleteUser(id string) error
 	ListUsers() ([]*User, error)
 	UpdateLastLogin(id string) error
+	GetUserByEmail(email string) (*User, error)
+	// MarkEmailVerified marks the email of a user verified if it is still
+	// email, and reports whether it was
+	MarkEmailVerified(id, email string) (bool, error)
 }
 
 // SQLiteUserStorage implements UserStorage using SQLite
 type SQLiteUserStorage struct {
 	db *sql.DB
+	// Policy is checked when a password is set; DefaultPasswordPolicy if nil
+	Policy *PasswordPolicy
 }
 
 // NewSQLiteUserStorage creates a new SQLiteUserStorage instance
 func NewSQLiteUserStorage(db *sql.DB) (*SQLiteUserStorage, error) {
-	// Create users table if it doesn't exist
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id TEXT PRIMARY KEY,
-			username TEXT UNIQUE NOT NULL,
-			email TEXT UNIQUE NOT NULL,
-			password_hash TEXT NOT NULL,
-			role TEXT NOT NULL,
-			created_at TIMESTAMP NOT NULL,
-			updated_at TIMESTAMP NOT NULL,
-			last_login TIMESTAMP,
-			is_active BOOLEAN NOT NULL DEFAULT true
-		)
-	`)
-	if err != nil {
+	// The users table is part of the golem.db schema
+	if _, err := migrations.Up(db); err != nil {
 		return nil, err
 	}
 
@@ -66,6 +62,10 @@ func (s *SQLiteUserStorage) CreateUser(user *UserCreate) (*User, error) {
 		return nil, ErrUserAlreadyExists
 	}
 
+	if err := s.policy().Check(user.Username, user.Password); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -98,35 +98,41 @@ func (s *SQLiteUserStorage) CreateUser(user *UserCreate) (*User, error) {
 
 // GetUserByID retrieves a user by ID
 func (s *SQLiteUserStorage) GetUserByID(id string) (*User, error) {
-	user := &User{}
-	err := s.db.QueryRow(`
-		SELECT id, username, email, password_hash, role, created_at, updated_at, last_login, is_active
-		FROM users WHERE id = ?
-	`, id).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.IsActive)
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return s.getUser("SELECT "+userColumns+" FROM users WHERE id = ?", id)
 }
 
 // GetUserByUsername retrieves a user by username
 func (s *SQLiteUserStorage) GetUserByUsername(username string) (*User, error) {
-	user := &User{}
-	err := s.db.QueryRow(`
-		SELECT id, username, email, password_hash, role, created_at, updated_at, last_login, is_active
-		FROM users WHERE username = ?
-	`, username).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.IsActive)
+	return s.getUser("SELECT "+userColumns+" FROM users WHERE username = ?", username)
+}
+
+// GetUserByEmail retrieves the oldest user with an email address, ignoring case
+func (s *SQLiteUserStorage) GetUserByEmail(email string) (*User, error) {
+	return s.getUser("SELECT "+userColumns+" FROM users WHERE email = ? COLLATE NOCASE ORDER BY created_at LIMIT 1", email)
+}
+
+func (s *SQLiteUserStorage) getUser(query string, args ...interface{}) (*User, error) {
+	user, err := scanUser(s.db.QueryRow(query, args...))
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
+	return user, err
+}
+
+// userColumns are the columns read by scanUser
+const userColumns = "id, username, email, password_hash, role, created_at, updated_at, last_login, is_active, email_verified_at"
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	user := &User{}
+	// last_login is NULL until the first login
+	var lastLogin, emailVerified sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt, &lastLogin, &user.IsActive, &emailVerified)
 	if err != nil {
 		return nil, err
 	}
+	user.LastLogin = lastLogin.Time
+	user.EmailVerified = emailVerified.Valid
 	return user, nil
 }
 
@@ -139,9 +145,15 @@ func (s *SQLiteUserStorage) UpdateUser(id string, update *UserUpdate) (*User, er
 
 	// Update fields if provided
 	if update.Email != nil {
+		if !strings.EqualFold(user.Email, *update.Email) {
+			user.EmailVerified = false
+		}
 		user.Email = *update.Email
 	}
 	if update.Password != nil {
+		if err := s.policy().Check(user.Username, *update.Password); err != nil {
+			return nil, err
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*update.Password), bcrypt.DefaultCost)
 		if err != nil {
 			return nil, err
@@ -159,9 +171,10 @@ func (s *SQLiteUserStorage) UpdateUser(id string, update *UserUpdate) (*User, er
 
 	_, err = s.db.Exec(`
 		UPDATE users
-		SET email = ?, password_hash = ?, role = ?, updated_at = ?, is_active = ?
+		SET email = ?, password_hash = ?, role = ?, updated_at = ?, is_active = ?,
+			email_verified_at = CASE WHEN ? THEN email_verified_at END
 		WHERE id = ?
-	`, user.Email, user.PasswordHash, user.Role, user.UpdatedAt, user.IsActive, id)
+	`, user.Email, user.PasswordHash, user.Role, user.UpdatedAt, user.IsActive, user.EmailVerified, id)
 	if err != nil {
 		return nil, err
 	}
@@ -189,10 +202,7 @@ func (s *SQLiteUserStorage) DeleteUser(id string) error {
 
 // ListUsers retrieves all users
 func (s *SQLiteUserStorage) ListUsers() ([]*User, error) {
-	rows, err := s.db.Query(`
-		SELECT id, username, email, password_hash, role, created_at, updated_at, last_login, is_active
-		FROM users
-	`)
+	rows, err := s.db.Query("SELECT " + userColumns + " FROM users")
 	if err != nil {
 		return nil, err
 	}
@@ -200,16 +210,34 @@ func (s *SQLiteUserStorage) ListUsers() ([]*User, error) {
 
 	var users []*User
 	for rows.Next() {
-		user := &User{}
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role,
-			&user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.IsActive)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
+}
+
+// MarkEmailVerified marks the email of a user verified if it is still email
+func (s *SQLiteUserStorage) MarkEmailVerified(id, email string) (bool, error) {
+	result, err := s.db.Exec(
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ? AND email = ? COLLATE NOCASE",
+		time.Now().UTC(), id, email,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (s *SQLiteUserStorage) policy() *PasswordPolicy {
+	if s.Policy == nil {
+		return DefaultPasswordPolicy
+	}
+	return s.Policy
 }
 
 // UpdateLastLogin updates the last login timestamp for a user
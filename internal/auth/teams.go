@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"Golem/internal/storage/migrations"
+)
+
+// TeamRole is a member's role within one team
+type TeamRole string
+
+const (
+	// TeamAdmin members manage the team's members as well as its checks
+	TeamAdmin  TeamRole = "admin"
+	TeamEditor TeamRole = "editor"
+	TeamViewer TeamRole = "viewer"
+)
+
+// teamRoles are the permissions each team role grants on the team's checks
+var teamRoles = map[TeamRole][]Permission{
+	TeamAdmin:  {PermChecksRead, PermChecksWrite},
+	TeamEditor: {PermChecksRead, PermChecksWrite},
+	TeamViewer: {PermChecksRead},
+}
+
+var (
+	ErrTeamNotFound   = errors.New("team not found")
+	ErrTeamExists     = errors.New("team already exists")
+	ErrMemberNotFound = errors.New("not a member of the team")
+)
+
+// Team groups users and the health checks they own
+type Team struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Members     int       `json:"members"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// Role is the caller's role in the team, when listing their own teams
+	Role TeamRole `json:"role,omitempty"`
+}
+
+// TeamMember is a user's membership of a team
+type TeamMember struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      TeamRole  `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Membership is one of a user's teams and their role in it
+type Membership struct {
+	Team string
+	Role TeamRole
+}
+
+// Validate checks the team name
+func (t *Team) Validate() error {
+	if !roleNamePattern.MatchString(t.Name) {
+		return fmt.Errorf("team name must be 2-50 lowercase letters, digits, '-' or '_', starting with a letter")
+	}
+	return nil
+}
+
+// ValidTeamRole reports whether role is admin, editor or viewer
+func ValidTeamRole(role TeamRole) bool {
+	_, ok := teamRoles[role]
+	return ok
+}
+
+// TeamGrants reports whether role grants perm on the team's checks
+func TeamGrants(role TeamRole, perm Permission) bool {
+	return slices.Contains(teamRoles[role], perm)
+}
+
+// TeamStorage defines the interface for teams and their members
+type TeamStorage interface {
+	ListTeams() ([]*Team, error)
+	GetTeam(name string) (*Team, error)
+	CreateTeam(team *Team) (*Team, error)
+	UpdateTeam(team *Team) (*Team, error)
+	// DeleteTeam deletes a team and its memberships
+	DeleteTeam(name string) error
+	ListMembers(team string) ([]*TeamMember, error)
+	// SetMember adds a user to a team or changes their role in it
+	SetMember(team, userID string, role TeamRole) error
+	RemoveMember(team, userID string) error
+	// Memberships returns the teams userID belongs to
+	Memberships(userID string) ([]Membership, error)
+}
+
+// SQLiteTeamStorage implements TeamStorage using SQLite
+type SQLiteTeamStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteTeamStorage creates a new SQLiteTeamStorage instance
+func NewSQLiteTeamStorage(db *sql.DB) (*SQLiteTeamStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteTeamStorage{db: db}, nil
+}
+
+// Members of deleted users are not counted or listed.
+const teamColumns = `t.name, t.description, t.created_at, t.updated_at,
+	(SELECT COUNT(*) FROM team_members m JOIN users u ON u.id = m.user_id WHERE m.team = t.name)`
+
+func scanTeam(row rowScanner) (*Team, error) {
+	t := &Team{}
+	if err := row.Scan(&t.Name, &t.Description, &t.CreatedAt, &t.UpdatedAt, &t.Members); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ListTeams returns all teams sorted by name
+func (s *SQLiteTeamStorage) ListTeams() ([]*Team, error) {
+	rows, err := s.db.Query("SELECT " + teamColumns + " FROM teams t ORDER BY t.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []*Team{}
+	for rows.Next() {
+		t, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+// GetTeam retrieves a team by name
+func (s *SQLiteTeamStorage) GetTeam(name string) (*Team, error) {
+	t, err := scanTeam(s.db.QueryRow("SELECT "+teamColumns+" FROM teams t WHERE t.name = ?", name))
+	if err == sql.ErrNoRows {
+		return nil, ErrTeamNotFound
+	}
+	return t, err
+}
+
+// CreateTeam creates a team
+func (s *SQLiteTeamStorage) CreateTeam(team *Team) (*Team, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM teams WHERE name = ?)", team.Name).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrTeamExists
+	}
+
+	now := time.Now().UTC()
+	_, err = s.db.Exec(
+		"INSERT INTO teams (name, description, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		team.Name, team.Description, now, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTeam(team.Name)
+}
+
+// UpdateTeam changes a team's description
+func (s *SQLiteTeamStorage) UpdateTeam(team *Team) (*Team, error) {
+	result, err := s.db.Exec(
+		"UPDATE teams SET description = ?, updated_at = ? WHERE name = ?",
+		team.Description, time.Now().UTC(), team.Name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if rows == 0 {
+		return nil, ErrTeamNotFound
+	}
+	return s.GetTeam(team.Name)
+}
+
+// DeleteTeam deletes a team and its memberships
+func (s *SQLiteTeamStorage) DeleteTeam(name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM teams WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrTeamNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM team_members WHERE team = ?", name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListMembers returns a team's members sorted by username
+func (s *SQLiteTeamStorage) ListMembers(team string) ([]*TeamMember, error) {
+	rows, err := s.db.Query(`
+		SELECT m.user_id, u.username, m.role, m.created_at
+		FROM team_members m JOIN users u ON u.id = m.user_id
+		WHERE m.team = ? ORDER BY u.username`, team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*TeamMember{}
+	for rows.Next() {
+		m := &TeamMember{}
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetMember adds a user to a team or changes their role in it
+func (s *SQLiteTeamStorage) SetMember(team, userID string, role TeamRole) error {
+	_, err := s.db.Exec(`
+		INSERT INTO team_members (team, user_id, role, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (team, user_id) DO UPDATE SET role = excluded.role`,
+		team, userID, role, time.Now().UTC(),
+	)
+	return err
+}
+
+// RemoveMember removes a user from a team
+func (s *SQLiteTeamStorage) RemoveMember(team, userID string) error {
+	result, err := s.db.Exec("DELETE FROM team_members WHERE team = ? AND user_id = ?", team, userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// Memberships returns the teams userID belongs to, sorted by name
+func (s *SQLiteTeamStorage) Memberships(userID string) ([]Membership, error) {
+	rows, err := s.db.Query("SELECT team, role FROM team_members WHERE user_id = ? ORDER BY team", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []Membership
+	for rows.Next() {
+		var m Membership
+		if err := rows.Scan(&m.Team, &m.Role); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
@@ -24,6 +24,8 @@ type User struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 	LastLogin    time.Time `json:"last_login,omitempty"`
 	IsActive     bool      `json:"is_active"`
+	// EmailVerified is set once the user followed a link sent to Email
+	EmailVerified bool `json:"email_verified"`
 }
 
 // UserCreate represents the data needed to create a new user
@@ -53,4 +55,22 @@ type LoginResponse struct {
 	Token     string `json:"token"`
 	User      User   `json:"user"`
 	ExpiresAt int64  `json:"expires_at"`
+	// RecoveryCodes are only set when MFA was set up during this login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// RegisterRequest represents a self-registration, optionally with an invitation
+type RegisterRequest struct {
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	Invitation string `json:"invitation,omitempty"`
+}
+
+// SetupRequest creates the first admin with the setup token
+type SetupRequest struct {
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
 }
@@ -0,0 +1,334 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"Golem/internal/docker"
+	"Golem/internal/metrics"
+)
+
+// CgroupMode selects which cgroups are collected
+type CgroupMode string
+
+const (
+	CgroupsOff CgroupMode = "off"
+	// CgroupsContainers collects containers and the top-level cgroups, such
+	// as system.slice and kubepods
+	CgroupsContainers CgroupMode = "containers"
+	CgroupsAll        CgroupMode = "all"
+)
+
+// ParseCgroupMode parses GOLEM_CGROUPS
+func ParseCgroupMode(s string) (CgroupMode, error) {
+	switch mode := CgroupMode(s); mode {
+	case CgroupsOff, CgroupsContainers, CgroupsAll:
+		return mode, nil
+	}
+	return "", fmt.Errorf("cgroup mode must be off, containers or all, not %q", s)
+}
+
+// Option configures optional Collector sources.
+type Option func(*Collector)
+
+// WithCgroups collects the cgroups under root, a cgroup v2 mount or the
+// directory holding the v1 controller mounts. Container names are looked up
+// with docker when it is not nil.
+func WithCgroups(root string, mode CgroupMode, docker *docker.Client) Option {
+	return func(c *Collector) {
+		if mode == CgroupsOff {
+			return
+		}
+		c.cgroups = &cgroupReader{root: root, mode: mode, docker: docker}
+	}
+}
+
+// v1Controllers are the cgroup v1 hierarchies read, each mounted under root
+var v1Controllers = []string{"cpuacct", "cpu", "memory", "blkio", "pids"}
+
+// containerPattern finds the runtime and container ID in the last element
+// of a container's cgroup path: docker-<id>.scope, cri-containerd-<id>.scope,
+// crio-<id>.scope, libpod-<id>.scope or a bare <id>.
+var containerPattern = regexp.MustCompile(`^(?:(docker|cri-containerd|crio|libpod)-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+// runtimeNames maps cgroup name prefixes and v1 parent directories to
+// runtime names
+var runtimeNames = map[string]string{
+	"docker":         "docker",
+	"cri-containerd": "containerd",
+	"crio":           "cri-o",
+	"libpod":         "podman",
+}
+
+type cgroupReader struct {
+	root   string
+	mode   CgroupMode
+	docker *docker.Client
+
+	v2     *bool
+	names  map[string]string
+	warned bool
+}
+
+// isV2 reports whether root is a unified (v2) hierarchy
+func (r *cgroupReader) isV2() bool {
+	if r.v2 == nil {
+		_, err := os.Stat(filepath.Join(r.root, "cgroup.controllers"))
+		v2 := err == nil
+		r.v2 = &v2
+	}
+	return *r.v2
+}
+
+// collect reads every selected cgroup. Files a kernel or controller does
+// not provide leave their fields at zero.
+func (r *cgroupReader) collect() ([]metrics.CgroupMetrics, error) {
+	tree := r.root
+	if !r.isV2() {
+		tree = filepath.Join(r.root, "memory")
+	}
+
+	var cgroups []metrics.CgroupMetrics
+	err := filepath.WalkDir(tree, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A cgroup removed during the walk is not an error.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() || path == tree {
+			return nil
+		}
+		rel := "/" + filepath.ToSlash(strings.TrimPrefix(path, tree+string(filepath.Separator)))
+
+		c := metrics.CgroupMetrics{Path: rel}
+		container := containerOf(rel, &c)
+		if r.mode == CgroupsContainers && !container && strings.Count(rel, "/") > 1 {
+			return nil
+		}
+		if r.isV2() {
+			r.readV2(path, &c)
+		} else {
+			r.readV1(rel, &c)
+		}
+		cgroups = append(cgroups, c)
+
+		// Cgroups a container creates inside its own are part of it.
+		if container {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cgroups: %v", err)
+	}
+
+	r.nameContainers(cgroups)
+	return cgroups, nil
+}
+
+// containerOf fills in the container ID and runtime of the cgroup at path,
+// and reports whether it is a container
+func containerOf(path string, c *metrics.CgroupMetrics) bool {
+	parent, name := filepath.Split(path)
+	m := containerPattern.FindStringSubmatch(name)
+	if m == nil {
+		return false
+	}
+	c.ContainerID = m[2]
+	c.Runtime = runtimeNames[m[1]]
+	if c.Runtime == "" {
+		// cgroup v1 and the cgroupfs driver: /docker/<id>, /kubepods/.../<id>
+		switch first := strings.SplitN(strings.TrimPrefix(parent, "/"), "/", 2)[0]; {
+		case first == "docker":
+			c.Runtime = "docker"
+		case strings.HasPrefix(first, "kubepods"):
+			c.Runtime = "kubernetes"
+		}
+	}
+	return true
+}
+
+func (r *cgroupReader) readV2(dir string, c *metrics.CgroupMetrics) {
+	cpu := readKeyed(filepath.Join(dir, "cpu.stat"))
+	c.CPUUsage = float64(cpu["usage_usec"]) / 1e6
+	c.CPUUser = float64(cpu["user_usec"]) / 1e6
+	c.CPUSystem = float64(cpu["system_usec"]) / 1e6
+	c.CPUPeriods = cpu["nr_periods"]
+	c.CPUThrottled = cpu["nr_throttled"]
+	c.CPUThrottledTime = float64(cpu["throttled_usec"]) / 1e6
+
+	c.MemoryUsage, _ = readUint(filepath.Join(dir, "memory.current"))
+	c.MemoryLimit, _ = readUint(filepath.Join(dir, "memory.max"))
+	events := readKeyed(filepath.Join(dir, "memory.events"))
+	c.MemoryOOMEvents = events["oom"]
+	c.MemoryOOMKills = events["oom_kill"]
+
+	// io.stat has one line per device: "8:0 rbytes=1 wbytes=2 rios=3 wios=4 ..."
+	eachLine(filepath.Join(dir, "io.stat"), func(fields []string) {
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, _ := strconv.ParseUint(value, 10, 64)
+			switch key {
+			case "rbytes":
+				c.IOReadBytes += n
+			case "wbytes":
+				c.IOWriteBytes += n
+			case "rios":
+				c.IOReads += n
+			case "wios":
+				c.IOWrites += n
+			}
+		}
+	})
+
+	c.PIDs, _ = readUint(filepath.Join(dir, "pids.current"))
+	c.PIDsLimit, _ = readUint(filepath.Join(dir, "pids.max"))
+}
+
+// userHZ is the unit of cpuacct.stat, fixed at 100 on Linux
+const userHZ = 100
+
+func (r *cgroupReader) readV1(rel string, c *metrics.CgroupMetrics) {
+	dir := func(controller string) string {
+		return filepath.Join(r.root, controller, filepath.FromSlash(rel))
+	}
+
+	usage, _ := readUint(filepath.Join(dir("cpuacct"), "cpuacct.usage"))
+	c.CPUUsage = float64(usage) / 1e9
+	acct := readKeyed(filepath.Join(dir("cpuacct"), "cpuacct.stat"))
+	c.CPUUser = float64(acct["user"]) / userHZ
+	c.CPUSystem = float64(acct["system"]) / userHZ
+	cpu := readKeyed(filepath.Join(dir("cpu"), "cpu.stat"))
+	c.CPUPeriods = cpu["nr_periods"]
+	c.CPUThrottled = cpu["nr_throttled"]
+	c.CPUThrottledTime = float64(cpu["throttled_time"]) / 1e9
+
+	c.MemoryUsage, _ = readUint(filepath.Join(dir("memory"), "memory.usage_in_bytes"))
+	c.MemoryLimit, _ = readUint(filepath.Join(dir("memory"), "memory.limit_in_bytes"))
+	// Without a limit v1 reports the largest page-aligned int64.
+	if c.MemoryLimit >= 1<<62 {
+		c.MemoryLimit = 0
+	}
+	c.MemoryOOMKills = readKeyed(filepath.Join(dir("memory"), "memory.oom_control"))["oom_kill"]
+
+	// "8:0 Read 4096" lines per device and operation, then a "Total" line
+	sum := func(file string, read, write *uint64) {
+		eachLine(filepath.Join(dir("blkio"), file), func(fields []string) {
+			if len(fields) != 3 {
+				return
+			}
+			n, _ := strconv.ParseUint(fields[2], 10, 64)
+			switch fields[1] {
+			case "Read":
+				*read += n
+			case "Write":
+				*write += n
+			}
+		})
+	}
+	sum("blkio.throttle.io_service_bytes", &c.IOReadBytes, &c.IOWriteBytes)
+	sum("blkio.throttle.io_serviced", &c.IOReads, &c.IOWrites)
+
+	c.PIDs, _ = readUint(filepath.Join(dir("pids"), "pids.current"))
+	c.PIDsLimit, _ = readUint(filepath.Join(dir("pids"), "pids.max"))
+}
+
+// nameContainers fills in container names from Docker. The name list is
+// fetched again only when a container has not been seen before; containers
+// Docker does not know, such as those of other runtimes, are remembered
+// without a name so they do not cause a fetch on every collection.
+func (r *cgroupReader) nameContainers(cgroups []metrics.CgroupMetrics) {
+	if r.docker == nil {
+		return
+	}
+	var unknown []string
+	for _, c := range cgroups {
+		if _, ok := r.names[c.ContainerID]; c.ContainerID != "" && !ok {
+			unknown = append(unknown, c.ContainerID)
+		}
+	}
+	if len(unknown) > 0 && r.refreshNames() {
+		for _, id := range unknown {
+			if _, ok := r.names[id]; !ok {
+				r.names[id] = ""
+			}
+		}
+	}
+	for i := range cgroups {
+		cgroups[i].ContainerName = r.names[cgroups[i].ContainerID]
+	}
+}
+
+// refreshNames fetches the name list and reports whether it could
+func (r *cgroupReader) refreshNames() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	containers, err := r.docker.ListContainers(ctx, true)
+	if err != nil {
+		if !r.warned {
+			log.Printf("Container names are not available: %v", err)
+			r.warned = true
+		}
+		return false
+	}
+	r.warned = false
+	r.names = make(map[string]string, len(containers))
+	for _, container := range containers {
+		r.names[container.ID] = container.Name()
+	}
+	return true
+}
+
+// readUint reads a file holding one number; "max" reads as 0
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// readKeyed reads a file of "key value" lines
+func readKeyed(path string) map[string]uint64 {
+	values := map[string]uint64{}
+	eachLine(path, func(fields []string) {
+		if len(fields) == 2 {
+			values[fields[0]], _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	})
+	return values
+}
+
+// eachLine calls fn with the fields of every non-empty line of path
+func eachLine(path string, fn func(fields []string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			fn(fields)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"Golem/internal/docker/dockertest"
+	"Golem/internal/metrics"
+)
+
+func TestNameContainers(t *testing.T) {
+	web := strings.Repeat("a", 64)
+	// A containerd container Docker does not know
+	other := strings.Repeat("b", 64)
+	srv, client := newDockerDaemon(t, dockertest.Container{ID: web, Name: "web"})
+	r := &cgroupReader{docker: client}
+
+	cgroups := []metrics.CgroupMetrics{{Path: "/system.slice"}, {ContainerID: web}, {ContainerID: other}}
+	r.nameContainers(cgroups)
+	if cgroups[1].ContainerName != "web" || cgroups[2].ContainerName != "" {
+		t.Fatalf("got %+v", cgroups)
+	}
+
+	// Known containers, named or not, do not fetch the list again
+	srv.Close()
+	r.nameContainers(cgroups)
+	if r.warned {
+		t.Errorf("fetched the name list again for containers seen before")
+	}
+	if cgroups[1].ContainerName != "web" {
+		t.Errorf("lost the name of web: %+v", cgroups[1])
+	}
+
+	// A new container does
+	db := strings.Repeat("c", 64)
+	srv, client = newDockerDaemon(t, dockertest.Container{ID: web, Name: "web"}, dockertest.Container{ID: db, Name: "db"})
+	r.docker = client
+	cgroups = append(cgroups, metrics.CgroupMetrics{ContainerID: db})
+	r.nameContainers(cgroups)
+	if cgroups[3].ContainerName != "db" || cgroups[1].ContainerName != "web" {
+		t.Errorf("after db started: got %+v", cgroups)
+	}
+}
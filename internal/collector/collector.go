@@ -3,6 +3,8 @@ package collector
 import (
 	"context"
 	"log"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -13,22 +15,42 @@ import (
 	"github.com/shirou/gopsutil/v3/net"
 	"github.com/shirou/gopsutil/v3/process"
 
+	"Golem/internal/docker"
 	"Golem/internal/metrics"
 	"Golem/internal/storage"
+	"Golem/internal/systemd"
 )
 
 type Collector struct {
 	storage storage.MetricStorage
+	last    *metrics.SystemMetrics
+	cgroups *cgroupReader
+
+	docker        *docker.Client
+	dockerFailing bool
+
+	systemd        *systemd.Client
+	systemdUnits   []string
+	systemdFailing bool
 }
 
+// NewHealthCheckCollector returns a health check collector sharing c's
+// Docker and systemd clients.
 func (c *Collector) NewHealthCheckCollector(storage storage.HealthCheckStorage) *HealthCheckCollector {
-	return NewHealthCheckCollector(storage)
+	hc := NewHealthCheckCollector(storage)
+	hc.docker = c.docker
+	hc.systemd = c.systemd
+	return hc
 }
 
-func NewCollector(storage storage.MetricStorage) *Collector {
-	return &Collector{
+func NewCollector(storage storage.MetricStorage, opts ...Option) *Collector {
+	c := &Collector{
 		storage: storage,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *Collector) Start(ctx context.Context, interval time.Duration) {
@@ -46,6 +68,9 @@ func (c *Collector) Start(ctx context.Context, interval time.Duration) {
 				continue
 			}
 
+			applyRates(c.last, &metrics)
+			c.last = &metrics
+
 			if err := c.storage.StoreMetrics(metrics); err != nil {
 				log.Printf("Error storing metrics: %v", err)
 			}
@@ -86,15 +111,48 @@ func (c *Collector) collectMetrics() (metrics.SystemMetrics, error) {
 		return metrics.SystemMetrics{}, err
 	}
 
-	return metrics.SystemMetrics{
-		Timestamp: now,
-		CPU:       cpuMetrics,
-		Memory:    memMetrics,
-		Disk:      diskMetrics,
-		Network:   networkMetrics,
-		Process:   processMetrics,
-		Uptime:    uptimeMetrics,
-	}, nil
+	// Cgroups are optional; a snapshot without them is still useful.
+	var cgroupMetrics []metrics.CgroupMetrics
+	if c.cgroups != nil {
+		cgroupMetrics, err = c.cgroups.collect()
+		if err != nil {
+			log.Printf("Error collecting cgroup metrics: %v", err)
+		}
+	}
+	var containerMetrics []metrics.ContainerMetrics
+	if c.docker != nil {
+		containerMetrics, err = c.collectContainerMetrics()
+		c.logDockerError(err)
+	}
+	var unitMetrics []metrics.UnitMetrics
+	if c.systemd != nil && len(c.systemdUnits) > 0 {
+		unitMetrics, err = c.collectUnitMetrics()
+		c.logSystemdError(err)
+	}
+
+	m := metrics.SystemMetrics{
+		Timestamp:  now,
+		CPU:        cpuMetrics,
+		Memory:     memMetrics,
+		Disk:       diskMetrics,
+		Network:    networkMetrics,
+		Process:    processMetrics,
+		Uptime:     uptimeMetrics,
+		Cgroups:    cgroupMetrics,
+		Containers: containerMetrics,
+		Units:      unitMetrics,
+	}
+	collectKernelMetrics(&m)
+	return m, nil
+}
+
+// perCoreUsage keys the usage of each core by its number, "0", "1" and so on
+func perCoreUsage(perCPU []float64) map[string]float64 {
+	usage := make(map[string]float64, len(perCPU))
+	for i, p := range perCPU {
+		usage[strconv.Itoa(i)] = p
+	}
+	return usage
 }
 
 func (c *Collector) collectCPUMetrics() (metrics.CPUMetrics, error) {
@@ -116,9 +174,7 @@ func (c *Collector) collectCPUMetrics() (metrics.CPUMetrics, error) {
 		return cpuMetrics, err
 	}
 
-	for i, p := range perCPU {
-		cpuMetrics.PerCoreUsage[string(rune(i))] = p
-	}
+	cpuMetrics.PerCoreUsage = perCoreUsage(perCPU)
 
 	loadAvg, err := load.Avg()
 	if err == nil {
@@ -197,6 +253,7 @@ func (c *Collector) collectDiskMetrics() (metrics.DiskMetrics, error) {
 			WriteBytes: counter.WriteBytes,
 			ReadTime:   counter.ReadTime,
 			WriteTime:  counter.WriteTime,
+			IoTime:     counter.IoTime,
 		}
 	}
 
@@ -288,6 +345,20 @@ func (c *Collector) collectProcessMetrics() ([]metrics.ProcessMetrics, error) {
 			processIO.WriteBytes = ioCounters.WriteBytes
 		}
 
+		openFiles, err := p.NumFDs()
+		if err != nil {
+			openFiles = 0
+		}
+
+		var maxOpenFiles uint64
+		if limits, err := p.Rlimit(); err == nil {
+			for _, limit := range limits {
+				if limit.Resource == process.RLIMIT_NOFILE && limit.Soft != math.MaxUint64 {
+					maxOpenFiles = limit.Soft
+				}
+			}
+		}
+
 		processMetric := metrics.ProcessMetrics{
 			PID:        p.Pid,
 			Name:       name,
@@ -298,6 +369,9 @@ func (c *Collector) collectProcessMetrics() ([]metrics.ProcessMetrics, error) {
 			CreateTime: createTime,
 			NumThreads: numThreads,
 			IOCounters: processIO,
+
+			OpenFiles:    openFiles,
+			MaxOpenFiles: maxOpenFiles,
 		}
 
 		processMetrics = append(processMetrics, processMetric)
@@ -0,0 +1,17 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPerCoreUsage(t *testing.T) {
+	got := perCoreUsage([]float64{12.5, 0, 99.9})
+	want := map[string]float64{"0": 12.5, "1": 0, "2": 99.9}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := perCoreUsage(nil); len(got) != 0 {
+		t.Errorf("no cores: got %v", got)
+	}
+}
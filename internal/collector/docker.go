@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"Golem/internal/docker"
+	"Golem/internal/metrics"
+)
+
+// WithDocker records every container of the Docker daemon behind client
+// with each snapshot, and enables the docker check type.
+func WithDocker(client *docker.Client) Option {
+	return func(c *Collector) {
+		c.docker = client
+	}
+}
+
+// collectContainerMetrics lists the daemon's containers, inspecting each
+// for its restart count and health
+func (c *Collector) collectContainerMetrics() ([]metrics.ContainerMetrics, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	list, err := c.docker.ListContainers(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]metrics.ContainerMetrics, 0, len(list))
+	for _, listed := range list {
+		info, err := c.docker.InspectContainer(ctx, listed.ID)
+		if errors.Is(err, docker.ErrNotFound) {
+			// Removed since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		container := metrics.ContainerMetrics{
+			ID:           info.ID,
+			Name:         info.Name,
+			Image:        info.Config.Image,
+			State:        info.State.Status,
+			RestartCount: info.RestartCount,
+			ExitCode:     info.State.ExitCode,
+			Labels:       info.Config.Labels,
+		}
+		if info.State.Health != nil {
+			container.Health = info.State.Health.Status
+		}
+		if !info.State.StartedAt.IsZero() {
+			container.StartedAt = info.State.StartedAt.Unix()
+		}
+		containers = append(containers, container)
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+	return containers, nil
+}
+
+// performDockerCheck checks that the container named by the target, or with
+// that ID, is running and not unhealthy. A container whose HEALTHCHECK has
+// not passed yet is a warning.
+func (c *HealthCheckCollector) performDockerCheck(result *metrics.HealthCheckResult, check metrics.HealthCheckConfig) {
+	if c.docker == nil {
+		result.Status = metrics.StatusUnknown
+		result.Message = "Docker is not available"
+		return
+	}
+
+	timeout := 5 * time.Second
+	if check.Timeout > 0 {
+		timeout = check.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	info, err := c.docker.InspectContainer(ctx, check.Target)
+	if errors.Is(err, docker.ErrNotFound) {
+		result.Status = metrics.StatusDown
+		result.Message = fmt.Sprintf("Container %s not found", check.Target)
+		return
+	}
+	if err != nil {
+		result.Status = metrics.StatusUnknown
+		result.Message = fmt.Sprintf("Error inspecting container: %v", err)
+		return
+	}
+
+	details := []string{info.Config.Image}
+	if info.RestartCount > 0 {
+		details = append(details, fmt.Sprintf("%d restarts", info.RestartCount))
+	}
+	state := info.State.Status
+	switch {
+	case state != "running":
+		result.Status = metrics.StatusDown
+		if state == "exited" || state == "dead" {
+			state += fmt.Sprintf(" with code %d", info.State.ExitCode)
+		}
+		if info.State.OOMKilled {
+			state += ", OOM killed"
+		}
+	case info.State.Health == nil:
+		result.Status = metrics.StatusUp
+	case info.State.Health.Status == docker.HealthHealthy:
+		result.Status = metrics.StatusUp
+		state += ", healthy"
+	case info.State.Health.Status == docker.HealthUnhealthy:
+		result.Status = metrics.StatusDown
+		state += fmt.Sprintf(", unhealthy (%d failed checks)", info.State.Health.FailingStreak)
+	default:
+		result.Status = metrics.StatusWarning
+		state += ", health " + info.State.Health.Status
+	}
+	result.Message = fmt.Sprintf("Container %s is %s (%s)", info.Name, state, strings.Join(details, ", "))
+}
+
+// logDockerError logs the first of a run of errors talking to Docker
+func (c *Collector) logDockerError(err error) {
+	if err == nil {
+		c.dockerFailing = false
+		return
+	}
+	if !c.dockerFailing {
+		log.Printf("Error collecting Docker containers: %v", err)
+		c.dockerFailing = true
+	}
+}
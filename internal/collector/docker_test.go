@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"path/filepath"
+	"testing"
+
+	"Golem/internal/docker"
+	"Golem/internal/docker/dockertest"
+	"Golem/internal/metrics"
+)
+
+// newDockerDaemon serves containers on a socket in a temporary directory and
+// returns it and a client for it
+func newDockerDaemon(t *testing.T, containers ...dockertest.Container) (*dockertest.Server, *docker.Client) {
+	t.Helper()
+	srv := &dockertest.Server{}
+	for _, c := range containers {
+		srv.Set(c)
+	}
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	if err := srv.Listen(socket); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv, docker.NewClient(socket)
+}
+
+func TestDockerCheck(t *testing.T) {
+	_, client := newDockerDaemon(t,
+		dockertest.Container{ID: "0123456789ab", Name: "web", Image: "nginx:1.27", Health: "healthy"},
+		dockertest.Container{Name: "worker", Image: "worker:latest", RestartCount: 2},
+		dockertest.Container{Name: "db", Image: "postgres:16", State: "exited", ExitCode: 137},
+		dockertest.Container{Name: "api", Image: "api:2", Health: "unhealthy"},
+		dockertest.Container{Name: "queue", Image: "rabbitmq:4", Health: "starting"},
+		dockertest.Container{Name: "cache", Image: "redis:7", State: "restarting", RestartCount: 5},
+	)
+	hc := NewCollector(nil, WithDocker(client)).NewHealthCheckCollector(nil)
+
+	tests := []struct {
+		target  string
+		status  metrics.HealthCheckStatus
+		message string
+	}{
+		{"web", metrics.StatusUp, "Container web is running, healthy (nginx:1.27)"},
+		{"0123456789ab", metrics.StatusUp, "Container web is running, healthy (nginx:1.27)"},
+		{"0123", metrics.StatusUp, "Container web is running, healthy (nginx:1.27)"},
+		{"worker", metrics.StatusUp, "Container worker is running (worker:latest, 2 restarts)"},
+		{"db", metrics.StatusDown, "Container db is exited with code 137 (postgres:16)"},
+		{"api", metrics.StatusDown, "Container api is running, unhealthy (3 failed checks) (api:2)"},
+		{"queue", metrics.StatusWarning, "Container queue is running, health starting (rabbitmq:4)"},
+		{"cache", metrics.StatusDown, "Container cache is restarting (redis:7, 5 restarts)"},
+		{"missing", metrics.StatusDown, "Container missing not found"},
+	}
+	for _, tt := range tests {
+		result, err := hc.runHealthCheck(metrics.HealthCheckConfig{ID: tt.target, Name: tt.target, Type: metrics.DockerCheck, Target: tt.target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != tt.status || result.Message != tt.message {
+			t.Errorf("%s: got %s %q, want %s %q", tt.target, result.Status, result.Message, tt.status, tt.message)
+		}
+	}
+}
+
+func TestDockerCheckWithoutDaemon(t *testing.T) {
+	srv, client := newDockerDaemon(t, dockertest.Container{Name: "web"})
+	srv.Close()
+
+	for name, hc := range map[string]*HealthCheckCollector{
+		"not configured": NewHealthCheckCollector(nil),
+		"not running":    NewCollector(nil, WithDocker(client)).NewHealthCheckCollector(nil),
+	} {
+		result, err := hc.runHealthCheck(metrics.HealthCheckConfig{Type: metrics.DockerCheck, Target: "web"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != metrics.StatusUnknown {
+			t.Errorf("%s: got %s %q, want %s", name, result.Status, result.Message, metrics.StatusUnknown)
+		}
+	}
+}
+
+func TestCollectContainerMetrics(t *testing.T) {
+	srv, client := newDockerDaemon(t,
+		dockertest.Container{Name: "web", Image: "nginx:1.27", Health: "healthy", Labels: map[string]string{"com.example.team": "ops"}},
+		dockertest.Container{Name: "db", Image: "postgres:16", State: "exited", ExitCode: 137, RestartCount: 1},
+	)
+	c := NewCollector(nil, WithDocker(client))
+
+	containers, err := c.collectContainerMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 || containers[0].Name != "db" || containers[1].Name != "web" {
+		t.Fatalf("got %+v, want db and web in order", containers)
+	}
+	db, web := containers[0], containers[1]
+	if db.State != "exited" || db.ExitCode != 137 || db.RestartCount != 1 || db.Image != "postgres:16" {
+		t.Errorf("db: got %+v", db)
+	}
+	if web.State != "running" || web.Health != "healthy" || web.Labels["com.example.team"] != "ops" || web.StartedAt == 0 {
+		t.Errorf("web: got %+v", web)
+	}
+
+	srv.Remove("db")
+	if containers, err = c.collectContainerMetrics(); err != nil || len(containers) != 1 {
+		t.Errorf("after removing db: got %d containers, %v", len(containers), err)
+	}
+
+	srv.Close()
+	if _, err := c.collectContainerMetrics(); err == nil {
+		t.Errorf("listed containers without a daemon")
+	}
+}
@@ -12,9 +12,11 @@ import (
 	"sync"
 	"time"
 
+	"Golem/internal/docker"
 	"Golem/internal/metrics"
 	"Golem/internal/plugin"
 	"Golem/internal/storage"
+	"Golem/internal/systemd"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
@@ -29,6 +31,8 @@ type HealthCheckCollector struct {
 	checks         map[string]metrics.HealthCheckConfig
 	results        map[string]metrics.HealthCheckResult
 	pluginRegistry *plugin.Registry
+	docker         *docker.Client
+	systemd        *systemd.Client
 }
 
 func NewHealthCheckCollector(storage storage.HealthCheckStorage) *HealthCheckCollector {
@@ -60,11 +64,14 @@ func (c *HealthCheckCollector) Start(ctx context.Context) {
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 
+	// Each check runs once per its own interval.
+	lastRun := make(map[string]time.Time)
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case now := <-ticker.C:
 			configs, err := c.storage.GetAllHealthCheckConfigs()
 			if err != nil {
 				log.Printf("Error getting health check configs: %v", err)
@@ -75,6 +82,10 @@ func (c *HealthCheckCollector) Start(ctx context.Context) {
 				if !config.Enabled {
 					continue
 				}
+				if last, ok := lastRun[config.ID]; ok && now.Sub(last) < config.Interval {
+					continue
+				}
+				lastRun[config.ID] = now
 
 				result, err := c.runHealthCheck(config)
 				if err != nil {
@@ -109,6 +120,10 @@ func (c *HealthCheckCollector) runHealthCheck(config metrics.HealthCheckConfig)
 		c.performDatabaseCheck(&result, config)
 	case metrics.APICheck:
 		c.performAPICheck(&result, config)
+	case metrics.DockerCheck:
+		c.performDockerCheck(&result, config)
+	case metrics.SystemdCheck:
+		c.performSystemdCheck(&result, config)
 	case "plugin":
 		c.performPluginCheck(&result, config)
 	default:
@@ -287,7 +302,6 @@ func (c *HealthCheckCollector) AddHealthCheck(config metrics.HealthCheckConfig)
 		config.ID = fmt.Sprintf("check_%d", time.Now().UnixNano())
 	}
 
-	config.Enabled = true
 	config.CreatedAt = time.Now()
 	config.UpdatedAt = time.Now()
 
@@ -309,19 +323,22 @@ func (c *HealthCheckCollector) UpdateHealthCheck(config metrics.HealthCheckConfi
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	_, exists := c.checks[config.ID]
-	if !exists {
+	// Storage is authoritative; checks created before a restart are not
+	// in c.checks.
+	if _, err := c.storage.GetHealthCheckConfig(config.ID); err != nil {
 		return fmt.Errorf("health check with ID %s not found", config.ID)
 	}
 
-	config.UpdatedAt = time.Now()
-
 	err := c.storage.StoreHealthCheckConfig(config)
 	if err != nil {
 		return err
 	}
 
-	c.checks[config.ID] = config
+	stored, err := c.storage.GetHealthCheckConfig(config.ID)
+	if err != nil {
+		return err
+	}
+	c.checks[config.ID] = stored
 	return nil
 }
 
@@ -329,7 +346,7 @@ func (c *HealthCheckCollector) DeleteHealthCheck(id string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if _, exists := c.checks[id]; !exists {
+	if _, err := c.storage.GetHealthCheckConfig(id); err != nil {
 		return fmt.Errorf("health check with ID %s not found", id)
 	}
 
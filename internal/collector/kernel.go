@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"Golem/internal/metrics"
+)
+
+// procRoot is where procfs is mounted
+const procRoot = "/proc"
+
+// tcpStates names the connection states in /proc/net/tcp, by their hex code
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+	"0C": "new_syn_recv",
+}
+
+// collectKernelMetrics fills in the Linux-only parts of m from procfs:
+// pressure stall information, context switches and interrupts, the file
+// handle table, sockets and entropy. Files a kernel does not provide leave
+// their fields at zero, and Pressure nil without PSI.
+func collectKernelMetrics(m *metrics.SystemMetrics) {
+	m.Pressure = readPressure(filepath.Join(procRoot, "pressure"))
+
+	eachLine(filepath.Join(procRoot, "stat"), func(fields []string) {
+		if len(fields) < 2 {
+			return
+		}
+		switch fields[0] {
+		case "ctxt":
+			m.CPU.ContextSwitches, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "intr":
+			m.CPU.Interrupts, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	})
+
+	// file-nr is allocated, allocated but unused (always 0 since 2.6) and max
+	eachLine(filepath.Join(procRoot, "sys/fs/file-nr"), func(fields []string) {
+		if len(fields) == 3 {
+			fd := &m.FileDescriptors
+			fd.Allocated, _ = strconv.ParseUint(fields[0], 10, 64)
+			fd.Max, _ = strconv.ParseUint(fields[2], 10, 64)
+			if fd.Max > 0 {
+				fd.UsedPercent = float64(fd.Allocated) / float64(fd.Max) * 100
+			}
+		}
+	})
+
+	m.Sockets.TCP = make(map[string]uint64)
+	for _, name := range []string{"net/tcp", "net/tcp6"} {
+		eachLine(filepath.Join(procRoot, name), func(fields []string) {
+			if len(fields) > 3 {
+				if state, ok := tcpStates[fields[3]]; ok {
+					m.Sockets.TCP[state]++
+				}
+			}
+		})
+	}
+	eachLine(filepath.Join(procRoot, "net/sockstat"), func(fields []string) {
+		if len(fields) == 3 && fields[0] == "sockets:" && fields[1] == "used" {
+			m.Sockets.Used, _ = strconv.ParseUint(fields[2], 10, 64)
+		}
+	})
+
+	m.Entropy.Available, _ = readUint(filepath.Join(procRoot, "sys/kernel/random/entropy_avail"))
+	m.Entropy.PoolSize, _ = readUint(filepath.Join(procRoot, "sys/kernel/random/poolsize"))
+}
+
+// readPressure reads the cpu, memory and io files under dir, each a "some"
+// and a "full" line of key=value pairs. Kernels before 5.13 have no "full"
+// line for cpu.
+func readPressure(dir string) *metrics.PressureMetrics {
+	if _, err := os.Stat(filepath.Join(dir, "cpu")); err != nil {
+		return nil
+	}
+	p := &metrics.PressureMetrics{}
+	for name, pressure := range map[string]*metrics.Pressure{"cpu": &p.CPU, "memory": &p.Memory, "io": &p.IO} {
+		eachLine(filepath.Join(dir, name), func(fields []string) {
+			var stall *metrics.PressureStall
+			switch fields[0] {
+			case "some":
+				stall = &pressure.Some
+			case "full":
+				stall = &pressure.Full
+			default:
+				return
+			}
+			for _, field := range fields[1:] {
+				key, value, _ := strings.Cut(field, "=")
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+				switch key {
+				case "avg10":
+					stall.Avg10 = n
+				case "avg60":
+					stall.Avg60 = n
+				case "avg300":
+					stall.Avg300 = n
+				case "total":
+					// Microseconds
+					stall.Total = n / 1e6
+				}
+			}
+		})
+	}
+	return p
+}
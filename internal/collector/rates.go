@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"Golem/internal/metrics"
+)
+
+// applyRates fills the derived per-second rate fields of cur using prev as
+// the baseline. Rates are left empty when there is no usable baseline: on the
+// first sample, after a reboot (BootTime changed) or when a device's counters
+// went backwards because the driver or interface was reset.
+func applyRates(prev *metrics.SystemMetrics, cur *metrics.SystemMetrics) {
+	cur.Disk.IORates = make(map[string]metrics.DiskIORate)
+	cur.Network.Rates = make(map[string]metrics.NetworkInterfaceRate)
+
+	if prev == nil || prev.Uptime.BootTime != cur.Uptime.BootTime {
+		return
+	}
+
+	elapsed := cur.Timestamp.Sub(prev.Timestamp).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	if cur.CPU.ContextSwitches >= prev.CPU.ContextSwitches && cur.CPU.Interrupts >= prev.CPU.Interrupts {
+		cur.CPU.ContextSwitchesPerSec = perSecond(prev.CPU.ContextSwitches, cur.CPU.ContextSwitches, elapsed)
+		cur.CPU.InterruptsPerSec = perSecond(prev.CPU.Interrupts, cur.CPU.Interrupts, elapsed)
+	}
+
+	for name, io := range cur.Disk.IOCounters {
+		last, ok := prev.Disk.IOCounters[name]
+		if !ok || diskCountersReset(last, io) {
+			continue
+		}
+
+		busy := float64(io.IoTime-last.IoTime) / (elapsed * 1000) * 100
+		if busy > 100 {
+			busy = 100
+		}
+
+		cur.Disk.IORates[name] = metrics.DiskIORate{
+			ReadBytesPerSec:  perSecond(last.ReadBytes, io.ReadBytes, elapsed),
+			WriteBytesPerSec: perSecond(last.WriteBytes, io.WriteBytes, elapsed),
+			ReadIOPS:         perSecond(last.ReadCount, io.ReadCount, elapsed),
+			WriteIOPS:        perSecond(last.WriteCount, io.WriteCount, elapsed),
+			BusyPercent:      busy,
+		}
+	}
+
+	for name, iface := range cur.Network.Interfaces {
+		last, ok := prev.Network.Interfaces[name]
+		if !ok || networkCountersReset(last, iface) {
+			continue
+		}
+
+		cur.Network.Rates[name] = metrics.NetworkInterfaceRate{
+			BytesSentPerSec:   perSecond(last.BytesSent, iface.BytesSent, elapsed),
+			BytesRecvPerSec:   perSecond(last.BytesRecv, iface.BytesRecv, elapsed),
+			PacketsSentPerSec: perSecond(last.PacketsSent, iface.PacketsSent, elapsed),
+			PacketsRecvPerSec: perSecond(last.PacketsRecv, iface.PacketsRecv, elapsed),
+			ErrinPerSec:       perSecond(last.Errin, iface.Errin, elapsed),
+			ErroutPerSec:      perSecond(last.Errout, iface.Errout, elapsed),
+			DropinPerSec:      perSecond(last.Dropin, iface.Dropin, elapsed),
+			DropoutPerSec:     perSecond(last.Dropout, iface.Dropout, elapsed),
+		}
+	}
+
+	// A cgroup using one CPU core fully is at 100%.
+	lastCgroups := make(map[string]metrics.CgroupMetrics, len(prev.Cgroups))
+	for _, c := range prev.Cgroups {
+		lastCgroups[c.Path] = c
+	}
+	for i := range cur.Cgroups {
+		c := &cur.Cgroups[i]
+		last, ok := lastCgroups[c.Path]
+		if !ok || c.CPUUsage < last.CPUUsage {
+			continue
+		}
+		c.CPUPercent = (c.CPUUsage - last.CPUUsage) / elapsed * 100
+	}
+}
+
+func diskCountersReset(prev, cur metrics.DiskIO) bool {
+	return cur.ReadCount < prev.ReadCount || cur.WriteCount < prev.WriteCount ||
+		cur.ReadBytes < prev.ReadBytes || cur.WriteBytes < prev.WriteBytes ||
+		cur.IoTime < prev.IoTime
+}
+
+func networkCountersReset(prev, cur metrics.NetworkInterface) bool {
+	return cur.BytesSent < prev.BytesSent || cur.BytesRecv < prev.BytesRecv ||
+		cur.PacketsSent < prev.PacketsSent || cur.PacketsRecv < prev.PacketsRecv ||
+		cur.Errin < prev.Errin || cur.Errout < prev.Errout ||
+		cur.Dropin < prev.Dropin || cur.Dropout < prev.Dropout
+}
+
+func perSecond(prev, cur uint64, elapsed float64) float64 {
+	return float64(cur-prev) / elapsed
+}
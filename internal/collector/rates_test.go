@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+var rateStart = time.Unix(1700000000, 0)
+
+// rateSample is a sample taken after seconds, since a boot at boot
+func rateSample(seconds int, boot uint64, disks map[string]metrics.DiskIO, ifaces map[string]metrics.NetworkInterface) *metrics.SystemMetrics {
+	return &metrics.SystemMetrics{
+		Timestamp: rateStart.Add(time.Duration(seconds) * time.Second),
+		Uptime:    metrics.UptimeMetrics{BootTime: boot},
+		Disk:      metrics.DiskMetrics{IOCounters: disks},
+		Network:   metrics.NetworkMetrics{Interfaces: ifaces},
+	}
+}
+
+func TestApplyRates(t *testing.T) {
+	sda := metrics.DiskIO{ReadBytes: 1000, WriteBytes: 2000, ReadCount: 10, WriteCount: 20, IoTime: 500}
+	sdaLater := metrics.DiskIO{ReadBytes: 3000, WriteBytes: 2000, ReadCount: 30, WriteCount: 24, IoTime: 1500}
+	sdaRate := metrics.DiskIORate{ReadBytesPerSec: 1000, ReadIOPS: 10, WriteIOPS: 2, BusyPercent: 50}
+	eth0 := metrics.NetworkInterface{BytesSent: 100, BytesRecv: 200, PacketsSent: 1, PacketsRecv: 2}
+	eth0Later := metrics.NetworkInterface{BytesSent: 300, BytesRecv: 600, PacketsSent: 3, PacketsRecv: 6, Dropin: 2}
+	eth0Rate := metrics.NetworkInterfaceRate{BytesSentPerSec: 100, BytesRecvPerSec: 200, PacketsSentPerSec: 1, PacketsRecvPerSec: 2, DropinPerSec: 1}
+
+	tests := []struct {
+		name     string
+		prev     *metrics.SystemMetrics
+		cur      *metrics.SystemMetrics
+		wantDisk map[string]metrics.DiskIORate
+		wantNet  map[string]metrics.NetworkInterfaceRate
+	}{
+		{
+			name:     "increase",
+			prev:     rateSample(0, 1, map[string]metrics.DiskIO{"sda": sda}, map[string]metrics.NetworkInterface{"eth0": eth0}),
+			cur:      rateSample(2, 1, map[string]metrics.DiskIO{"sda": sdaLater}, map[string]metrics.NetworkInterface{"eth0": eth0Later}),
+			wantDisk: map[string]metrics.DiskIORate{"sda": sdaRate},
+			wantNet:  map[string]metrics.NetworkInterfaceRate{"eth0": eth0Rate},
+		},
+		{
+			name:     "first sample",
+			cur:      rateSample(2, 1, map[string]metrics.DiskIO{"sda": sdaLater}, map[string]metrics.NetworkInterface{"eth0": eth0Later}),
+			wantDisk: map[string]metrics.DiskIORate{},
+			wantNet:  map[string]metrics.NetworkInterfaceRate{},
+		},
+		{
+			name:     "counters reset",
+			prev:     rateSample(0, 1, map[string]metrics.DiskIO{"sda": sdaLater, "sdb": sda}, map[string]metrics.NetworkInterface{"eth0": eth0Later, "eth1": eth0}),
+			cur:      rateSample(2, 1, map[string]metrics.DiskIO{"sda": sda, "sdb": sdaLater}, map[string]metrics.NetworkInterface{"eth0": eth0, "eth1": eth0Later}),
+			wantDisk: map[string]metrics.DiskIORate{"sdb": sdaRate},
+			wantNet:  map[string]metrics.NetworkInterfaceRate{"eth1": eth0Rate},
+		},
+		{
+			name:     "one counter wrapped",
+			prev:     rateSample(0, 1, map[string]metrics.DiskIO{"sda": sda}, map[string]metrics.NetworkInterface{"eth0": {BytesSent: 1 << 32}}),
+			cur:      rateSample(2, 1, map[string]metrics.DiskIO{"sda": {ReadBytes: 5000, WriteBytes: 2000, ReadCount: 10, WriteCount: 20, IoTime: 400}}, map[string]metrics.NetworkInterface{"eth0": {BytesSent: 10, BytesRecv: 1000}}),
+			wantDisk: map[string]metrics.DiskIORate{},
+			wantNet:  map[string]metrics.NetworkInterfaceRate{},
+		},
+		{
+			name:     "reboot",
+			prev:     rateSample(0, 1, map[string]metrics.DiskIO{"sda": sda}, map[string]metrics.NetworkInterface{"eth0": eth0}),
+			cur:      rateSample(2, 2, map[string]metrics.DiskIO{"sda": sdaLater}, map[string]metrics.NetworkInterface{"eth0": eth0Later}),
+			wantDisk: map[string]metrics.DiskIORate{},
+			wantNet:  map[string]metrics.NetworkInterfaceRate{},
+		},
+		{
+			name:     "devices added and removed",
+			prev:     rateSample(0, 1, map[string]metrics.DiskIO{"sda": sda, "sdc": sda}, map[string]metrics.NetworkInterface{"eth0": eth0, "veth1": eth0}),
+			cur:      rateSample(2, 1, map[string]metrics.DiskIO{"sda": sdaLater, "sdb": sdaLater}, map[string]metrics.NetworkInterface{"eth0": eth0Later, "veth2": eth0Later}),
+			wantDisk: map[string]metrics.DiskIORate{"sda": sdaRate},
+			wantNet:  map[string]metrics.NetworkInterfaceRate{"eth0": eth0Rate},
+		},
+		{
+			name:     "no time elapsed",
+			prev:     rateSample(2, 1, map[string]metrics.DiskIO{"sda": sda}, map[string]metrics.NetworkInterface{"eth0": eth0}),
+			cur:      rateSample(2, 1, map[string]metrics.DiskIO{"sda": sdaLater}, map[string]metrics.NetworkInterface{"eth0": eth0Later}),
+			wantDisk: map[string]metrics.DiskIORate{},
+			wantNet:  map[string]metrics.NetworkInterfaceRate{},
+		},
+		{
+			name:     "clock went back",
+			prev:     rateSample(2, 1, map[string]metrics.DiskIO{"sda": sda}, map[string]metrics.NetworkInterface{"eth0": eth0}),
+			cur:      rateSample(0, 1, map[string]metrics.DiskIO{"sda": sdaLater}, map[string]metrics.NetworkInterface{"eth0": eth0Later}),
+			wantDisk: map[string]metrics.DiskIORate{},
+			wantNet:  map[string]metrics.NetworkInterfaceRate{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applyRates(tt.prev, tt.cur)
+			if !reflect.DeepEqual(tt.cur.Disk.IORates, tt.wantDisk) {
+				t.Errorf("disk rates: got %+v, want %+v", tt.cur.Disk.IORates, tt.wantDisk)
+			}
+			if !reflect.DeepEqual(tt.cur.Network.Rates, tt.wantNet) {
+				t.Errorf("network rates: got %+v, want %+v", tt.cur.Network.Rates, tt.wantNet)
+			}
+		})
+	}
+}
+
+func TestApplyRatesCPU(t *testing.T) {
+	tests := []struct {
+		name                      string
+		prevSwitches, curSwitches uint64
+		prevUsage, curUsage       float64
+		wantSwitches, wantCPU     float64
+	}{
+		{"increase", 1000, 3000, 10, 11, 1000, 50},
+		{"counters reset", 3000, 1000, 11, 10, 0, 0},
+		{"idle", 1000, 1000, 10, 10, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := rateSample(0, 1, nil, nil)
+			prev.CPU.ContextSwitches = tt.prevSwitches
+			prev.Cgroups = []metrics.CgroupMetrics{{Path: "/web", CPUUsage: tt.prevUsage}}
+			cur := rateSample(2, 1, nil, nil)
+			cur.CPU.ContextSwitches = tt.curSwitches
+			cur.Cgroups = []metrics.CgroupMetrics{{Path: "/web", CPUUsage: tt.curUsage}, {Path: "/new", CPUUsage: 5}}
+
+			applyRates(prev, cur)
+			if cur.CPU.ContextSwitchesPerSec != tt.wantSwitches {
+				t.Errorf("context switches: got %v/s, want %v/s", cur.CPU.ContextSwitchesPerSec, tt.wantSwitches)
+			}
+			if cur.Cgroups[0].CPUPercent != tt.wantCPU {
+				t.Errorf("cgroup CPU: got %v%%, want %v%%", cur.Cgroups[0].CPUPercent, tt.wantCPU)
+			}
+			if cur.Cgroups[1].CPUPercent != 0 {
+				t.Errorf("new cgroup has CPU %v%% without a baseline", cur.Cgroups[1].CPUPercent)
+			}
+		})
+	}
+}
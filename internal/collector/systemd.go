@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"Golem/internal/metrics"
+	"Golem/internal/systemd"
+)
+
+// WithSystemd records the systemd units matching patterns with each
+// snapshot, and enables the systemd check type. With no patterns only the
+// check type is enabled.
+func WithSystemd(client *systemd.Client, patterns ...string) Option {
+	return func(c *Collector) {
+		c.systemd = client
+		c.systemdUnits = patterns
+	}
+}
+
+// collectUnitMetrics reads the state of the units matching c.systemdUnits
+func (c *Collector) collectUnitMetrics() ([]metrics.UnitMetrics, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	found, err := c.systemd.Units(ctx, c.systemdUnits...)
+	if err != nil {
+		return nil, err
+	}
+	units := make([]metrics.UnitMetrics, 0, len(found))
+	for _, u := range found {
+		if !u.Found() {
+			continue
+		}
+		units = append(units, metrics.UnitMetrics{
+			Name:          u.Name,
+			Description:   u.Description,
+			LoadState:     u.LoadState,
+			ActiveState:   u.ActiveState,
+			SubState:      u.SubState,
+			Result:        u.Result,
+			Restarts:      u.Restarts,
+			MainPID:       u.MainPID,
+			MemoryCurrent: u.MemoryCurrent,
+			CPUUsage:      float64(u.CPUUsage) / 1e9,
+		})
+	}
+	return units, nil
+}
+
+// performSystemdCheck checks the unit named by the target, or every unit
+// matching it when it is a glob. A failed, missing or stopped unit is down
+// and a unit still starting or reloading is a warning. Units that are meant
+// to stop, such as oneshot services, can be allowed to be inactive with the
+// allow_inactive option.
+func (c *HealthCheckCollector) performSystemdCheck(result *metrics.HealthCheckResult, check metrics.HealthCheckConfig) {
+	if c.systemd == nil {
+		result.Status = metrics.StatusUnknown
+		result.Message = "systemd is not available"
+		return
+	}
+
+	timeout := 5 * time.Second
+	if check.Timeout > 0 {
+		timeout = check.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	units, err := c.systemd.Units(ctx, check.Target)
+	if err != nil {
+		result.Status = metrics.StatusUnknown
+		result.Message = fmt.Sprintf("Error reading units: %v", err)
+		return
+	}
+	allowInactive := check.Options["allow_inactive"] == "true"
+
+	var failed, missing, stopped, changing []string
+	active := 0
+	for _, u := range units {
+		switch {
+		case !u.Found():
+			missing = append(missing, u.Name)
+		case u.Failed():
+			failed = append(failed, describeUnit(u))
+		case u.ActiveState == "active":
+			active++
+		case u.ActiveState == "inactive":
+			if allowInactive {
+				active++
+			} else {
+				stopped = append(stopped, u.Name)
+			}
+		default:
+			changing = append(changing, u.Name+" "+u.ActiveState)
+		}
+	}
+
+	switch {
+	case len(units) == 0:
+		result.Status = metrics.StatusDown
+		result.Message = fmt.Sprintf("No units match %s", check.Target)
+		return
+	case len(failed) > 0 || len(missing) > 0 || len(stopped) > 0:
+		result.Status = metrics.StatusDown
+	case len(changing) > 0:
+		result.Status = metrics.StatusWarning
+	default:
+		result.Status = metrics.StatusUp
+	}
+
+	if len(units) == 1 {
+		u := units[0]
+		switch {
+		case !u.Found():
+			result.Message = fmt.Sprintf("Unit %s not found", u.Name)
+		case u.Failed():
+			result.Message = fmt.Sprintf("Unit %s", describeUnit(u))
+		default:
+			result.Message = fmt.Sprintf("Unit %s is %s (%s)", u.Name, u.ActiveState, u.SubState)
+			if u.Restarts > 0 {
+				result.Message += fmt.Sprintf(", %d restarts", u.Restarts)
+			}
+		}
+		return
+	}
+
+	parts := []string{fmt.Sprintf("%d of %d units active", active, len(units))}
+	if len(failed) > 0 {
+		parts = append(parts, strings.Join(failed, ", "))
+	}
+	if len(stopped) > 0 {
+		parts = append(parts, "inactive: "+strings.Join(stopped, ", "))
+	}
+	if len(missing) > 0 {
+		parts = append(parts, "not found: "+strings.Join(missing, ", "))
+	}
+	if len(changing) > 0 {
+		parts = append(parts, strings.Join(changing, ", "))
+	}
+	result.Message = strings.Join(parts, "; ")
+}
+
+// describeUnit names a failed unit and why it failed
+func describeUnit(u systemd.Unit) string {
+	if u.Result != "" && u.Result != "success" {
+		return fmt.Sprintf("%s failed (%s)", u.Name, u.Result)
+	}
+	return u.Name + " failed"
+}
+
+// logSystemdError logs the first of a run of errors reading systemd units
+func (c *Collector) logSystemdError(err error) {
+	if err == nil {
+		c.systemdFailing = false
+		return
+	}
+	if !c.systemdFailing {
+		log.Printf("Error collecting systemd units: %v", err)
+		c.systemdFailing = true
+	}
+}
@@ -0,0 +1,152 @@
+// Package docker is a small client for the Docker Engine API over its Unix
+// socket.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultSocket is where the Docker daemon listens by default
+const DefaultSocket = "/var/run/docker.sock"
+
+// ErrNotFound is returned for a container that does not exist
+var ErrNotFound = errors.New("no such container")
+
+// Health states of a container with a HEALTHCHECK
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Client talks to one Docker daemon
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client for the daemon listening on socket
+func NewClient(socket string) *Client {
+	return &Client{http: &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}}
+}
+
+// Container is a container as listed by the Engine API
+type Container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	State  string            `json:"State"`
+	Status string            `json:"Status"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// Name is the container's name without the leading slash
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// ContainerInfo is a container as inspected by the Engine API
+type ContainerInfo struct {
+	ID           string         `json:"Id"`
+	Name         string         `json:"Name"`
+	Image        string         `json:"Image"`
+	RestartCount int            `json:"RestartCount"`
+	State        ContainerState `json:"State"`
+	Config       struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// ContainerState is the run state of a container. Status is one of
+// created, running, paused, restarting, removing, exited or dead.
+type ContainerState struct {
+	Status     string    `json:"Status"`
+	Running    bool      `json:"Running"`
+	OOMKilled  bool      `json:"OOMKilled"`
+	ExitCode   int       `json:"ExitCode"`
+	StartedAt  time.Time `json:"StartedAt"`
+	FinishedAt time.Time `json:"FinishedAt"`
+	// Health is nil for containers without a HEALTHCHECK
+	Health *ContainerHealth `json:"Health,omitempty"`
+}
+
+// ContainerHealth is the result of a container's HEALTHCHECK
+type ContainerHealth struct {
+	Status        string `json:"Status"`
+	FailingStreak int    `json:"FailingStreak"`
+}
+
+// ListContainers returns the running containers, or all of them
+func (c *Client) ListContainers(ctx context.Context, all bool) ([]Container, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	var containers []Container
+	if err := c.get(ctx, "/containers/json?"+query.Encode(), &containers); err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+	return containers, nil
+}
+
+// InspectContainer returns a container by ID or name
+func (c *Client) InspectContainer(ctx context.Context, idOrName string) (*ContainerInfo, error) {
+	var info ContainerInfo
+	if err := c.get(ctx, "/containers/"+url.PathEscape(idOrName)+"/json", &info); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, idOrName)
+		}
+		return nil, fmt.Errorf("failed to inspect container %s: %v", idOrName, err)
+	}
+	info.Name = strings.TrimPrefix(info.Name, "/")
+	return &info, nil
+}
+
+// get decodes the JSON response to a GET of path into v
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	// The host is ignored; every request goes to the socket.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,197 @@
+// Package dockertest implements a minimal Docker Engine API for trying out
+// and testing Golem's Docker integration without a Docker daemon.
+//
+// It serves the container list and inspect endpoints, with or without a
+// /v1.xx version prefix, from containers set by the caller. Typical use from
+// a test:
+//
+//	srv := &dockertest.Server{}
+//	srv.Set(dockertest.Container{Name: "web", State: "running", Health: "healthy"})
+//	srv.Listen(filepath.Join(t.TempDir(), "docker.sock"))
+//	defer srv.Close()
+//	client := docker.NewClient(socket)
+package dockertest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"Golem/internal/docker"
+)
+
+// Container is a container of the mock daemon
+type Container struct {
+	// ID defaults to a hash of Name
+	ID    string
+	Name  string
+	Image string
+	// State is running, exited, restarting, paused, created or dead
+	State string
+	// Health is starting, healthy or unhealthy; empty for no HEALTHCHECK
+	Health       string
+	RestartCount int
+	ExitCode     int
+	Labels       map[string]string
+	StartedAt    time.Time
+}
+
+// Server is the mock Engine API
+type Server struct {
+	mu         sync.Mutex
+	containers map[string]Container
+	server     *http.Server
+	socket     string
+}
+
+// Set adds a container or replaces the one with the same name
+func (s *Server) Set(c Container) {
+	if c.ID == "" {
+		sum := sha256.Sum256([]byte(c.Name))
+		c.ID = hex.EncodeToString(sum[:])
+	}
+	if c.Image == "" {
+		c.Image = "alpine:latest"
+	}
+	if c.State == "" {
+		c.State = "running"
+	}
+	if c.StartedAt.IsZero() {
+		c.StartedAt = time.Now().UTC()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.containers == nil {
+		s.containers = map[string]Container{}
+	}
+	s.containers[c.Name] = c
+}
+
+// Remove deletes the container named name
+func (s *Server) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.containers, name)
+}
+
+// Listen starts serving on the Unix socket at path, replacing a stale one
+func (s *Server) Listen(path string) error {
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	s.socket = path
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(l)
+	return nil
+}
+
+// Close stops the server and removes its socket
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	err := s.server.Close()
+	os.Remove(s.socket)
+	return err
+}
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+\.[0-9]+`)
+
+// ServeHTTP implements GET /containers/json and GET /containers/{id}/json
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "")
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if path == "/containers/json" {
+		s.list(w, r.URL.Query().Get("all") == "1" || r.URL.Query().Get("all") == "true")
+		return
+	}
+	if id, ok := strings.CutPrefix(path, "/containers/"); ok {
+		if id, ok := strings.CutSuffix(id, "/json"); ok && !strings.Contains(id, "/") {
+			s.inspect(w, id)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "page not found")
+}
+
+func (s *Server) list(w http.ResponseWriter, all bool) {
+	s.mu.Lock()
+	list := []docker.Container{}
+	for _, c := range s.containers {
+		if !all && c.State != "running" {
+			continue
+		}
+		status := c.State
+		if c.Health != "" {
+			status += " (" + c.Health + ")"
+		}
+		list = append(list, docker.Container{
+			ID: c.ID, Names: []string{"/" + c.Name}, Image: c.Image,
+			State: c.State, Status: status, Labels: c.Labels,
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Names[0] < list[j].Names[0] })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// inspect finds a container by name, ID or ID prefix, as Docker does
+func (s *Server) inspect(w http.ResponseWriter, idOrName string) {
+	s.mu.Lock()
+	var found *Container
+	for _, c := range s.containers {
+		if c.Name == strings.TrimPrefix(idOrName, "/") || strings.HasPrefix(c.ID, idOrName) {
+			found = &c
+			break
+		}
+	}
+	s.mu.Unlock()
+	if found == nil {
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+
+	info := docker.ContainerInfo{
+		ID:           found.ID,
+		Name:         "/" + found.Name,
+		Image:        "sha256:" + found.ID,
+		RestartCount: found.RestartCount,
+		State: docker.ContainerState{
+			Status:    found.State,
+			Running:   found.State == "running" || found.State == "paused",
+			ExitCode:  found.ExitCode,
+			StartedAt: found.StartedAt,
+		},
+	}
+	info.Config.Image = found.Image
+	info.Config.Labels = found.Labels
+	if found.Health != "" {
+		info.State.Health = &docker.ContainerHealth{Status: found.Health}
+		if found.Health == docker.HealthUnhealthy {
+			info.State.Health.FailingStreak = 3
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
@@ -0,0 +1,162 @@
+// Package mail sends plain text email over SMTP.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// TLS modes of an SMTP connection
+const (
+	// TLSStartTLS upgrades the connection with STARTTLS and fails if the
+	// server does not offer it
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects with TLS, usually on port 465
+	TLSImplicit = "tls"
+	// TLSNone sends in the clear, for a relay on the same host
+	TLSNone = "none"
+)
+
+// SMTPMailer sends messages through an SMTP server
+type SMTPMailer struct {
+	// Addr is the server as host:port
+	Addr string
+	// Username and Password authenticate with PLAIN if set
+	Username string
+	Password string
+	From     string
+	// TLS is TLSStartTLS (the default), TLSImplicit or TLSNone
+	TLS                string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+// Send delivers msg
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := m.format(msg)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address %q: %v", m.Addr, err)
+	}
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: m.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if m.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", m.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", m.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %v", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %v", err)
+	}
+	defer c.Close()
+
+	if m.TLS == "" || m.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %v", err)
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return fmt.Errorf("failed to authenticate with SMTP server: %v", err)
+		}
+	}
+	if err := c.Mail(m.from().Address); err != nil {
+		return fmt.Errorf("SMTP server refused sender: %v", err)
+	}
+	to, _ := mail.ParseAddress(msg.To)
+	if err := c.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("SMTP server refused recipient: %v", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	return c.Quit()
+}
+
+func (m *SMTPMailer) from() *mail.Address {
+	if addr, err := mail.ParseAddress(m.From); err == nil {
+		return addr
+	}
+	return &mail.Address{Name: "Golem", Address: "golem@localhost"}
+}
+
+// format renders msg with headers, quoted-printable encoded
+func (m *SMTPMailer) format(msg *Message) ([]byte, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %v", msg.To, err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("subject must be a single line")
+	}
+	from := m.from()
+	id := make([]byte, 16)
+	rand.Read(id)
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,237 @@
+// Package mailtest implements a minimal in-process SMTP server for trying out
+// and testing Golem's email delivery without a real mail server.
+//
+// It accepts any sender, recipient and AUTH PLAIN credentials, supports
+// STARTTLS when TLSConfig is set, and keeps every message it receives. Typical
+// use from a test:
+//
+//	srv := &mailtest.Server{}
+//	addr, _ := srv.Listen("127.0.0.1:0")
+//	defer srv.Close()
+//	mailer := &mail.SMTPMailer{Addr: addr, TLS: mail.TLSNone}
+package mailtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"strings"
+	"sync"
+)
+
+// Message is a received message
+type Message struct {
+	From string
+	To   []string
+	// Subject and Body are decoded
+	Subject string
+	Body    string
+	// Data is the message as sent
+	Data []byte
+}
+
+// Server is the SMTP server
+type Server struct {
+	// TLSConfig enables STARTTLS
+	TLSConfig *tls.Config
+	// OnMessage, if set, is called with each message received
+	OnMessage func(*Message)
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	messages []*Message
+}
+
+// Listen starts serving on addr and returns the address it listens on
+func (s *Server) Listen(addr string) (string, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.listener = l
+	s.conns = map[net.Conn]struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return l.Addr().String(), nil
+}
+
+// Close stops the server and closes open connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// Messages returns the messages received so far
+func (s *Server) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Message(nil), s.messages...)
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) bool {
+		_, err := io.WriteString(conn, line+"\r\n")
+		return err == nil
+	}
+	if !reply("220 localhost golem mailtest ready") {
+		return
+	}
+
+	var msg *Message
+	tlsActive := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			reply("250 localhost")
+		case "EHLO":
+			ext := []string{"250-localhost", "250-8BITMIME", "250-AUTH PLAIN"}
+			if s.TLSConfig != nil && !tlsActive {
+				ext = append(ext, "250-STARTTLS")
+			}
+			reply(strings.Join(ext, "\r\n") + "\r\n250 SIZE 10485760")
+		case "STARTTLS":
+			if s.TLSConfig == nil || tlsActive {
+				reply("502 STARTTLS not available")
+				continue
+			}
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.TLSConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			r = bufio.NewReader(conn)
+			tlsActive = true
+			msg = nil
+		case "AUTH":
+			reply("235 authenticated")
+		case "MAIL":
+			msg = &Message{From: addrArg(arg)}
+			reply("250 ok")
+		case "RCPT":
+			if msg == nil {
+				reply("503 need MAIL first")
+				continue
+			}
+			msg.To = append(msg.To, addrArg(arg))
+			reply("250 ok")
+		case "DATA":
+			if msg == nil || len(msg.To) == 0 {
+				reply("503 need RCPT first")
+				continue
+			}
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := readData(r)
+			if err != nil {
+				return
+			}
+			msg.Data = data
+			parse(msg)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			if s.OnMessage != nil {
+				s.OnMessage(msg)
+			}
+			msg = nil
+			reply("250 queued")
+		case "RSET":
+			msg = nil
+			reply("250 ok")
+		case "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// addrArg returns the address of a "FROM:<addr>" or "TO:<addr>" argument
+func addrArg(arg string) string {
+	if i := strings.IndexByte(arg, '<'); i >= 0 {
+		arg = arg[i+1:]
+		if j := strings.IndexByte(arg, '>'); j >= 0 {
+			arg = arg[:j]
+		}
+	}
+	return arg
+}
+
+// readData reads a message up to the terminating "." line, undoing dot
+// stuffing
+func readData(r *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return buf.Bytes(), nil
+		}
+		buf.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+// parse fills in the decoded subject and body of msg
+func parse(msg *Message) {
+	m, err := netmail.ReadMessage(bytes.NewReader(msg.Data))
+	if err != nil {
+		msg.Body = string(msg.Data)
+		return
+	}
+	subject := m.Header.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	msg.Subject = subject
+	body := m.Body
+	if strings.EqualFold(m.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	data, _ := io.ReadAll(body)
+	msg.Body = strings.ReplaceAll(string(data), "\r\n", "\n")
+}
@@ -0,0 +1,205 @@
+// Package manifest converts health checks to and from versioned YAML/JSON
+// manifests and plans the changes needed to make the store match one.
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"Golem/internal/metrics"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	APIVersion = "golem/v1"
+	Kind       = "HealthChecks"
+)
+
+const (
+	defaultInterval = 60 * time.Second
+	defaultTimeout  = 10 * time.Second
+)
+
+// checkTypes are the types a manifest may use.
+var checkTypes = map[metrics.HealthCheckType]bool{
+	metrics.HTTPCheck:     true,
+	metrics.TCPCheck:      true,
+	metrics.DatabaseCheck: true,
+	metrics.APICheck:      true,
+	metrics.DockerCheck:   true,
+	metrics.SystemdCheck:  true,
+	"plugin":              true,
+}
+
+type Manifest struct {
+	APIVersion string  `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string  `json:"kind" yaml:"kind"`
+	Checks     []Check `json:"checks" yaml:"checks"`
+}
+
+// Check is a health check keyed by its name. IDs are not part of a manifest,
+// so the same file can be applied to any Golem instance.
+type Check struct {
+	Name       string                  `json:"name" yaml:"name"`
+	Type       metrics.HealthCheckType `json:"type" yaml:"type"`
+	Target     string                  `json:"target" yaml:"target"`
+	Interval   Duration                `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout    Duration                `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Enabled    *bool                   `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Labels     map[string]string       `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Team       string                  `json:"team,omitempty" yaml:"team,omitempty"`
+	Method     string                  `json:"method,omitempty" yaml:"method,omitempty"`
+	Headers    map[string]string       `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body       string                  `json:"body,omitempty" yaml:"body,omitempty"`
+	ExpectCode int                     `json:"expect_code,omitempty" yaml:"expect_code,omitempty"`
+	ExpectBody string                  `json:"expect_body,omitempty" yaml:"expect_body,omitempty"`
+	PluginName string                  `json:"plugin_name,omitempty" yaml:"plugin_name,omitempty"`
+	Options    map[string]string       `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// Duration is a time.Duration written as a Go duration string such as "30s".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Parse reads a YAML or JSON manifest and validates it.
+func Parse(r io.Reader) (Manifest, error) {
+	var m Manifest
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		if err == io.EOF {
+			return m, fmt.Errorf("manifest is empty")
+		}
+		return m, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	if err := m.Validate(); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+func (m Manifest) Validate() error {
+	if m.APIVersion != APIVersion {
+		return fmt.Errorf("unsupported apiVersion %q, expected %q", m.APIVersion, APIVersion)
+	}
+	if m.Kind != Kind {
+		return fmt.Errorf("unsupported kind %q, expected %q", m.Kind, Kind)
+	}
+
+	seen := make(map[string]bool)
+	for i, c := range m.Checks {
+		if c.Name == "" {
+			return fmt.Errorf("check %d: name cannot be empty", i+1)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("check %q: duplicate name", c.Name)
+		}
+		seen[c.Name] = true
+
+		if c.Target == "" {
+			return fmt.Errorf("check %q: target cannot be empty", c.Name)
+		}
+		if !checkTypes[c.Type] {
+			return fmt.Errorf("check %q: unknown type %q", c.Name, c.Type)
+		}
+		if c.Interval < 0 || c.Timeout < 0 {
+			return fmt.Errorf("check %q: interval and timeout must be positive", c.Name)
+		}
+	}
+	return nil
+}
+
+// Export builds a manifest from stored configs.
+func Export(configs []metrics.HealthCheckConfig) Manifest {
+	m := Manifest{APIVersion: APIVersion, Kind: Kind, Checks: make([]Check, 0, len(configs))}
+	for _, config := range configs {
+		enabled := config.Enabled
+		m.Checks = append(m.Checks, Check{
+			Name:       config.Name,
+			Type:       config.Type,
+			Target:     config.Target,
+			Interval:   Duration(config.Interval),
+			Timeout:    Duration(config.Timeout),
+			Enabled:    &enabled,
+			Labels:     config.Labels,
+			Team:       config.Team,
+			Method:     config.Method,
+			Headers:    config.Headers,
+			Body:       config.Body,
+			ExpectCode: config.ExpectCode,
+			ExpectBody: config.ExpectBody,
+			PluginName: config.PluginName,
+			Options:    config.Options,
+		})
+	}
+	return m
+}
+
+// Marshal encodes m as "yaml" or "json".
+func Marshal(m Manifest, format string) ([]byte, error) {
+	switch format {
+	case "", "yaml", "yml":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(m); err != nil {
+			return nil, fmt.Errorf("failed to encode manifest: %v", err)
+		}
+		enc.Close()
+		return buf.Bytes(), nil
+	case "json":
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode manifest: %v", err)
+		}
+		return append(data, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// config returns the stored form of c, with defaults filled in.
+func (c Check) config() metrics.HealthCheckConfig {
+	config := metrics.HealthCheckConfig{
+		Name:       c.Name,
+		Type:       c.Type,
+		Target:     c.Target,
+		Interval:   time.Duration(c.Interval),
+		Timeout:    time.Duration(c.Timeout),
+		Enabled:    c.Enabled == nil || *c.Enabled,
+		Labels:     c.Labels,
+		Team:       c.Team,
+		Method:     c.Method,
+		Headers:    c.Headers,
+		Body:       c.Body,
+		ExpectCode: c.ExpectCode,
+		ExpectBody: c.ExpectBody,
+		PluginName: c.PluginName,
+		Options:    c.Options,
+	}
+	if config.Interval == 0 {
+		config.Interval = defaultInterval
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	return config
+}
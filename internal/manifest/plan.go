@@ -0,0 +1,129 @@
+package manifest
+
+import (
+	"fmt"
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionUpdate    Action = "update"
+	ActionDelete    Action = "delete"
+	ActionUnchanged Action = "unchanged"
+)
+
+type Change struct {
+	Action  Action                 `json:"action"`
+	Name    string                 `json:"name"`
+	ID      string                 `json:"id,omitempty"`
+	Changes []metrics.ConfigChange `json:"changes,omitempty"`
+
+	config metrics.HealthCheckConfig
+}
+
+type Summary struct {
+	Create    int `json:"create"`
+	Update    int `json:"update"`
+	Delete    int `json:"delete"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Plan lists, in manifest order, what applying a manifest does to each
+// check. Deletions come last.
+type Plan struct {
+	Changes []Change `json:"changes"`
+	Summary Summary  `json:"summary"`
+}
+
+// NewPlan matches the manifest's checks to current configs by name. Checks
+// missing from the manifest are deleted only when prune is set.
+func NewPlan(current []metrics.HealthCheckConfig, m Manifest, prune bool) (Plan, error) {
+	byName := make(map[string]metrics.HealthCheckConfig, len(current))
+	for _, config := range current {
+		if _, dup := byName[config.Name]; dup {
+			return Plan{}, fmt.Errorf("cannot match by name: more than one check is named %q", config.Name)
+		}
+		byName[config.Name] = config
+	}
+
+	plan := Plan{Changes: []Change{}}
+	inManifest := make(map[string]bool, len(m.Checks))
+	for _, c := range m.Checks {
+		inManifest[c.Name] = true
+		want := c.config()
+
+		existing, ok := byName[c.Name]
+		if !ok {
+			plan.add(Change{Action: ActionCreate, Name: c.Name, config: want})
+			continue
+		}
+
+		want.ID = existing.ID
+		want.CreatedAt = existing.CreatedAt
+		change := Change{Action: ActionUnchanged, Name: c.Name, ID: existing.ID, config: want}
+		if diff := want.Diff(existing); len(diff) > 0 {
+			change.Action = ActionUpdate
+			change.Changes = diff
+		}
+		plan.add(change)
+	}
+
+	if prune {
+		for _, config := range current {
+			if !inManifest[config.Name] {
+				plan.add(Change{Action: ActionDelete, Name: config.Name, ID: config.ID, config: config})
+			}
+		}
+	}
+	return plan, nil
+}
+
+func (p *Plan) add(c Change) {
+	p.Changes = append(p.Changes, c)
+	switch c.Action {
+	case ActionCreate:
+		p.Summary.Create++
+	case ActionUpdate:
+		p.Summary.Update++
+	case ActionDelete:
+		p.Summary.Delete++
+	case ActionUnchanged:
+		p.Summary.Unchanged++
+	}
+}
+
+// Applier is implemented by collector.HealthCheckCollector.
+type Applier interface {
+	AddHealthCheck(config metrics.HealthCheckConfig) error
+	UpdateHealthCheck(config metrics.HealthCheckConfig) error
+	DeleteHealthCheck(id string) error
+}
+
+// Apply carries out the plan and fills in the IDs of created checks. It
+// stops at the first error; changes before it stay applied, and applying
+// the same manifest again picks up where it left off.
+func (p *Plan) Apply(a Applier) error {
+	for i := range p.Changes {
+		c := &p.Changes[i]
+
+		var err error
+		switch c.Action {
+		case ActionCreate:
+			c.config.ID = fmt.Sprintf("check_%d_%d", time.Now().UnixNano(), i)
+			c.ID = c.config.ID
+			err = a.AddHealthCheck(c.config)
+		case ActionUpdate:
+			err = a.UpdateHealthCheck(c.config)
+		case ActionDelete:
+			err = a.DeleteHealthCheck(c.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s check %q: %v", c.Action, c.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import "sort"
+
+// HealthCheckGroup summarizes the enabled checks sharing a label value.
+// Status is the worst status among them.
+type HealthCheckGroup struct {
+	Label     string            `json:"label,omitempty"`
+	Value     string            `json:"value,omitempty"`
+	Status    HealthCheckStatus `json:"status"`
+	Total     int               `json:"total"`
+	Up        int               `json:"up"`
+	Warning   int               `json:"warning"`
+	Down      int               `json:"down"`
+	Unknown   int               `json:"unknown"`
+	PercentUp float64           `json:"percent_up"`
+	Checks    []string          `json:"checks"`
+}
+
+var statusSeverity = map[HealthCheckStatus]int{
+	StatusUp:      0,
+	StatusUnknown: 1,
+	StatusWarning: 2,
+	StatusDown:    3,
+}
+
+// WorseStatus returns whichever of a and b is more severe.
+func WorseStatus(a, b HealthCheckStatus) HealthCheckStatus {
+	if statusSeverity[b] > statusSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// GroupHealthChecks groups enabled configs by the value of label, using
+// results for their current status. Checks without a result count as
+// unknown. With an empty label everything forms a single group.
+func GroupHealthChecks(configs []HealthCheckConfig, results map[string]HealthCheckResult, label string) []HealthCheckGroup {
+	groups := make(map[string]*HealthCheckGroup)
+	var order []string
+
+	for _, config := range configs {
+		if !config.Enabled {
+			continue
+		}
+		value := ""
+		if label != "" {
+			value = config.Labels[label]
+		}
+
+		g, ok := groups[value]
+		if !ok {
+			g = &HealthCheckGroup{Label: label, Value: value, Status: StatusUp, Checks: []string{}}
+			groups[value] = g
+			order = append(order, value)
+		}
+
+		status := StatusUnknown
+		if result, ok := results[config.ID]; ok && result.Status != "" {
+			status = result.Status
+		}
+		switch status {
+		case StatusUp:
+			g.Up++
+		case StatusWarning:
+			g.Warning++
+		case StatusDown:
+			g.Down++
+		default:
+			g.Unknown++
+		}
+		g.Total++
+		g.Status = WorseStatus(g.Status, status)
+		g.Checks = append(g.Checks, config.ID)
+	}
+
+	if label == "" && len(groups) == 0 {
+		return []HealthCheckGroup{{Status: StatusUnknown, Checks: []string{}}}
+	}
+
+	sort.Strings(order)
+	out := make([]HealthCheckGroup, 0, len(order))
+	for _, value := range order {
+		g := groups[value]
+		g.PercentUp = float64(g.Up) / float64(g.Total) * 100
+		out = append(out, *g)
+	}
+	return out
+}
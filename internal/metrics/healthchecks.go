@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"encoding/json"
+	"reflect"
+	"sort"
 	"time"
 )
 
@@ -11,6 +14,11 @@ const (
 	TCPCheck      HealthCheckType = "tcp"
 	DatabaseCheck HealthCheckType = "database"
 	APICheck      HealthCheckType = "api"
+	// DockerCheck targets a container by name or ID
+	DockerCheck HealthCheckType = "docker"
+	// SystemdCheck targets a systemd unit by name, or a family of units by
+	// glob such as worker@*
+	SystemdCheck HealthCheckType = "systemd"
 )
 
 type HealthCheckStatus string
@@ -35,7 +43,11 @@ type HealthCheckConfig struct {
 	ExpectCode int               `json:"expect_code,omitempty"`
 	ExpectBody string            `json:"expect_body,omitempty"`
 	PluginName string            `json:"plugin_name,omitempty"`
+	Options    map[string]string `json:"options,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Team       string            `json:"team,omitempty"`
 	Enabled    bool              `json:"enabled"`
+	Revision   int               `json:"revision"`
 	CreatedAt  time.Time         `json:"created_at"`
 	UpdatedAt  time.Time         `json:"updated_at"`
 }
@@ -45,6 +57,8 @@ type HealthCheckResult struct {
 	Name         string                    `json:"name"`
 	Type         HealthCheckType           `json:"type"`
 	Target       string                    `json:"target"`
+	Labels       map[string]string         `json:"labels,omitempty"`
+	Team         string                    `json:"team,omitempty"`
 	Status       HealthCheckStatus         `json:"status"`
 	ResponseTime time.Duration             `json:"response_time"`
 	Message      string                    `json:"message,omitempty"`
@@ -62,3 +76,50 @@ type HealthCheckHistoryEntry struct {
 type HealthCheckMetrics struct {
 	Checks []HealthCheckResult `json:"checks"`
 }
+
+// HealthCheckRevision is a stored version of a check's configuration.
+// Changes lists what differs from the previous revision.
+type HealthCheckRevision struct {
+	Revision  int               `json:"revision"`
+	ChangedAt time.Time         `json:"changed_at"`
+	Config    HealthCheckConfig `json:"config"`
+	Changes   []ConfigChange    `json:"changes,omitempty"`
+}
+
+type ConfigChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// Diff returns the fields of c that differ from prev, keyed by their JSON
+// names. Bookkeeping fields (id, revision and timestamps) are ignored.
+func (c HealthCheckConfig) Diff(prev HealthCheckConfig) []ConfigChange {
+	cur, old := c.contentFields(), prev.contentFields()
+
+	var changes []ConfigChange
+	for field, value := range cur {
+		if !reflect.DeepEqual(value, old[field]) {
+			changes = append(changes, ConfigChange{Field: field, Old: old[field], New: value})
+		}
+	}
+	for field, value := range old {
+		if _, ok := cur[field]; !ok {
+			changes = append(changes, ConfigChange{Field: field, Old: value, New: nil})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func (c HealthCheckConfig) contentFields() map[string]interface{} {
+	data, _ := json.Marshal(c)
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+
+	for _, field := range []string{"id", "revision", "created_at", "updated_at"} {
+		delete(fields, field)
+	}
+	return fields
+}
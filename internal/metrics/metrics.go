@@ -5,20 +5,32 @@ import (
 )
 
 type SystemMetrics struct {
-	Timestamp   time.Time          `json:"timestamp"`
-	CPU         CPUMetrics         `json:"cpu"`
-	Memory      MemoryMetrics      `json:"memory"`
-	Disk        DiskMetrics        `json:"disk"`
-	Network     NetworkMetrics     `json:"network"`
-	Process     []ProcessMetrics   `json:"processes"`
-	Uptime      UptimeMetrics      `json:"uptime"`
-	HealthCheck HealthCheckMetrics `json:"health_checks"`
+	Timestamp       time.Time             `json:"timestamp"`
+	CPU             CPUMetrics            `json:"cpu"`
+	Memory          MemoryMetrics         `json:"memory"`
+	Disk            DiskMetrics           `json:"disk"`
+	Network         NetworkMetrics        `json:"network"`
+	Process         []ProcessMetrics      `json:"processes"`
+	Uptime          UptimeMetrics         `json:"uptime"`
+	Pressure        *PressureMetrics      `json:"pressure,omitempty"`
+	FileDescriptors FileDescriptorMetrics `json:"file_descriptors"`
+	Sockets         SocketMetrics         `json:"sockets"`
+	Entropy         EntropyMetrics        `json:"entropy"`
+	Cgroups         []CgroupMetrics       `json:"cgroups,omitempty"`
+	Containers      []ContainerMetrics    `json:"containers,omitempty"`
+	Units           []UnitMetrics         `json:"units,omitempty"`
+	HealthCheck     HealthCheckMetrics    `json:"health_checks"`
 }
 
 type CPUMetrics struct {
 	TotalUsage   float64            `json:"total_usage"`
 	PerCoreUsage map[string]float64 `json:"per_core_usage"`
 	LoadAverage  [3]float64         `json:"load_average"`
+	// ContextSwitches and Interrupts count since boot
+	ContextSwitches       uint64  `json:"context_switches"`
+	Interrupts            uint64  `json:"interrupts"`
+	ContextSwitchesPerSec float64 `json:"context_switches_per_sec"`
+	InterruptsPerSec      float64 `json:"interrupts_per_sec"`
 }
 
 type MemoryMetrics struct {
@@ -32,8 +44,9 @@ type MemoryMetrics struct {
 }
 
 type DiskMetrics struct {
-	Partitions []DiskPartition   `json:"partitions"`
-	IOCounters map[string]DiskIO `json:"io_counters"`
+	Partitions []DiskPartition       `json:"partitions"`
+	IOCounters map[string]DiskIO     `json:"io_counters"`
+	IORates    map[string]DiskIORate `json:"io_rates"`
 }
 
 type DiskPartition struct {
@@ -52,10 +65,20 @@ type DiskIO struct {
 	WriteBytes uint64 `json:"write_bytes"`
 	ReadTime   uint64 `json:"read_time"`
 	WriteTime  uint64 `json:"write_time"`
+	IoTime     uint64 `json:"io_time"`
+}
+
+type DiskIORate struct {
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	ReadIOPS         float64 `json:"read_iops"`
+	WriteIOPS        float64 `json:"write_iops"`
+	BusyPercent      float64 `json:"busy_percent"`
 }
 
 type NetworkMetrics struct {
-	Interfaces map[string]NetworkInterface `json:"interfaces"`
+	Interfaces map[string]NetworkInterface     `json:"interfaces"`
+	Rates      map[string]NetworkInterfaceRate `json:"rates"`
 }
 
 type NetworkInterface struct {
@@ -69,6 +92,17 @@ type NetworkInterface struct {
 	Dropout     uint64 `json:"dropout"`
 }
 
+type NetworkInterfaceRate struct {
+	BytesSentPerSec   float64 `json:"bytes_sent_per_sec"`
+	BytesRecvPerSec   float64 `json:"bytes_recv_per_sec"`
+	PacketsSentPerSec float64 `json:"packets_sent_per_sec"`
+	PacketsRecvPerSec float64 `json:"packets_recv_per_sec"`
+	ErrinPerSec       float64 `json:"errin_per_sec"`
+	ErroutPerSec      float64 `json:"errout_per_sec"`
+	DropinPerSec      float64 `json:"dropin_per_sec"`
+	DropoutPerSec     float64 `json:"dropout_per_sec"`
+}
+
 type ProcessMetrics struct {
 	PID        int32     `json:"pid"`
 	Name       string    `json:"name"`
@@ -79,6 +113,9 @@ type ProcessMetrics struct {
 	CreateTime int64     `json:"create_time"`
 	NumThreads int32     `json:"num_threads"`
 	IOCounters ProcessIO `json:"io_counters,omitempty"`
+	OpenFiles  int32     `json:"open_files"`
+	// MaxOpenFiles is the soft RLIMIT_NOFILE, 0 when unlimited or unknown
+	MaxOpenFiles uint64 `json:"max_open_files"`
 }
 
 type ProcessIO struct {
@@ -92,3 +129,116 @@ type UptimeMetrics struct {
 	Uptime   float64 `json:"uptime"`
 	BootTime uint64  `json:"boot_time"`
 }
+
+// PressureMetrics is Linux pressure stall information: how much of the time
+// tasks were stalled waiting for CPU, memory or IO.
+type PressureMetrics struct {
+	CPU    Pressure `json:"cpu"`
+	Memory Pressure `json:"memory"`
+	IO     Pressure `json:"io"`
+}
+
+// Pressure is the stall time of one resource. Some is when at least one task
+// was stalled, Full when every non-idle task was.
+type Pressure struct {
+	Some PressureStall `json:"some"`
+	Full PressureStall `json:"full"`
+}
+
+// PressureStall is the percentage of time stalled over the last 10, 60 and
+// 300 seconds, and the total time stalled in seconds
+type PressureStall struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  float64 `json:"total"`
+}
+
+// FileDescriptorMetrics is the system-wide file handle table
+type FileDescriptorMetrics struct {
+	Allocated   uint64  `json:"allocated"`
+	Max         uint64  `json:"max"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// SocketMetrics counts sockets in use, and TCP connections by state such as
+// established, time_wait or listen, over IPv4 and IPv6
+type SocketMetrics struct {
+	Used uint64            `json:"used"`
+	TCP  map[string]uint64 `json:"tcp"`
+}
+
+// EntropyMetrics is the kernel's random pool, in bits
+type EntropyMetrics struct {
+	Available uint64 `json:"available"`
+	PoolSize  uint64 `json:"pool_size"`
+}
+
+// CgroupMetrics is the resource usage of one cgroup, usually a container.
+// Counters are cumulative; limits are 0 when there is none.
+type CgroupMetrics struct {
+	Path          string `json:"path"`
+	ContainerID   string `json:"container_id,omitempty"`
+	ContainerName string `json:"container_name,omitempty"`
+	Runtime       string `json:"runtime,omitempty"`
+
+	CPUUsage         float64 `json:"cpu_usage_seconds"`
+	CPUUser          float64 `json:"cpu_user_seconds"`
+	CPUSystem        float64 `json:"cpu_system_seconds"`
+	CPUPercent       float64 `json:"cpu_percent"`
+	CPUPeriods       uint64  `json:"cpu_periods"`
+	CPUThrottled     uint64  `json:"cpu_throttled_periods"`
+	CPUThrottledTime float64 `json:"cpu_throttled_seconds"`
+
+	MemoryUsage     uint64 `json:"memory_usage"`
+	MemoryLimit     uint64 `json:"memory_limit"`
+	MemoryOOMEvents uint64 `json:"memory_oom_events"`
+	MemoryOOMKills  uint64 `json:"memory_oom_kills"`
+
+	IOReadBytes  uint64 `json:"io_read_bytes"`
+	IOWriteBytes uint64 `json:"io_write_bytes"`
+	IOReads      uint64 `json:"io_reads"`
+	IOWrites     uint64 `json:"io_writes"`
+
+	PIDs      uint64 `json:"pids"`
+	PIDsLimit uint64 `json:"pids_limit"`
+}
+
+// Name is the container name, or the cgroup path when it is not a known
+// container.
+func (c CgroupMetrics) Name() string {
+	if c.ContainerName != "" {
+		return c.ContainerName
+	}
+	return c.Path
+}
+
+// ContainerMetrics is a container known to the Docker daemon. Health is
+// empty for containers without a HEALTHCHECK.
+type ContainerMetrics struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	State        string            `json:"state"`
+	Health       string            `json:"health,omitempty"`
+	RestartCount int               `json:"restart_count"`
+	ExitCode     int               `json:"exit_code"`
+	StartedAt    int64             `json:"started_at"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// UnitMetrics is a systemd unit. MemoryCurrent and CPUUsage are 0 for units
+// without resource accounting.
+type UnitMetrics struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	LoadState     string `json:"load_state"`
+	ActiveState   string `json:"active_state"`
+	SubState      string `json:"sub_state"`
+	Result        string `json:"result,omitempty"`
+	Restarts      int    `json:"restarts"`
+	MainPID       int    `json:"main_pid"`
+	MemoryCurrent uint64 `json:"memory_current"`
+	// CPUUsage is in seconds
+	CPUUsage float64 `json:"cpu_usage"`
+}
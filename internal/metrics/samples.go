@@ -0,0 +1,735 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricNameLabel is the reserved label holding a sample's metric name.
+const MetricNameLabel = "__name__"
+
+// Labels identifies a series. The metric name is stored under MetricNameLabel.
+type Labels map[string]string
+
+// Sample is a single labeled value taken from a snapshot or check result.
+type Sample struct {
+	Labels Labels
+	Value  float64
+}
+
+func (l Labels) Name() string {
+	return l[MetricNameLabel]
+}
+
+// Key returns a stable string identifying the label set, suitable as a map key.
+func (l Labels) Key() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0xff)
+		b.WriteString(l[name])
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+func (l Labels) Copy() Labels {
+	c := make(Labels, len(l))
+	for k, v := range l {
+		c[k] = v
+	}
+	return c
+}
+
+func sample(name string, value float64, labels ...string) Sample {
+	l := Labels{MetricNameLabel: name}
+	for i := 0; i+1 < len(labels); i += 2 {
+		l[labels[i]] = labels[i+1]
+	}
+	return Sample{Labels: l, Value: value}
+}
+
+// Samples converts a snapshot into Prometheus-style labeled samples, e.g.
+// golem_disk_read_bytes_total{device="sda"}. Counters keep their raw
+// cumulative value so rate() and increase() can be applied to them.
+func (m SystemMetrics) Samples() []Sample {
+	samples := []Sample{
+		sample("golem_cpu_usage_percent", m.CPU.TotalUsage),
+		sample("golem_load1", m.CPU.LoadAverage[0]),
+		sample("golem_load5", m.CPU.LoadAverage[1]),
+		sample("golem_load15", m.CPU.LoadAverage[2]),
+		sample("golem_memory_total_bytes", float64(m.Memory.Total)),
+		sample("golem_memory_used_bytes", float64(m.Memory.Used)),
+		sample("golem_memory_free_bytes", float64(m.Memory.Free)),
+		sample("golem_memory_used_percent", m.Memory.UsedPercent),
+		sample("golem_swap_total_bytes", float64(m.Memory.SwapTotal)),
+		sample("golem_swap_used_bytes", float64(m.Memory.SwapUsed)),
+		sample("golem_swap_free_bytes", float64(m.Memory.SwapFree)),
+		sample("golem_uptime_seconds", m.Uptime.Uptime),
+		sample("golem_boot_time_seconds", float64(m.Uptime.BootTime)),
+		sample("golem_processes", float64(len(m.Process))),
+		sample("golem_context_switches_total", float64(m.CPU.ContextSwitches)),
+		sample("golem_interrupts_total", float64(m.CPU.Interrupts)),
+		sample("golem_context_switches_per_second", m.CPU.ContextSwitchesPerSec),
+		sample("golem_interrupts_per_second", m.CPU.InterruptsPerSec),
+		sample("golem_file_descriptors_allocated", float64(m.FileDescriptors.Allocated)),
+		sample("golem_file_descriptors_max", float64(m.FileDescriptors.Max)),
+		sample("golem_file_descriptors_used_percent", m.FileDescriptors.UsedPercent),
+		sample("golem_sockets_used", float64(m.Sockets.Used)),
+		sample("golem_entropy_available_bits", float64(m.Entropy.Available)),
+		sample("golem_entropy_pool_size_bits", float64(m.Entropy.PoolSize)),
+	}
+
+	for state, n := range m.Sockets.TCP {
+		samples = append(samples, sample("golem_tcp_connections", float64(n), "state", state))
+	}
+
+	if p := m.Pressure; p != nil {
+		for resource, pressure := range map[string]Pressure{"cpu": p.CPU, "memory": p.Memory, "io": p.IO} {
+			for kind, stall := range map[string]PressureStall{"some": pressure.Some, "full": pressure.Full} {
+				l := []string{"resource", resource, "kind", kind}
+				samples = append(samples,
+					sample("golem_pressure_avg10_percent", stall.Avg10, l...),
+					sample("golem_pressure_avg60_percent", stall.Avg60, l...),
+					sample("golem_pressure_avg300_percent", stall.Avg300, l...),
+					sample("golem_pressure_stalled_seconds_total", stall.Total, l...),
+				)
+			}
+		}
+	}
+
+	for core, usage := range m.CPU.PerCoreUsage {
+		samples = append(samples, sample("golem_cpu_core_usage_percent", usage, "core", core))
+	}
+
+	for _, p := range m.Disk.Partitions {
+		l := []string{"device", p.Device, "mountpoint", p.Mountpoint}
+		samples = append(samples,
+			sample("golem_filesystem_size_bytes", float64(p.Total), l...),
+			sample("golem_filesystem_used_bytes", float64(p.Used), l...),
+			sample("golem_filesystem_free_bytes", float64(p.Free), l...),
+			sample("golem_filesystem_used_percent", p.UsedPercent, l...),
+		)
+	}
+
+	for dev, io := range m.Disk.IOCounters {
+		samples = append(samples,
+			sample("golem_disk_reads_completed_total", float64(io.ReadCount), "device", dev),
+			sample("golem_disk_writes_completed_total", float64(io.WriteCount), "device", dev),
+			sample("golem_disk_read_bytes_total", float64(io.ReadBytes), "device", dev),
+			sample("golem_disk_written_bytes_total", float64(io.WriteBytes), "device", dev),
+			sample("golem_disk_read_time_seconds_total", float64(io.ReadTime)/1000, "device", dev),
+			sample("golem_disk_write_time_seconds_total", float64(io.WriteTime)/1000, "device", dev),
+			sample("golem_disk_io_time_seconds_total", float64(io.IoTime)/1000, "device", dev),
+		)
+	}
+
+	for dev, rate := range m.Disk.IORates {
+		samples = append(samples,
+			sample("golem_disk_read_bytes_per_second", rate.ReadBytesPerSec, "device", dev),
+			sample("golem_disk_written_bytes_per_second", rate.WriteBytesPerSec, "device", dev),
+			sample("golem_disk_reads_per_second", rate.ReadIOPS, "device", dev),
+			sample("golem_disk_writes_per_second", rate.WriteIOPS, "device", dev),
+			sample("golem_disk_busy_percent", rate.BusyPercent, "device", dev),
+		)
+	}
+
+	for name, iface := range m.Network.Interfaces {
+		samples = append(samples,
+			sample("golem_network_transmit_bytes_total", float64(iface.BytesSent), "interface", name),
+			sample("golem_network_receive_bytes_total", float64(iface.BytesRecv), "interface", name),
+			sample("golem_network_transmit_packets_total", float64(iface.PacketsSent), "interface", name),
+			sample("golem_network_receive_packets_total", float64(iface.PacketsRecv), "interface", name),
+			sample("golem_network_receive_errors_total", float64(iface.Errin), "interface", name),
+			sample("golem_network_transmit_errors_total", float64(iface.Errout), "interface", name),
+			sample("golem_network_receive_drop_total", float64(iface.Dropin), "interface", name),
+			sample("golem_network_transmit_drop_total", float64(iface.Dropout), "interface", name),
+		)
+	}
+
+	for name, rate := range m.Network.Rates {
+		samples = append(samples,
+			sample("golem_network_transmit_bytes_per_second", rate.BytesSentPerSec, "interface", name),
+			sample("golem_network_receive_bytes_per_second", rate.BytesRecvPerSec, "interface", name),
+			sample("golem_network_transmit_packets_per_second", rate.PacketsSentPerSec, "interface", name),
+			sample("golem_network_receive_packets_per_second", rate.PacketsRecvPerSec, "interface", name),
+			sample("golem_network_receive_errors_per_second", rate.ErrinPerSec, "interface", name),
+			sample("golem_network_transmit_errors_per_second", rate.ErroutPerSec, "interface", name),
+			sample("golem_network_receive_drop_per_second", rate.DropinPerSec, "interface", name),
+			sample("golem_network_transmit_drop_per_second", rate.DropoutPerSec, "interface", name),
+		)
+	}
+
+	for _, c := range m.Cgroups {
+		l := c.labels()
+		samples = append(samples,
+			sample("golem_cgroup_cpu_usage_seconds_total", c.CPUUsage, l...),
+			sample("golem_cgroup_cpu_user_seconds_total", c.CPUUser, l...),
+			sample("golem_cgroup_cpu_system_seconds_total", c.CPUSystem, l...),
+			sample("golem_cgroup_cpu_usage_percent", c.CPUPercent, l...),
+			sample("golem_cgroup_cpu_periods_total", float64(c.CPUPeriods), l...),
+			sample("golem_cgroup_cpu_throttled_periods_total", float64(c.CPUThrottled), l...),
+			sample("golem_cgroup_cpu_throttled_seconds_total", c.CPUThrottledTime, l...),
+			sample("golem_cgroup_memory_usage_bytes", float64(c.MemoryUsage), l...),
+			sample("golem_cgroup_memory_oom_events_total", float64(c.MemoryOOMEvents), l...),
+			sample("golem_cgroup_memory_oom_kills_total", float64(c.MemoryOOMKills), l...),
+			sample("golem_cgroup_io_read_bytes_total", float64(c.IOReadBytes), l...),
+			sample("golem_cgroup_io_written_bytes_total", float64(c.IOWriteBytes), l...),
+			sample("golem_cgroup_io_reads_total", float64(c.IOReads), l...),
+			sample("golem_cgroup_io_writes_total", float64(c.IOWrites), l...),
+			sample("golem_cgroup_pids", float64(c.PIDs), l...),
+		)
+		if c.MemoryLimit > 0 {
+			samples = append(samples, sample("golem_cgroup_memory_limit_bytes", float64(c.MemoryLimit), l...))
+		}
+		if c.PIDsLimit > 0 {
+			samples = append(samples, sample("golem_cgroup_pids_limit", float64(c.PIDsLimit), l...))
+		}
+	}
+
+	// Processes whose descriptors could not be read, such as other users'
+	// without root, are left out rather than reported with none open
+	for _, p := range m.Process {
+		if p.OpenFiles <= 0 {
+			continue
+		}
+		l := []string{"pid", strconv.Itoa(int(p.PID)), "name", p.Name}
+		samples = append(samples, sample("golem_process_open_fds", float64(p.OpenFiles), l...))
+		if p.MaxOpenFiles > 0 {
+			samples = append(samples, sample("golem_process_max_fds", float64(p.MaxOpenFiles), l...))
+		}
+	}
+
+	for _, c := range m.Containers {
+		l := []string{"container_id", c.ID, "container_name", c.Name}
+		info := append([]string{"image", c.Image, "state", c.State}, l...)
+		if c.Health != "" {
+			info = append(info, "health", c.Health)
+		}
+		// Docker labels that sanitize to the same name keep the first in
+		// sort order on the info series; golem_container_label has each
+		// one as written, which is what snapshots are rebuilt from
+		keys := make([]string, 0, len(c.Labels))
+		for key := range c.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		named := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			name := ContainerLabelPrefix + sanitizeLabelName(key)
+			if !named[name] {
+				named[name] = true
+				info = append(info, name, c.Labels[key])
+			}
+			samples = append(samples, sample("golem_container_label", 1, append([]string{"label", key, "value", c.Labels[key]}, l...)...))
+		}
+		running := 0.0
+		if c.State == "running" {
+			running = 1
+		}
+		samples = append(samples,
+			sample("golem_container_info", 1, info...),
+			sample("golem_container_running", running, l...),
+			sample("golem_container_restarts_total", float64(c.RestartCount), l...),
+			sample("golem_container_exit_code", float64(c.ExitCode), l...),
+			sample("golem_container_start_time_seconds", float64(c.StartedAt), l...),
+		)
+		if c.Health != "" {
+			healthy := 0.0
+			if c.Health == "healthy" {
+				healthy = 1
+			}
+			samples = append(samples, sample("golem_container_healthy", healthy, l...))
+		}
+	}
+
+	for _, u := range m.Units {
+		l := []string{"unit", u.Name}
+		info := append([]string{"load_state", u.LoadState, "active_state", u.ActiveState, "sub_state", u.SubState}, l...)
+		if u.Description != "" {
+			info = append(info, "description", u.Description)
+		}
+		if u.Result != "" {
+			info = append(info, "result", u.Result)
+		}
+		active, failed := 0.0, 0.0
+		switch u.ActiveState {
+		case "active":
+			active = 1
+		case "failed":
+			failed = 1
+		}
+		samples = append(samples,
+			sample("golem_systemd_unit_info", 1, info...),
+			sample("golem_systemd_unit_active", active, l...),
+			sample("golem_systemd_unit_failed", failed, l...),
+			sample("golem_systemd_unit_restarts_total", float64(u.Restarts), l...),
+			sample("golem_systemd_unit_main_pid", float64(u.MainPID), l...),
+			sample("golem_systemd_unit_memory_bytes", float64(u.MemoryCurrent), l...),
+			sample("golem_systemd_unit_cpu_seconds_total", u.CPUUsage, l...),
+		)
+	}
+
+	return samples
+}
+
+// ContainerLabelPrefix starts the series labels holding a container's
+// Docker labels
+const ContainerLabelPrefix = "container_label_"
+
+// sanitizeLabelName turns a Docker label such as com.docker.compose.service
+// into a valid series label name
+func sanitizeLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// labels identifies a cgroup's series by its path, and by container where
+// known
+func (c CgroupMetrics) labels() []string {
+	l := []string{"cgroup", c.Path}
+	if c.ContainerID != "" {
+		l = append(l, "container_id", c.ContainerID)
+	}
+	if c.ContainerName != "" {
+		l = append(l, "container_name", c.ContainerName)
+	}
+	if c.Runtime != "" {
+		l = append(l, "runtime", c.Runtime)
+	}
+	return l
+}
+
+// SnapshotFromSamples is the inverse of SystemMetrics.Samples. Only the
+// file descriptors of processes are stored as samples, so Process lists the
+// processes that had descriptors open with their PID, name and descriptors.
+func SnapshotFromSamples(ts time.Time, samples []Sample) SystemMetrics {
+	m := SystemMetrics{
+		Timestamp: ts,
+		Process:   []ProcessMetrics{},
+		CPU:       CPUMetrics{PerCoreUsage: make(map[string]float64)},
+		Disk: DiskMetrics{
+			Partitions: []DiskPartition{},
+			IOCounters: make(map[string]DiskIO),
+			IORates:    make(map[string]DiskIORate),
+		},
+		Network: NetworkMetrics{
+			Interfaces: make(map[string]NetworkInterface),
+			Rates:      make(map[string]NetworkInterfaceRate),
+		},
+		Sockets: SocketMetrics{TCP: make(map[string]uint64)},
+	}
+
+	// Pressure is only set when the snapshot had it
+	stall := func(l Labels) *PressureStall {
+		if m.Pressure == nil {
+			m.Pressure = &PressureMetrics{}
+		}
+		var p *Pressure
+		switch l["resource"] {
+		case "cpu":
+			p = &m.Pressure.CPU
+		case "memory":
+			p = &m.Pressure.Memory
+		case "io":
+			p = &m.Pressure.IO
+		default:
+			return &PressureStall{}
+		}
+		if l["kind"] == "full" {
+			return &p.Full
+		}
+		return &p.Some
+	}
+
+	cgroups := make(map[string]*CgroupMetrics)
+	cgroup := func(l Labels) *CgroupMetrics {
+		c, ok := cgroups[l["cgroup"]]
+		if !ok {
+			c = &CgroupMetrics{Path: l["cgroup"], ContainerID: l["container_id"], ContainerName: l["container_name"], Runtime: l["runtime"]}
+			cgroups[l["cgroup"]] = c
+		}
+		return c
+	}
+
+	processes := make(map[string]*ProcessMetrics)
+	process := func(l Labels) *ProcessMetrics {
+		p, ok := processes[l["pid"]]
+		if !ok {
+			pid, _ := strconv.ParseInt(l["pid"], 10, 32)
+			p = &ProcessMetrics{PID: int32(pid), Name: l["name"]}
+			processes[l["pid"]] = p
+		}
+		return p
+	}
+
+	containers := make(map[string]*ContainerMetrics)
+	container := func(l Labels) *ContainerMetrics {
+		c, ok := containers[l["container_id"]]
+		if !ok {
+			c = &ContainerMetrics{ID: l["container_id"], Name: l["container_name"]}
+			containers[l["container_id"]] = c
+		}
+		return c
+	}
+
+	units := make(map[string]*UnitMetrics)
+	unit := func(l Labels) *UnitMetrics {
+		u, ok := units[l["unit"]]
+		if !ok {
+			u = &UnitMetrics{Name: l["unit"]}
+			units[l["unit"]] = u
+		}
+		return u
+	}
+
+	partitions := make(map[string]*DiskPartition)
+	partition := func(l Labels) *DiskPartition {
+		p, ok := partitions[l["mountpoint"]]
+		if !ok {
+			p = &DiskPartition{Device: l["device"], Mountpoint: l["mountpoint"]}
+			partitions[l["mountpoint"]] = p
+		}
+		return p
+	}
+
+	for _, s := range samples {
+		v := s.Value
+		dev := s.Labels["device"]
+		iface := s.Labels["interface"]
+
+		switch s.Labels.Name() {
+		case "golem_cpu_usage_percent":
+			m.CPU.TotalUsage = v
+		case "golem_cpu_core_usage_percent":
+			m.CPU.PerCoreUsage[s.Labels["core"]] = v
+		case "golem_load1":
+			m.CPU.LoadAverage[0] = v
+		case "golem_load5":
+			m.CPU.LoadAverage[1] = v
+		case "golem_load15":
+			m.CPU.LoadAverage[2] = v
+		case "golem_memory_total_bytes":
+			m.Memory.Total = uint64(v)
+		case "golem_memory_used_bytes":
+			m.Memory.Used = uint64(v)
+		case "golem_memory_free_bytes":
+			m.Memory.Free = uint64(v)
+		case "golem_memory_used_percent":
+			m.Memory.UsedPercent = v
+		case "golem_swap_total_bytes":
+			m.Memory.SwapTotal = uint64(v)
+		case "golem_swap_used_bytes":
+			m.Memory.SwapUsed = uint64(v)
+		case "golem_swap_free_bytes":
+			m.Memory.SwapFree = uint64(v)
+		case "golem_uptime_seconds":
+			m.Uptime.Uptime = v
+		case "golem_boot_time_seconds":
+			m.Uptime.BootTime = uint64(v)
+		case "golem_context_switches_total":
+			m.CPU.ContextSwitches = uint64(v)
+		case "golem_interrupts_total":
+			m.CPU.Interrupts = uint64(v)
+		case "golem_context_switches_per_second":
+			m.CPU.ContextSwitchesPerSec = v
+		case "golem_interrupts_per_second":
+			m.CPU.InterruptsPerSec = v
+		case "golem_file_descriptors_allocated":
+			m.FileDescriptors.Allocated = uint64(v)
+		case "golem_file_descriptors_max":
+			m.FileDescriptors.Max = uint64(v)
+		case "golem_file_descriptors_used_percent":
+			m.FileDescriptors.UsedPercent = v
+		case "golem_sockets_used":
+			m.Sockets.Used = uint64(v)
+		case "golem_tcp_connections":
+			m.Sockets.TCP[s.Labels["state"]] = uint64(v)
+		case "golem_entropy_available_bits":
+			m.Entropy.Available = uint64(v)
+		case "golem_entropy_pool_size_bits":
+			m.Entropy.PoolSize = uint64(v)
+
+		case "golem_pressure_avg10_percent":
+			stall(s.Labels).Avg10 = v
+		case "golem_pressure_avg60_percent":
+			stall(s.Labels).Avg60 = v
+		case "golem_pressure_avg300_percent":
+			stall(s.Labels).Avg300 = v
+		case "golem_pressure_stalled_seconds_total":
+			stall(s.Labels).Total = v
+
+		case "golem_filesystem_size_bytes":
+			partition(s.Labels).Total = uint64(v)
+		case "golem_filesystem_used_bytes":
+			partition(s.Labels).Used = uint64(v)
+		case "golem_filesystem_free_bytes":
+			partition(s.Labels).Free = uint64(v)
+		case "golem_filesystem_used_percent":
+			partition(s.Labels).UsedPercent = v
+
+		case "golem_disk_reads_completed_total":
+			io := m.Disk.IOCounters[dev]
+			io.ReadCount = uint64(v)
+			m.Disk.IOCounters[dev] = io
+		case "golem_disk_writes_completed_total":
+			io := m.Disk.IOCounters[dev]
+			io.WriteCount = uint64(v)
+			m.Disk.IOCounters[dev] = io
+		case "golem_disk_read_bytes_total":
+			io := m.Disk.IOCounters[dev]
+			io.ReadBytes = uint64(v)
+			m.Disk.IOCounters[dev] = io
+		case "golem_disk_written_bytes_total":
+			io := m.Disk.IOCounters[dev]
+			io.WriteBytes = uint64(v)
+			m.Disk.IOCounters[dev] = io
+		case "golem_disk_read_time_seconds_total":
+			io := m.Disk.IOCounters[dev]
+			io.ReadTime = uint64(math.Round(v * 1000))
+			m.Disk.IOCounters[dev] = io
+		case "golem_disk_write_time_seconds_total":
+			io := m.Disk.IOCounters[dev]
+			io.WriteTime = uint64(math.Round(v * 1000))
+			m.Disk.IOCounters[dev] = io
+		case "golem_disk_io_time_seconds_total":
+			io := m.Disk.IOCounters[dev]
+			io.IoTime = uint64(math.Round(v * 1000))
+			m.Disk.IOCounters[dev] = io
+
+		case "golem_disk_read_bytes_per_second":
+			rate := m.Disk.IORates[dev]
+			rate.ReadBytesPerSec = v
+			m.Disk.IORates[dev] = rate
+		case "golem_disk_written_bytes_per_second":
+			rate := m.Disk.IORates[dev]
+			rate.WriteBytesPerSec = v
+			m.Disk.IORates[dev] = rate
+		case "golem_disk_reads_per_second":
+			rate := m.Disk.IORates[dev]
+			rate.ReadIOPS = v
+			m.Disk.IORates[dev] = rate
+		case "golem_disk_writes_per_second":
+			rate := m.Disk.IORates[dev]
+			rate.WriteIOPS = v
+			m.Disk.IORates[dev] = rate
+		case "golem_disk_busy_percent":
+			rate := m.Disk.IORates[dev]
+			rate.BusyPercent = v
+			m.Disk.IORates[dev] = rate
+
+		case "golem_network_transmit_bytes_total":
+			n := m.Network.Interfaces[iface]
+			n.BytesSent = uint64(v)
+			m.Network.Interfaces[iface] = n
+		case "golem_network_receive_bytes_total":
+			n := m.Network.Interfaces[iface]
+			n.BytesRecv = uint64(v)
+			m.Network.Interfaces[iface] = n
+		case "golem_network_transmit_packets_total":
+			n := m.Network.Interfaces[iface]
+			n.PacketsSent = uint64(v)
+			m.Network.Interfaces[iface] = n
+		case "golem_network_receive_packets_total":
+			n := m.Network.Interfaces[iface]
+			n.PacketsRecv = uint64(v)
+			m.Network.Interfaces[iface] = n
+		case "golem_network_receive_errors_total":
+			n := m.Network.Interfaces[iface]
+			n.Errin = uint64(v)
+			m.Network.Interfaces[iface] = n
+		case "golem_network_transmit_errors_total":
+			n := m.Network.Interfaces[iface]
+			n.Errout = uint64(v)
+			m.Network.Interfaces[iface] = n
+		case "golem_network_receive_drop_total":
+			n := m.Network.Interfaces[iface]
+			n.Dropin = uint64(v)
+			m.Network.Interfaces[iface] = n
+		case "golem_network_transmit_drop_total":
+			n := m.Network.Interfaces[iface]
+			n.Dropout = uint64(v)
+			m.Network.Interfaces[iface] = n
+
+		case "golem_network_transmit_bytes_per_second":
+			rate := m.Network.Rates[iface]
+			rate.BytesSentPerSec = v
+			m.Network.Rates[iface] = rate
+		case "golem_network_receive_bytes_per_second":
+			rate := m.Network.Rates[iface]
+			rate.BytesRecvPerSec = v
+			m.Network.Rates[iface] = rate
+		case "golem_network_transmit_packets_per_second":
+			rate := m.Network.Rates[iface]
+			rate.PacketsSentPerSec = v
+			m.Network.Rates[iface] = rate
+		case "golem_network_receive_packets_per_second":
+			rate := m.Network.Rates[iface]
+			rate.PacketsRecvPerSec = v
+			m.Network.Rates[iface] = rate
+		case "golem_network_receive_errors_per_second":
+			rate := m.Network.Rates[iface]
+			rate.ErrinPerSec = v
+			m.Network.Rates[iface] = rate
+		case "golem_network_transmit_errors_per_second":
+			rate := m.Network.Rates[iface]
+			rate.ErroutPerSec = v
+			m.Network.Rates[iface] = rate
+		case "golem_network_receive_drop_per_second":
+			rate := m.Network.Rates[iface]
+			rate.DropinPerSec = v
+			m.Network.Rates[iface] = rate
+		case "golem_network_transmit_drop_per_second":
+			rate := m.Network.Rates[iface]
+			rate.DropoutPerSec = v
+			m.Network.Rates[iface] = rate
+
+		case "golem_cgroup_cpu_usage_seconds_total":
+			cgroup(s.Labels).CPUUsage = v
+		case "golem_cgroup_cpu_user_seconds_total":
+			cgroup(s.Labels).CPUUser = v
+		case "golem_cgroup_cpu_system_seconds_total":
+			cgroup(s.Labels).CPUSystem = v
+		case "golem_cgroup_cpu_usage_percent":
+			cgroup(s.Labels).CPUPercent = v
+		case "golem_cgroup_cpu_periods_total":
+			cgroup(s.Labels).CPUPeriods = uint64(v)
+		case "golem_cgroup_cpu_throttled_periods_total":
+			cgroup(s.Labels).CPUThrottled = uint64(v)
+		case "golem_cgroup_cpu_throttled_seconds_total":
+			cgroup(s.Labels).CPUThrottledTime = v
+		case "golem_cgroup_memory_usage_bytes":
+			cgroup(s.Labels).MemoryUsage = uint64(v)
+		case "golem_cgroup_memory_limit_bytes":
+			cgroup(s.Labels).MemoryLimit = uint64(v)
+		case "golem_cgroup_memory_oom_events_total":
+			cgroup(s.Labels).MemoryOOMEvents = uint64(v)
+		case "golem_cgroup_memory_oom_kills_total":
+			cgroup(s.Labels).MemoryOOMKills = uint64(v)
+		case "golem_cgroup_io_read_bytes_total":
+			cgroup(s.Labels).IOReadBytes = uint64(v)
+		case "golem_cgroup_io_written_bytes_total":
+			cgroup(s.Labels).IOWriteBytes = uint64(v)
+		case "golem_cgroup_io_reads_total":
+			cgroup(s.Labels).IOReads = uint64(v)
+		case "golem_cgroup_io_writes_total":
+			cgroup(s.Labels).IOWrites = uint64(v)
+		case "golem_cgroup_pids":
+			cgroup(s.Labels).PIDs = uint64(v)
+		case "golem_cgroup_pids_limit":
+			cgroup(s.Labels).PIDsLimit = uint64(v)
+
+		case "golem_process_open_fds":
+			process(s.Labels).OpenFiles = int32(v)
+		case "golem_process_max_fds":
+			process(s.Labels).MaxOpenFiles = uint64(v)
+		case "golem_container_info":
+			c := container(s.Labels)
+			c.Image = s.Labels["image"]
+			c.State = s.Labels["state"]
+			c.Health = s.Labels["health"]
+		case "golem_container_label":
+			c := container(s.Labels)
+			if c.Labels == nil {
+				c.Labels = map[string]string{}
+			}
+			c.Labels[s.Labels["label"]] = s.Labels["value"]
+		case "golem_container_restarts_total":
+			container(s.Labels).RestartCount = int(v)
+		case "golem_container_exit_code":
+			container(s.Labels).ExitCode = int(v)
+		case "golem_container_start_time_seconds":
+			container(s.Labels).StartedAt = int64(v)
+
+		case "golem_systemd_unit_info":
+			u := unit(s.Labels)
+			u.Description = s.Labels["description"]
+			u.LoadState = s.Labels["load_state"]
+			u.ActiveState = s.Labels["active_state"]
+			u.SubState = s.Labels["sub_state"]
+			u.Result = s.Labels["result"]
+		case "golem_systemd_unit_restarts_total":
+			unit(s.Labels).Restarts = int(v)
+		case "golem_systemd_unit_main_pid":
+			unit(s.Labels).MainPID = int(v)
+		case "golem_systemd_unit_memory_bytes":
+			unit(s.Labels).MemoryCurrent = uint64(v)
+		case "golem_systemd_unit_cpu_seconds_total":
+			unit(s.Labels).CPUUsage = v
+		}
+	}
+
+	mountpoints := make([]string, 0, len(partitions))
+	for mp := range partitions {
+		mountpoints = append(mountpoints, mp)
+	}
+	sort.Strings(mountpoints)
+	for _, mp := range mountpoints {
+		m.Disk.Partitions = append(m.Disk.Partitions, *partitions[mp])
+	}
+
+	paths := make([]string, 0, len(cgroups))
+	for path := range cgroups {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		m.Cgroups = append(m.Cgroups, *cgroups[path])
+	}
+
+	for _, p := range processes {
+		m.Process = append(m.Process, *p)
+	}
+	sort.Slice(m.Process, func(i, j int) bool { return m.Process[i].PID < m.Process[j].PID })
+
+	ids := make([]string, 0, len(containers))
+	for id := range containers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return containers[ids[i]].Name < containers[ids[j]].Name })
+	for _, id := range ids {
+		m.Containers = append(m.Containers, *containers[id])
+	}
+
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m.Units = append(m.Units, *units[name])
+	}
+
+	return m
+}
+
+// CheckSamples converts one health check history entry into labeled samples.
+func CheckSamples(config HealthCheckConfig, entry HealthCheckHistoryEntry) []Sample {
+	up := 0.0
+	if entry.Status == StatusUp {
+		up = 1
+	}
+
+	l := []string{"check_id", config.ID, "check_name", config.Name, "check_type", string(config.Type)}
+	if config.Team != "" {
+		l = append(l, "team", config.Team)
+	}
+	return []Sample{
+		sample("golem_check_up", up, l...),
+		sample("golem_check_response_time_seconds", float64(entry.ResponseTime)/float64(time.Second), l...),
+	}
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestContainerLabelsRoundTrip(t *testing.T) {
+	labels := map[string]string{
+		"com.docker.compose.service": "web",
+		// Sanitizes to the same series label name as the one above
+		"com_docker_compose_service":      "other",
+		"org.opencontainers.image.source": "https://example.com/web",
+		"maintainer":                      "",
+	}
+	m := SystemMetrics{
+		Timestamp: time.Unix(1700000000, 0),
+		Containers: []ContainerMetrics{
+			{ID: "abc", Name: "web", Image: "nginx:1.27", State: "running", Health: "healthy", Labels: labels},
+			{ID: "def", Name: "db", Image: "postgres:16", State: "exited", ExitCode: 137},
+		},
+	}
+	samples := m.Samples()
+
+	var info Labels
+	for _, s := range samples {
+		if s.Labels.Name() == "golem_container_info" && s.Labels["container_id"] == "abc" {
+			info = s.Labels
+		}
+	}
+	want := map[string]string{
+		"container_label_com_docker_compose_service":      "web",
+		"container_label_org_opencontainers_image_source": "https://example.com/web",
+		"container_label_maintainer":                      "",
+	}
+	for name, value := range want {
+		if got, ok := info[name]; !ok || got != value {
+			t.Errorf("info series has %s=%q, want %q", name, got, value)
+		}
+	}
+
+	got := SnapshotFromSamples(m.Timestamp, samples).Containers
+	if len(got) != 2 {
+		t.Fatalf("got %d containers, want 2", len(got))
+	}
+	for _, c := range got {
+		switch c.ID {
+		case "abc":
+			if !reflect.DeepEqual(c.Labels, labels) {
+				t.Errorf("web labels: got %v, want %v", c.Labels, labels)
+			}
+			if c.Image != "nginx:1.27" || c.Health != "healthy" {
+				t.Errorf("web: got %+v", c)
+			}
+		case "def":
+			if c.Labels != nil || c.ExitCode != 137 {
+				t.Errorf("db: got %+v", c)
+			}
+		}
+	}
+}
+
+func TestProcessFileDescriptorsRoundTrip(t *testing.T) {
+	m := SystemMetrics{
+		Timestamp: time.Unix(1700000000, 0),
+		Process: []ProcessMetrics{
+			{PID: 42, Name: "nginx", OpenFiles: 120, MaxOpenFiles: 1024, CPUPercent: 3},
+			{PID: 7, Name: "init", OpenFiles: 30},
+			// Not readable without root
+			{PID: 99, Name: "sshd"},
+		},
+	}
+
+	got := SnapshotFromSamples(m.Timestamp, m.Samples()).Process
+	want := []ProcessMetrics{
+		{PID: 7, Name: "init", OpenFiles: 30},
+		{PID: 42, Name: "nginx", OpenFiles: 120, MaxOpenFiles: 1024},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := SnapshotFromSamples(m.Timestamp, nil).Process; got == nil || len(got) != 0 {
+		t.Errorf("snapshot without process series has processes %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Requirement is one comma-separated term of a label selector.
+type Requirement struct {
+	Key   string
+	Op    string // "=", "!=", "exists" or "!exists"
+	Value string
+}
+
+// Selector matches health checks by label. All requirements must hold; the
+// empty selector matches everything.
+type Selector []Requirement
+
+// ParseSelector parses selectors such as "env=prod,team!=payments,tier,!canary".
+// "==" is accepted as "=". A bare key requires the label to be present, "!key"
+// requires it to be absent.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var req Requirement
+		switch {
+		case term == "":
+			return nil, fmt.Errorf("invalid selector %q: empty term", s)
+		case strings.Contains(term, "!="):
+			key, value, _ := strings.Cut(term, "!=")
+			req = Requirement{Key: key, Op: "!=", Value: value}
+		case strings.Contains(term, "=="):
+			key, value, _ := strings.Cut(term, "==")
+			req = Requirement{Key: key, Op: "=", Value: value}
+		case strings.Contains(term, "="):
+			key, value, _ := strings.Cut(term, "=")
+			req = Requirement{Key: key, Op: "=", Value: value}
+		case strings.HasPrefix(term, "!"):
+			req = Requirement{Key: term[1:], Op: "!exists"}
+		default:
+			req = Requirement{Key: term, Op: "exists"}
+		}
+
+		req.Key = strings.TrimSpace(req.Key)
+		req.Value = strings.TrimSpace(req.Value)
+		if req.Key == "" {
+			return nil, fmt.Errorf("invalid selector %q: missing label name in %q", s, term)
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, req := range sel {
+		value, ok := labels[req.Key]
+		switch req.Op {
+		case "=":
+			if !ok || value != req.Value {
+				return false
+			}
+		case "!=":
+			if ok && value == req.Value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (sel Selector) String() string {
+	terms := make([]string, 0, len(sel))
+	for _, req := range sel {
+		switch req.Op {
+		case "exists":
+			terms = append(terms, req.Key)
+		case "!exists":
+			terms = append(terms, "!"+req.Key)
+		default:
+			terms = append(terms, req.Key+req.Op+req.Value)
+		}
+	}
+	return strings.Join(terms, ",")
+}
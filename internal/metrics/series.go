@@ -0,0 +1,145 @@
+package metrics
+
+// Series flattens a snapshot into dotted series names, e.g.
+// "memory.used_percent" or "disk.io.sda.read_bytes", mapped to their value.
+func (m SystemMetrics) Series() map[string]float64 {
+	series := map[string]float64{
+		"cpu.total_usage": m.CPU.TotalUsage,
+		"cpu.load1":       m.CPU.LoadAverage[0],
+		"cpu.load5":       m.CPU.LoadAverage[1],
+		"cpu.load15":      m.CPU.LoadAverage[2],
+
+		"memory.total":        float64(m.Memory.Total),
+		"memory.used":         float64(m.Memory.Used),
+		"memory.free":         float64(m.Memory.Free),
+		"memory.used_percent": m.Memory.UsedPercent,
+		"memory.swap_total":   float64(m.Memory.SwapTotal),
+		"memory.swap_used":    float64(m.Memory.SwapUsed),
+		"memory.swap_free":    float64(m.Memory.SwapFree),
+
+		"uptime.uptime":   m.Uptime.Uptime,
+		"processes.count": float64(len(m.Process)),
+
+		"cpu.context_switches_per_sec": m.CPU.ContextSwitchesPerSec,
+		"cpu.interrupts_per_sec":       m.CPU.InterruptsPerSec,
+
+		"fd.allocated":    float64(m.FileDescriptors.Allocated),
+		"fd.max":          float64(m.FileDescriptors.Max),
+		"fd.used_percent": m.FileDescriptors.UsedPercent,
+
+		"sockets.used":      float64(m.Sockets.Used),
+		"entropy.available": float64(m.Entropy.Available),
+	}
+
+	for state, n := range m.Sockets.TCP {
+		series["sockets.tcp."+state] = float64(n)
+	}
+
+	if p := m.Pressure; p != nil {
+		for resource, pressure := range map[string]Pressure{"cpu": p.CPU, "memory": p.Memory, "io": p.IO} {
+			prefix := "pressure." + resource + "."
+			series[prefix+"some.avg10"] = pressure.Some.Avg10
+			series[prefix+"some.avg60"] = pressure.Some.Avg60
+			series[prefix+"full.avg10"] = pressure.Full.Avg10
+			series[prefix+"full.avg60"] = pressure.Full.Avg60
+		}
+	}
+
+	for core, usage := range m.CPU.PerCoreUsage {
+		series["cpu.core."+core] = usage
+	}
+
+	for _, p := range m.Disk.Partitions {
+		prefix := "disk.partition." + p.Mountpoint + "."
+		series[prefix+"total"] = float64(p.Total)
+		series[prefix+"used"] = float64(p.Used)
+		series[prefix+"free"] = float64(p.Free)
+		series[prefix+"used_percent"] = p.UsedPercent
+	}
+
+	for dev, io := range m.Disk.IOCounters {
+		prefix := "disk.io." + dev + "."
+		series[prefix+"read_count"] = float64(io.ReadCount)
+		series[prefix+"write_count"] = float64(io.WriteCount)
+		series[prefix+"read_bytes"] = float64(io.ReadBytes)
+		series[prefix+"write_bytes"] = float64(io.WriteBytes)
+		series[prefix+"read_time"] = float64(io.ReadTime)
+		series[prefix+"write_time"] = float64(io.WriteTime)
+		series[prefix+"io_time"] = float64(io.IoTime)
+	}
+
+	for dev, rate := range m.Disk.IORates {
+		prefix := "disk.io." + dev + "."
+		series[prefix+"read_bytes_per_sec"] = rate.ReadBytesPerSec
+		series[prefix+"write_bytes_per_sec"] = rate.WriteBytesPerSec
+		series[prefix+"read_iops"] = rate.ReadIOPS
+		series[prefix+"write_iops"] = rate.WriteIOPS
+		series[prefix+"busy_percent"] = rate.BusyPercent
+	}
+
+	for name, iface := range m.Network.Interfaces {
+		prefix := "network." + name + "."
+		series[prefix+"bytes_sent"] = float64(iface.BytesSent)
+		series[prefix+"bytes_recv"] = float64(iface.BytesRecv)
+		series[prefix+"packets_sent"] = float64(iface.PacketsSent)
+		series[prefix+"packets_recv"] = float64(iface.PacketsRecv)
+		series[prefix+"errin"] = float64(iface.Errin)
+		series[prefix+"errout"] = float64(iface.Errout)
+		series[prefix+"dropin"] = float64(iface.Dropin)
+		series[prefix+"dropout"] = float64(iface.Dropout)
+	}
+
+	for name, rate := range m.Network.Rates {
+		prefix := "network." + name + "."
+		series[prefix+"bytes_sent_per_sec"] = rate.BytesSentPerSec
+		series[prefix+"bytes_recv_per_sec"] = rate.BytesRecvPerSec
+		series[prefix+"packets_sent_per_sec"] = rate.PacketsSentPerSec
+		series[prefix+"packets_recv_per_sec"] = rate.PacketsRecvPerSec
+		series[prefix+"errin_per_sec"] = rate.ErrinPerSec
+		series[prefix+"errout_per_sec"] = rate.ErroutPerSec
+		series[prefix+"dropin_per_sec"] = rate.DropinPerSec
+		series[prefix+"dropout_per_sec"] = rate.DropoutPerSec
+	}
+
+	for _, c := range m.Cgroups {
+		prefix := "cgroup." + c.Name() + "."
+		series[prefix+"cpu_usage"] = c.CPUUsage
+		series[prefix+"cpu_percent"] = c.CPUPercent
+		series[prefix+"cpu_throttled_periods"] = float64(c.CPUThrottled)
+		series[prefix+"cpu_throttled_time"] = c.CPUThrottledTime
+		series[prefix+"memory_usage"] = float64(c.MemoryUsage)
+		series[prefix+"memory_limit"] = float64(c.MemoryLimit)
+		series[prefix+"memory_oom_kills"] = float64(c.MemoryOOMKills)
+		series[prefix+"io_read_bytes"] = float64(c.IOReadBytes)
+		series[prefix+"io_write_bytes"] = float64(c.IOWriteBytes)
+		series[prefix+"pids"] = float64(c.PIDs)
+	}
+
+	for _, c := range m.Containers {
+		prefix := "container." + c.Name + "."
+		running := 0.0
+		if c.State == "running" {
+			running = 1
+		}
+		series[prefix+"running"] = running
+		series[prefix+"restart_count"] = float64(c.RestartCount)
+	}
+
+	for _, u := range m.Units {
+		prefix := "unit." + u.Name + "."
+		active, failed := 0.0, 0.0
+		switch u.ActiveState {
+		case "active":
+			active = 1
+		case "failed":
+			failed = 1
+		}
+		series[prefix+"active"] = active
+		series[prefix+"failed"] = failed
+		series[prefix+"restarts"] = float64(u.Restarts)
+		series[prefix+"memory_current"] = float64(u.MemoryCurrent)
+		series[prefix+"cpu_usage"] = u.CPUUsage
+	}
+
+	return series
+}
@@ -0,0 +1,143 @@
+package promql
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+type ValueType string
+
+const (
+	ValueTypeScalar ValueType = "scalar"
+	ValueTypeVector ValueType = "vector"
+	ValueTypeMatrix ValueType = "matrix"
+	ValueTypeString ValueType = "string"
+)
+
+type Expr interface {
+	Type() ValueType
+}
+
+type NumberLiteral struct {
+	Val float64
+}
+
+type StringLiteral struct {
+	Val string
+}
+
+type ParenExpr struct {
+	Expr Expr
+}
+
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+}
+
+type VectorSelector struct {
+	Name     string
+	Matchers []*Matcher
+	Offset   time.Duration
+}
+
+type MatrixSelector struct {
+	Vector *VectorSelector
+	Range  time.Duration
+}
+
+type Call struct {
+	Func *function
+	Args []Expr
+}
+
+type AggregateExpr struct {
+	Op       string
+	Expr     Expr
+	Param    Expr
+	Grouping []string
+	Without  bool
+}
+
+type BinaryExpr struct {
+	Op         string
+	LHS        Expr
+	RHS        Expr
+	ReturnBool bool
+}
+
+func (e *NumberLiteral) Type() ValueType  { return ValueTypeScalar }
+func (e *StringLiteral) Type() ValueType  { return ValueTypeString }
+func (e *ParenExpr) Type() ValueType      { return e.Expr.Type() }
+func (e *UnaryExpr) Type() ValueType      { return e.Expr.Type() }
+func (e *VectorSelector) Type() ValueType { return ValueTypeVector }
+func (e *MatrixSelector) Type() ValueType { return ValueTypeMatrix }
+func (e *Call) Type() ValueType           { return e.Func.returnType }
+func (e *AggregateExpr) Type() ValueType  { return ValueTypeVector }
+
+func (e *BinaryExpr) Type() ValueType {
+	if e.LHS.Type() == ValueTypeScalar && e.RHS.Type() == ValueTypeScalar {
+		return ValueTypeScalar
+	}
+	return ValueTypeVector
+}
+
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher is a single label matcher from a selector such as {device=~"sd.*"}.
+type Matcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+	re    *regexp.Regexp
+}
+
+func NewMatcher(t MatchType, name, value string) (*Matcher, error) {
+	m := &Matcher{Type: t, Name: name, Value: value}
+	if t == MatchRegexp || t == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+func (m *Matcher) Matches(v string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// MatchLabels reports whether every matcher accepts the label set. Missing
+// labels are treated as the empty string, as in Prometheus.
+func MatchLabels(matchers []*Matcher, labels metrics.Labels) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+var errNotSelector = errors.New("expected a series selector")
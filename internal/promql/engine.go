@@ -0,0 +1,519 @@
+package promql
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+// DefaultLookbackDelta is how far back an instant vector selector looks for
+// the most recent sample, matching Prometheus' default.
+const DefaultLookbackDelta = 5 * time.Minute
+
+// Queryable provides the raw series an expression is evaluated against.
+type Queryable interface {
+	Select(mint, maxt time.Time, matchers []*Matcher) ([]Series, error)
+}
+
+type Engine struct {
+	queryable     Queryable
+	lookbackDelta time.Duration
+}
+
+func NewEngine(queryable Queryable) *Engine {
+	return &Engine{
+		queryable:     queryable,
+		lookbackDelta: DefaultLookbackDelta,
+	}
+}
+
+// evalError aborts evaluation from deep inside the evaluator; it is turned
+// back into a regular error at the Instant/Range boundary.
+type evalError struct {
+	err error
+}
+
+type evaluator struct {
+	lookbackDelta int64
+	data          map[*VectorSelector][]Series
+}
+
+// Instant evaluates the query at a single point in time.
+func (e *Engine) Instant(query string, ts time.Time) (result Value, err error) {
+	expr, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ev, err := e.newEvaluator(expr, ts, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer recoverEval(&err)
+	return ev.eval(expr, timestamp(ts)), nil
+}
+
+// Range evaluates the query at every step between start and end inclusive.
+func (e *Engine) Range(query string, start, end time.Time, step time.Duration) (result Matrix, err error) {
+	expr, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	if t := expr.Type(); t != ValueTypeScalar && t != ValueTypeVector {
+		return nil, fmt.Errorf("invalid expression type %q for range query, must be scalar or instant vector", t)
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("zero or negative query resolution step widths are not accepted")
+	}
+	// Steps are taken in whole milliseconds, so a shorter one never moves
+	if step < time.Millisecond {
+		return nil, fmt.Errorf("query resolution step widths below 1ms are not accepted")
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end timestamp must not be before start time")
+	}
+
+	ev, err := e.newEvaluator(expr, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	defer recoverEval(&err)
+
+	series := make(map[string]*Series)
+	for t := timestamp(start); t <= timestamp(end); t += step.Milliseconds() {
+		switch v := ev.eval(expr, t).(type) {
+		case Scalar:
+			appendPoint(series, metrics.Labels{}, Point{T: t, V: v.V})
+		case Vector:
+			for _, s := range v {
+				appendPoint(series, s.Labels, Point{T: t, V: s.V})
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result = make(Matrix, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *series[key])
+	}
+	return result, nil
+}
+
+func appendPoint(series map[string]*Series, labels metrics.Labels, p Point) {
+	key := labels.Key()
+	s, ok := series[key]
+	if !ok {
+		s = &Series{Labels: labels}
+		series[key] = s
+	}
+	s.Points = append(s.Points, p)
+}
+
+func recoverEval(err *error) {
+	if r := recover(); r != nil {
+		ee, ok := r.(evalError)
+		if !ok {
+			panic(r)
+		}
+		*err = ee.err
+	}
+}
+
+// newEvaluator loads every series referenced by expr for the whole
+// evaluation window in one Select per selector.
+func (e *Engine) newEvaluator(expr Expr, start, end time.Time) (*evaluator, error) {
+	ev := &evaluator{
+		lookbackDelta: e.lookbackDelta.Milliseconds(),
+		data:          make(map[*VectorSelector][]Series),
+	}
+
+	var err error
+	inspect(expr, 0, func(vs *VectorSelector, rng time.Duration) {
+		if err != nil {
+			return
+		}
+		window := rng
+		if window < e.lookbackDelta {
+			window = e.lookbackDelta
+		}
+		var series []Series
+		series, err = e.queryable.Select(start.Add(-vs.Offset-window), end.Add(-vs.Offset), vs.Matchers)
+		ev.data[vs] = series
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+func inspect(expr Expr, rng time.Duration, fn func(*VectorSelector, time.Duration)) {
+	switch e := expr.(type) {
+	case *ParenExpr:
+		inspect(e.Expr, rng, fn)
+	case *UnaryExpr:
+		inspect(e.Expr, rng, fn)
+	case *VectorSelector:
+		fn(e, rng)
+	case *MatrixSelector:
+		fn(e.Vector, e.Range)
+	case *Call:
+		for _, arg := range e.Args {
+			inspect(arg, rng, fn)
+		}
+	case *AggregateExpr:
+		if e.Param != nil {
+			inspect(e.Param, rng, fn)
+		}
+		inspect(e.Expr, rng, fn)
+	case *BinaryExpr:
+		inspect(e.LHS, rng, fn)
+		inspect(e.RHS, rng, fn)
+	}
+}
+
+func (ev *evaluator) errorf(format string, args ...interface{}) {
+	panic(evalError{fmt.Errorf(format, args...)})
+}
+
+func (ev *evaluator) eval(expr Expr, ts int64) Value {
+	switch e := expr.(type) {
+	case *NumberLiteral:
+		return Scalar{T: ts, V: e.Val}
+	case *StringLiteral:
+		return String{T: ts, V: e.Val}
+	case *ParenExpr:
+		return ev.eval(e.Expr, ts)
+	case *UnaryExpr:
+		switch v := ev.eval(e.Expr, ts).(type) {
+		case Scalar:
+			return Scalar{T: ts, V: -v.V}
+		case Vector:
+			out := make(Vector, 0, len(v))
+			for _, s := range v {
+				out = append(out, Sample{Labels: dropMetricName(s.Labels), Point: Point{T: ts, V: -s.V}})
+			}
+			return out
+		}
+	case *VectorSelector:
+		return ev.vectorSelector(e, ts)
+	case *MatrixSelector:
+		return ev.matrixSelector(e, ts)
+	case *Call:
+		return e.Func.call(ev, e.Args, ts)
+	case *AggregateExpr:
+		return ev.aggregate(e, ts)
+	case *BinaryExpr:
+		return ev.binary(e, ts)
+	}
+	ev.errorf("unhandled expression of type %T", expr)
+	return nil
+}
+
+func (ev *evaluator) vectorSelector(vs *VectorSelector, ts int64) Vector {
+	refT := ts - vs.Offset.Milliseconds()
+	var out Vector
+	for _, s := range ev.data[vs] {
+		i := sort.Search(len(s.Points), func(i int) bool { return s.Points[i].T > refT }) - 1
+		if i < 0 || s.Points[i].T <= refT-ev.lookbackDelta {
+			continue
+		}
+		out = append(out, Sample{Labels: s.Labels, Point: Point{T: ts, V: s.Points[i].V}})
+	}
+	return out
+}
+
+func (ev *evaluator) matrixSelector(ms *MatrixSelector, ts int64) Matrix {
+	refT := ts - ms.Vector.Offset.Milliseconds()
+	mint := refT - ms.Range.Milliseconds()
+	var out Matrix
+	for _, s := range ev.data[ms.Vector] {
+		lo := sort.Search(len(s.Points), func(i int) bool { return s.Points[i].T > mint })
+		hi := sort.Search(len(s.Points), func(i int) bool { return s.Points[i].T > refT })
+		if lo >= hi {
+			continue
+		}
+		out = append(out, Series{Labels: s.Labels, Points: s.Points[lo:hi]})
+	}
+	return out
+}
+
+func (ev *evaluator) evalScalar(expr Expr, ts int64) float64 {
+	v, ok := ev.eval(expr, ts).(Scalar)
+	if !ok {
+		ev.errorf("expected scalar")
+	}
+	return v.V
+}
+
+func (ev *evaluator) evalVector(expr Expr, ts int64) Vector {
+	v, ok := ev.eval(expr, ts).(Vector)
+	if !ok {
+		ev.errorf("expected instant vector")
+	}
+	return v
+}
+
+type aggregateGroup struct {
+	labels  metrics.Labels
+	value   float64
+	count   int
+	values  []float64
+	samples Vector
+}
+
+func (ev *evaluator) aggregate(agg *AggregateExpr, ts int64) Vector {
+	input := ev.evalVector(agg.Expr, ts)
+
+	var param float64
+	if agg.Param != nil {
+		param = ev.evalScalar(agg.Param, ts)
+	}
+
+	groups := make(map[string]*aggregateGroup)
+	var order []string
+
+	for _, s := range input {
+		labels := groupingLabels(s.Labels, agg.Grouping, agg.Without)
+		key := labels.Key()
+
+		g, ok := groups[key]
+		if !ok {
+			g = &aggregateGroup{labels: labels, value: s.V}
+			groups[key] = g
+			order = append(order, key)
+		} else {
+			switch agg.Op {
+			case "sum", "avg":
+				g.value += s.V
+			case "min":
+				if s.V < g.value || math.IsNaN(g.value) {
+					g.value = s.V
+				}
+			case "max":
+				if s.V > g.value || math.IsNaN(g.value) {
+					g.value = s.V
+				}
+			}
+		}
+		g.count++
+		g.values = append(g.values, s.V)
+		g.samples = append(g.samples, s)
+	}
+
+	var out Vector
+	for _, key := range order {
+		g := groups[key]
+		switch agg.Op {
+		case "avg":
+			g.value /= float64(g.count)
+		case "count":
+			g.value = float64(g.count)
+		case "quantile":
+			g.value = quantile(param, g.values)
+		case "topk", "bottomk":
+			out = append(out, selectK(agg.Op == "topk", int(param), g.samples, ts)...)
+			continue
+		}
+		out = append(out, Sample{Labels: g.labels, Point: Point{T: ts, V: g.value}})
+	}
+	return out
+}
+
+func selectK(top bool, k int, samples Vector, ts int64) Vector {
+	if k < 1 {
+		return nil
+	}
+	sorted := append(Vector(nil), samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if top {
+			return sorted[i].V > sorted[j].V
+		}
+		return sorted[i].V < sorted[j].V
+	})
+	if k < len(sorted) {
+		sorted = sorted[:k]
+	}
+	for i := range sorted {
+		sorted[i].T = ts
+	}
+	return sorted
+}
+
+func groupingLabels(labels metrics.Labels, grouping []string, without bool) metrics.Labels {
+	if without {
+		out := dropMetricName(labels)
+		for _, name := range grouping {
+			delete(out, name)
+		}
+		return out
+	}
+
+	out := metrics.Labels{}
+	for _, name := range grouping {
+		if v, ok := labels[name]; ok {
+			out[name] = v
+		}
+	}
+	return out
+}
+
+func (ev *evaluator) binary(e *BinaryExpr, ts int64) Value {
+	lhs := ev.eval(e.LHS, ts)
+	rhs := ev.eval(e.RHS, ts)
+	comparison := binaryPrecedence[e.Op] == 1
+
+	switch l := lhs.(type) {
+	case Scalar:
+		switch r := rhs.(type) {
+		case Scalar:
+			v, keep := binaryOp(e.Op, l.V, r.V)
+			if comparison {
+				v = boolValue(keep)
+			}
+			return Scalar{T: ts, V: v}
+		case Vector:
+			return ev.vectorScalar(e, r, l.V, true, ts)
+		}
+	case Vector:
+		switch r := rhs.(type) {
+		case Scalar:
+			return ev.vectorScalar(e, l, r.V, false, ts)
+		case Vector:
+			return ev.vectorVector(e, l, r, ts)
+		}
+	}
+	ev.errorf("invalid operand types for %s", e.Op)
+	return nil
+}
+
+func (ev *evaluator) vectorScalar(e *BinaryExpr, vec Vector, scalar float64, swap bool, ts int64) Vector {
+	comparison := binaryPrecedence[e.Op] == 1
+	var out Vector
+	for _, s := range vec {
+		l, r := s.V, scalar
+		if swap {
+			l, r = r, l
+		}
+		v, keep := binaryOp(e.Op, l, r)
+		labels := s.Labels
+		switch {
+		case comparison && e.ReturnBool:
+			v = boolValue(keep)
+			labels = dropMetricName(labels)
+		case comparison:
+			if !keep {
+				continue
+			}
+			v = s.V
+		default:
+			labels = dropMetricName(labels)
+		}
+		out = append(out, Sample{Labels: labels, Point: Point{T: ts, V: v}})
+	}
+	return out
+}
+
+// vectorVector performs one-to-one matching on all labels except the metric
+// name.
+func (ev *evaluator) vectorVector(e *BinaryExpr, lhs, rhs Vector, ts int64) Vector {
+	comparison := binaryPrecedence[e.Op] == 1
+
+	right := make(map[string]Sample, len(rhs))
+	for _, s := range rhs {
+		key := dropMetricName(s.Labels).Key()
+		if _, dup := right[key]; dup {
+			ev.errorf("found duplicate series for the match group on the right hand-side of the operation: many-to-many matching not allowed")
+		}
+		right[key] = s
+	}
+
+	seen := make(map[string]bool, len(lhs))
+	var out Vector
+	for _, s := range lhs {
+		matchLabels := dropMetricName(s.Labels)
+		key := matchLabels.Key()
+		r, ok := right[key]
+		if !ok {
+			continue
+		}
+		if seen[key] {
+			ev.errorf("found duplicate series for the match group on the left hand-side of the operation: many-to-many matching not allowed")
+		}
+		seen[key] = true
+
+		v, keep := binaryOp(e.Op, s.V, r.V)
+		labels := matchLabels
+		switch {
+		case comparison && e.ReturnBool:
+			v = boolValue(keep)
+		case comparison:
+			if !keep {
+				continue
+			}
+			v = s.V
+			labels = s.Labels
+		}
+		out = append(out, Sample{Labels: labels, Point: Point{T: ts, V: v}})
+	}
+	return out
+}
+
+// binaryOp returns the arithmetic result, or for comparison operators
+// whether the comparison holds.
+func binaryOp(op string, l, r float64) (float64, bool) {
+	switch op {
+	case "+":
+		return l + r, true
+	case "-":
+		return l - r, true
+	case "*":
+		return l * r, true
+	case "/":
+		return l / r, true
+	case "%":
+		return math.Mod(l, r), true
+	case "^":
+		return math.Pow(l, r), true
+	case "==":
+		return l, l == r
+	case "!=":
+		return l, l != r
+	case ">":
+		return l, l > r
+	case "<":
+		return l, l < r
+	case ">=":
+		return l, l >= r
+	case "<=":
+		return l, l <= r
+	}
+	return math.NaN(), false
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func dropMetricName(labels metrics.Labels) metrics.Labels {
+	out := labels.Copy()
+	delete(out, metrics.MetricNameLabel)
+	return out
+}
+
+func timestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
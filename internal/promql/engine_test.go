@@ -0,0 +1,109 @@
+package promql
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+// seriesQueryable serves fixed series
+type seriesQueryable []Series
+
+func (q seriesQueryable) Select(mint, maxt time.Time, matchers []*Matcher) ([]Series, error) {
+	var out []Series
+	for _, s := range q {
+		if !MatchLabels(matchers, s.Labels) {
+			continue
+		}
+		var points []Point
+		for _, p := range s.Points {
+			if p.T >= timestamp(mint) && p.T <= timestamp(maxt) {
+				points = append(points, p)
+			}
+		}
+		out = append(out, Series{Labels: s.Labels, Points: points})
+	}
+	return out, nil
+}
+
+// counter is a series rising by perSecond every 15s for 10 minutes up to end
+func counter(name string, end time.Time, perSecond float64) Series {
+	s := Series{Labels: metrics.Labels{metrics.MetricNameLabel: name}}
+	start := end.Add(-10 * time.Minute)
+	for t := start; !t.After(end); t = t.Add(15 * time.Second) {
+		s.Points = append(s.Points, Point{T: timestamp(t), V: t.Sub(start).Seconds() * perSecond})
+	}
+	return s
+}
+
+func TestInstantRateOfParenthesizedSelector(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	engine := NewEngine(seriesQueryable{counter("foo_total", now, 2)})
+
+	for _, query := range []string{"rate(foo_total[5m])", "rate((foo_total[5m]))", "sum(rate(((foo_total[5m]))))"} {
+		v, err := engine.Instant(query, now)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		vec, ok := v.(Vector)
+		if !ok || len(vec) != 1 {
+			t.Fatalf("%s = %v, want one sample", query, v)
+		}
+		if math.Abs(vec[0].V-2) > 1e-9 {
+			t.Errorf("%s = %v, want 2", query, vec[0].V)
+		}
+	}
+}
+
+func TestRangeOverTimeOfParenthesizedSelector(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	engine := NewEngine(seriesQueryable{counter("foo_total", now, 1)})
+
+	m, err := engine.Range("max_over_time((foo_total[1m]))", now.Add(-2*time.Minute), now, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 1 || len(m[0].Points) != 3 {
+		t.Fatalf("got %v, want one series of 3 points", m)
+	}
+	if last := m[0].Points[2].V; last != 600 {
+		t.Errorf("last point = %v, want 600", last)
+	}
+}
+
+func TestInstantErrorsDoNotPanic(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	engine := NewEngine(seriesQueryable{counter("foo_total", now, 1)})
+
+	for _, query := range []string{"rate((foo_total))", "foo_total[5m] * 2", "rate(foo_total[5m]"} {
+		if _, err := engine.Instant(query, now); err == nil {
+			t.Errorf("%s succeeded, want an error", query)
+		}
+	}
+}
+
+func TestRangeRefusesSubMillisecondStep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	engine := NewEngine(seriesQueryable{counter("foo_total", now, 1)})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := engine.Range("foo_total", now, now, 500*time.Microsecond)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("0.5ms step succeeded, want an error")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("range query with a 0.5ms step did not return")
+	}
+
+	m, err := engine.Range("foo_total", now.Add(-time.Millisecond), now, time.Millisecond)
+	if err != nil || len(m) != 1 || len(m[0].Points) != 2 {
+		t.Errorf("1ms step: got %v, %v; want one series of 2 points", m, err)
+	}
+}
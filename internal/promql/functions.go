@@ -0,0 +1,308 @@
+package promql
+
+import (
+	"math"
+	"sort"
+
+	"Golem/internal/metrics"
+)
+
+type function struct {
+	name         string
+	argTypes     []ValueType
+	optionalArgs int
+	returnType   ValueType
+	call         func(ev *evaluator, args []Expr, ts int64) Value
+}
+
+var functions = map[string]*function{
+	"rate": rangeFunction("rate", func(points []Point, rng rangeWindow) (float64, bool) {
+		return extrapolatedRate(points, rng, true, true)
+	}),
+	"increase": rangeFunction("increase", func(points []Point, rng rangeWindow) (float64, bool) {
+		return extrapolatedRate(points, rng, true, false)
+	}),
+	"delta": rangeFunction("delta", func(points []Point, rng rangeWindow) (float64, bool) {
+		return extrapolatedRate(points, rng, false, false)
+	}),
+	"irate":  rangeFunction("irate", func(points []Point, _ rangeWindow) (float64, bool) { return instantValue(points, true) }),
+	"idelta": rangeFunction("idelta", func(points []Point, _ rangeWindow) (float64, bool) { return instantValue(points, false) }),
+
+	"avg_over_time": rangeFunction("avg_over_time", func(points []Point, _ rangeWindow) (float64, bool) {
+		sum := 0.0
+		for _, p := range points {
+			sum += p.V
+		}
+		return sum / float64(len(points)), true
+	}),
+	"min_over_time": rangeFunction("min_over_time", func(points []Point, _ rangeWindow) (float64, bool) {
+		min := points[0].V
+		for _, p := range points[1:] {
+			if p.V < min || math.IsNaN(min) {
+				min = p.V
+			}
+		}
+		return min, true
+	}),
+	"max_over_time": rangeFunction("max_over_time", func(points []Point, _ rangeWindow) (float64, bool) {
+		max := points[0].V
+		for _, p := range points[1:] {
+			if p.V > max || math.IsNaN(max) {
+				max = p.V
+			}
+		}
+		return max, true
+	}),
+	"sum_over_time": rangeFunction("sum_over_time", func(points []Point, _ rangeWindow) (float64, bool) {
+		sum := 0.0
+		for _, p := range points {
+			sum += p.V
+		}
+		return sum, true
+	}),
+	"count_over_time": rangeFunction("count_over_time", func(points []Point, _ rangeWindow) (float64, bool) {
+		return float64(len(points)), true
+	}),
+	"last_over_time": rangeFunction("last_over_time", func(points []Point, _ rangeWindow) (float64, bool) {
+		return points[len(points)-1].V, true
+	}),
+
+	"quantile_over_time": {
+		name:       "quantile_over_time",
+		argTypes:   []ValueType{ValueTypeScalar, ValueTypeMatrix},
+		returnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Expr, ts int64) Value {
+			q := ev.evalScalar(args[0], ts)
+			var out Vector
+			for _, s := range ev.eval(args[1], ts).(Matrix) {
+				values := make([]float64, len(s.Points))
+				for i, p := range s.Points {
+					values[i] = p.V
+				}
+				out = append(out, Sample{Labels: dropMetricName(s.Labels), Point: Point{T: ts, V: quantile(q, values)}})
+			}
+			return out
+		},
+	},
+
+	"abs":   mathFunction("abs", math.Abs),
+	"ceil":  mathFunction("ceil", math.Ceil),
+	"floor": mathFunction("floor", math.Floor),
+	"exp":   mathFunction("exp", math.Exp),
+	"sqrt":  mathFunction("sqrt", math.Sqrt),
+	"ln":    mathFunction("ln", math.Log),
+	"log2":  mathFunction("log2", math.Log2),
+	"log10": mathFunction("log10", math.Log10),
+
+	"round": {
+		name:         "round",
+		argTypes:     []ValueType{ValueTypeVector, ValueTypeScalar},
+		optionalArgs: 1,
+		returnType:   ValueTypeVector,
+		call: func(ev *evaluator, args []Expr, ts int64) Value {
+			toNearest := 1.0
+			if len(args) > 1 {
+				toNearest = ev.evalScalar(args[1], ts)
+			}
+			return mapVector(ev.evalVector(args[0], ts), ts, func(v float64) float64 {
+				return math.Floor(v/toNearest+0.5) * toNearest
+			})
+		},
+	},
+	"clamp_min": {
+		name:       "clamp_min",
+		argTypes:   []ValueType{ValueTypeVector, ValueTypeScalar},
+		returnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Expr, ts int64) Value {
+			min := ev.evalScalar(args[1], ts)
+			return mapVector(ev.evalVector(args[0], ts), ts, func(v float64) float64 { return math.Max(v, min) })
+		},
+	},
+	"clamp_max": {
+		name:       "clamp_max",
+		argTypes:   []ValueType{ValueTypeVector, ValueTypeScalar},
+		returnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Expr, ts int64) Value {
+			max := ev.evalScalar(args[1], ts)
+			return mapVector(ev.evalVector(args[0], ts), ts, func(v float64) float64 { return math.Min(v, max) })
+		},
+	},
+
+	"time": {
+		name:       "time",
+		returnType: ValueTypeScalar,
+		call: func(ev *evaluator, args []Expr, ts int64) Value {
+			return Scalar{T: ts, V: float64(ts) / 1000}
+		},
+	},
+	"vector": {
+		name:       "vector",
+		argTypes:   []ValueType{ValueTypeScalar},
+		returnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Expr, ts int64) Value {
+			return Vector{{Labels: metrics.Labels{}, Point: Point{T: ts, V: ev.evalScalar(args[0], ts)}}}
+		},
+	},
+	"scalar": {
+		name:       "scalar",
+		argTypes:   []ValueType{ValueTypeVector},
+		returnType: ValueTypeScalar,
+		call: func(ev *evaluator, args []Expr, ts int64) Value {
+			v := ev.evalVector(args[0], ts)
+			if len(v) != 1 {
+				return Scalar{T: ts, V: math.NaN()}
+			}
+			return Scalar{T: ts, V: v[0].V}
+		},
+	},
+}
+
+type rangeWindow struct {
+	start int64
+	end   int64
+}
+
+func rangeFunction(name string, fn func(points []Point, rng rangeWindow) (float64, bool)) *function {
+	return &function{
+		name:       name,
+		argTypes:   []ValueType{ValueTypeMatrix},
+		returnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Expr, ts int64) Value {
+			ms, ok := unwrapParens(args[0]).(*MatrixSelector)
+			if !ok {
+				ev.errorf("expected a range vector selector in call to %s()", name)
+			}
+			end := ts - ms.Vector.Offset.Milliseconds()
+			rng := rangeWindow{start: end - ms.Range.Milliseconds(), end: end}
+
+			var out Vector
+			for _, s := range ev.matrixSelector(ms, ts) {
+				v, ok := fn(s.Points, rng)
+				if !ok {
+					continue
+				}
+				labels := dropMetricName(s.Labels)
+				if name == "last_over_time" {
+					labels = s.Labels
+				}
+				out = append(out, Sample{Labels: labels, Point: Point{T: ts, V: v}})
+			}
+			return out
+		},
+	}
+}
+
+func mathFunction(name string, fn func(float64) float64) *function {
+	return &function{
+		name:       name,
+		argTypes:   []ValueType{ValueTypeVector},
+		returnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Expr, ts int64) Value {
+			return mapVector(ev.evalVector(args[0], ts), ts, fn)
+		},
+	}
+}
+
+func mapVector(v Vector, ts int64, fn func(float64) float64) Vector {
+	out := make(Vector, 0, len(v))
+	for _, s := range v {
+		out = append(out, Sample{Labels: dropMetricName(s.Labels), Point: Point{T: ts, V: fn(s.V)}})
+	}
+	return out
+}
+
+// extrapolatedRate implements rate, increase and delta the way Prometheus
+// does: counter resets are compensated for and the result is extrapolated
+// to the edges of the range when the samples stop short of them.
+func extrapolatedRate(points []Point, rng rangeWindow, isCounter, isRate bool) (float64, bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+
+	first, last := points[0], points[len(points)-1]
+	result := last.V - first.V
+	if isCounter {
+		prev := first.V
+		for _, p := range points[1:] {
+			if p.V < prev {
+				result += prev
+			}
+			prev = p.V
+		}
+	}
+
+	durationToStart := float64(first.T-rng.start) / 1000
+	durationToEnd := float64(rng.end-last.T) / 1000
+	sampledInterval := float64(last.T-first.T) / 1000
+	averageInterval := sampledInterval / float64(len(points)-1)
+
+	if isCounter && result > 0 && first.V >= 0 {
+		durationToZero := sampledInterval * (first.V / result)
+		if durationToZero < durationToStart {
+			durationToStart = durationToZero
+		}
+	}
+
+	threshold := averageInterval * 1.1
+	extrapolateTo := sampledInterval
+	if durationToStart < threshold {
+		extrapolateTo += durationToStart
+	} else {
+		extrapolateTo += averageInterval / 2
+	}
+	if durationToEnd < threshold {
+		extrapolateTo += durationToEnd
+	} else {
+		extrapolateTo += averageInterval / 2
+	}
+
+	result *= extrapolateTo / sampledInterval
+	if isRate {
+		result /= float64(rng.end-rng.start) / 1000
+	}
+	return result, true
+}
+
+// instantValue implements irate and idelta from the last two samples.
+func instantValue(points []Point, isRate bool) (float64, bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+
+	prev, last := points[len(points)-2], points[len(points)-1]
+	result := last.V - prev.V
+	if isRate && last.V < prev.V {
+		result = last.V
+	}
+	if !isRate {
+		return result, true
+	}
+
+	interval := last.T - prev.T
+	if interval == 0 {
+		return 0, false
+	}
+	return result / (float64(interval) / 1000), true
+}
+
+// quantile returns the φ-quantile of values using linear interpolation.
+func quantile(q float64, values []float64) float64 {
+	if len(values) == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(1)
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := q * float64(len(sorted)-1)
+	lower := math.Floor(rank)
+	upper := math.Min(lower+1, float64(len(sorted)-1))
+	weight := rank - lower
+	return sorted[int(lower)]*(1-weight) + sorted[int(upper)]*weight
+}
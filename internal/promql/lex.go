@@ -0,0 +1,210 @@
+package promql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokDuration
+	tokLeftParen
+	tokRightParen
+	tokLeftBrace
+	tokRightBrace
+	tokLeftBracket
+	tokRightBracket
+	tokComma
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+// lex splits a PromQL expression into tokens. Durations are only recognised
+// inside square brackets and after "offset", where PromQL expects them.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	inBrackets := false
+
+	for i := 0; i < len(input); {
+		c := input[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '#':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+			continue
+		}
+
+		start := i
+		switch c {
+		case '(':
+			tokens = append(tokens, token{tokLeftParen, "(", start})
+			i++
+			continue
+		case ')':
+			tokens = append(tokens, token{tokRightParen, ")", start})
+			i++
+			continue
+		case '{':
+			tokens = append(tokens, token{tokLeftBrace, "{", start})
+			i++
+			continue
+		case '}':
+			tokens = append(tokens, token{tokRightBrace, "}", start})
+			i++
+			continue
+		case '[':
+			tokens = append(tokens, token{tokLeftBracket, "[", start})
+			inBrackets = true
+			i++
+			continue
+		case ']':
+			tokens = append(tokens, token{tokRightBracket, "]", start})
+			inBrackets = false
+			i++
+			continue
+		case ',':
+			tokens = append(tokens, token{tokComma, ",", start})
+			i++
+			continue
+		case '"', '\'', '`':
+			s, n, err := lexString(input[i:])
+			if err != nil {
+				return nil, fmt.Errorf("at position %d: %v", start, err)
+			}
+			tokens = append(tokens, token{tokString, s, start})
+			i += n
+			continue
+		}
+
+		if op := lexOperator(input[i:]); op != "" {
+			tokens = append(tokens, token{tokOp, op, start})
+			i += len(op)
+			continue
+		}
+
+		afterOffset := len(tokens) > 0 && tokens[len(tokens)-1].kind == tokIdent && tokens[len(tokens)-1].val == "offset"
+		if (inBrackets || afterOffset) && isDigit(c) {
+			for i < len(input) && (isDigit(input[i]) || unicode.IsLetter(rune(input[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{tokDuration, input[start:i], start})
+			continue
+		}
+
+		if isDigit(c) || (c == '.' && i+1 < len(input) && isDigit(input[i+1])) {
+			i = lexNumber(input, i)
+			tokens = append(tokens, token{tokNumber, input[start:i], start})
+			continue
+		}
+
+		if isIdentStart(c) {
+			for i < len(input) && isIdentChar(input[i]) {
+				i++
+			}
+			word := input[start:i]
+			if lower := strings.ToLower(word); lower == "inf" || lower == "nan" {
+				tokens = append(tokens, token{tokNumber, word, start})
+				continue
+			}
+			tokens = append(tokens, token{tokIdent, word, start})
+			continue
+		}
+
+		return nil, fmt.Errorf("unexpected character %q at position %d", c, start)
+	}
+
+	tokens = append(tokens, token{tokEOF, "", len(input)})
+	return tokens, nil
+}
+
+func lexOperator(s string) string {
+	for _, op := range []string{"==", "!=", ">=", "<=", "=~", "!~", "+", "-", "*", "/", "%", "^", ">", "<", "="} {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && quote != '`' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func lexNumber(s string, i int) int {
+	if strings.HasPrefix(s[i:], "0x") || strings.HasPrefix(s[i:], "0X") {
+		i += 2
+		for i < len(s) && strings.ContainsRune("0123456789abcdefABCDEF", rune(s[i])) {
+			i++
+		}
+		return i
+	}
+	for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+		i++
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
@@ -0,0 +1,455 @@
+package promql
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+var aggregations = map[string]bool{
+	"sum":      true,
+	"avg":      true,
+	"min":      true,
+	"max":      true,
+	"count":    true,
+	"quantile": true,
+	"topk":     true,
+	"bottomk":  true,
+}
+
+var binaryPrecedence = map[string]int{
+	"==": 1, "!=": 1, ">": 1, "<": 1, ">=": 1, "<=": 1,
+	"+": 2, "-": 2,
+	"*": 3, "/": 3, "%": 3,
+	"^": 4,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses a PromQL expression.
+func Parse(input string) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s but got %s at position %d", what, t, t.pos)
+	}
+	return t, nil
+}
+
+func (p *parser) parseExpr(minPrec int) (Expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec, ok := binaryPrecedence[t.val]
+		if t.kind != tokOp || !ok || prec < minPrec {
+			return lhs, nil
+		}
+		p.next()
+
+		returnBool := false
+		if prec == 1 && p.peek().kind == tokIdent && p.peek().val == "bool" {
+			p.next()
+			returnBool = true
+		}
+
+		// "^" is right associative, everything else is left associative.
+		nextPrec := prec + 1
+		if t.val == "^" {
+			nextPrec = prec
+		}
+
+		rhs, err := p.parseExpr(nextPrec)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkBinaryOperand(lhs); err != nil {
+			return nil, err
+		}
+		if err := checkBinaryOperand(rhs); err != nil {
+			return nil, err
+		}
+		if prec == 1 && !returnBool && lhs.Type() == ValueTypeScalar && rhs.Type() == ValueTypeScalar {
+			return nil, fmt.Errorf("comparisons between scalars must use the bool modifier")
+		}
+
+		lhs = &BinaryExpr{Op: t.val, LHS: lhs, RHS: rhs, ReturnBool: returnBool}
+	}
+}
+
+func checkBinaryOperand(e Expr) error {
+	if t := e.Type(); t != ValueTypeScalar && t != ValueTypeVector {
+		return fmt.Errorf("binary expressions must contain only scalar and instant vector types, got %s", t)
+	}
+	return nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+	if t.kind == tokOp && (t.val == "-" || t.val == "+") {
+		p.next()
+		expr, err := p.parseExpr(binaryPrecedence["^"])
+		if err != nil {
+			return nil, err
+		}
+		if t.val == "+" {
+			return expr, nil
+		}
+		if n, ok := expr.(*NumberLiteral); ok {
+			return &NumberLiteral{Val: -n.Val}, nil
+		}
+		if err := checkBinaryOperand(expr); err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "-", Expr: expr}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (Expr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == tokLeftBracket {
+		vs, ok := expr.(*VectorSelector)
+		if !ok {
+			return nil, fmt.Errorf("ranges are only allowed on vector selectors")
+		}
+		p.next()
+		d, err := p.expect(tokDuration, "duration")
+		if err != nil {
+			return nil, err
+		}
+		rng, err := parseDuration(d.val)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRightBracket, "]"); err != nil {
+			return nil, err
+		}
+		expr = &MatrixSelector{Vector: vs, Range: rng}
+	}
+
+	if t := p.peek(); t.kind == tokIdent && t.val == "offset" {
+		p.next()
+		d, err := p.expect(tokDuration, "duration")
+		if err != nil {
+			return nil, err
+		}
+		offset, err := parseDuration(d.val)
+		if err != nil {
+			return nil, err
+		}
+		switch e := expr.(type) {
+		case *VectorSelector:
+			e.Offset = offset
+		case *MatrixSelector:
+			e.Vector.Offset = offset
+		default:
+			return nil, fmt.Errorf("offset modifier must be preceded by a selector")
+		}
+	}
+
+	return expr, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := parseNumber(t.val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.val, t.pos)
+		}
+		return &NumberLiteral{Val: v}, nil
+	case tokString:
+		return &StringLiteral{Val: t.val}, nil
+	case tokLeftParen:
+		expr, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRightParen, ")"); err != nil {
+			return nil, err
+		}
+		return &ParenExpr{Expr: expr}, nil
+	case tokLeftBrace:
+		p.pos--
+		return p.parseVectorSelector("")
+	case tokIdent:
+		if aggregations[t.val] {
+			return p.parseAggregate(t.val)
+		}
+		if p.peek().kind == tokLeftParen {
+			return p.parseCall(t)
+		}
+		return p.parseVectorSelector(t.val)
+	}
+	return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+}
+
+func (p *parser) parseVectorSelector(name string) (Expr, error) {
+	vs := &VectorSelector{Name: name}
+	if name != "" {
+		m, _ := NewMatcher(MatchEqual, metrics.MetricNameLabel, name)
+		vs.Matchers = append(vs.Matchers, m)
+	}
+
+	if p.peek().kind == tokLeftBrace {
+		p.next()
+		for p.peek().kind != tokRightBrace {
+			label, err := p.expect(tokIdent, "label name")
+			if err != nil {
+				return nil, err
+			}
+			op := p.next()
+			if op.kind != tokOp || (op.val != "=" && op.val != "!=" && op.val != "=~" && op.val != "!~") {
+				return nil, fmt.Errorf("expected label matching operator but got %s at position %d", op, op.pos)
+			}
+			value, err := p.expect(tokString, "label value")
+			if err != nil {
+				return nil, err
+			}
+			m, err := NewMatcher(MatchType(op.val), label.val, value.val)
+			if err != nil {
+				return nil, err
+			}
+			vs.Matchers = append(vs.Matchers, m)
+
+			if p.peek().kind == tokComma {
+				p.next()
+				continue
+			}
+			if p.peek().kind != tokRightBrace {
+				return nil, fmt.Errorf("expected , or } but got %s at position %d", p.peek(), p.peek().pos)
+			}
+		}
+		p.next()
+	}
+
+	if len(vs.Matchers) == 0 {
+		return nil, fmt.Errorf("vector selector must contain at least one matcher")
+	}
+	matchesEmpty := true
+	for _, m := range vs.Matchers {
+		if !m.Matches("") {
+			matchesEmpty = false
+		}
+	}
+	if matchesEmpty {
+		return nil, fmt.Errorf("vector selector must contain at least one non-empty matcher")
+	}
+
+	return vs, nil
+}
+
+func (p *parser) parseCall(name token) (Expr, error) {
+	fn, ok := functions[name.val]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.val, name.pos)
+	}
+	p.next()
+
+	var args []Expr
+	for p.peek().kind != tokRightParen {
+		arg, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().kind == tokComma {
+			p.next()
+			continue
+		}
+		if p.peek().kind != tokRightParen {
+			return nil, fmt.Errorf("expected , or ) but got %s at position %d", p.peek(), p.peek().pos)
+		}
+	}
+	p.next()
+
+	if len(args) < len(fn.argTypes)-fn.optionalArgs || len(args) > len(fn.argTypes) {
+		return nil, fmt.Errorf("wrong number of arguments for %s(): expected %d, got %d", fn.name, len(fn.argTypes), len(args))
+	}
+	for i, arg := range args {
+		// Range functions evaluate their selector directly, so rate((x[5m]))
+		// is read as rate(x[5m]), as Prometheus does.
+		if fn.argTypes[i] == ValueTypeMatrix {
+			arg = unwrapParens(arg)
+			args[i] = arg
+		}
+		if arg.Type() != fn.argTypes[i] {
+			return nil, fmt.Errorf("expected type %s in call to %s(), got %s", fn.argTypes[i], fn.name, arg.Type())
+		}
+	}
+
+	return &Call{Func: fn, Args: args}, nil
+}
+
+func unwrapParens(expr Expr) Expr {
+	for {
+		paren, ok := expr.(*ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.Expr
+	}
+}
+
+func (p *parser) parseAggregate(op string) (Expr, error) {
+	agg := &AggregateExpr{Op: op}
+
+	if err := p.parseGrouping(agg); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(tokLeftParen, "("); err != nil {
+		return nil, err
+	}
+	if op == "quantile" || op == "topk" || op == "bottomk" {
+		param, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		if param.Type() != ValueTypeScalar {
+			return nil, fmt.Errorf("expected scalar parameter for %s", op)
+		}
+		agg.Param = param
+		if _, err := p.expect(tokComma, ","); err != nil {
+			return nil, err
+		}
+	}
+	expr, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if expr.Type() != ValueTypeVector {
+		return nil, fmt.Errorf("expected instant vector in aggregation %s, got %s", op, expr.Type())
+	}
+	agg.Expr = expr
+	if _, err := p.expect(tokRightParen, ")"); err != nil {
+		return nil, err
+	}
+
+	if agg.Grouping == nil && !agg.Without {
+		if err := p.parseGrouping(agg); err != nil {
+			return nil, err
+		}
+	}
+
+	return agg, nil
+}
+
+func (p *parser) parseGrouping(agg *AggregateExpr) error {
+	t := p.peek()
+	if t.kind != tokIdent || (t.val != "by" && t.val != "without") {
+		return nil
+	}
+	p.next()
+	agg.Without = t.val == "without"
+	agg.Grouping = []string{}
+
+	if _, err := p.expect(tokLeftParen, "("); err != nil {
+		return err
+	}
+	for p.peek().kind != tokRightParen {
+		label, err := p.expect(tokIdent, "label name")
+		if err != nil {
+			return err
+		}
+		agg.Grouping = append(agg.Grouping, label.val)
+		if p.peek().kind == tokComma {
+			p.next()
+		}
+	}
+	p.next()
+	return nil
+}
+
+func parseNumber(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "inf":
+		return math.Inf(1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		v, err := strconv.ParseInt(s[2:], 16, 64)
+		return float64(v), err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+var durationRE = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)w)?(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?(?:(\d+)ms)?$`)
+
+// parseDuration parses a Prometheus duration such as "5m" or "1h30m".
+func parseDuration(s string) (time.Duration, error) {
+	parts := durationRE.FindStringSubmatch(s)
+	if s == "" || parts == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	units := []time.Duration{
+		365 * 24 * time.Hour,
+		7 * 24 * time.Hour,
+		24 * time.Hour,
+		time.Hour,
+		time.Minute,
+		time.Second,
+		time.Millisecond,
+	}
+
+	var d time.Duration
+	for i, unit := range units {
+		if parts[i+1] == "" {
+			continue
+		}
+		n, _ := strconv.Atoi(parts[i+1])
+		d += time.Duration(n) * unit
+	}
+	if d == 0 {
+		return 0, fmt.Errorf("duration must be greater than 0: %q", s)
+	}
+	return d, nil
+}
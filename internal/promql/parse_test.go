@@ -0,0 +1,46 @@
+package promql
+
+import (
+	"testing"
+)
+
+func TestParseMatrixArgumentInParens(t *testing.T) {
+	for _, query := range []string{
+		"rate((foo[5m]))",
+		"rate(((foo[5m])))",
+		"max_over_time((foo[1m] offset 5m))",
+		"quantile_over_time(0.9, (foo[5m]))",
+	} {
+		expr, err := Parse(query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", query, err)
+			continue
+		}
+		call, ok := expr.(*Call)
+		if !ok {
+			t.Errorf("Parse(%q) = %T, want *Call", query, expr)
+			continue
+		}
+		if _, ok := call.Args[len(call.Args)-1].(*MatrixSelector); !ok {
+			t.Errorf("Parse(%q): argument is %T, want the unwrapped *MatrixSelector", query, call.Args[len(call.Args)-1])
+		}
+	}
+}
+
+func TestParseTypeErrors(t *testing.T) {
+	for _, query := range []string{
+		"rate(foo)",
+		"rate((foo))",
+		"rate((1))",
+		"abs(foo[5m])",
+		"(foo)[5m]",
+		"-foo[5m]",
+		"foo[5m] + 1",
+		"rate(foo[5m]",
+		"nope(foo)",
+	} {
+		if _, err := Parse(query); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", query)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package promql
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"Golem/internal/metrics"
+	"Golem/internal/storage"
+)
+
+// StorageQueryable exposes stored host snapshots and health check history as
+// labeled series. See metrics.SystemMetrics.Samples and metrics.CheckSamples
+// for the series names.
+type StorageQueryable struct {
+	Metrics storage.MetricStorage
+	Checks  storage.HealthCheckStorage
+}
+
+func (q *StorageQueryable) Select(mint, maxt time.Time, matchers []*Matcher) ([]Series, error) {
+	series := make(map[string]*Series)
+	add := func(samples []metrics.Sample, t time.Time) {
+		for _, s := range samples {
+			if !MatchLabels(matchers, s.Labels) {
+				continue
+			}
+			appendPoint(series, s.Labels, Point{T: timestamp(t), V: s.Value})
+		}
+	}
+
+	if q.Metrics != nil && mayMatchName(matchers, func(name string) bool { return !strings.HasPrefix(name, "golem_check_") }) {
+		if native, ok := q.Metrics.(Queryable); ok {
+			// Engines such as tsdb.DB index series themselves, which
+			// avoids rebuilding every snapshot in the window.
+			selected, err := native.Select(mint, maxt, matchers)
+			if err != nil {
+				return nil, err
+			}
+			for i := range selected {
+				series[selected[i].Labels.Key()] = &selected[i]
+			}
+		} else {
+			snapshots, err := q.Metrics.GetMetricsRange(mint, maxt)
+			if err != nil {
+				return nil, err
+			}
+			for _, snapshot := range snapshots {
+				add(snapshot.Samples(), snapshot.Timestamp)
+			}
+		}
+	}
+
+	if q.Checks != nil && mayMatchName(matchers, func(name string) bool { return strings.HasPrefix(name, "golem_check_") }) {
+		configs, err := q.Checks.GetAllHealthCheckConfigs()
+		if err != nil {
+			return nil, err
+		}
+		for _, config := range configs {
+			history, err := q.Checks.GetHealthCheckHistory(config.ID, time.Since(mint))
+			if err != nil {
+				return nil, err
+			}
+			// History is returned newest first.
+			for i := len(history) - 1; i >= 0; i-- {
+				entry := history[i]
+				if entry.Timestamp.Before(mint) || entry.Timestamp.After(maxt) {
+					continue
+				}
+				add(metrics.CheckSamples(config, entry), entry.Timestamp)
+			}
+		}
+	}
+
+	result := make([]Series, 0, len(series))
+	for _, s := range series {
+		sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].T < s.Points[j].T })
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Labels.Key() < result[j].Labels.Key() })
+	return result, nil
+}
+
+// mayMatchName reports whether the metric name matchers could select a
+// series from a source whose names satisfy fromSource. It only rules a
+// source out when there is an equality matcher on the name.
+func mayMatchName(matchers []*Matcher, fromSource func(string) bool) bool {
+	for _, m := range matchers {
+		if m.Name == metrics.MetricNameLabel && m.Type == MatchEqual && !fromSource(m.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// LabelNames returns the sorted set of label names present in the window.
+func LabelNames(q Queryable, mint, maxt time.Time, matchers []*Matcher) ([]string, error) {
+	series, err := q.Select(mint, maxt, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range series {
+		for name := range s.Labels {
+			seen[name] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// LabelValues returns the sorted set of values of a label in the window.
+func LabelValues(q Queryable, name string, mint, maxt time.Time, matchers []*Matcher) ([]string, error) {
+	series, err := q.Select(mint, maxt, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range series {
+		if v, ok := s.Labels[name]; ok {
+			seen[v] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseSeriesSelector parses a bare selector such as the match[] parameter of
+// the series and labels APIs.
+func ParseSeriesSelector(s string) ([]*Matcher, error) {
+	expr, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	vs, ok := expr.(*VectorSelector)
+	if !ok {
+		return nil, errNotSelector
+	}
+	return vs.Matchers, nil
+}
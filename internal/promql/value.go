@@ -0,0 +1,108 @@
+package promql
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"Golem/internal/metrics"
+)
+
+// Point is a single value at a timestamp in milliseconds.
+type Point struct {
+	T int64
+	V float64
+}
+
+func (p Point) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{float64(p.T) / 1000, formatValue(p.V)})
+}
+
+type Series struct {
+	Labels metrics.Labels
+	Points []Point
+}
+
+func (s Series) MarshalJSON() ([]byte, error) {
+	points := s.Points
+	if points == nil {
+		points = []Point{}
+	}
+	return json.Marshal(struct {
+		Metric metrics.Labels `json:"metric"`
+		Values []Point        `json:"values"`
+	}{labelsOrEmpty(s.Labels), points})
+}
+
+type Sample struct {
+	Labels metrics.Labels
+	Point
+}
+
+func (s Sample) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Metric metrics.Labels `json:"metric"`
+		Value  Point          `json:"value"`
+	}{labelsOrEmpty(s.Labels), s.Point})
+}
+
+type Value interface {
+	Type() ValueType
+}
+
+type Scalar Point
+
+type String struct {
+	T int64
+	V string
+}
+
+type Vector []Sample
+
+type Matrix []Series
+
+func (Scalar) Type() ValueType { return ValueTypeScalar }
+func (String) Type() ValueType { return ValueTypeString }
+func (Vector) Type() ValueType { return ValueTypeVector }
+func (Matrix) Type() ValueType { return ValueTypeMatrix }
+
+func (s Scalar) MarshalJSON() ([]byte, error) {
+	return Point(s).MarshalJSON()
+}
+
+func (s String) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{float64(s.T) / 1000, s.V})
+}
+
+func (v Vector) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]Sample(v))
+}
+
+func (m Matrix) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]Series(m))
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func labelsOrEmpty(l metrics.Labels) metrics.Labels {
+	if l == nil {
+		return metrics.Labels{}
+	}
+	return l
+}
@@ -0,0 +1,261 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+type Aggregation string
+
+const (
+	AggAvg  Aggregation = "avg"
+	AggMin  Aggregation = "min"
+	AggMax  Aggregation = "max"
+	AggP95  Aggregation = "p95"
+	AggLast Aggregation = "last"
+)
+
+// MaxPoints bounds the number of buckets a single request may produce.
+const MaxPoints = 11000
+
+type Request struct {
+	From         time.Time
+	To           time.Time
+	Step         time.Duration
+	Selectors    []string
+	Aggregations []Aggregation
+}
+
+type Series struct {
+	Name        string      `json:"name"`
+	Aggregation Aggregation `json:"aggregation"`
+	Values      []*float64  `json:"values"`
+}
+
+// Result is the columnar response: every Series.Values slice lines up with
+// Timestamps, with null for buckets that had no samples.
+type Result struct {
+	From       int64    `json:"from"`
+	To         int64    `json:"to"`
+	Step       int64    `json:"step"`
+	Timestamps []int64  `json:"timestamps"`
+	Series     []Series `json:"series"`
+}
+
+// ParseRequest reads from, to, step, series and agg from URL query values.
+// from and to accept RFC3339 or unix seconds; series and agg may be repeated
+// or comma separated.
+func ParseRequest(values url.Values, now time.Time) (Request, error) {
+	req := Request{
+		To:   now,
+		Step: time.Minute,
+	}
+
+	if v := values.Get("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid to: %v", err)
+		}
+		req.To = t
+	}
+
+	req.From = req.To.Add(-time.Hour)
+	if v := values.Get("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid from: %v", err)
+		}
+		req.From = t
+	}
+
+	if !req.From.Before(req.To) {
+		return req, fmt.Errorf("from must be before to")
+	}
+
+	if v := values.Get("step"); v != "" {
+		step, err := time.ParseDuration(v)
+		if err != nil {
+			seconds, serr := strconv.ParseFloat(v, 64)
+			if serr != nil {
+				return req, fmt.Errorf("invalid step: %v", err)
+			}
+			step = time.Duration(seconds * float64(time.Second))
+		}
+		req.Step = step
+	}
+
+	if req.Step <= 0 {
+		return req, fmt.Errorf("step must be positive")
+	}
+	if req.To.Sub(req.From)/req.Step > MaxPoints {
+		return req, fmt.Errorf("exceeded maximum of %d points per series, increase step", MaxPoints)
+	}
+
+	req.Selectors = splitList(values["series"])
+	if len(req.Selectors) == 0 {
+		return req, fmt.Errorf("at least one series selector is required")
+	}
+
+	for _, agg := range splitList(values["agg"]) {
+		switch a := Aggregation(agg); a {
+		case AggAvg, AggMin, AggMax, AggP95, AggLast:
+			req.Aggregations = append(req.Aggregations, a)
+		default:
+			return req, fmt.Errorf("unsupported aggregation: %s", agg)
+		}
+	}
+	if len(req.Aggregations) == 0 {
+		req.Aggregations = []Aggregation{AggAvg}
+	}
+
+	return req, nil
+}
+
+// Execute buckets the snapshots into req.Step wide windows starting at
+// req.From and aggregates every series matching one of req.Selectors.
+func Execute(snapshots []metrics.SystemMetrics, req Request) Result {
+	buckets := int(req.To.Sub(req.From)/req.Step) + 1
+
+	result := Result{
+		From:       req.From.Unix(),
+		To:         req.To.Unix(),
+		Step:       int64(req.Step.Seconds()),
+		Timestamps: make([]int64, buckets),
+		Series:     []Series{},
+	}
+	for i := range result.Timestamps {
+		result.Timestamps[i] = req.From.Add(time.Duration(i) * req.Step).Unix()
+	}
+
+	matchers := make([]*regexp.Regexp, 0, len(req.Selectors))
+	for _, selector := range req.Selectors {
+		matchers = append(matchers, compileSelector(selector))
+	}
+
+	// samples[name][bucket] holds the raw values that fell into each bucket.
+	samples := make(map[string][][]float64)
+	for _, snapshot := range snapshots {
+		if snapshot.Timestamp.Before(req.From) || snapshot.Timestamp.After(req.To) {
+			continue
+		}
+		bucket := int(snapshot.Timestamp.Sub(req.From) / req.Step)
+
+		for name, value := range snapshot.Series() {
+			if !matchAny(matchers, name) {
+				continue
+			}
+			values, ok := samples[name]
+			if !ok {
+				values = make([][]float64, buckets)
+				samples[name] = values
+			}
+			values[bucket] = append(values[bucket], value)
+		}
+	}
+
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, agg := range req.Aggregations {
+			series := Series{
+				Name:        name,
+				Aggregation: agg,
+				Values:      make([]*float64, buckets),
+			}
+			for i, values := range samples[name] {
+				if len(values) == 0 {
+					continue
+				}
+				v := aggregate(agg, values)
+				series.Values[i] = &v
+			}
+			result.Series = append(result.Series, series)
+		}
+	}
+
+	return result
+}
+
+func aggregate(agg Aggregation, values []float64) float64 {
+	switch agg {
+	case AggMin:
+		min := math.Inf(1)
+		for _, v := range values {
+			min = math.Min(min, v)
+		}
+		return min
+	case AggMax:
+		max := math.Inf(-1)
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+		return max
+	case AggP95:
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return sorted[rank]
+	case AggLast:
+		return values[len(values)-1]
+	default:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+}
+
+// compileSelector turns a dotted selector into a regexp where "*" matches a
+// single path segment, so "disk.io.*.read_bytes" matches every device.
+func compileSelector(selector string) *regexp.Regexp {
+	parts := strings.Split(selector, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, `[^.]*`) + "$")
+}
+
+func matchAny(matchers []*regexp.Regexp, name string) bool {
+	for _, m := range matchers {
+		if m.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTime(v string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func splitList(values []string) []string {
+	var result []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package statuspage
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+var badgeColors = map[ComponentStatus]string{
+	StatusOperational: "#4c1",
+	StatusDegraded:    "#dfb317",
+	StatusOutage:      "#e05d44",
+	StatusNoData:      "#9f9f9f",
+}
+
+var badgeText = map[ComponentStatus]string{
+	StatusOperational: "up",
+	StatusDegraded:    "degraded",
+	StatusOutage:      "down",
+	StatusNoData:      "unknown",
+}
+
+// Badge renders a flat shields.io-style badge.
+func Badge(label string, status ComponentStatus) []byte {
+	message := badgeText[status]
+	color := badgeColors[status]
+	if message == "" {
+		message, color = string(status), badgeColors[StatusNoData]
+	}
+
+	lw, mw := textWidth(label)+10, textWidth(message)+10
+	w := lw + mw
+	label, message = html.EscapeString(label), html.EscapeString(message)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, w, label, message)
+	fmt.Fprintf(&b, `<title>%s: %s</title>`, label, message)
+	b.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, w)
+	fmt.Fprintf(&b, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`, lw, lw, mw, color, w)
+	b.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	fmt.Fprintf(&b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`, lw/2, label, lw/2, label)
+	fmt.Fprintf(&b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`, lw+mw/2, message, lw+mw/2, message)
+	b.WriteString(`</g></svg>`)
+	return []byte(b.String())
+}
+
+// textWidth approximates the width of s in 11px Verdana.
+func textWidth(s string) int {
+	width := 0.0
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune("ijlI.,:;!|' ", r):
+			width += 3.5
+		case strings.ContainsRune("mwMW", r):
+			width += 10
+		case r >= 'A' && r <= 'Z':
+			width += 8
+		default:
+			width += 7
+		}
+	}
+	return int(width + 0.5)
+}
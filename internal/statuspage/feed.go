@@ -0,0 +1,144 @@
+package statuspage
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// feedIncidents is the number of incidents listed in the feeds.
+const feedIncidents = 50
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string    `json:"id"`
+	URL           string    `json:"url"`
+	Title         string    `json:"title"`
+	ContentText   string    `json:"content_text"`
+	DatePublished time.Time `json:"date_published"`
+	DateModified  time.Time `json:"date_modified"`
+	Tags          []string  `json:"tags"`
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// FeedIncidents returns the incidents listed in the feeds, newest first.
+func (s *Service) FeedIncidents(now time.Time) (Config, []Incident, error) {
+	config, err := s.Store.GetConfig()
+	if err != nil {
+		return config, nil, err
+	}
+	incidents, err := s.Store.ListIncidents(now.AddDate(0, 0, -UptimeDays), feedIncidents)
+	return config, incidents, err
+}
+
+// JSONFeed renders incidents as a JSON Feed 1.1 document. baseURL is the
+// scheme and host the page is served from.
+func JSONFeed(config Config, incidents []Incident, baseURL string) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       config.Title,
+		HomePageURL: baseURL + "/status",
+		FeedURL:     baseURL + "/status/feed.json",
+		Description: config.Description,
+		Items:       []jsonFeedItem{},
+	}
+	for _, incident := range incidents {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            incident.ID,
+			URL:           incidentURL(baseURL, incident),
+			Title:         incident.Title,
+			ContentText:   incidentText(incident),
+			DatePublished: incident.CreatedAt,
+			DateModified:  incident.UpdatedAt,
+			Tags:          []string{string(incident.Status), string(incident.Impact)},
+		})
+	}
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+// RSSFeed renders incidents as an RSS 2.0 document.
+func RSSFeed(config Config, incidents []Incident, baseURL string, now time.Time) ([]byte, error) {
+	channel := rssChannel{
+		Title:         config.Title,
+		Link:          baseURL + "/status",
+		Description:   config.Description,
+		LastBuildDate: now.UTC().Format(time.RFC1123Z),
+	}
+	if channel.Description == "" {
+		channel.Description = config.Title + " incidents"
+	}
+	for _, incident := range incidents {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       fmt.Sprintf("%s [%s]", incident.Title, incident.Status),
+			Link:        incidentURL(baseURL, incident),
+			Description: incidentText(incident),
+			GUID:        rssGUID{Value: incident.ID},
+			PubDate:     incident.CreatedAt.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	data, err := xml.MarshalIndent(rss{Version: "2.0", Channel: channel}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+func incidentURL(baseURL string, incident Incident) string {
+	return baseURL + "/status#incident-" + incident.ID
+}
+
+// incidentText lists the updates of an incident, newest first.
+func incidentText(incident Incident) string {
+	var b strings.Builder
+	for i, u := range incident.Updates {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "%s (%s): %s", capitalize(string(u.Status)), u.CreatedAt.UTC().Format("Jan 2, 15:04 MST"), u.Message)
+	}
+	return b.String()
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,56 @@
+package statuspage
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+//go:embed page.html
+var pageHTML string
+
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"capitalize": capitalize,
+	"percent": func(p *float64) string {
+		if p == nil {
+			return "no data"
+		}
+		return fmt.Sprintf("%.2f%%", *p)
+	},
+	"barClass": func(day UptimeDay) string {
+		switch {
+		case day.Uptime == nil:
+			return "none"
+		case *day.Uptime >= 99.9:
+			return "good"
+		case *day.Uptime >= 99:
+			return "minor"
+		case *day.Uptime >= 95:
+			return "major"
+		default:
+			return "bad"
+		}
+	},
+	"when": func(t time.Time) string {
+		return t.UTC().Format("Jan 2, 15:04 MST")
+	},
+	"banner": func(status ComponentStatus) string {
+		switch status {
+		case StatusOperational:
+			return "All systems operational"
+		case StatusDegraded:
+			return "Some systems are degraded"
+		case StatusOutage:
+			return "Some systems are down"
+		default:
+			return "Status unknown"
+		}
+	},
+}).Parse(pageHTML))
+
+// Render writes the HTML status page.
+func Render(w io.Writer, summary Summary) error {
+	return pageTemplate.Execute(w, summary)
+}
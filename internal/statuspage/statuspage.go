@@ -0,0 +1,306 @@
+// Package statuspage builds the public status page: components made of
+// health checks, their daily uptime, and incidents posted by admins.
+package statuspage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"Golem/internal/metrics"
+	"Golem/internal/storage"
+)
+
+const (
+	// UptimeDays is the length of the uptime history.
+	UptimeDays = 90
+	// recentIncidents is how long resolved incidents stay on the page.
+	recentIncidents = 14 * 24 * time.Hour
+)
+
+type Service struct {
+	Store  Storage
+	Checks storage.HealthCheckStorage
+}
+
+// Start rolls up check history into daily uptime every interval. Stored
+// history is capped per check, so interval must be well below 100 check
+// intervals for no results to be missed.
+func (s *Service) Start(ctx context.Context, interval time.Duration) {
+	if err := s.Rollup(time.Now()); err != nil {
+		log.Printf("Uptime rollup failed: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Rollup(time.Now()); err != nil {
+				log.Printf("Uptime rollup failed: %v", err)
+			}
+		}
+	}
+}
+
+// Rollup adds check results newer than each check's watermark to the daily
+// uptime counts and drops counts that are too old or belong to deleted
+// checks.
+func (s *Service) Rollup(now time.Time) error {
+	configs, err := s.Checks.GetAllHealthCheckConfigs()
+	if err != nil {
+		return err
+	}
+
+	oldest := startOfDay(now).AddDate(0, 0, -(UptimeDays - 1))
+	ids := make([]string, 0, len(configs))
+	for _, config := range configs {
+		ids = append(ids, config.ID)
+
+		watermark, ok, err := s.Store.UptimeWatermark(config.ID)
+		if err != nil {
+			return err
+		}
+		if !ok || watermark.Before(oldest) {
+			watermark = oldest
+		}
+
+		history, err := s.Checks.GetHealthCheckHistory(config.ID, now.Sub(watermark)+time.Second)
+		if err != nil {
+			return err
+		}
+
+		days := make(map[string]dayCount)
+		latest := watermark
+		for _, entry := range history {
+			if !entry.Timestamp.After(watermark) {
+				continue
+			}
+			day := entry.Timestamp.UTC().Format(dayFormat)
+			count := days[day]
+			count.Total++
+			if entry.Status == metrics.StatusUp {
+				count.Up++
+			}
+			days[day] = count
+			if entry.Timestamp.After(latest) {
+				latest = entry.Timestamp
+			}
+		}
+		if len(days) == 0 {
+			continue
+		}
+		if err := s.Store.AddUptime(config.ID, days, latest); err != nil {
+			return err
+		}
+	}
+
+	return s.Store.PruneUptime(oldest, ids)
+}
+
+func (s *Service) Summary(now time.Time) (Summary, error) {
+	config, err := s.Store.GetConfig()
+	if err != nil {
+		return Summary{}, err
+	}
+	components, err := s.components(config)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	summary := Summary{
+		Title:       config.Title,
+		Description: config.Description,
+		Components:  components,
+		Active:      []Incident{},
+		Recent:      []Incident{},
+		GeneratedAt: now,
+	}
+
+	incidents, err := s.Store.ListIncidents(now.Add(-recentIncidents), 50)
+	if err != nil {
+		return Summary{}, err
+	}
+	impacts := make(map[string]ComponentStatus)
+	for _, incident := range incidents {
+		if incident.ResolvedAt != nil {
+			summary.Recent = append(summary.Recent, incident)
+			continue
+		}
+		summary.Active = append(summary.Active, incident)
+		for _, id := range incident.Components {
+			impacts[id] = worse(impacts[id], incident.Impact.status())
+		}
+	}
+
+	first := startOfDay(now).AddDate(0, 0, -(UptimeDays - 1))
+	uptime, err := s.Store.DailyUptime(first)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	// Components without data do not affect the overall status unless
+	// nothing has data.
+	for i := range summary.Components {
+		c := &summary.Components[i]
+		c.Status = worse(c.Status, impacts[c.ID])
+		c.Uptime, c.UptimeDays = uptimeDays(c.checks, uptime, first)
+		if c.Status != StatusNoData {
+			summary.Status = worse(summary.Status, c.Status)
+		}
+	}
+	if summary.Status == "" {
+		summary.Status = StatusNoData
+	}
+	return summary, nil
+}
+
+// Badge returns the name and status shown for a component, or for a check
+// that is part of one. Checks outside all components are not public.
+func (s *Service) Badge(id string) (string, ComponentStatus, bool, error) {
+	config, err := s.Store.GetConfig()
+	if err != nil {
+		return "", "", false, err
+	}
+	components, err := s.components(config)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	for _, c := range components {
+		if c.ID == id {
+			return c.Name, c.Status, true, nil
+		}
+	}
+	for _, c := range components {
+		for _, check := range c.checks {
+			if check.ID != id {
+				continue
+			}
+			status := StatusNoData
+			if result, err := s.Checks.GetHealthCheckResult(id); err == nil {
+				status = checkStatus(result.Status)
+			}
+			return check.Name, status, true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// components resolves each component's checks and current status.
+func (s *Service) components(config Config) ([]ComponentSummary, error) {
+	configs, err := s.Checks.GetAllHealthCheckConfigs()
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.Checks.GetAllHealthCheckResults()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]metrics.HealthCheckResult, len(results))
+	for _, result := range results {
+		byID[result.ID] = result
+	}
+
+	summaries := make([]ComponentSummary, 0, len(config.Components))
+	for _, component := range config.Components {
+		sel, err := metrics.ParseSelector(component.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %v", component.ID, err)
+		}
+		listed := make(map[string]bool, len(component.Checks))
+		for _, id := range component.Checks {
+			listed[id] = true
+		}
+
+		summary := ComponentSummary{Component: component}
+		for _, check := range configs {
+			if listed[check.ID] || (component.Selector != "" && sel.Matches(check.Labels)) {
+				summary.checks = append(summary.checks, check)
+			}
+		}
+
+		group := metrics.GroupHealthChecks(summary.checks, byID, "")
+		summary.Status = StatusNoData
+		if len(group) > 0 && group[0].Total > 0 {
+			summary.Status = checkStatus(group[0].Status)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+func uptimeDays(checks []metrics.HealthCheckConfig, uptime map[string]map[string]dayCount, first time.Time) (*float64, []UptimeDay) {
+	days := make([]UptimeDay, UptimeDays)
+	var up, total int
+	for i := range days {
+		date := first.AddDate(0, 0, i).Format(dayFormat)
+		day := UptimeDay{Date: date}
+		for _, check := range checks {
+			count := uptime[check.ID][date]
+			day.Up += count.Up
+			day.Total += count.Total
+		}
+		day.Uptime = percent(day.Up, day.Total)
+		up += day.Up
+		total += day.Total
+		days[i] = day
+	}
+	return percent(up, total), days
+}
+
+func percent(up, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	p := float64(up) / float64(total) * 100
+	return &p
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func checkStatus(status metrics.HealthCheckStatus) ComponentStatus {
+	switch status {
+	case metrics.StatusUp:
+		return StatusOperational
+	case metrics.StatusWarning:
+		return StatusDegraded
+	case metrics.StatusDown:
+		return StatusOutage
+	default:
+		return StatusNoData
+	}
+}
+
+func (i Impact) status() ComponentStatus {
+	switch i {
+	case ImpactMinor:
+		return StatusDegraded
+	case ImpactMajor, ImpactCritical:
+		return StatusOutage
+	default:
+		return ""
+	}
+}
+
+var severity = map[ComponentStatus]int{
+	"":                0,
+	StatusOperational: 1,
+	StatusNoData:      2,
+	StatusDegraded:    3,
+	StatusOutage:      4,
+}
+
+func worse(a, b ComponentStatus) ComponentStatus {
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,425 @@
+package statuspage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Golem/internal/storage/migrations"
+
+	"github.com/google/uuid"
+)
+
+var ErrIncidentNotFound = errors.New("incident not found")
+
+// dayFormat keys the daily uptime rollups, always in UTC.
+const dayFormat = "2006-01-02"
+
+// dayCount is the number of up and total results on one day.
+type dayCount struct {
+	Up    int
+	Total int
+}
+
+// Storage keeps the status page configuration, incidents and uptime
+// rollups.
+type Storage interface {
+	GetConfig() (Config, error)
+	SaveConfig(config Config) error
+
+	// ListIncidents returns incidents created or still open since the given
+	// time, newest first.
+	ListIncidents(since time.Time, limit int) ([]Incident, error)
+	GetIncident(id string) (*Incident, error)
+	CreateIncident(create IncidentCreate, now time.Time) (*Incident, error)
+	AddIncidentUpdate(id string, update IncidentUpdateCreate, now time.Time) (*Incident, error)
+	DeleteIncident(id string) error
+
+	// UptimeWatermark is the timestamp of the newest result already rolled
+	// up for a check.
+	UptimeWatermark(configID string) (time.Time, bool, error)
+	AddUptime(configID string, days map[string]dayCount, watermark time.Time) error
+	// DailyUptime returns the rollups since the given day, keyed by check
+	// and then by day.
+	DailyUptime(since time.Time) (map[string]map[string]dayCount, error)
+	// PruneUptime drops rollups before the given day and those of checks
+	// not in keep.
+	PruneUptime(before time.Time, keep []string) error
+}
+
+// SQLiteStorage implements Storage in golem.db.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(db *sql.DB) (*SQLiteStorage, error) {
+	if _, err := migrations.Up(db); err != nil {
+		return nil, err
+	}
+	return &SQLiteStorage{db: db}, nil
+}
+
+func (s *SQLiteStorage) GetConfig() (Config, error) {
+	config := Config{Title: "Status", Components: []Component{}}
+
+	err := s.db.QueryRow("SELECT title, description FROM status_page WHERE id = 1").Scan(&config.Title, &config.Description)
+	if err != nil && err != sql.ErrNoRows {
+		return config, fmt.Errorf("failed to get status page: %v", err)
+	}
+
+	rows, err := s.db.Query("SELECT id, name, description, selector, checks FROM status_components ORDER BY position")
+	if err != nil {
+		return config, fmt.Errorf("failed to get status components: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Component
+		var checks string
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Selector, &checks); err != nil {
+			return config, fmt.Errorf("failed to scan status component: %v", err)
+		}
+		if err := json.Unmarshal([]byte(checks), &c.Checks); err != nil {
+			return config, fmt.Errorf("failed to unmarshal component checks: %v", err)
+		}
+		config.Components = append(config.Components, c)
+	}
+	return config, rows.Err()
+}
+
+// SaveConfig replaces the page settings and all components.
+func (s *SQLiteStorage) SaveConfig(config Config) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO status_page (id, title, description) VALUES (1, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET title = excluded.title, description = excluded.description`,
+		config.Title, config.Description,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store status page: %v", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM status_components"); err != nil {
+		return fmt.Errorf("failed to replace status components: %v", err)
+	}
+	for i, c := range config.Components {
+		checks, err := json.Marshal(nonNil(c.Checks))
+		if err != nil {
+			return fmt.Errorf("failed to marshal component checks: %v", err)
+		}
+		_, err = tx.Exec(
+			`INSERT INTO status_components (id, name, description, selector, checks, position)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			c.ID, c.Name, c.Description, c.Selector, string(checks), i,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store status component: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) ListIncidents(since time.Time, limit int) ([]Incident, error) {
+	rows, err := s.db.Query(
+		`SELECT id, title, status, impact, components, created_at, updated_at, resolved_at
+		FROM incidents
+		WHERE created_at >= ? OR resolved_at IS NULL OR resolved_at >= ?
+		ORDER BY created_at DESC
+		LIMIT ?`,
+		since.UTC(), since.UTC(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %v", err)
+	}
+	defer rows.Close()
+
+	incidents := []Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, incident)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range incidents {
+		if incidents[i].Updates, err = s.incidentUpdates(incidents[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return incidents, nil
+}
+
+func (s *SQLiteStorage) GetIncident(id string) (*Incident, error) {
+	incident, err := scanIncident(s.db.QueryRow(
+		`SELECT id, title, status, impact, components, created_at, updated_at, resolved_at
+		FROM incidents WHERE id = ?`, id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrIncidentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if incident.Updates, err = s.incidentUpdates(id); err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
+
+func (s *SQLiteStorage) CreateIncident(create IncidentCreate, now time.Time) (*Incident, error) {
+	now = now.UTC()
+	components, err := json.Marshal(nonNil(create.Components))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal incident components: %v", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	id := uuid.New().String()
+	var resolvedAt *time.Time
+	if create.Status == IncidentResolved {
+		resolvedAt = &now
+	}
+	_, err = tx.Exec(
+		`INSERT INTO incidents (id, title, status, impact, components, created_at, updated_at, resolved_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, create.Title, create.Status, create.Impact, string(components), now, now, resolvedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store incident: %v", err)
+	}
+	_, err = tx.Exec(
+		`INSERT INTO incident_updates (id, incident_id, status, message, created_at) VALUES (?, ?, ?, ?, ?)`,
+		uuid.New().String(), id, create.Status, create.Message, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store incident update: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return s.GetIncident(id)
+}
+
+func (s *SQLiteStorage) AddIncidentUpdate(id string, update IncidentUpdateCreate, now time.Time) (*Incident, error) {
+	now = now.UTC()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Resolving sets resolved_at once; reopening clears it.
+	result, err := tx.Exec(
+		`UPDATE incidents SET status = ?, updated_at = ?,
+			resolved_at = CASE WHEN ? THEN COALESCE(resolved_at, ?) ELSE NULL END
+		WHERE id = ?`,
+		update.Status, now, update.Status == IncidentResolved, now, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update incident: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrIncidentNotFound
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO incident_updates (id, incident_id, status, message, created_at) VALUES (?, ?, ?, ?, ?)`,
+		uuid.New().String(), id, update.Status, update.Message, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store incident update: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return s.GetIncident(id)
+}
+
+func (s *SQLiteStorage) DeleteIncident(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM incidents WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete incident: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrIncidentNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM incident_updates WHERE incident_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete incident updates: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) incidentUpdates(id string) ([]IncidentUpdate, error) {
+	rows, err := s.db.Query(
+		`SELECT id, status, message, created_at FROM incident_updates
+		WHERE incident_id = ? ORDER BY created_at DESC`, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incident updates: %v", err)
+	}
+	defer rows.Close()
+
+	updates := []IncidentUpdate{}
+	for rows.Next() {
+		var u IncidentUpdate
+		if err := rows.Scan(&u.ID, &u.Status, &u.Message, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan incident update: %v", err)
+		}
+		updates = append(updates, u)
+	}
+	return updates, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIncident(row rowScanner) (Incident, error) {
+	var incident Incident
+	var components string
+	var resolvedAt sql.NullTime
+	err := row.Scan(&incident.ID, &incident.Title, &incident.Status, &incident.Impact, &components,
+		&incident.CreatedAt, &incident.UpdatedAt, &resolvedAt)
+	if err != nil {
+		return incident, err
+	}
+	if err := json.Unmarshal([]byte(components), &incident.Components); err != nil {
+		return incident, fmt.Errorf("failed to unmarshal incident components: %v", err)
+	}
+	if resolvedAt.Valid {
+		incident.ResolvedAt = &resolvedAt.Time
+	}
+	return incident, nil
+}
+
+func (s *SQLiteStorage) UptimeWatermark(configID string) (time.Time, bool, error) {
+	var t time.Time
+	err := s.db.QueryRow("SELECT last_timestamp FROM check_uptime_watermarks WHERE config_id = ?", configID).Scan(&t)
+	if err == sql.ErrNoRows {
+		return t, false, nil
+	}
+	if err != nil {
+		return t, false, fmt.Errorf("failed to get uptime watermark: %v", err)
+	}
+	return t, true, nil
+}
+
+func (s *SQLiteStorage) AddUptime(configID string, days map[string]dayCount, watermark time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for day, count := range days {
+		_, err := tx.Exec(
+			`INSERT INTO check_uptime_daily (config_id, day, up, total) VALUES (?, ?, ?, ?)
+			ON CONFLICT (config_id, day) DO UPDATE SET up = up + excluded.up, total = total + excluded.total`,
+			configID, day, count.Up, count.Total,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store uptime: %v", err)
+		}
+	}
+	_, err = tx.Exec(
+		`INSERT INTO check_uptime_watermarks (config_id, last_timestamp) VALUES (?, ?)
+		ON CONFLICT (config_id) DO UPDATE SET last_timestamp = excluded.last_timestamp`,
+		configID, watermark,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store uptime watermark: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) DailyUptime(since time.Time) (map[string]map[string]dayCount, error) {
+	rows, err := s.db.Query(
+		"SELECT config_id, day, up, total FROM check_uptime_daily WHERE day >= ?",
+		since.UTC().Format(dayFormat),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query uptime: %v", err)
+	}
+	defer rows.Close()
+
+	uptime := make(map[string]map[string]dayCount)
+	for rows.Next() {
+		var id, day string
+		var count dayCount
+		if err := rows.Scan(&id, &day, &count.Up, &count.Total); err != nil {
+			return nil, fmt.Errorf("failed to scan uptime: %v", err)
+		}
+		if uptime[id] == nil {
+			uptime[id] = make(map[string]dayCount)
+		}
+		uptime[id][day] = count
+	}
+	return uptime, rows.Err()
+}
+
+func (s *SQLiteStorage) PruneUptime(before time.Time, keep []string) error {
+	_, err := s.db.Exec("DELETE FROM check_uptime_daily WHERE day < ?", before.UTC().Format(dayFormat))
+	if err != nil {
+		return fmt.Errorf("failed to prune uptime: %v", err)
+	}
+
+	notIn := ""
+	args := make([]interface{}, len(keep))
+	if len(keep) > 0 {
+		notIn = " WHERE config_id NOT IN (?" + strings.Repeat(", ?", len(keep)-1) + ")"
+		for i, id := range keep {
+			args[i] = id
+		}
+	}
+	for _, table := range []string{"check_uptime_daily", "check_uptime_watermarks"} {
+		if _, err := s.db.Exec("DELETE FROM "+table+notIn, args...); err != nil {
+			return fmt.Errorf("failed to prune uptime of deleted checks: %v", err)
+		}
+	}
+	return nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
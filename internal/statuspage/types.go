@@ -0,0 +1,116 @@
+package statuspage
+
+import (
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+// ComponentStatus is the public status of a component.
+type ComponentStatus string
+
+const (
+	StatusOperational ComponentStatus = "operational"
+	StatusDegraded    ComponentStatus = "degraded"
+	StatusOutage      ComponentStatus = "outage"
+	StatusNoData      ComponentStatus = "unknown"
+)
+
+// IncidentStatus follows the usual investigating → resolved progression.
+type IncidentStatus string
+
+const (
+	IncidentInvestigating IncidentStatus = "investigating"
+	IncidentIdentified    IncidentStatus = "identified"
+	IncidentMonitoring    IncidentStatus = "monitoring"
+	IncidentResolved      IncidentStatus = "resolved"
+)
+
+type Impact string
+
+const (
+	ImpactNone     Impact = "none"
+	ImpactMinor    Impact = "minor"
+	ImpactMajor    Impact = "major"
+	ImpactCritical Impact = "critical"
+)
+
+// Config is the admin-editable part of the status page.
+type Config struct {
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	Components  []Component `json:"components"`
+}
+
+// Component groups the checks listed in Checks and those whose labels match
+// Selector. Only checks that belong to a component are shown publicly.
+type Component struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Selector    string   `json:"selector,omitempty"`
+	Checks      []string `json:"checks,omitempty"`
+}
+
+type Incident struct {
+	ID         string           `json:"id"`
+	Title      string           `json:"title"`
+	Status     IncidentStatus   `json:"status"`
+	Impact     Impact           `json:"impact"`
+	Components []string         `json:"components"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	ResolvedAt *time.Time       `json:"resolved_at,omitempty"`
+	Updates    []IncidentUpdate `json:"updates"`
+}
+
+type IncidentUpdate struct {
+	ID        string         `json:"id"`
+	Status    IncidentStatus `json:"status"`
+	Message   string         `json:"message"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// IncidentCreate opens an incident with its first update.
+type IncidentCreate struct {
+	Title      string         `json:"title"`
+	Status     IncidentStatus `json:"status"`
+	Impact     Impact         `json:"impact"`
+	Components []string       `json:"components"`
+	Message    string         `json:"message"`
+}
+
+// IncidentUpdateCreate posts an update and moves the incident to Status.
+type IncidentUpdateCreate struct {
+	Status  IncidentStatus `json:"status"`
+	Message string         `json:"message"`
+}
+
+// UptimeDay is one bar of the uptime history. Uptime is nil for days
+// without data.
+type UptimeDay struct {
+	Date   string   `json:"date"`
+	Uptime *float64 `json:"uptime"`
+	Up     int      `json:"up"`
+	Total  int      `json:"total"`
+}
+
+type ComponentSummary struct {
+	Component
+	Status ComponentStatus `json:"status"`
+	// Uptime is the percentage over all of UptimeDays with data.
+	Uptime     *float64    `json:"uptime"`
+	UptimeDays []UptimeDay `json:"uptime_days"`
+	checks     []metrics.HealthCheckConfig
+}
+
+// Summary is everything the public page shows.
+type Summary struct {
+	Title       string             `json:"title"`
+	Description string             `json:"description,omitempty"`
+	Status      ComponentStatus    `json:"status"`
+	Components  []ComponentSummary `json:"components"`
+	Active      []Incident         `json:"active_incidents"`
+	Recent      []Incident         `json:"recent_incidents"`
+	GeneratedAt time.Time          `json:"generated_at"`
+}
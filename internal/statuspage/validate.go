@@ -0,0 +1,83 @@
+package statuspage
+
+import (
+	"fmt"
+	"strings"
+
+	"Golem/internal/metrics"
+)
+
+var incidentStatuses = map[IncidentStatus]bool{
+	IncidentInvestigating: true,
+	IncidentIdentified:    true,
+	IncidentMonitoring:    true,
+	IncidentResolved:      true,
+}
+
+var impacts = map[Impact]bool{
+	ImpactNone:     true,
+	ImpactMinor:    true,
+	ImpactMajor:    true,
+	ImpactCritical: true,
+}
+
+func (c Config) Validate() error {
+	if strings.TrimSpace(c.Title) == "" {
+		return fmt.Errorf("title cannot be empty")
+	}
+
+	seen := make(map[string]bool)
+	for i, component := range c.Components {
+		if component.ID == "" || strings.ContainsAny(component.ID, "/ ") {
+			return fmt.Errorf("component %d: id must be non-empty and contain no spaces or slashes", i+1)
+		}
+		if seen[component.ID] {
+			return fmt.Errorf("component %q: duplicate id", component.ID)
+		}
+		seen[component.ID] = true
+
+		if component.Name == "" {
+			return fmt.Errorf("component %q: name cannot be empty", component.ID)
+		}
+		if component.Selector == "" && len(component.Checks) == 0 {
+			return fmt.Errorf("component %q: needs a selector or a list of checks", component.ID)
+		}
+		if _, err := metrics.ParseSelector(component.Selector); err != nil {
+			return fmt.Errorf("component %q: %v", component.ID, err)
+		}
+	}
+	return nil
+}
+
+// Validate fills in defaults and checks the fields.
+func (c *IncidentCreate) Validate() error {
+	if strings.TrimSpace(c.Title) == "" {
+		return fmt.Errorf("title cannot be empty")
+	}
+	if c.Status == "" {
+		c.Status = IncidentInvestigating
+	}
+	if c.Impact == "" {
+		c.Impact = ImpactMinor
+	}
+	if !incidentStatuses[c.Status] {
+		return fmt.Errorf("unknown incident status %q", c.Status)
+	}
+	if !impacts[c.Impact] {
+		return fmt.Errorf("unknown impact %q", c.Impact)
+	}
+	if strings.TrimSpace(c.Message) == "" {
+		return fmt.Errorf("message cannot be empty")
+	}
+	return nil
+}
+
+func (u IncidentUpdateCreate) Validate() error {
+	if !incidentStatuses[u.Status] {
+		return fmt.Errorf("unknown incident status %q", u.Status)
+	}
+	if strings.TrimSpace(u.Message) == "" {
+		return fmt.Errorf("message cannot be empty")
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Package backup takes consistent online copies of golem.db and restores
+// them. Copies are made with VACUUM INTO, which reads a single snapshot of
+// the database while the server keeps writing.
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"Golem/internal/storage/migrations"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const filePrefix = "golem-"
+
+// Create writes a consistent copy of db to dest, which must not exist.
+func Create(db *sql.DB, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("backup destination %s already exists", dest)
+	}
+
+	tmp := dest + ".tmp"
+	os.Remove(tmp)
+	if _, err := db.Exec("VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to back up database: %v", err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move backup into place: %v", err)
+	}
+	return nil
+}
+
+// Verify checks that path is an intact golem.db this binary can run
+// against and returns its schema version.
+func Verify(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	// Read-only, so that checking a backup never changes it
+	db, err := sql.Open("sqlite3", "file:"+(&url.URL{Path: path}).EscapedPath()+"?mode=ro")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("%s is not a readable SQLite database: %v", path, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("integrity check of %s failed: %s", path, result)
+	}
+
+	if err := migrations.Check(db); err != nil {
+		return 0, err
+	}
+	version, err := migrations.Version(db)
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("%s has no schema_migrations table; it is not a golem database", path)
+	}
+	return version, nil
+}
+
+// Restore verifies src and swaps it in as dbPath. The current database, if
+// any, is kept next to it with a .pre-restore-<timestamp> suffix. The
+// server must not be running.
+func Restore(src, dbPath string) (string, error) {
+	staged := dbPath + ".restore"
+	if err := copyFile(src, staged); err != nil {
+		return "", fmt.Errorf("failed to stage %s: %v", src, err)
+	}
+	if _, err := Verify(staged); err != nil {
+		os.Remove(staged)
+		return "", err
+	}
+
+	var previous string
+	if _, err := os.Stat(dbPath); err == nil {
+		previous = dbPath + ".pre-restore-" + time.Now().UTC().Format("20060102T150405Z")
+		if err := os.Rename(dbPath, previous); err != nil {
+			os.Remove(staged)
+			return "", fmt.Errorf("failed to move current database aside: %v", err)
+		}
+	}
+	// A leftover WAL or shared-memory file belongs to the old database.
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		os.Remove(dbPath + suffix)
+	}
+
+	if err := os.Rename(staged, dbPath); err != nil {
+		return previous, fmt.Errorf("failed to move restored database into place: %v", err)
+	}
+	return previous, nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// FileName returns the name used for a backup taken at t, e.g.
+// golem-20260102T150405Z.db. Names sort chronologically.
+func FileName(t time.Time) string {
+	return filePrefix + t.UTC().Format("20060102T150405Z") + ".db"
+}
+
+// Scheduler takes a backup into Dir every interval and keeps the newest Keep.
+type Scheduler struct {
+	DB   *sql.DB
+	Dir  string
+	Keep int
+}
+
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path, err := s.Run()
+			if err != nil {
+				log.Printf("Scheduled backup failed: %v", err)
+				continue
+			}
+			log.Printf("Wrote backup %s", path)
+		}
+	}
+}
+
+// Run takes one backup and deletes the oldest ones beyond Keep.
+func (s *Scheduler) Run() (string, error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	path := filepath.Join(s.Dir, FileName(time.Now()))
+	if err := Create(s.DB, path); err != nil {
+		return "", err
+	}
+	return path, s.rotate()
+}
+
+func (s *Scheduler) rotate() error {
+	if s.Keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), filePrefix) && strings.HasSuffix(e.Name(), ".db") {
+			backups = append(backups, e.Name())
+		}
+	}
+	sort.Strings(backups)
+
+	var errs []error
+	for len(backups) > s.Keep {
+		if err := os.Remove(filepath.Join(s.Dir, backups[0])); err != nil {
+			errs = append(errs, err)
+		}
+		backups = backups[1:]
+	}
+	return errors.Join(errs...)
+}
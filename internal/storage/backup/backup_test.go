@@ -0,0 +1,98 @@
+package backup
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Golem/internal/storage/migrations"
+)
+
+func openDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestVerifyBackup(t *testing.T) {
+	dir := t.TempDir()
+	db := openDB(t, filepath.Join(dir, "golem.db"))
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	// A name that needs escaping in a SQLite URI
+	dest := filepath.Join(dir, "golem #1?.db")
+	if err := Create(db, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	before := readFile(t, dest)
+	version, err := Verify(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != migrations.Latest() {
+		t.Errorf("Verify = %d, want %d", version, migrations.Latest())
+	}
+	if !bytes.Equal(before, readFile(t, dest)) {
+		t.Error("Verify changed the backup")
+	}
+}
+
+func TestVerifyLeavesOtherDatabasesAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "other.db")
+	db := openDB(t, path)
+	if _, err := db.Exec("CREATE TABLE notes (body TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	before := readFile(t, path)
+	if _, err := Verify(path); err == nil {
+		t.Fatal("Verify accepted a database without schema_migrations")
+	}
+	if !bytes.Equal(before, readFile(t, path)) {
+		t.Error("Verify changed a database that is not Golem's")
+	}
+
+	var tables int
+	if err := openDB(t, path).QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'").Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Error("Verify created schema_migrations")
+	}
+}
+
+func TestRestoreRefusesOtherDatabases(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "other.db")
+	db := openDB(t, src)
+	if _, err := db.Exec("CREATE TABLE notes (body TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	dbPath := filepath.Join(dir, "golem.db")
+	if _, err := Restore(src, dbPath); err == nil {
+		t.Fatal("Restore accepted a database that is not Golem's")
+	}
+	if _, err := os.Stat(dbPath + ".restore"); !os.IsNotExist(err) {
+		t.Error("Restore left its staged copy behind")
+	}
+}
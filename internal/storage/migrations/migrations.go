@@ -0,0 +1,304 @@
+// Package migrations versions the schema of golem.db. Migrations are
+// embedded SQL files named NNNN_description.up.sql and
+// NNNN_description.down.sql; applied versions are recorded in the
+// schema_migrations table.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// this binary does not know about, i.e. it was written by a newer version.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of golem supports")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes one migration, known to the binary or found applied in
+// the database.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Unknown is set for versions applied in the database that this binary
+	// does not ship.
+	Unknown bool
+}
+
+var all = mustLoad()
+
+func mustLoad() []Migration {
+	migrations, err := load(files)
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, name := range names {
+		base := path.Base(name)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", base)
+		}
+
+		stem := strings.TrimSuffix(base, "."+direction+".sql")
+		versionPart, description, ok := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(versionPart)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must be named NNNN_description", base)
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: description}
+			byVersion[version] = m
+		} else if m.Name != description {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, description)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest returns the newest schema version this binary understands.
+func Latest() int {
+	if len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+func ensureTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+type appliedMigration struct {
+	name      string
+	appliedAt time.Time
+}
+
+// applied reads schema_migrations without creating it, so that reading the
+// version never writes to the database; a database without the table has
+// no migrations applied.
+func applied(db *sql.DB) (map[int]appliedMigration, error) {
+	var exists int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %v", err)
+	}
+	result := make(map[int]appliedMigration)
+	if exists == 0 {
+		return result, nil
+	}
+
+	rows, err := db.Query("SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var m appliedMigration
+		if err := rows.Scan(&version, &m.name, &m.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %v", err)
+		}
+		result[version] = m
+	}
+	return result, rows.Err()
+}
+
+// Version returns the highest applied version, or 0 for an empty database.
+func Version(db *sql.DB) (int, error) {
+	done, err := applied(db)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range done {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Check returns ErrSchemaTooNew if the database is ahead of the binary.
+func Check(db *sql.DB) error {
+	version, err := Version(db)
+	if err != nil {
+		return err
+	}
+	if version > Latest() {
+		return fmt.Errorf("%w (database is at version %d, latest known is %d)", ErrSchemaTooNew, version, Latest())
+	}
+	return nil
+}
+
+// StatusOf lists every known migration and any unknown applied ones, by version.
+func StatusOf(db *sql.DB) ([]Status, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	known := make(map[int]bool)
+	for _, m := range all {
+		known[m.Version] = true
+		s := Status{Version: m.Version, Name: m.Name}
+		if a, ok := done[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.appliedAt
+		}
+		statuses = append(statuses, s)
+	}
+	for version, a := range done {
+		if !known[version] {
+			statuses = append(statuses, Status{Version: version, Name: a.name, Applied: true, AppliedAt: a.appliedAt, Unknown: true})
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the ones applied. It refuses to touch a database whose schema
+// is newer than the binary.
+func Up(db *sql.DB) ([]Migration, error) {
+	if err := Check(db); err != nil {
+		return nil, err
+	}
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range all {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				m.Version, m.Name, time.Now(),
+			)
+			return err
+		})
+		if err != nil {
+			return ran, fmt.Errorf("failed to apply migration %d_%s: %v", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Down reverts the newest steps applied migrations and returns the ones
+// reverted, newest first.
+func Down(db *sql.DB, steps int) ([]Migration, error) {
+	if err := Check(db); err != nil {
+		return nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(all) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := all[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("failed to revert migration %d_%s: %v", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,160 @@
+package migrations_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"Golem/internal/storage/migrations"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "golem.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func exec(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// keys returns the config_id of each row of table, ordered by rowid
+func keys(t *testing.T, db *sql.DB, table string) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT config_id FROM " + table + " ORDER BY rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// results maps the id of each health check result to its config_id
+func results(t *testing.T, db *sql.DB) map[string]string {
+	t.Helper()
+	rows, err := db.Query("SELECT id, config_id FROM health_check_results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	keyed := map[string]string{}
+	for rows.Next() {
+		var id, configID string
+		if err := rows.Scan(&id, &configID); err != nil {
+			t.Fatal(err)
+		}
+		keyed[id] = configID
+	}
+	return keyed
+}
+
+// downBefore reverts migrations until the one named name is no longer applied
+func downBefore(t *testing.T, db *sql.DB, name string) {
+	t.Helper()
+	statuses, err := migrations.StatusOf(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := -1
+	for _, s := range statuses {
+		if s.Name == name {
+			target = s.Version - 1
+		}
+	}
+	if target < 0 {
+		t.Fatalf("no migration named %s", name)
+	}
+	current, err := migrations.Version(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.Down(db, current-target); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := migrations.Version(db); err != nil || v != target {
+		t.Fatalf("after down: version %d, %v; want %d", v, err, target)
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	db := openDB(t)
+
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := migrations.Version(db); err != nil || v != migrations.Latest() {
+		t.Fatalf("after up: version %d, %v; want %d", v, err, migrations.Latest())
+	}
+	if _, err := migrations.Down(db, migrations.Latest()); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := migrations.Version(db); err != nil || v != 0 {
+		t.Fatalf("after down: version %d, %v; want 0", v, err)
+	}
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatalf("up after down: %v", err)
+	}
+}
+
+func TestHealthCheckResultsByID(t *testing.T) {
+	db := openDB(t)
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	// Back to before results were keyed by check ID
+	downBefore(t, db, "health_check_results_by_id")
+
+	for id, name := range map[string]string{"check_1": "web", "check_2": "db", "check_3": "dup", "check_4": "dup"} {
+		exec(t, db, `INSERT INTO health_check_configs (id, name, type, target, interval, timeout, enabled, created_at, updated_at)
+			VALUES (?, ?, 'http', 'http://example.com', 60, 10, true, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`, id, name)
+	}
+	for id, name := range map[string]string{"check_1": "web", "check_2": "db"} {
+		exec(t, db, `INSERT INTO health_check_results (id, config_id, status, response_time, message, last_checked)
+			VALUES (?, ?, 'up', 0, '', CURRENT_TIMESTAMP)`, id, name)
+	}
+	for _, name := range []string{"web", "db", "web", "dup", "deleted"} {
+		exec(t, db, `INSERT INTO health_check_history (config_id, timestamp, status, response_time, message)
+			VALUES (?, CURRENT_TIMESTAMP, 'up', 0, '')`, name)
+	}
+
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	byID := map[string]string{"check_1": "check_1", "check_2": "check_2"}
+	if got := results(t, db); !reflect.DeepEqual(got, byID) {
+		t.Errorf("results keyed %v, want %v", got, byID)
+	}
+	// Checks sharing a name, and deleted checks, cannot be told apart
+	want := []string{"check_1", "check_2", "check_1", "dup", "deleted"}
+	if got := keys(t, db, "health_check_history"); !reflect.DeepEqual(got, want) {
+		t.Errorf("history keyed %v, want %v", got, want)
+	}
+
+	downBefore(t, db, "health_check_results_by_id")
+	want = []string{"web", "db", "web", "dup", "deleted"}
+	if got := keys(t, db, "health_check_history"); !reflect.DeepEqual(got, want) {
+		t.Errorf("after down: history keyed %v, want %v", got, want)
+	}
+	byName := map[string]string{"check_1": "web", "check_2": "db"}
+	if got := results(t, db); !reflect.DeepEqual(got, byName) {
+		t.Errorf("after down: results keyed %v, want %v", got, byName)
+	}
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS health_check_history;
+DROP TABLE IF EXISTS health_check_results;
+DROP TABLE IF EXISTS health_check_configs;
+DROP TABLE IF EXISTS metrics;
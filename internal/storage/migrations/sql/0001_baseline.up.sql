@@ -0,0 +1,52 @@
+-- Baseline schema. Tables use IF NOT EXISTS so databases created before
+-- migrations existed are adopted as version 1 unchanged.
+
+CREATE TABLE IF NOT EXISTS metrics (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp DATETIME NOT NULL,
+	data TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS health_check_configs (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	target TEXT NOT NULL,
+	interval INTEGER NOT NULL,
+	timeout INTEGER NOT NULL,
+	enabled BOOLEAN NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS health_check_results (
+	id TEXT PRIMARY KEY,
+	config_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	response_time INTEGER NOT NULL,
+	message TEXT,
+	last_checked DATETIME NOT NULL,
+	FOREIGN KEY (config_id) REFERENCES health_check_configs(id)
+);
+
+CREATE TABLE IF NOT EXISTS health_check_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	config_id TEXT NOT NULL,
+	timestamp DATETIME NOT NULL,
+	status TEXT NOT NULL,
+	response_time INTEGER NOT NULL,
+	message TEXT,
+	FOREIGN KEY (config_id) REFERENCES health_check_configs(id)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	last_login TIMESTAMP,
+	is_active BOOLEAN NOT NULL DEFAULT true
+);
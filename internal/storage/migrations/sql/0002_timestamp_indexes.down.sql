@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS health_check_history_config_idx;
+DROP INDEX IF EXISTS metrics_timestamp_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS metrics_timestamp_idx ON metrics (timestamp);
+CREATE INDEX IF NOT EXISTS health_check_history_config_idx ON health_check_history (config_id, timestamp);
@@ -0,0 +1,10 @@
+DROP TABLE health_check_config_revisions;
+
+ALTER TABLE health_check_configs DROP COLUMN revision;
+ALTER TABLE health_check_configs DROP COLUMN options;
+ALTER TABLE health_check_configs DROP COLUMN plugin_name;
+ALTER TABLE health_check_configs DROP COLUMN expect_body;
+ALTER TABLE health_check_configs DROP COLUMN expect_code;
+ALTER TABLE health_check_configs DROP COLUMN body;
+ALTER TABLE health_check_configs DROP COLUMN headers;
+ALTER TABLE health_check_configs DROP COLUMN method;
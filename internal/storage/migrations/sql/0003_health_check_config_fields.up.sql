@@ -0,0 +1,17 @@
+ALTER TABLE health_check_configs ADD COLUMN method TEXT NOT NULL DEFAULT '';
+ALTER TABLE health_check_configs ADD COLUMN headers TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE health_check_configs ADD COLUMN body TEXT NOT NULL DEFAULT '';
+ALTER TABLE health_check_configs ADD COLUMN expect_code INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE health_check_configs ADD COLUMN expect_body TEXT NOT NULL DEFAULT '';
+ALTER TABLE health_check_configs ADD COLUMN plugin_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE health_check_configs ADD COLUMN options TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE health_check_configs ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+
+-- Each stored revision holds the full config as JSON.
+CREATE TABLE health_check_config_revisions (
+	config_id TEXT NOT NULL,
+	revision INTEGER NOT NULL,
+	config TEXT NOT NULL,
+	changed_at DATETIME NOT NULL,
+	PRIMARY KEY (config_id, revision)
+);
@@ -0,0 +1 @@
+ALTER TABLE health_check_configs DROP COLUMN labels;
@@ -0,0 +1 @@
+ALTER TABLE health_check_configs ADD COLUMN labels TEXT NOT NULL DEFAULT '{}';
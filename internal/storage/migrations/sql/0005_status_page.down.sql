@@ -0,0 +1,6 @@
+DROP TABLE check_uptime_watermarks;
+DROP TABLE check_uptime_daily;
+DROP TABLE incident_updates;
+DROP TABLE incidents;
+DROP TABLE status_components;
+DROP TABLE status_page;
@@ -0,0 +1,53 @@
+CREATE TABLE status_page (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT ''
+);
+
+-- A component shows the combined status of the checks it lists or whose
+-- labels match its selector.
+CREATE TABLE status_components (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	selector TEXT NOT NULL DEFAULT '',
+	checks TEXT NOT NULL DEFAULT '[]',
+	position INTEGER NOT NULL
+);
+
+CREATE TABLE incidents (
+	id TEXT PRIMARY KEY,
+	title TEXT NOT NULL,
+	status TEXT NOT NULL,
+	impact TEXT NOT NULL,
+	components TEXT NOT NULL DEFAULT '[]',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	resolved_at DATETIME
+);
+
+CREATE INDEX incidents_created_at_idx ON incidents(created_at);
+
+CREATE TABLE incident_updates (
+	id TEXT PRIMARY KEY,
+	incident_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	message TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX incident_updates_incident_idx ON incident_updates(incident_id, created_at);
+
+-- Check history is short-lived, so uptime is rolled up per UTC day.
+CREATE TABLE check_uptime_daily (
+	config_id TEXT NOT NULL,
+	day TEXT NOT NULL,
+	up INTEGER NOT NULL,
+	total INTEGER NOT NULL,
+	PRIMARY KEY (config_id, day)
+);
+
+CREATE TABLE check_uptime_watermarks (
+	config_id TEXT PRIMARY KEY,
+	last_timestamp DATETIME NOT NULL
+);
@@ -0,0 +1,8 @@
+-- Custom roles; the built-in admin, user and viewer roles are defined in code.
+CREATE TABLE roles (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT '',
+	permissions TEXT NOT NULL DEFAULT '[]',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
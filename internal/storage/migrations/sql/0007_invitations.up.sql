@@ -0,0 +1,12 @@
+-- Invitations to register; only a hash of the token is stored.
+CREATE TABLE invitations (
+	id TEXT PRIMARY KEY,
+	token_hash TEXT NOT NULL UNIQUE,
+	email TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL,
+	created_by TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME,
+	used_by TEXT NOT NULL DEFAULT ''
+);
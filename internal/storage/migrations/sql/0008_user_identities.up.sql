@@ -0,0 +1,10 @@
+-- Links users to accounts at external identity providers.
+CREATE TABLE user_identities (
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
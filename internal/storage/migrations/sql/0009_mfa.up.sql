@@ -0,0 +1,22 @@
+-- TOTP factors. A factor is pending until the user confirms a code from it.
+CREATE TABLE user_mfa (
+	user_id TEXT PRIMARY KEY,
+	secret TEXT NOT NULL,
+	enabled INTEGER NOT NULL DEFAULT 0,
+	last_step INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	enabled_at DATETIME
+);
+
+-- One-time recovery codes, stored as SHA-256 hashes.
+CREATE TABLE mfa_recovery_codes (
+	user_id TEXT NOT NULL,
+	code_hash TEXT NOT NULL,
+	used_at DATETIME,
+	PRIMARY KEY (user_id, code_hash)
+);
+
+-- Roles whose users must set up MFA before they can log in with a password.
+CREATE TABLE mfa_required_roles (
+	role TEXT PRIMARY KEY
+);
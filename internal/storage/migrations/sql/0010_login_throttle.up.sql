@@ -0,0 +1,25 @@
+-- Failed login attempts per username ("user:<name>") and per client address
+-- ("ip:<addr>"), for backoff and temporary lockout.
+CREATE TABLE login_throttle (
+	key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure DATETIME NOT NULL,
+	blocked_until DATETIME NOT NULL,
+	locked INTEGER NOT NULL DEFAULT 0
+);
+
+-- Every login attempt, successful or not.
+CREATE TABLE login_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time DATETIME NOT NULL,
+	method TEXT NOT NULL,
+	username TEXT NOT NULL,
+	user_id TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	outcome TEXT NOT NULL
+);
+
+CREATE INDEX idx_login_events_time ON login_events(time);
+CREATE INDEX idx_login_events_username ON login_events(username, time);
+CREATE INDEX idx_login_events_ip ON login_events(ip, time);
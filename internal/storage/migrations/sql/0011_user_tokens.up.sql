@@ -0,0 +1,15 @@
+-- Single-use password reset and email verification tokens; only a hash of
+-- the token is stored.
+CREATE TABLE user_tokens (
+	id TEXT PRIMARY KEY,
+	token_hash TEXT NOT NULL UNIQUE,
+	user_id TEXT NOT NULL,
+	purpose TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME
+);
+CREATE INDEX idx_user_tokens_user ON user_tokens (user_id, purpose, created_at);
+
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
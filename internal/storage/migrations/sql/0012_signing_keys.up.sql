@@ -0,0 +1,10 @@
+-- Keys that sign session tokens. A key signs from active_at until a newer
+-- key is active, and verifies tokens until expires_at.
+CREATE TABLE signing_keys (
+	kid TEXT PRIMARY KEY,
+	algorithm TEXT NOT NULL,
+	key_data BLOB NOT NULL,
+	created_at DATETIME NOT NULL,
+	active_at DATETIME NOT NULL,
+	expires_at DATETIME
+);
@@ -0,0 +1,34 @@
+-- Every configuration and user-management change made through the API.
+-- Rows are never updated or deleted.
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time DATETIME NOT NULL,
+	actor_type TEXT NOT NULL,
+	actor_id TEXT NOT NULL DEFAULT '',
+	actor TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id TEXT NOT NULL DEFAULT '',
+	method TEXT NOT NULL DEFAULT '',
+	path TEXT NOT NULL DEFAULT '',
+	status INTEGER NOT NULL DEFAULT 0,
+	ip TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	before_json TEXT,
+	after_json TEXT
+);
+
+CREATE INDEX idx_audit_log_time ON audit_log(time);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor_id, time);
+CREATE INDEX idx_audit_log_target ON audit_log(target_type, target_id, time);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;
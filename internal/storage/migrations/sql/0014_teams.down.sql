@@ -0,0 +1,4 @@
+DROP INDEX idx_health_check_configs_team;
+ALTER TABLE health_check_configs DROP COLUMN team;
+DROP TABLE team_members;
+DROP TABLE teams;
@@ -0,0 +1,22 @@
+-- Teams own health checks; members see and change only their teams' checks.
+CREATE TABLE teams (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+-- role is the member's role within the team: admin, editor or viewer.
+CREATE TABLE team_members (
+	team TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (team, user_id)
+);
+
+CREATE INDEX idx_team_members_user ON team_members(user_id);
+
+-- Checks without a team are shared, as before teams existed.
+ALTER TABLE health_check_configs ADD COLUMN team TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_health_check_configs_team ON health_check_configs(team);
@@ -0,0 +1,7 @@
+UPDATE health_check_history
+SET config_id = (SELECT c.name FROM health_check_configs c WHERE c.id = health_check_history.config_id)
+WHERE config_id IN (SELECT id FROM health_check_configs);
+
+UPDATE health_check_results
+SET config_id = (SELECT c.name FROM health_check_configs c WHERE c.id = health_check_results.id)
+WHERE id IN (SELECT id FROM health_check_configs);
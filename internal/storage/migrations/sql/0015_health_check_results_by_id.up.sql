@@ -0,0 +1,10 @@
+-- Results and history were stored under the check's name in config_id
+-- instead of its ID. A result row's id was always the check ID.
+UPDATE health_check_results SET config_id = id WHERE config_id <> id;
+
+-- History has no ID to fall back on; rows are moved to the check with that
+-- name, unless several checks share it and the rows cannot be told apart.
+UPDATE health_check_history
+SET config_id = (SELECT c.id FROM health_check_configs c WHERE c.name = health_check_history.config_id)
+WHERE config_id NOT IN (SELECT id FROM health_check_configs)
+	AND (SELECT COUNT(*) FROM health_check_configs c WHERE c.name = health_check_history.config_id) = 1;
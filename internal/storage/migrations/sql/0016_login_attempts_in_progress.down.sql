@@ -0,0 +1,2 @@
+ALTER TABLE login_throttle DROP COLUMN pending_until;
+ALTER TABLE login_throttle DROP COLUMN pending;
@@ -0,0 +1,5 @@
+-- Logins being checked right now, so parallel attempts cannot all get past
+-- the backoff before the first of them fails. A count whose pending_until
+-- has passed was left by a process that stopped mid-login and is ignored.
+ALTER TABLE login_throttle ADD COLUMN pending INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE login_throttle ADD COLUMN pending_until DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
@@ -0,0 +1,614 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"Golem/internal/metrics"
+
+	_ "github.com/lib/pq"
+)
+
+// metricsCleanupInterval is how often old metrics are dropped. Dropping
+// them on every insert would be a retention pass every few seconds.
+const metricsCleanupInterval = 10 * time.Minute
+
+type PostgresStorage struct {
+	db          *sql.DB
+	timescaleDB bool
+
+	cleanupMu   sync.Mutex
+	lastCleanup time.Time
+
+	// scope limits the checks of a view made by ScopedHealthChecks
+	scope *Scope
+}
+
+func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %v", err)
+	}
+
+	storage := &PostgresStorage{db: db}
+	if err := storage.initTables(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize tables: %v", err)
+	}
+
+	return storage, nil
+}
+
+func (s *PostgresStorage) initTables() error {
+	// The metrics table has no surrogate key so that it can be turned into a
+	// TimescaleDB hypertable partitioned on timestamp.
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS metrics (
+			timestamp TIMESTAMPTZ NOT NULL,
+			data JSONB NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS metrics_timestamp_idx ON metrics (timestamp DESC)`,
+		`CREATE TABLE IF NOT EXISTS health_check_configs (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			target TEXT NOT NULL,
+			interval BIGINT NOT NULL,
+			timeout BIGINT NOT NULL,
+			enabled BOOLEAN NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL
+		)`,
+		`ALTER TABLE health_check_configs
+			ADD COLUMN IF NOT EXISTS method TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS headers JSONB NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS body TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS expect_code INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS expect_body TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS plugin_name TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS options JSONB NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1,
+			ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS team TEXT NOT NULL DEFAULT ''`,
+		`CREATE TABLE IF NOT EXISTS health_check_config_revisions (
+			config_id TEXT NOT NULL,
+			revision INTEGER NOT NULL,
+			config JSONB NOT NULL,
+			changed_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (config_id, revision)
+		)`,
+		`CREATE TABLE IF NOT EXISTS health_check_results (
+			id TEXT PRIMARY KEY,
+			config_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			response_time BIGINT NOT NULL,
+			message TEXT,
+			last_checked TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS health_check_history (
+			id BIGSERIAL PRIMARY KEY,
+			config_id TEXT NOT NULL,
+			timestamp TIMESTAMPTZ NOT NULL,
+			status TEXT NOT NULL,
+			response_time BIGINT NOT NULL,
+			message TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS health_check_history_config_idx ON health_check_history (config_id, timestamp DESC)`,
+	}
+
+	for _, query := range queries {
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %v", err)
+		}
+	}
+
+	s.timescaleDB = s.enableTimescaleDB()
+	return nil
+}
+
+// enableTimescaleDB converts metrics into a hypertable when the timescaledb
+// extension is installed on the server. Plain PostgreSQL works unchanged.
+func (s *PostgresStorage) enableTimescaleDB() bool {
+	var available bool
+	err := s.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM pg_available_extensions WHERE name = 'timescaledb')",
+	).Scan(&available)
+	if err != nil || !available {
+		return false
+	}
+
+	if _, err := s.db.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb"); err != nil {
+		log.Printf("TimescaleDB is available but could not be enabled: %v", err)
+		return false
+	}
+
+	_, err = s.db.Exec(
+		"SELECT create_hypertable('metrics', 'timestamp', if_not_exists => TRUE, migrate_data => TRUE)",
+	)
+	if err != nil {
+		log.Printf("Failed to create TimescaleDB hypertable for metrics: %v", err)
+		return false
+	}
+
+	return true
+}
+
+func (s *PostgresStorage) StoreMetrics(m metrics.SystemMetrics) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %v", err)
+	}
+
+	_, err = s.db.Exec(
+		"INSERT INTO metrics (timestamp, data) VALUES ($1, $2)",
+		m.Timestamp, string(data),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store metrics: %v", err)
+	}
+
+	return s.cleanupMetrics(time.Now())
+}
+
+// cleanupMetrics keeps the last 24 hours of metrics, dropping older ones at
+// most once per metricsCleanupInterval
+func (s *PostgresStorage) cleanupMetrics(now time.Time) error {
+	s.cleanupMu.Lock()
+	defer s.cleanupMu.Unlock()
+	if now.Sub(s.lastCleanup) < metricsCleanupInterval {
+		return nil
+	}
+
+	var err error
+	if s.timescaleDB {
+		_, err = s.db.Exec("SELECT drop_chunks('metrics', older_than => now() - INTERVAL '24 hours')")
+	} else {
+		_, err = s.db.Exec("DELETE FROM metrics WHERE timestamp < now() - INTERVAL '24 hours'")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to clean up old metrics: %v", err)
+	}
+	s.lastCleanup = now
+	return nil
+}
+
+func (s *PostgresStorage) GetLatestMetrics() (metrics.SystemMetrics, error) {
+	var data string
+	err := s.db.QueryRow(
+		"SELECT data FROM metrics ORDER BY timestamp DESC LIMIT 1",
+	).Scan(&data)
+	if err == sql.ErrNoRows {
+		return metrics.SystemMetrics{}, nil
+	}
+	if err != nil {
+		return metrics.SystemMetrics{}, fmt.Errorf("failed to get latest metrics: %v", err)
+	}
+
+	var m metrics.SystemMetrics
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		return metrics.SystemMetrics{}, fmt.Errorf("failed to unmarshal metrics: %v", err)
+	}
+
+	return m, nil
+}
+
+func (s *PostgresStorage) GetMetricsHistory(duration time.Duration) ([]metrics.SystemMetrics, error) {
+	return s.queryMetrics(
+		"SELECT data FROM metrics WHERE timestamp > $1 ORDER BY timestamp DESC",
+		time.Now().Add(-duration),
+	)
+}
+
+func (s *PostgresStorage) GetMetricsRange(from, to time.Time) ([]metrics.SystemMetrics, error) {
+	return s.queryMetrics(
+		"SELECT data FROM metrics WHERE timestamp >= $1 AND timestamp <= $2 ORDER BY timestamp ASC",
+		from, to,
+	)
+}
+
+func (s *PostgresStorage) queryMetrics(query string, args ...interface{}) ([]metrics.SystemMetrics, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics: %v", err)
+	}
+	defer rows.Close()
+
+	var result []metrics.SystemMetrics
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan metrics row: %v", err)
+		}
+
+		var m metrics.SystemMetrics
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal metrics: %v", err)
+		}
+
+		result = append(result, m)
+	}
+
+	return result, rows.Err()
+}
+
+// ScopedHealthChecks returns a view of the checks limited to scope.
+func (s *PostgresStorage) ScopedHealthChecks(scope Scope) HealthCheckStorage {
+	return &PostgresStorage{db: s.db, timescaleDB: s.timescaleDB, scope: &scope}
+}
+
+// teamCondition returns the condition on column that limits rows to the
+// scope of s, and its arguments, numbered from first.
+func (s *PostgresStorage) teamCondition(column string, first int) (string, []interface{}) {
+	return teamCondition(s.scope, column, func(n int) string { return fmt.Sprintf("$%d", n) }, first)
+}
+
+func (s *PostgresStorage) StoreHealthCheckConfig(config metrics.HealthCheckConfig) error {
+	if !inScope(s.scope, config.Team) {
+		return ErrOutOfScope
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var prev *metrics.HealthCheckConfig
+	existing, err := scanHealthCheckConfig(tx.QueryRow(
+		"SELECT "+healthCheckConfigColumns+" FROM health_check_configs WHERE id = $1 FOR UPDATE", config.ID,
+	))
+	if err == nil {
+		if !inScope(s.scope, existing.Team) {
+			return ErrOutOfScope
+		}
+		prev = &existing
+	} else if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get health check config: %v", err)
+	}
+
+	config, changed := reviseHealthCheckConfig(prev, config, time.Now())
+	if !changed {
+		return nil
+	}
+
+	headers, err := jsonObject(config.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal headers: %v", err)
+	}
+	options, err := jsonObject(config.Options)
+	if err != nil {
+		return fmt.Errorf("failed to marshal options: %v", err)
+	}
+	labels, err := jsonObject(config.Labels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal labels: %v", err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO health_check_configs (`+healthCheckConfigColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name, type = EXCLUDED.type, target = EXCLUDED.target,
+			interval = EXCLUDED.interval, timeout = EXCLUDED.timeout, method = EXCLUDED.method,
+			headers = EXCLUDED.headers, body = EXCLUDED.body, expect_code = EXCLUDED.expect_code,
+			expect_body = EXCLUDED.expect_body, plugin_name = EXCLUDED.plugin_name,
+			options = EXCLUDED.options, labels = EXCLUDED.labels, team = EXCLUDED.team, enabled = EXCLUDED.enabled,
+			revision = EXCLUDED.revision, updated_at = EXCLUDED.updated_at`,
+		config.ID, config.Name, config.Type, config.Target,
+		config.Interval, config.Timeout, config.Method, headers, config.Body,
+		config.ExpectCode, config.ExpectBody, config.PluginName, options, labels, config.Team,
+		config.Enabled, config.Revision, config.CreatedAt, config.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store health check config: %v", err)
+	}
+
+	revisions := []metrics.HealthCheckConfig{config}
+	if prev != nil {
+		revisions = []metrics.HealthCheckConfig{*prev, config}
+	}
+	for _, revision := range revisions {
+		data, err := json.Marshal(revision)
+		if err != nil {
+			return fmt.Errorf("failed to marshal health check config: %v", err)
+		}
+		_, err = tx.Exec(
+			`INSERT INTO health_check_config_revisions (config_id, revision, config, changed_at)
+			VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+			revision.ID, revision.Revision, string(data), revision.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store health check config revision: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) GetHealthCheckConfig(id string) (metrics.HealthCheckConfig, error) {
+	team, args := s.teamCondition("team", 2)
+	config, err := scanHealthCheckConfig(s.db.QueryRow(
+		"SELECT "+healthCheckConfigColumns+" FROM health_check_configs WHERE id = $1 AND "+team,
+		append([]interface{}{id}, args...)...,
+	))
+	if err == sql.ErrNoRows {
+		return metrics.HealthCheckConfig{}, fmt.Errorf("health check config not found: %s", id)
+	}
+	if err != nil {
+		return metrics.HealthCheckConfig{}, fmt.Errorf("failed to get health check config: %v", err)
+	}
+	return config, nil
+}
+
+func (s *PostgresStorage) GetAllHealthCheckConfigs() ([]metrics.HealthCheckConfig, error) {
+	team, args := s.teamCondition("team", 1)
+	rows, err := s.db.Query(
+		"SELECT "+healthCheckConfigColumns+" FROM health_check_configs WHERE "+team+" ORDER BY name",
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health check configs: %v", err)
+	}
+	defer rows.Close()
+
+	var configs []metrics.HealthCheckConfig
+	for rows.Next() {
+		config, err := scanHealthCheckConfig(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan health check config: %v", err)
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+func (s *PostgresStorage) GetHealthCheckRevisions(id string) ([]metrics.HealthCheckRevision, error) {
+	current, err := s.GetHealthCheckConfig(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(
+		`SELECT revision, config, changed_at FROM health_check_config_revisions
+		WHERE config_id = $1 ORDER BY revision DESC`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health check config revisions: %v", err)
+	}
+	defer rows.Close()
+
+	var revisions []metrics.HealthCheckRevision
+	for rows.Next() {
+		var revision metrics.HealthCheckRevision
+		var data []byte
+		if err := rows.Scan(&revision.Revision, &data, &revision.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan health check config revision: %v", err)
+		}
+		if err := json.Unmarshal(data, &revision.Config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal health check config revision: %v", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		revisions = append(revisions, metrics.HealthCheckRevision{
+			Revision: current.Revision, ChangedAt: current.UpdatedAt, Config: current,
+		})
+	}
+	return revisions, nil
+}
+
+func (s *PostgresStorage) DeleteHealthCheckConfig(id string) error {
+	team, args := s.teamCondition("team", 2)
+	res, err := s.db.Exec(
+		"DELETE FROM health_check_configs WHERE id = $1 AND "+team,
+		append([]interface{}{id}, args...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete health check config: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("health check config not found: %s", id)
+	}
+	_, err = s.db.Exec("DELETE FROM health_check_config_revisions WHERE config_id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete health check config revisions: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) StoreHealthCheckResult(result metrics.HealthCheckResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if s.scope != nil {
+		team, args := s.teamCondition("team", 2)
+		var n int
+		err := tx.QueryRow(
+			"SELECT COUNT(*) FROM health_check_configs WHERE id = $1 AND "+team,
+			append([]interface{}{result.ID}, args...)...,
+		).Scan(&n)
+		if err != nil {
+			return fmt.Errorf("failed to get health check config: %v", err)
+		}
+		if n == 0 {
+			return ErrOutOfScope
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO health_check_results
+		(id, config_id, status, response_time, message, last_checked)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status, response_time = EXCLUDED.response_time,
+			message = EXCLUDED.message, last_checked = EXCLUDED.last_checked`,
+		result.ID, result.ID, result.Status,
+		result.ResponseTime, result.Message, result.LastChecked,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store health check result: %v", err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO health_check_history
+		(config_id, timestamp, status, response_time, message)
+		VALUES ($1, $2, $3, $4, $5)`,
+		result.ID, result.LastChecked, result.Status,
+		result.ResponseTime, result.Message,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store health check history: %v", err)
+	}
+
+	// Clean up old history entries (keep last 100)
+	_, err = tx.Exec(
+		`DELETE FROM health_check_history
+		WHERE config_id = $1 AND id NOT IN (
+			SELECT id FROM health_check_history
+			WHERE config_id = $1
+			ORDER BY timestamp DESC LIMIT 100
+		)`,
+		result.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to clean up old history: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+const postgresResultColumns = `r.id, COALESCE(c.name, r.config_id), COALESCE(c.type, ''), COALESCE(c.target, ''),
+	r.status, r.response_time, COALESCE(r.message, ''), r.last_checked`
+
+func (s *PostgresStorage) GetHealthCheckResult(id string) (metrics.HealthCheckResult, error) {
+	var result metrics.HealthCheckResult
+	team, args := s.teamCondition("c.team", 2)
+	err := s.db.QueryRow(
+		`SELECT `+postgresResultColumns+`
+		FROM health_check_results r
+		LEFT JOIN health_check_configs c ON c.id = r.config_id
+		WHERE r.id = $1 AND `+team,
+		append([]interface{}{id}, args...)...,
+	).Scan(
+		&result.ID, &result.Name, &result.Type, &result.Target, &result.Status,
+		&result.ResponseTime, &result.Message, &result.LastChecked,
+	)
+	if err == sql.ErrNoRows {
+		return metrics.HealthCheckResult{}, fmt.Errorf("health check result not found: %s", id)
+	}
+	if err != nil {
+		return metrics.HealthCheckResult{}, fmt.Errorf("failed to get health check result: %v", err)
+	}
+
+	result.History, err = s.GetHealthCheckHistory(result.ID, 0)
+	if err != nil {
+		return metrics.HealthCheckResult{}, err
+	}
+
+	return result, nil
+}
+
+func (s *PostgresStorage) GetAllHealthCheckResults() ([]metrics.HealthCheckResult, error) {
+	team, args := s.teamCondition("c.team", 1)
+	rows, err := s.db.Query(
+		`SELECT `+postgresResultColumns+`
+		FROM health_check_results r
+		LEFT JOIN health_check_configs c ON c.id = r.config_id
+		WHERE `+team+`
+		ORDER BY r.last_checked DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health check results: %v", err)
+	}
+
+	var results []metrics.HealthCheckResult
+	for rows.Next() {
+		var result metrics.HealthCheckResult
+		err := rows.Scan(
+			&result.ID, &result.Name, &result.Type, &result.Target, &result.Status,
+			&result.ResponseTime, &result.Message, &result.LastChecked,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan health check result: %v", err)
+		}
+		results = append(results, result)
+	}
+	rows.Close()
+
+	for i := range results {
+		results[i].History, err = s.GetHealthCheckHistory(results[i].ID, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+func (s *PostgresStorage) GetHealthCheckHistory(id string, duration time.Duration) ([]metrics.HealthCheckHistoryEntry, error) {
+	query := `SELECT timestamp, status, response_time, COALESCE(message, '')
+		FROM health_check_history
+		WHERE config_id = $1`
+	args := []interface{}{id}
+
+	if duration > 0 {
+		query += ` AND timestamp > $2`
+		args = append(args, time.Now().Add(-duration))
+	}
+
+	if s.scope != nil {
+		team, teamArgs := s.teamCondition("team", len(args)+1)
+		query += ` AND config_id IN (SELECT id FROM health_check_configs WHERE ` + team + `)`
+		args = append(args, teamArgs...)
+	}
+
+	query += ` ORDER BY timestamp DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health check history: %v", err)
+	}
+	defer rows.Close()
+
+	var history []metrics.HealthCheckHistoryEntry
+	for rows.Next() {
+		var entry metrics.HealthCheckHistoryEntry
+		err := rows.Scan(
+			&entry.Timestamp, &entry.Status,
+			&entry.ResponseTime, &entry.Message,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan history entry: %v", err)
+		}
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+func (s *PostgresStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Backend is a complete storage implementation for metrics and health checks.
+type Backend interface {
+	MetricStorage
+	HealthCheckStorage
+	Close() error
+}
+
+// Factory opens a backend from a backend-specific data source name.
+type Factory func(dsn string) (Backend, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Factory)
+)
+
+// Register makes a backend available to Open under the given name. It panics
+// if the name is registered twice, mirroring database/sql.Register.
+func Register(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if factory == nil {
+		panic("storage: Register factory is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("storage: Register called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// Open opens the named backend.
+func Open(name, dsn string) (Backend, error) {
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q (available: %v)", name, Backends())
+	}
+	return factory(dsn)
+}
+
+// Backends returns the sorted names of the registered backends.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("sqlite", func(dsn string) (Backend, error) {
+		return NewSQLiteStorage(dsn)
+	})
+	Register("memory", func(dsn string) (Backend, error) {
+		return NewMemoryStorage(), nil
+	})
+	Register("postgres", func(dsn string) (Backend, error) {
+		return NewPostgresStorage(dsn)
+	})
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+// reviseHealthCheckConfig applies the bookkeeping shared by every backend
+// when config is stored over prev (nil for a new check): the creation time
+// never changes and the revision only increases when the content did. It
+// reports whether anything needs to be written.
+func reviseHealthCheckConfig(prev *metrics.HealthCheckConfig, config metrics.HealthCheckConfig, now time.Time) (metrics.HealthCheckConfig, bool) {
+	if prev == nil {
+		config.Revision = 1
+		if config.CreatedAt.IsZero() {
+			config.CreatedAt = now
+		}
+		if config.UpdatedAt.IsZero() {
+			config.UpdatedAt = config.CreatedAt
+		}
+		return config, true
+	}
+
+	config.CreatedAt = prev.CreatedAt
+	if len(config.Diff(*prev)) == 0 {
+		return *prev, false
+	}
+
+	config.Revision = prev.Revision + 1
+	config.UpdatedAt = now
+	return config, true
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"Golem/internal/metrics"
+)
+
+// ErrOutOfScope is returned when storing a check outside the scope
+var ErrOutOfScope = errors.New("health check belongs to another team")
+
+// Scope is the set of teams whose checks a caller may see.
+type Scope struct {
+	// All includes every check, whatever its team
+	All bool
+	// Shared includes checks without a team
+	Shared bool
+	Teams  []string
+}
+
+// Allows reports whether checks of team are in the scope.
+func (s Scope) Allows(team string) bool {
+	if s.All {
+		return true
+	}
+	if team == "" {
+		return s.Shared
+	}
+	return slices.Contains(s.Teams, team)
+}
+
+// inScope reports whether checks of team are in scope. A nil scope
+// includes every team.
+func inScope(scope *Scope, team string) bool {
+	return scope == nil || scope.Allows(team)
+}
+
+// teamCondition returns an SQL condition that holds when column names a
+// team in scope, and its arguments. placeholder returns the placeholder of
+// the nth argument of the query, counting from first.
+func teamCondition(scope *Scope, column string, placeholder func(n int) string, first int) (string, []interface{}) {
+	if scope == nil || scope.All {
+		return "TRUE", nil
+	}
+	var conds []string
+	var args []interface{}
+	if scope.Shared {
+		conds = append(conds, column+" = ''")
+	}
+	if len(scope.Teams) > 0 {
+		marks := make([]string, len(scope.Teams))
+		for i, team := range scope.Teams {
+			marks[i] = placeholder(first + i)
+			args = append(args, team)
+		}
+		conds = append(conds, column+" IN ("+strings.Join(marks, ", ")+")")
+	}
+	if len(conds) == 0 {
+		return "FALSE", nil
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// TeamScoper is implemented by backends that limit checks to a scope in
+// their own queries, as Scoped does.
+type TeamScoper interface {
+	ScopedHealthChecks(scope Scope) HealthCheckStorage
+}
+
+// Scoped returns a view of checks limited to scope. Checks of other teams,
+// and their results and history, look like checks that do not exist;
+// storing one fails with ErrOutOfScope.
+//
+// Backends that implement TeamScoper filter checks in their queries; the
+// view still checks the team of every config they return.
+func Scoped(checks HealthCheckStorage, scope Scope) HealthCheckStorage {
+	if scope.All {
+		return checks
+	}
+	if scoper, ok := checks.(TeamScoper); ok {
+		checks = scoper.ScopedHealthChecks(scope)
+	}
+	return &scopedHealthChecks{checks: checks, scope: scope}
+}
+
+type scopedHealthChecks struct {
+	checks HealthCheckStorage
+	scope  Scope
+}
+
+// visible returns the config of id if it is in scope.
+func (s *scopedHealthChecks) visible(id string) (metrics.HealthCheckConfig, error) {
+	config, err := s.checks.GetHealthCheckConfig(id)
+	if err != nil {
+		return config, err
+	}
+	if !s.scope.Allows(config.Team) {
+		return metrics.HealthCheckConfig{}, fmt.Errorf("health check config not found: %s", id)
+	}
+	return config, nil
+}
+
+func (s *scopedHealthChecks) StoreHealthCheckConfig(config metrics.HealthCheckConfig) error {
+	if !s.scope.Allows(config.Team) {
+		return ErrOutOfScope
+	}
+	if existing, err := s.checks.GetHealthCheckConfig(config.ID); err == nil && !s.scope.Allows(existing.Team) {
+		return ErrOutOfScope
+	}
+	return s.checks.StoreHealthCheckConfig(config)
+}
+
+func (s *scopedHealthChecks) GetHealthCheckConfig(id string) (metrics.HealthCheckConfig, error) {
+	return s.visible(id)
+}
+
+func (s *scopedHealthChecks) GetAllHealthCheckConfigs() ([]metrics.HealthCheckConfig, error) {
+	configs, err := s.checks.GetAllHealthCheckConfigs()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(configs, func(config metrics.HealthCheckConfig) bool {
+		return !s.scope.Allows(config.Team)
+	}), nil
+}
+
+func (s *scopedHealthChecks) DeleteHealthCheckConfig(id string) error {
+	if _, err := s.visible(id); err != nil {
+		return err
+	}
+	return s.checks.DeleteHealthCheckConfig(id)
+}
+
+func (s *scopedHealthChecks) GetHealthCheckRevisions(id string) ([]metrics.HealthCheckRevision, error) {
+	if _, err := s.visible(id); err != nil {
+		return nil, err
+	}
+	return s.checks.GetHealthCheckRevisions(id)
+}
+
+func (s *scopedHealthChecks) StoreHealthCheckResult(result metrics.HealthCheckResult) error {
+	if _, err := s.visible(result.ID); err != nil {
+		return ErrOutOfScope
+	}
+	return s.checks.StoreHealthCheckResult(result)
+}
+
+func (s *scopedHealthChecks) GetHealthCheckResult(id string) (metrics.HealthCheckResult, error) {
+	if _, err := s.visible(id); err != nil {
+		return metrics.HealthCheckResult{}, err
+	}
+	return s.checks.GetHealthCheckResult(id)
+}
+
+func (s *scopedHealthChecks) GetAllHealthCheckResults() ([]metrics.HealthCheckResult, error) {
+	configs, err := s.GetAllHealthCheckConfigs()
+	if err != nil {
+		return nil, err
+	}
+	inScope := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		inScope[config.ID] = true
+	}
+	results, err := s.checks.GetAllHealthCheckResults()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(results, func(result metrics.HealthCheckResult) bool {
+		return !inScope[result.ID]
+	}), nil
+}
+
+// GetHealthCheckHistory returns no history for checks out of scope, as for
+// unknown checks.
+func (s *scopedHealthChecks) GetHealthCheckHistory(id string, duration time.Duration) ([]metrics.HealthCheckHistoryEntry, error) {
+	if _, err := s.visible(id); err != nil {
+		return []metrics.HealthCheckHistoryEntry{}, nil
+	}
+	return s.checks.GetHealthCheckHistory(id, duration)
+}
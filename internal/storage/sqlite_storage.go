@@ -7,12 +7,16 @@ import (
 	"time"
 
 	"Golem/internal/metrics"
+	"Golem/internal/storage/migrations"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type SQLiteStorage struct {
 	db *sql.DB
+
+	// scope limits the checks of a view made by ScopedHealthChecks
+	scope *Scope
 }
 
 func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
@@ -25,59 +29,12 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
-	storage := &SQLiteStorage{db: db}
-	if err := storage.initTables(); err != nil {
-		return nil, fmt.Errorf("failed to initialize tables: %v", err)
+	if _, err := migrations.Up(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	return storage, nil
-}
-
-func (s *SQLiteStorage) initTables() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS metrics (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			timestamp DATETIME NOT NULL,
-			data TEXT NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS health_check_configs (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			type TEXT NOT NULL,
-			target TEXT NOT NULL,
-			interval INTEGER NOT NULL,
-			timeout INTEGER NOT NULL,
-			enabled BOOLEAN NOT NULL,
-			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS health_check_results (
-			id TEXT PRIMARY KEY,
-			config_id TEXT NOT NULL,
-			status TEXT NOT NULL,
-			response_time INTEGER NOT NULL,
-			message TEXT,
-			last_checked DATETIME NOT NULL,
-			FOREIGN KEY (config_id) REFERENCES health_check_configs(id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS health_check_history (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			config_id TEXT NOT NULL,
-			timestamp DATETIME NOT NULL,
-			status TEXT NOT NULL,
-			response_time INTEGER NOT NULL,
-			message TEXT,
-			FOREIGN KEY (config_id) REFERENCES health_check_configs(id)
-		)`,
-	}
-
-	for _, query := range queries {
-		if _, err := s.db.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute query: %v", err)
-		}
-	}
-
-	return nil
+	return &SQLiteStorage{db: db}, nil
 }
 
 func (s *SQLiteStorage) StoreMetrics(m metrics.SystemMetrics) error {
@@ -153,32 +110,175 @@ func (s *SQLiteStorage) GetMetricsHistory(duration time.Duration) ([]metrics.Sys
 	return result, nil
 }
 
+func (s *SQLiteStorage) GetMetricsRange(from, to time.Time) ([]metrics.SystemMetrics, error) {
+	rows, err := s.db.Query(
+		"SELECT data FROM metrics WHERE timestamp >= ? AND timestamp <= ? ORDER BY timestamp ASC",
+		from.Local(), to.Local(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics range: %v", err)
+	}
+	defer rows.Close()
+
+	var result []metrics.SystemMetrics
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan metrics row: %v", err)
+		}
+
+		var m metrics.SystemMetrics
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal metrics: %v", err)
+		}
+
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+const healthCheckConfigColumns = `id, name, type, target, interval, timeout, method, headers, body,
+	expect_code, expect_body, plugin_name, options, labels, team, enabled, revision, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanHealthCheckConfig(row rowScanner) (metrics.HealthCheckConfig, error) {
+	var config metrics.HealthCheckConfig
+	var headers, options, labels string
+	err := row.Scan(
+		&config.ID, &config.Name, &config.Type, &config.Target,
+		&config.Interval, &config.Timeout, &config.Method, &headers, &config.Body,
+		&config.ExpectCode, &config.ExpectBody, &config.PluginName, &options, &labels, &config.Team,
+		&config.Enabled, &config.Revision, &config.CreatedAt, &config.UpdatedAt,
+	)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal([]byte(headers), &config.Headers); err != nil {
+		return config, fmt.Errorf("failed to unmarshal headers: %v", err)
+	}
+	if err := json.Unmarshal([]byte(options), &config.Options); err != nil {
+		return config, fmt.Errorf("failed to unmarshal options: %v", err)
+	}
+	if err := json.Unmarshal([]byte(labels), &config.Labels); err != nil {
+		return config, fmt.Errorf("failed to unmarshal labels: %v", err)
+	}
+	return config, nil
+}
+
+func jsonObject(m map[string]string) (string, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+// ScopedHealthChecks returns a view of the checks limited to scope.
+func (s *SQLiteStorage) ScopedHealthChecks(scope Scope) HealthCheckStorage {
+	return &SQLiteStorage{db: s.db, scope: &scope}
+}
+
+// teamCondition returns the condition on column that limits rows to the
+// scope of s, and its arguments.
+func (s *SQLiteStorage) teamCondition(column string) (string, []interface{}) {
+	return teamCondition(s.scope, column, func(int) string { return "?" }, 0)
+}
+
 func (s *SQLiteStorage) StoreHealthCheckConfig(config metrics.HealthCheckConfig) error {
-	now := time.Now()
-	_, err := s.db.Exec(
-		`INSERT OR REPLACE INTO health_check_configs 
-		(id, name, type, target, interval, timeout, enabled, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	if !inScope(s.scope, config.Team) {
+		return ErrOutOfScope
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var prev *metrics.HealthCheckConfig
+	existing, err := scanHealthCheckConfig(tx.QueryRow(
+		"SELECT "+healthCheckConfigColumns+" FROM health_check_configs WHERE id = ?", config.ID,
+	))
+	if err == nil {
+		if !inScope(s.scope, existing.Team) {
+			return ErrOutOfScope
+		}
+		prev = &existing
+	} else if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get health check config: %v", err)
+	}
+
+	config, changed := reviseHealthCheckConfig(prev, config, time.Now())
+	if !changed {
+		return nil
+	}
+
+	headers, err := jsonObject(config.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal headers: %v", err)
+	}
+	options, err := jsonObject(config.Options)
+	if err != nil {
+		return fmt.Errorf("failed to marshal options: %v", err)
+	}
+	labels, err := jsonObject(config.Labels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal labels: %v", err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO health_check_configs (`+healthCheckConfigColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name, type = excluded.type, target = excluded.target,
+			interval = excluded.interval, timeout = excluded.timeout, method = excluded.method,
+			headers = excluded.headers, body = excluded.body, expect_code = excluded.expect_code,
+			expect_body = excluded.expect_body, plugin_name = excluded.plugin_name,
+			options = excluded.options, labels = excluded.labels, team = excluded.team, enabled = excluded.enabled,
+			revision = excluded.revision, updated_at = excluded.updated_at`,
 		config.ID, config.Name, config.Type, config.Target,
-		config.Interval, config.Timeout, config.Enabled,
-		now, now,
+		config.Interval, config.Timeout, config.Method, headers, config.Body,
+		config.ExpectCode, config.ExpectBody, config.PluginName, options, labels, config.Team,
+		config.Enabled, config.Revision, config.CreatedAt, config.UpdatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to store health check config: %v", err)
 	}
-	return nil
+
+	// Configs stored before revisions were tracked have no revision row
+	// for their current state yet.
+	revisions := []metrics.HealthCheckConfig{config}
+	if prev != nil {
+		revisions = []metrics.HealthCheckConfig{*prev, config}
+	}
+	for _, revision := range revisions {
+		data, err := json.Marshal(revision)
+		if err != nil {
+			return fmt.Errorf("failed to marshal health check config: %v", err)
+		}
+		_, err = tx.Exec(
+			`INSERT OR IGNORE INTO health_check_config_revisions (config_id, revision, config, changed_at)
+			VALUES (?, ?, ?, ?)`,
+			revision.ID, revision.Revision, string(data), revision.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store health check config revision: %v", err)
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (s *SQLiteStorage) GetHealthCheckConfig(id string) (metrics.HealthCheckConfig, error) {
-	var config metrics.HealthCheckConfig
-	err := s.db.QueryRow(
-		`SELECT id, name, type, target, interval, timeout, enabled
-		FROM health_check_configs WHERE id = ?`,
-		id,
-	).Scan(
-		&config.ID, &config.Name, &config.Type, &config.Target,
-		&config.Interval, &config.Timeout, &config.Enabled,
-	)
+	team, args := s.teamCondition("team")
+	config, err := scanHealthCheckConfig(s.db.QueryRow(
+		"SELECT "+healthCheckConfigColumns+" FROM health_check_configs WHERE id = ? AND "+team,
+		append([]interface{}{id}, args...)...,
+	))
 	if err == sql.ErrNoRows {
 		return metrics.HealthCheckConfig{}, fmt.Errorf("health check config not found: %s", id)
 	}
@@ -189,9 +289,10 @@ func (s *SQLiteStorage) GetHealthCheckConfig(id string) (metrics.HealthCheckConf
 }
 
 func (s *SQLiteStorage) GetAllHealthCheckConfigs() ([]metrics.HealthCheckConfig, error) {
+	team, args := s.teamCondition("team")
 	rows, err := s.db.Query(
-		`SELECT id, name, type, target, interval, timeout, enabled
-		FROM health_check_configs ORDER BY name`,
+		"SELECT "+healthCheckConfigColumns+" FROM health_check_configs WHERE "+team+" ORDER BY name",
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query health check configs: %v", err)
@@ -200,11 +301,7 @@ func (s *SQLiteStorage) GetAllHealthCheckConfigs() ([]metrics.HealthCheckConfig,
 
 	var configs []metrics.HealthCheckConfig
 	for rows.Next() {
-		var config metrics.HealthCheckConfig
-		err := rows.Scan(
-			&config.ID, &config.Name, &config.Type, &config.Target,
-			&config.Interval, &config.Timeout, &config.Enabled,
-		)
+		config, err := scanHealthCheckConfig(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan health check config: %v", err)
 		}
@@ -213,11 +310,62 @@ func (s *SQLiteStorage) GetAllHealthCheckConfigs() ([]metrics.HealthCheckConfig,
 	return configs, nil
 }
 
+func (s *SQLiteStorage) GetHealthCheckRevisions(id string) ([]metrics.HealthCheckRevision, error) {
+	current, err := s.GetHealthCheckConfig(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(
+		`SELECT revision, config, changed_at FROM health_check_config_revisions
+		WHERE config_id = ? ORDER BY revision DESC`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health check config revisions: %v", err)
+	}
+	defer rows.Close()
+
+	var revisions []metrics.HealthCheckRevision
+	for rows.Next() {
+		var revision metrics.HealthCheckRevision
+		var data string
+		if err := rows.Scan(&revision.Revision, &data, &revision.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan health check config revision: %v", err)
+		}
+		if err := json.Unmarshal([]byte(data), &revision.Config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal health check config revision: %v", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		revisions = append(revisions, metrics.HealthCheckRevision{
+			Revision: current.Revision, ChangedAt: current.UpdatedAt, Config: current,
+		})
+	}
+	return revisions, nil
+}
+
 func (s *SQLiteStorage) DeleteHealthCheckConfig(id string) error {
-	_, err := s.db.Exec("DELETE FROM health_check_configs WHERE id = ?", id)
+	team, args := s.teamCondition("team")
+	res, err := s.db.Exec(
+		"DELETE FROM health_check_configs WHERE id = ? AND "+team,
+		append([]interface{}{id}, args...)...,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to delete health check config: %v", err)
 	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("health check config not found: %s", id)
+	}
+	_, err = s.db.Exec("DELETE FROM health_check_config_revisions WHERE config_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete health check config revisions: %v", err)
+	}
 	return nil
 }
 
@@ -228,12 +376,27 @@ func (s *SQLiteStorage) StoreHealthCheckResult(result metrics.HealthCheckResult)
 	}
 	defer tx.Rollback()
 
+	if s.scope != nil {
+		team, args := s.teamCondition("team")
+		var n int
+		err := tx.QueryRow(
+			"SELECT COUNT(*) FROM health_check_configs WHERE id = ? AND "+team,
+			append([]interface{}{result.ID}, args...)...,
+		).Scan(&n)
+		if err != nil {
+			return fmt.Errorf("failed to get health check config: %v", err)
+		}
+		if n == 0 {
+			return ErrOutOfScope
+		}
+	}
+
 	// Update or insert the latest result
 	_, err = tx.Exec(
 		`INSERT OR REPLACE INTO health_check_results 
 		(id, config_id, status, response_time, message, last_checked)
 		VALUES (?, ?, ?, ?, ?, ?)`,
-		result.ID, result.Name, result.Status,
+		result.ID, result.ID, result.Status,
 		result.ResponseTime, result.Message, result.LastChecked,
 	)
 	if err != nil {
@@ -245,7 +408,7 @@ func (s *SQLiteStorage) StoreHealthCheckResult(result metrics.HealthCheckResult)
 		`INSERT INTO health_check_history 
 		(config_id, timestamp, status, response_time, message)
 		VALUES (?, ?, ?, ?, ?)`,
-		result.Name, result.LastChecked, result.Status,
+		result.ID, result.LastChecked, result.Status,
 		result.ResponseTime, result.Message,
 	)
 	if err != nil {
@@ -260,7 +423,7 @@ func (s *SQLiteStorage) StoreHealthCheckResult(result metrics.HealthCheckResult)
 			WHERE config_id = ? 
 			ORDER BY timestamp DESC LIMIT 100
 		)`,
-		result.Name, result.Name,
+		result.ID, result.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to clean up old history: %v", err)
@@ -275,12 +438,16 @@ func (s *SQLiteStorage) StoreHealthCheckResult(result metrics.HealthCheckResult)
 
 func (s *SQLiteStorage) GetHealthCheckResult(id string) (metrics.HealthCheckResult, error) {
 	var result metrics.HealthCheckResult
+	team, args := s.teamCondition("c.team")
 	err := s.db.QueryRow(
-		`SELECT id, config_id, status, response_time, message, last_checked
-		FROM health_check_results WHERE id = ?`,
-		id,
+		`SELECT r.id, COALESCE(c.name, r.config_id), COALESCE(c.type, ''), COALESCE(c.target, ''),
+			r.status, r.response_time, r.message, r.last_checked
+		FROM health_check_results r
+		LEFT JOIN health_check_configs c ON c.id = r.config_id
+		WHERE r.id = ? AND `+team,
+		append([]interface{}{id}, args...)...,
 	).Scan(
-		&result.ID, &result.Name, &result.Status,
+		&result.ID, &result.Name, &result.Type, &result.Target, &result.Status,
 		&result.ResponseTime, &result.Message, &result.LastChecked,
 	)
 	if err == sql.ErrNoRows {
@@ -297,7 +464,7 @@ func (s *SQLiteStorage) GetHealthCheckResult(id string) (metrics.HealthCheckResu
 		WHERE config_id = ?
 		ORDER BY timestamp DESC
 		LIMIT 100`,
-		result.Name,
+		result.ID,
 	)
 	if err != nil {
 		return metrics.HealthCheckResult{}, fmt.Errorf("failed to query health check history: %v", err)
@@ -320,10 +487,15 @@ func (s *SQLiteStorage) GetHealthCheckResult(id string) (metrics.HealthCheckResu
 }
 
 func (s *SQLiteStorage) GetAllHealthCheckResults() ([]metrics.HealthCheckResult, error) {
+	team, args := s.teamCondition("c.team")
 	rows, err := s.db.Query(
-		`SELECT id, config_id, status, response_time, message, last_checked
-		FROM health_check_results
-		ORDER BY last_checked DESC`,
+		`SELECT r.id, COALESCE(c.name, r.config_id), COALESCE(c.type, ''), COALESCE(c.target, ''),
+			r.status, r.response_time, r.message, r.last_checked
+		FROM health_check_results r
+		LEFT JOIN health_check_configs c ON c.id = r.config_id
+		WHERE `+team+`
+		ORDER BY r.last_checked DESC`,
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query health check results: %v", err)
@@ -334,7 +506,7 @@ func (s *SQLiteStorage) GetAllHealthCheckResults() ([]metrics.HealthCheckResult,
 	for rows.Next() {
 		var result metrics.HealthCheckResult
 		err := rows.Scan(
-			&result.ID, &result.Name, &result.Status,
+			&result.ID, &result.Name, &result.Type, &result.Target, &result.Status,
 			&result.ResponseTime, &result.Message, &result.LastChecked,
 		)
 		if err != nil {
@@ -348,7 +520,7 @@ func (s *SQLiteStorage) GetAllHealthCheckResults() ([]metrics.HealthCheckResult,
 			WHERE config_id = ?
 			ORDER BY timestamp DESC
 			LIMIT 100`,
-			result.Name,
+			result.ID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to query health check history: %v", err)
@@ -380,6 +552,12 @@ func (s *SQLiteStorage) GetHealthCheckHistory(id string, duration time.Duration)
 		WHERE config_id = ?`
 	args := []interface{}{id}
 
+	if s.scope != nil {
+		team, teamArgs := s.teamCondition("team")
+		query += ` AND config_id IN (SELECT id FROM health_check_configs WHERE ` + team + `)`
+		args = append(args, teamArgs...)
+	}
+
 	if duration > 0 {
 		query += ` AND timestamp > datetime('now', ?)`
 		args = append(args, fmt.Sprintf("-%d seconds", int(duration.Seconds())))
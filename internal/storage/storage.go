@@ -2,6 +2,8 @@ package storage
 
 import (
 	"fmt"
+	"maps"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,6 +14,7 @@ type MetricStorage interface {
 	StoreMetrics(metrics metrics.SystemMetrics) error
 	GetLatestMetrics() (metrics.SystemMetrics, error)
 	GetMetricsHistory(duration time.Duration) ([]metrics.SystemMetrics, error)
+	GetMetricsRange(from, to time.Time) ([]metrics.SystemMetrics, error)
 }
 
 type HealthCheckStorage interface {
@@ -19,6 +22,8 @@ type HealthCheckStorage interface {
 	GetHealthCheckConfig(id string) (metrics.HealthCheckConfig, error)
 	GetAllHealthCheckConfigs() ([]metrics.HealthCheckConfig, error)
 	DeleteHealthCheckConfig(id string) error
+	// GetHealthCheckRevisions returns the stored revisions of a config, newest first.
+	GetHealthCheckRevisions(id string) ([]metrics.HealthCheckRevision, error)
 	StoreHealthCheckResult(result metrics.HealthCheckResult) error
 	GetHealthCheckResult(id string) (metrics.HealthCheckResult, error)
 	GetAllHealthCheckResults() ([]metrics.HealthCheckResult, error)
@@ -26,25 +31,31 @@ type HealthCheckStorage interface {
 }
 
 type MemoryStorage struct {
-	mu             sync.RWMutex
+	mu             *sync.RWMutex
 	latestMetrics  metrics.SystemMetrics
 	metricsHistory []metrics.SystemMetrics
 	maxHistory     int
 
-	healthCheckConfigs map[string]metrics.HealthCheckConfig
-	healthCheckResults map[string]metrics.HealthCheckResult
-	healthCheckHistory map[string][]metrics.HealthCheckHistoryEntry
-	maxCheckHistory    int
+	healthCheckConfigs   map[string]metrics.HealthCheckConfig
+	healthCheckRevisions map[string][]metrics.HealthCheckRevision
+	healthCheckResults   map[string]metrics.HealthCheckResult
+	healthCheckHistory   map[string][]metrics.HealthCheckHistoryEntry
+	maxCheckHistory      int
+
+	// scope limits the checks of a view made by ScopedHealthChecks
+	scope *Scope
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		metricsHistory:     make([]metrics.SystemMetrics, 0, 1000),
-		maxHistory:         1000,
-		healthCheckConfigs: make(map[string]metrics.HealthCheckConfig),
-		healthCheckResults: make(map[string]metrics.HealthCheckResult),
-		healthCheckHistory: make(map[string][]metrics.HealthCheckHistoryEntry),
-		maxCheckHistory:    100,
+		mu:                   new(sync.RWMutex),
+		metricsHistory:       make([]metrics.SystemMetrics, 0, 1000),
+		maxHistory:           1000,
+		healthCheckConfigs:   make(map[string]metrics.HealthCheckConfig),
+		healthCheckRevisions: make(map[string][]metrics.HealthCheckRevision),
+		healthCheckResults:   make(map[string]metrics.HealthCheckResult),
+		healthCheckHistory:   make(map[string][]metrics.HealthCheckHistoryEntry),
+		maxCheckHistory:      100,
 	}
 }
 
@@ -80,21 +91,86 @@ func (s *MemoryStorage) GetMetricsHistory(duration time.Duration) ([]metrics.Sys
 	cutoffTime := time.Now().Add(-duration)
 	var result []metrics.SystemMetrics
 
+	// Newest first, matching SQLiteStorage.
 	for i := len(s.metricsHistory) - 1; i >= 0; i-- {
 		if s.metricsHistory[i].Timestamp.Before(cutoffTime) {
 			break
 		}
-		result = append([]metrics.SystemMetrics{s.metricsHistory[i]}, result...)
+		result = append(result, s.metricsHistory[i])
+	}
+
+	return result, nil
+}
+
+func (s *MemoryStorage) GetMetricsRange(from, to time.Time) ([]metrics.SystemMetrics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []metrics.SystemMetrics
+	for _, m := range s.metricsHistory {
+		if m.Timestamp.Before(from) || m.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, m)
 	}
 
 	return result, nil
 }
 
+// ScopedHealthChecks returns a view of the checks limited to scope.
+func (s *MemoryStorage) ScopedHealthChecks(scope Scope) HealthCheckStorage {
+	return &MemoryStorage{
+		mu:                   s.mu,
+		healthCheckConfigs:   s.healthCheckConfigs,
+		healthCheckRevisions: s.healthCheckRevisions,
+		healthCheckResults:   s.healthCheckResults,
+		healthCheckHistory:   s.healthCheckHistory,
+		maxCheckHistory:      s.maxCheckHistory,
+		scope:                &scope,
+	}
+}
+
+// visible reports whether the check id is in the scope of s. Without a
+// scope every check is, whether or not it has a config.
+func (s *MemoryStorage) visible(id string) bool {
+	if s.scope == nil {
+		return true
+	}
+	config, ok := s.healthCheckConfigs[id]
+	return ok && s.scope.Allows(config.Team)
+}
+
 func (s *MemoryStorage) StoreHealthCheckConfig(config metrics.HealthCheckConfig) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if !inScope(s.scope, config.Team) {
+		return ErrOutOfScope
+	}
+	var prev *metrics.HealthCheckConfig
+	if existing, ok := s.healthCheckConfigs[config.ID]; ok {
+		if !inScope(s.scope, existing.Team) {
+			return ErrOutOfScope
+		}
+		prev = &existing
+	}
+
+	// Callers may keep modifying their maps.
+	config.Headers = maps.Clone(config.Headers)
+	config.Options = maps.Clone(config.Options)
+	config.Labels = maps.Clone(config.Labels)
+
+	config, changed := reviseHealthCheckConfig(prev, config, time.Now())
+	if !changed {
+		return nil
+	}
+
 	s.healthCheckConfigs[config.ID] = config
+	s.healthCheckRevisions[config.ID] = append(s.healthCheckRevisions[config.ID], metrics.HealthCheckRevision{
+		Revision:  config.Revision,
+		ChangedAt: config.UpdatedAt,
+		Config:    config,
+	})
 	return nil
 }
 
@@ -103,41 +179,67 @@ func (s *MemoryStorage) GetHealthCheckConfig(id string) (metrics.HealthCheckConf
 	defer s.mu.RUnlock()
 
 	config, exists := s.healthCheckConfigs[id]
-	if !exists {
+	if !exists || !inScope(s.scope, config.Team) {
 		return metrics.HealthCheckConfig{}, fmt.Errorf("health check config not found: %s", id)
 	}
 
 	return config, nil
 }
 
-func (s *MemoryStorage) GetAllHealthCheckConfigs() []metrics.HealthCheckConfig {
+func (s *MemoryStorage) GetAllHealthCheckConfigs() ([]metrics.HealthCheckConfig, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	configs := make([]metrics.HealthCheckConfig, 0, len(s.healthCheckConfigs))
 	for _, config := range s.healthCheckConfigs {
-		configs = append(configs, config)
+		if inScope(s.scope, config.Team) {
+			configs = append(configs, config)
+		}
 	}
 
-	return configs
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Name < configs[j].Name
+	})
+
+	return configs, nil
 }
 
 func (s *MemoryStorage) DeleteHealthCheckConfig(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.healthCheckConfigs[id]; !exists {
+	if config, exists := s.healthCheckConfigs[id]; !exists || !inScope(s.scope, config.Team) {
 		return fmt.Errorf("health check config not found: %s", id)
 	}
 
 	delete(s.healthCheckConfigs, id)
+	delete(s.healthCheckRevisions, id)
 	return nil
 }
 
+func (s *MemoryStorage) GetHealthCheckRevisions(id string) ([]metrics.HealthCheckRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if config, exists := s.healthCheckConfigs[id]; !exists || !inScope(s.scope, config.Team) {
+		return nil, fmt.Errorf("health check config not found: %s", id)
+	}
+
+	stored := s.healthCheckRevisions[id]
+	revisions := make([]metrics.HealthCheckRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, stored[i])
+	}
+	return revisions, nil
+}
+
 func (s *MemoryStorage) StoreHealthCheckResult(result metrics.HealthCheckResult) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if !s.visible(result.ID) {
+		return ErrOutOfScope
+	}
 	s.healthCheckResults[result.ID] = result
 
 	historyEntry := metrics.HealthCheckHistoryEntry{
@@ -168,7 +270,7 @@ func (s *MemoryStorage) GetHealthCheckResult(id string) (metrics.HealthCheckResu
 	defer s.mu.RUnlock()
 
 	result, exists := s.healthCheckResults[id]
-	if !exists {
+	if !exists || !s.visible(id) {
 		return metrics.HealthCheckResult{}, fmt.Errorf("health check result not found: %s", id)
 	}
 
@@ -183,10 +285,17 @@ func (s *MemoryStorage) GetAllHealthCheckResults() ([]metrics.HealthCheckResult,
 
 	results := make([]metrics.HealthCheckResult, 0, len(s.healthCheckResults))
 	for id, result := range s.healthCheckResults {
+		if !s.visible(id) {
+			continue
+		}
 		result.History = s.healthCheckHistory[id]
 		results = append(results, result)
 	}
 
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].LastChecked.After(results[j].LastChecked)
+	})
+
 	return results, nil
 }
 
@@ -195,7 +304,7 @@ func (s *MemoryStorage) GetHealthCheckHistory(id string, duration time.Duration)
 	defer s.mu.RUnlock()
 
 	history, exists := s.healthCheckHistory[id]
-	if !exists {
+	if !exists || !s.visible(id) {
 		return []metrics.HealthCheckHistoryEntry{}, nil
 	}
 
@@ -214,3 +323,7 @@ func (s *MemoryStorage) GetHealthCheckHistory(id string, duration time.Duration)
 
 	return result, nil
 }
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package storage_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"Golem/internal/storage"
+	"Golem/internal/storage/storagetest"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	storagetest.TestBackend(t, func() (storage.Backend, error) {
+		return storage.Open("memory", "")
+	})
+}
+
+func TestSQLiteBackend(t *testing.T) {
+	n := 0
+	storagetest.TestBackend(t, func() (storage.Backend, error) {
+		n++
+		return storage.Open("sqlite", filepath.Join(t.TempDir(), fmt.Sprintf("golem-%d.db", n)))
+	})
+}
+
+// TestPostgresBackend runs against the server in GOLEM_TEST_POSTGRES_DSN,
+// giving every check a schema of its own that is dropped afterwards.
+func TestPostgresBackend(t *testing.T) {
+	dsn := os.Getenv("GOLEM_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("GOLEM_TEST_POSTGRES_DSN is not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	n := 0
+	storagetest.TestBackend(t, func() (storage.Backend, error) {
+		n++
+		schema := fmt.Sprintf("golem_test_%d_%d", time.Now().UnixNano(), n)
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			return nil, err
+		}
+		t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+		return storage.Open("postgres", withSearchPath(dsn, schema))
+	})
+}
+
+// withSearchPath adds a search_path to a URL or key=value DSN
+func withSearchPath(dsn, schema string) string {
+	if strings.Contains(dsn, "://") {
+		if strings.Contains(dsn, "?") {
+			return dsn + "&search_path=" + schema
+		}
+		return dsn + "?search_path=" + schema
+	}
+	return dsn + " search_path=" + schema
+}
+
+func openSQLiteMetrics(dir string) (storage.MetricStorage, error) {
+	return storage.NewSQLiteStorage(filepath.Join(dir, "golem.db"))
+}
+
+func BenchmarkSQLiteWrite(b *testing.B) {
+	storagetest.BenchmarkWrite(b, openSQLiteMetrics)
+}
+
+func BenchmarkSQLiteRangeQuery(b *testing.B) {
+	storagetest.BenchmarkRangeQuery(b, 3600, openSQLiteMetrics)
+}
@@ -0,0 +1,144 @@
+package storagetest
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"Golem/internal/metrics"
+	"Golem/internal/storage"
+)
+
+// BenchmarkWrite measures StoreMetrics of snapshots shaped like a small
+// server, against an engine opened in an empty directory. Typical use from
+// a backend's tests:
+//
+//	func BenchmarkWrite(b *testing.B) {
+//		storagetest.BenchmarkWrite(b, func(dir string) (storage.MetricStorage, error) {
+//			return storage.NewSQLiteStorage(filepath.Join(dir, "golem.db"))
+//		})
+//	}
+func BenchmarkWrite(b *testing.B, open func(dir string) (storage.MetricStorage, error)) {
+	s, err := open(b.TempDir())
+	if err != nil {
+		b.Fatalf("open: %v", err)
+	}
+	defer closeTested(b, s)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.StoreMetrics(benchSnapshot(start.Add(time.Duration(i)*time.Millisecond), i)); err != nil {
+			b.Fatalf("StoreMetrics: %v", err)
+		}
+	}
+}
+
+// BenchmarkRangeQuery measures reading back the given number of
+// one-second-apart snapshots with GetMetricsRange. It reports the bytes the
+// engine uses on disk after loading them as disk-bytes.
+func BenchmarkRangeQuery(b *testing.B, snapshots int, open func(dir string) (storage.MetricStorage, error)) {
+	dir := b.TempDir()
+	s, err := open(dir)
+	if err != nil {
+		b.Fatalf("open: %v", err)
+	}
+	defer closeTested(b, s)
+
+	start := time.Now().Add(-time.Duration(snapshots) * time.Second).Truncate(time.Second)
+	for i := 0; i < snapshots; i++ {
+		if err := s.StoreMetrics(benchSnapshot(start.Add(time.Duration(i)*time.Second), i)); err != nil {
+			b.Fatalf("StoreMetrics: %v", err)
+		}
+	}
+	size, err := dirSize(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	end := start.Add(time.Duration(snapshots) * time.Second)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		got, err := s.GetMetricsRange(start, end)
+		if err != nil {
+			b.Fatalf("GetMetricsRange: %v", err)
+		}
+		if len(got) != snapshots {
+			b.Fatalf("expected %d snapshots, got %d", snapshots, len(got))
+		}
+	}
+	b.ReportMetric(float64(size), "disk-bytes")
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// benchSnapshot returns a snapshot shaped like a small server: 8 cores, 3
+// filesystems, 2 disks and 3 network interfaces with slowly moving values.
+func benchSnapshot(t time.Time, i int) metrics.SystemMetrics {
+	m := metrics.SystemMetrics{
+		Timestamp: t,
+		CPU: metrics.CPUMetrics{
+			TotalUsage:   float64(20 + i%7),
+			PerCoreUsage: make(map[string]float64),
+			LoadAverage:  [3]float64{0.5, 0.4, 0.3},
+		},
+		Memory: metrics.MemoryMetrics{
+			Total:       16 << 30,
+			Used:        uint64(6<<30 + i%100*4096),
+			Free:        uint64(10<<30 - i%100*4096),
+			UsedPercent: 37.5,
+		},
+		Disk: metrics.DiskMetrics{
+			IOCounters: make(map[string]metrics.DiskIO),
+			IORates:    make(map[string]metrics.DiskIORate),
+		},
+		Network: metrics.NetworkMetrics{
+			Interfaces: make(map[string]metrics.NetworkInterface),
+			Rates:      make(map[string]metrics.NetworkInterfaceRate),
+		},
+		Uptime: metrics.UptimeMetrics{Uptime: float64(i), BootTime: 1700000000},
+	}
+
+	for core := 0; core < 8; core++ {
+		m.CPU.PerCoreUsage[strconv.Itoa(core)] = float64((i + core) % 100)
+	}
+	for _, mp := range []string{"/", "/home", "/var"} {
+		m.Disk.Partitions = append(m.Disk.Partitions, metrics.DiskPartition{
+			Device: "/dev/sda" + strconv.Itoa(len(m.Disk.Partitions)+1), Mountpoint: mp,
+			Total: 100 << 30, Used: 40 << 30, Free: 60 << 30, UsedPercent: 40,
+		})
+	}
+	for _, dev := range []string{"sda", "sdb"} {
+		m.Disk.IOCounters[dev] = metrics.DiskIO{
+			ReadCount: uint64(i * 10), WriteCount: uint64(i * 20),
+			ReadBytes: uint64(i * 40960), WriteBytes: uint64(i * 81920), IoTime: uint64(i * 3),
+		}
+		m.Disk.IORates[dev] = metrics.DiskIORate{ReadBytesPerSec: 40960, WriteBytesPerSec: 81920, ReadIOPS: 10, WriteIOPS: 20}
+	}
+	for _, iface := range []string{"lo", "eth0", "eth1"} {
+		m.Network.Interfaces[iface] = metrics.NetworkInterface{
+			BytesSent: uint64(i * 1500), BytesRecv: uint64(i * 3000),
+			PacketsSent: uint64(i), PacketsRecv: uint64(i * 2),
+		}
+		m.Network.Rates[iface] = metrics.NetworkInterfaceRate{BytesSentPerSec: 1500, BytesRecvPerSec: 3000}
+	}
+	return m
+}
@@ -0,0 +1,548 @@
+// Package storagetest implements a conformance suite for storage backends.
+//
+// Every backend registered with storage.Register is expected to pass
+// TestBackend. Typical use from a backend's tests:
+//
+//	storagetest.TestBackend(t, func() (storage.Backend, error) {
+//		return storage.Open("sqlite", filepath.Join(t.TempDir(), "golem.db"))
+//	})
+package storagetest
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"Golem/internal/metrics"
+	"Golem/internal/storage"
+)
+
+var metricTests = []struct {
+	name string
+	run  func(t *testing.T, s storage.MetricStorage)
+}{
+	{"LatestMetricsEmpty", testLatestMetricsEmpty},
+	{"StoreAndGetLatestMetrics", testStoreAndGetLatestMetrics},
+	{"MetricsHistoryNewestFirst", testMetricsHistory},
+	{"MetricsRange", testMetricsRange},
+}
+
+var backendTests = []struct {
+	name string
+	run  func(t *testing.T, b storage.Backend)
+}{
+	{"HealthCheckConfigRoundTrip", testHealthCheckConfigRoundTrip},
+	{"HealthCheckConfigUpdate", testHealthCheckConfigUpdate},
+	{"HealthCheckConfigRevisions", testHealthCheckConfigRevisions},
+	{"HealthCheckConfigsSortedByName", testHealthCheckConfigsSorted},
+	{"HealthCheckConfigNotFound", testHealthCheckConfigNotFound},
+	{"DeleteHealthCheckConfig", testDeleteHealthCheckConfig},
+	{"HealthCheckResultAndHistory", testHealthCheckResult},
+	{"HealthCheckHistoryDuration", testHealthCheckHistoryDuration},
+	{"AllHealthCheckResults", testAllHealthCheckResults},
+	{"TeamScope", testTeamScope},
+}
+
+// TestBackend runs every conformance test as a subtest of t, each against a
+// fresh backend obtained from open.
+func TestBackend(t *testing.T, open func() (storage.Backend, error)) {
+	TestMetricStorage(t, func() (storage.MetricStorage, error) { return open() })
+	for _, tt := range backendTests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := open()
+			if err != nil {
+				t.Fatalf("open backend: %v", err)
+			}
+			defer closeTested(t, b)
+			tt.run(t, b)
+		})
+	}
+}
+
+// TestMetricStorage runs only the metric tests, for engines such as
+// tsdb.DB that store metrics but not health checks. The storage is closed
+// after each test if it implements io.Closer.
+func TestMetricStorage(t *testing.T, open func() (storage.MetricStorage, error)) {
+	for _, tt := range metricTests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := open()
+			if err != nil {
+				t.Fatalf("open storage: %v", err)
+			}
+			defer closeTested(t, s)
+			tt.run(t, s)
+		})
+	}
+}
+
+func closeTested(t testing.TB, s interface{}) {
+	t.Helper()
+	if closer, ok := s.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	}
+}
+
+func snapshot(t time.Time, usedPercent float64) metrics.SystemMetrics {
+	return metrics.SystemMetrics{
+		Timestamp: t,
+		Memory:    metrics.MemoryMetrics{UsedPercent: usedPercent},
+		Disk: metrics.DiskMetrics{
+			IOCounters: map[string]metrics.DiskIO{"sda": {ReadBytes: 42}},
+		},
+	}
+}
+
+func testLatestMetricsEmpty(t *testing.T, b storage.MetricStorage) {
+	m, err := b.GetLatestMetrics()
+	if err != nil {
+		t.Fatalf("GetLatestMetrics on empty backend: %v", err)
+	}
+	if !m.Timestamp.IsZero() {
+		t.Errorf("expected zero snapshot, got timestamp %v", m.Timestamp)
+	}
+}
+
+func testStoreAndGetLatestMetrics(t *testing.T, b storage.MetricStorage) {
+	now := time.Now().Truncate(time.Millisecond)
+	for i := 3; i >= 1; i-- {
+		if err := b.StoreMetrics(snapshot(now.Add(-time.Duration(i)*time.Second), float64(i))); err != nil {
+			t.Fatalf("StoreMetrics: %v", err)
+		}
+	}
+
+	m, err := b.GetLatestMetrics()
+	if err != nil {
+		t.Fatalf("GetLatestMetrics: %v", err)
+	}
+	if m.Memory.UsedPercent != 1 {
+		t.Errorf("expected latest snapshot with used_percent 1, got %v", m.Memory.UsedPercent)
+	}
+	if m.Disk.IOCounters["sda"].ReadBytes != 42 {
+		t.Errorf("nested fields did not round-trip: %+v", m.Disk.IOCounters)
+	}
+}
+
+func testMetricsHistory(t *testing.T, b storage.MetricStorage) {
+	now := time.Now()
+	for i := 3; i >= 1; i-- {
+		if err := b.StoreMetrics(snapshot(now.Add(-time.Duration(i)*time.Minute), float64(i))); err != nil {
+			t.Fatalf("StoreMetrics: %v", err)
+		}
+	}
+
+	history, err := b.GetMetricsHistory(150 * time.Second)
+	if err != nil {
+		t.Fatalf("GetMetricsHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 snapshots within 150s, got %d", len(history))
+	}
+	if history[0].Memory.UsedPercent != 1 || history[1].Memory.UsedPercent != 2 {
+		t.Errorf("expected newest first, got %v then %v", history[0].Memory.UsedPercent, history[1].Memory.UsedPercent)
+	}
+}
+
+func testMetricsRange(t *testing.T, b storage.MetricStorage) {
+	now := time.Now()
+	for i := 5; i >= 1; i-- {
+		if err := b.StoreMetrics(snapshot(now.Add(-time.Duration(i)*time.Minute), float64(i))); err != nil {
+			t.Fatalf("StoreMetrics: %v", err)
+		}
+	}
+
+	result, err := b.GetMetricsRange(now.Add(-270*time.Second), now.Add(-90*time.Second))
+	if err != nil {
+		t.Fatalf("GetMetricsRange: %v", err)
+	}
+	if len(result) != 3 {
+		t.Fatalf("expected 3 snapshots in range, got %d", len(result))
+	}
+	for i, want := range []float64{4, 3, 2} {
+		if result[i].Memory.UsedPercent != want {
+			t.Errorf("expected oldest first, snapshot %d has used_percent %v, want %v", i, result[i].Memory.UsedPercent, want)
+		}
+	}
+}
+
+func config(id, name string) metrics.HealthCheckConfig {
+	return metrics.HealthCheckConfig{
+		ID:       id,
+		Name:     name,
+		Type:     metrics.HTTPCheck,
+		Target:   "http://example.com/" + id,
+		Interval: 30 * time.Second,
+		Timeout:  5 * time.Second,
+		Enabled:  true,
+	}
+}
+
+func testHealthCheckConfigRoundTrip(t *testing.T, b storage.Backend) {
+	want := config("c1", "alpha")
+	want.Method = "POST"
+	want.Headers = map[string]string{"Authorization": "Bearer token", "X-Trace": "1"}
+	want.Body = `{"ping":true}`
+	want.ExpectCode = 202
+	want.ExpectBody = "pong"
+	want.PluginName = "custom"
+	want.Options = map[string]string{"region": "eu"}
+	want.Labels = map[string]string{"env": "prod", "team": "payments"}
+	want.Team = "payments"
+	if err := b.StoreHealthCheckConfig(want); err != nil {
+		t.Fatalf("StoreHealthCheckConfig: %v", err)
+	}
+
+	got, err := b.GetHealthCheckConfig("c1")
+	if err != nil {
+		t.Fatalf("GetHealthCheckConfig: %v", err)
+	}
+	if got.ID != want.ID || got.Name != want.Name || got.Type != want.Type || got.Target != want.Target ||
+		got.Interval != want.Interval || got.Timeout != want.Timeout || got.Enabled != want.Enabled ||
+		got.Method != want.Method || got.Body != want.Body || got.ExpectCode != want.ExpectCode ||
+		got.ExpectBody != want.ExpectBody || got.PluginName != want.PluginName || got.Team != want.Team ||
+		!maps.Equal(got.Headers, want.Headers) || !maps.Equal(got.Options, want.Options) || !maps.Equal(got.Labels, want.Labels) {
+		t.Errorf("config did not round-trip: got %+v, want %+v", got, want)
+	}
+	if got.Revision != 1 {
+		t.Errorf("expected a new config to be revision 1, got %d", got.Revision)
+	}
+}
+
+func testHealthCheckConfigUpdate(t *testing.T, b storage.Backend) {
+	c := config("c1", "alpha")
+	if err := b.StoreHealthCheckConfig(c); err != nil {
+		t.Fatalf("StoreHealthCheckConfig: %v", err)
+	}
+
+	c.Target = "http://example.com/changed"
+	c.Enabled = false
+	if err := b.StoreHealthCheckConfig(c); err != nil {
+		t.Fatalf("StoreHealthCheckConfig update: %v", err)
+	}
+
+	configs, err := b.GetAllHealthCheckConfigs()
+	if err != nil {
+		t.Fatalf("GetAllHealthCheckConfigs: %v", err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("expected update to replace the config, got %d configs", len(configs))
+	}
+	if configs[0].Target != c.Target || configs[0].Enabled {
+		t.Errorf("update not applied: %+v", configs[0])
+	}
+}
+
+func testHealthCheckConfigRevisions(t *testing.T, b storage.Backend) {
+	c := config("c1", "alpha")
+	c.CreatedAt = time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := b.StoreHealthCheckConfig(c); err != nil {
+		t.Fatalf("StoreHealthCheckConfig: %v", err)
+	}
+
+	// Storing identical content must not create a revision.
+	if err := b.StoreHealthCheckConfig(c); err != nil {
+		t.Fatalf("StoreHealthCheckConfig unchanged: %v", err)
+	}
+
+	update := c
+	update.CreatedAt = time.Now()
+	update.Timeout = 7 * time.Second
+	if err := b.StoreHealthCheckConfig(update); err != nil {
+		t.Fatalf("StoreHealthCheckConfig update: %v", err)
+	}
+
+	got, err := b.GetHealthCheckConfig("c1")
+	if err != nil {
+		t.Fatalf("GetHealthCheckConfig: %v", err)
+	}
+	if got.Revision != 2 {
+		t.Errorf("expected revision 2 after one change, got %d", got.Revision)
+	}
+	if !got.CreatedAt.Equal(c.CreatedAt) {
+		t.Errorf("created_at changed on update: got %v, want %v", got.CreatedAt, c.CreatedAt)
+	}
+
+	revisions, err := b.GetHealthCheckRevisions("c1")
+	if err != nil {
+		t.Fatalf("GetHealthCheckRevisions: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(revisions))
+	}
+	if revisions[0].Revision != 2 || revisions[1].Revision != 1 {
+		t.Errorf("expected revisions newest first, got %d, %d", revisions[0].Revision, revisions[1].Revision)
+	}
+	if revisions[0].Config.Timeout != update.Timeout || revisions[1].Config.Timeout != c.Timeout {
+		t.Errorf("revision snapshots do not match the stored configs")
+	}
+
+	if _, err := b.GetHealthCheckRevisions("missing"); err == nil {
+		t.Errorf("expected an error for revisions of a missing config")
+	}
+}
+
+func testHealthCheckConfigsSorted(t *testing.T, b storage.Backend) {
+	for _, c := range []metrics.HealthCheckConfig{config("c1", "charlie"), config("c2", "alpha"), config("c3", "bravo")} {
+		if err := b.StoreHealthCheckConfig(c); err != nil {
+			t.Fatalf("StoreHealthCheckConfig: %v", err)
+		}
+	}
+
+	configs, err := b.GetAllHealthCheckConfigs()
+	if err != nil {
+		t.Fatalf("GetAllHealthCheckConfigs: %v", err)
+	}
+	if len(configs) != 3 {
+		t.Fatalf("expected 3 configs, got %d", len(configs))
+	}
+	for i, want := range []string{"alpha", "bravo", "charlie"} {
+		if configs[i].Name != want {
+			t.Errorf("expected configs sorted by name, position %d is %q, want %q", i, configs[i].Name, want)
+		}
+	}
+}
+
+func testHealthCheckConfigNotFound(t *testing.T, b storage.Backend) {
+	if _, err := b.GetHealthCheckConfig("missing"); err == nil {
+		t.Errorf("expected an error for a missing config")
+	}
+	if _, err := b.GetHealthCheckResult("missing"); err == nil {
+		t.Errorf("expected an error for a missing result")
+	}
+}
+
+func testDeleteHealthCheckConfig(t *testing.T, b storage.Backend) {
+	if err := b.StoreHealthCheckConfig(config("c1", "alpha")); err != nil {
+		t.Fatalf("StoreHealthCheckConfig: %v", err)
+	}
+	if err := b.DeleteHealthCheckConfig("c1"); err != nil {
+		t.Fatalf("DeleteHealthCheckConfig: %v", err)
+	}
+	if _, err := b.GetHealthCheckConfig("c1"); err == nil {
+		t.Errorf("config still present after delete")
+	}
+}
+
+func result(c metrics.HealthCheckConfig, status metrics.HealthCheckStatus, at time.Time) metrics.HealthCheckResult {
+	return metrics.HealthCheckResult{
+		ID:           c.ID,
+		Name:         c.Name,
+		Type:         c.Type,
+		Target:       c.Target,
+		Status:       status,
+		ResponseTime: 120 * time.Millisecond,
+		Message:      string(status),
+		LastChecked:  at,
+	}
+}
+
+func testHealthCheckResult(t *testing.T, b storage.Backend) {
+	c := config("c1", "alpha")
+	if err := b.StoreHealthCheckConfig(c); err != nil {
+		t.Fatalf("StoreHealthCheckConfig: %v", err)
+	}
+
+	now := time.Now()
+	for i, status := range []metrics.HealthCheckStatus{metrics.StatusUp, metrics.StatusDown, metrics.StatusWarning} {
+		if err := b.StoreHealthCheckResult(result(c, status, now.Add(time.Duration(i-3)*time.Second))); err != nil {
+			t.Fatalf("StoreHealthCheckResult: %v", err)
+		}
+	}
+
+	got, err := b.GetHealthCheckResult("c1")
+	if err != nil {
+		t.Fatalf("GetHealthCheckResult: %v", err)
+	}
+	if got.ID != "c1" || got.Name != "alpha" {
+		t.Errorf("expected result for c1/alpha, got %s/%s", got.ID, got.Name)
+	}
+	if got.Status != metrics.StatusWarning {
+		t.Errorf("expected latest status warning, got %s", got.Status)
+	}
+	if got.ResponseTime != 120*time.Millisecond {
+		t.Errorf("response time did not round-trip: %v", got.ResponseTime)
+	}
+	if len(got.History) != 3 {
+		t.Fatalf("expected 3 history entries, got %d", len(got.History))
+	}
+	if got.History[0].Status != metrics.StatusWarning || got.History[2].Status != metrics.StatusUp {
+		t.Errorf("expected history newest first, got %s ... %s", got.History[0].Status, got.History[2].Status)
+	}
+
+	history, err := b.GetHealthCheckHistory("c1", 0)
+	if err != nil {
+		t.Fatalf("GetHealthCheckHistory: %v", err)
+	}
+	if len(history) != 3 {
+		t.Errorf("expected GetHealthCheckHistory to return 3 entries by check ID, got %d", len(history))
+	}
+}
+
+func testHealthCheckHistoryDuration(t *testing.T, b storage.Backend) {
+	c := config("c1", "alpha")
+	if err := b.StoreHealthCheckConfig(c); err != nil {
+		t.Fatalf("StoreHealthCheckConfig: %v", err)
+	}
+
+	now := time.Now()
+	for _, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, 10 * time.Minute} {
+		if err := b.StoreHealthCheckResult(result(c, metrics.StatusUp, now.Add(-age))); err != nil {
+			t.Fatalf("StoreHealthCheckResult: %v", err)
+		}
+	}
+
+	history, err := b.GetHealthCheckHistory("c1", time.Hour)
+	if err != nil {
+		t.Fatalf("GetHealthCheckHistory: %v", err)
+	}
+	if len(history) != 1 {
+		t.Errorf("expected 1 entry within the last hour, got %d", len(history))
+	}
+}
+
+func testAllHealthCheckResults(t *testing.T, b storage.Backend) {
+	now := time.Now()
+	for i, c := range []metrics.HealthCheckConfig{config("c1", "alpha"), config("c2", "bravo")} {
+		if err := b.StoreHealthCheckConfig(c); err != nil {
+			t.Fatalf("StoreHealthCheckConfig: %v", err)
+		}
+		if err := b.StoreHealthCheckResult(result(c, metrics.StatusUp, now.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatalf("StoreHealthCheckResult: %v", err)
+		}
+	}
+
+	results, err := b.GetAllHealthCheckResults()
+	if err != nil {
+		t.Fatalf("GetAllHealthCheckResults: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].ID != "c2" {
+		t.Errorf("expected most recently checked first, got %s", results[0].ID)
+	}
+	if len(results[0].History) != 1 {
+		t.Errorf("expected history to be attached to results, got %d entries", len(results[0].History))
+	}
+}
+
+func testTeamScope(t *testing.T, b storage.Backend) {
+	ours, theirs, shared := config("c1", "alpha"), config("c2", "bravo"), config("c3", "charlie")
+	ours.Team, theirs.Team = "web", "db"
+	now := time.Now()
+	for _, c := range []metrics.HealthCheckConfig{ours, theirs, shared} {
+		if err := b.StoreHealthCheckConfig(c); err != nil {
+			t.Fatalf("StoreHealthCheckConfig: %v", err)
+		}
+		if err := b.StoreHealthCheckResult(result(c, metrics.StatusUp, now.Add(-time.Minute))); err != nil {
+			t.Fatalf("StoreHealthCheckResult: %v", err)
+		}
+	}
+
+	// The backend's own queries must keep other teams out, not only the
+	// view returned by storage.Scoped
+	scope := storage.Scope{Teams: []string{"web"}}
+	views := []struct {
+		name   string
+		checks storage.HealthCheckStorage
+	}{{"Scoped", storage.Scoped(b, scope)}}
+	if scoper, ok := b.(storage.TeamScoper); ok {
+		views = append(views, struct {
+			name   string
+			checks storage.HealthCheckStorage
+		}{"Backend", scoper.ScopedHealthChecks(scope)})
+	}
+	for _, view := range views {
+		t.Run(view.name, func(t *testing.T) {
+			checkTeamScope(t, view.checks)
+		})
+	}
+
+	got, err := b.GetHealthCheckConfig("c2")
+	if err != nil || got.Team != "db" {
+		t.Errorf("check of another team after the scoped calls: got %+v, %v", got, err)
+	}
+	if _, err := b.GetHealthCheckConfig("c4"); err == nil {
+		t.Errorf("check stored in another team through a scoped view")
+	}
+	if history, err := b.GetHealthCheckHistory("c2", 0); err != nil || len(history) != 1 {
+		t.Errorf("history of another team's check after the scoped calls: got %d entries, %v; want 1", len(history), err)
+	}
+
+	for _, tt := range []struct {
+		scope storage.Scope
+		want  []string
+	}{
+		{storage.Scope{Shared: true}, []string{"c3"}},
+		{storage.Scope{Shared: true, Teams: []string{"db", "web"}}, []string{"c1", "c2", "c3"}},
+		{storage.Scope{}, nil},
+	} {
+		configs, err := storage.Scoped(b, tt.scope).GetAllHealthCheckConfigs()
+		if err != nil {
+			t.Fatalf("GetAllHealthCheckConfigs: %v", err)
+		}
+		var ids []string
+		for _, c := range configs {
+			ids = append(ids, c.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("configs in scope %+v: got %v, want %v", tt.scope, ids, tt.want)
+		}
+	}
+}
+
+// checkTeamScope checks that checks, scoped to team web, hides and refuses
+// changes to c2 of team db.
+func checkTeamScope(t *testing.T, checks storage.HealthCheckStorage) {
+	if _, err := checks.GetHealthCheckConfig("c1"); err != nil {
+		t.Errorf("GetHealthCheckConfig in scope: %v", err)
+	}
+	if _, err := checks.GetHealthCheckConfig("c2"); err == nil {
+		t.Errorf("read the config of another team")
+	}
+	if _, err := checks.GetHealthCheckRevisions("c2"); err == nil {
+		t.Errorf("read the revisions of another team's check")
+	}
+	if _, err := checks.GetHealthCheckResult("c2"); err == nil {
+		t.Errorf("read the result of another team's check")
+	}
+	if history, _ := checks.GetHealthCheckHistory("c2", 0); len(history) != 0 {
+		t.Errorf("read %d history entries of another team's check", len(history))
+	}
+
+	configs, err := checks.GetAllHealthCheckConfigs()
+	if err != nil {
+		t.Fatalf("GetAllHealthCheckConfigs: %v", err)
+	}
+	if len(configs) != 1 || configs[0].ID != "c1" {
+		t.Errorf("expected only c1 in scope, got %d configs", len(configs))
+	}
+	results, err := checks.GetAllHealthCheckResults()
+	if err != nil {
+		t.Fatalf("GetAllHealthCheckResults: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "c1" {
+		t.Errorf("expected only the result of c1 in scope, got %d results", len(results))
+	}
+
+	takeover := config("c2", "bravo")
+	takeover.Team = "web"
+	if err := checks.StoreHealthCheckConfig(takeover); !errors.Is(err, storage.ErrOutOfScope) {
+		t.Errorf("moving another team's check into scope: got %v, want %v", err, storage.ErrOutOfScope)
+	}
+	other := config("c4", "delta")
+	other.Team = "db"
+	if err := checks.StoreHealthCheckConfig(other); !errors.Is(err, storage.ErrOutOfScope) {
+		t.Errorf("storing a check in another team: got %v, want %v", err, storage.ErrOutOfScope)
+	}
+	if err := checks.StoreHealthCheckResult(result(config("c2", "bravo"), metrics.StatusDown, time.Now())); !errors.Is(err, storage.ErrOutOfScope) {
+		t.Errorf("storing a result of another team's check: got %v, want %v", err, storage.ErrOutOfScope)
+	}
+	if err := checks.DeleteHealthCheckConfig("c2"); err == nil {
+		t.Errorf("deleted another team's check")
+	}
+}
@@ -0,0 +1,347 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"Golem/internal/metrics"
+	"Golem/internal/promql"
+)
+
+const (
+	blockVersion = 1
+	indexMagic   = 0x474f4c4d // "GOLM"
+
+	metaFilename   = "meta.json"
+	indexFilename  = "index"
+	chunksFilename = "chunks"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// BlockMeta describes an immutable block on disk. MaxTime is inclusive.
+type BlockMeta struct {
+	Version    int   `json:"version"`
+	MinTime    int64 `json:"min_time"`
+	MaxTime    int64 `json:"max_time"`
+	NumSeries  int   `json:"num_series"`
+	NumChunks  int   `json:"num_chunks"`
+	NumSamples int   `json:"num_samples"`
+}
+
+type chunkMeta struct {
+	minT   int64
+	maxT   int64
+	offset uint64
+	length uint64
+}
+
+type blockSeries struct {
+	labels metrics.Labels
+	chunks []chunkMeta
+}
+
+// block is a read-only, persisted time partition. Series and postings are
+// held in memory; chunk data is read from disk on demand.
+type block struct {
+	dir      string
+	meta     BlockMeta
+	series   []blockSeries
+	postings *postings
+	chunks   *os.File
+}
+
+func blockDirName(minT, maxT int64) string {
+	return fmt.Sprintf("%013d-%013d", minT, maxT)
+}
+
+// writeBlock persists the head into a new block directory under dir. The
+// block is written to a temporary directory first and renamed into place so
+// a crash never leaves a partial block behind.
+func writeBlock(dir string, h *head) (string, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	name := blockDirName(h.minT, h.maxT)
+	tmp := filepath.Join(dir, name+".tmp")
+	if err := os.RemoveAll(tmp); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return "", err
+	}
+
+	// Series are written in label order so references are stable.
+	ordered := append([]*memSeries(nil), h.byRef...)
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].labels.Key() < ordered[j].labels.Key() })
+
+	meta := BlockMeta{Version: blockVersion, MinTime: h.minT, MaxTime: h.maxT, NumSeries: len(ordered)}
+	index := newPostings()
+
+	var chunkData []byte
+	buf := binary.BigEndian.AppendUint32(nil, indexMagic)
+	buf = binary.AppendUvarint(buf, uint64(len(ordered)))
+	for ref, s := range ordered {
+		index.add(uint32(ref), s.labels)
+
+		names := make([]string, 0, len(s.labels))
+		for name := range s.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		buf = binary.AppendUvarint(buf, uint64(len(names)))
+		for _, name := range names {
+			buf = appendString(buf, name)
+			buf = appendString(buf, s.labels[name])
+		}
+
+		buf = binary.AppendUvarint(buf, uint64(len(s.chunks)))
+		for _, c := range s.chunks {
+			minT, maxT := chunkTimeRange(c)
+			buf = binary.AppendVarint(buf, minT)
+			buf = binary.AppendVarint(buf, maxT)
+			buf = binary.AppendUvarint(buf, uint64(len(chunkData)))
+			buf = binary.AppendUvarint(buf, uint64(len(c.bytes())))
+			chunkData = append(chunkData, c.bytes()...)
+
+			meta.NumChunks++
+			meta.NumSamples += c.numSamples()
+		}
+	}
+
+	pairs := index.sortedLabelPairs()
+	buf = binary.AppendUvarint(buf, uint64(len(pairs)))
+	for _, pair := range pairs {
+		refs := index.m[pair[0]][pair[1]]
+		buf = appendString(buf, pair[0])
+		buf = appendString(buf, pair[1])
+		buf = binary.AppendUvarint(buf, uint64(len(refs)))
+		prev := uint32(0)
+		for _, ref := range refs {
+			buf = binary.AppendUvarint(buf, uint64(ref-prev))
+			prev = ref
+		}
+	}
+	buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+
+	metaData, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	files := map[string][]byte{
+		chunksFilename: chunkData,
+		indexFilename:  buf,
+		metaFilename:   metaData,
+	}
+	for filename, data := range files {
+		if err := writeFileSync(filepath.Join(tmp, filename), data); err != nil {
+			return "", err
+		}
+	}
+
+	final := filepath.Join(dir, name)
+	if err := os.Rename(tmp, final); err != nil {
+		return "", err
+	}
+	return final, nil
+}
+
+func chunkTimeRange(c *xorChunk) (int64, int64) {
+	it := c.iterator()
+	var minT, maxT int64
+	for i := 0; it.next(); i++ {
+		t, _ := it.at()
+		if i == 0 {
+			minT = t
+		}
+		maxT = t
+	}
+	return minT, maxT
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func openBlock(dir string) (*block, error) {
+	metaData, err := os.ReadFile(filepath.Join(dir, metaFilename))
+	if err != nil {
+		return nil, err
+	}
+	var meta BlockMeta
+	if err := json.Unmarshal(metaData, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse block meta: %v", err)
+	}
+	if meta.Version != blockVersion {
+		return nil, fmt.Errorf("unsupported block version %d", meta.Version)
+	}
+
+	indexData, err := os.ReadFile(filepath.Join(dir, indexFilename))
+	if err != nil {
+		return nil, err
+	}
+	series, index, err := decodeIndex(indexData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block index: %v", err)
+	}
+
+	chunks, err := os.Open(filepath.Join(dir, chunksFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	return &block{dir: dir, meta: meta, series: series, postings: index, chunks: chunks}, nil
+}
+
+var errCorruptIndex = errors.New("corrupt index")
+
+func decodeIndex(data []byte) ([]blockSeries, *postings, error) {
+	if len(data) < 8 || binary.BigEndian.Uint32(data) != indexMagic {
+		return nil, nil, errCorruptIndex
+	}
+	body := data[:len(data)-4]
+	if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return nil, nil, errors.New("index checksum mismatch")
+	}
+
+	d := decbuf{b: body[4:]}
+	series := make([]blockSeries, d.uvarint())
+	for i := range series {
+		labels := make(metrics.Labels)
+		for n := d.uvarint(); n > 0; n-- {
+			name := d.string()
+			labels[name] = d.string()
+		}
+		chunks := make([]chunkMeta, d.uvarint())
+		for j := range chunks {
+			chunks[j] = chunkMeta{minT: d.varint(), maxT: d.varint(), offset: d.uvarint(), length: d.uvarint()}
+		}
+		series[i] = blockSeries{labels: labels, chunks: chunks}
+	}
+
+	index := newPostings()
+	for n := d.uvarint(); n > 0; n-- {
+		name := d.string()
+		value := d.string()
+		refs := make([]uint32, d.uvarint())
+		prev := uint32(0)
+		for i := range refs {
+			prev += uint32(d.uvarint())
+			refs[i] = prev
+		}
+		if index.m[name] == nil {
+			index.m[name] = make(map[string][]uint32)
+		}
+		index.m[name][value] = refs
+	}
+	for i := range series {
+		index.all = append(index.all, uint32(i))
+	}
+
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	return series, index, nil
+}
+
+// decbuf decodes the index format. The first error sticks and later reads
+// return zero values.
+type decbuf struct {
+	b   []byte
+	err error
+}
+
+func (d *decbuf) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errCorruptIndex
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decbuf) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errCorruptIndex
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decbuf) string() string {
+	l := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.b)) < l {
+		d.err = errCorruptIndex
+		return ""
+	}
+	s := string(d.b[:l])
+	d.b = d.b[l:]
+	return s
+}
+
+func (b *block) selectSeries(mint, maxt int64, matchers []*promql.Matcher) ([]promql.Series, error) {
+	if maxt < b.meta.MinTime || mint > b.meta.MaxTime {
+		return nil, nil
+	}
+
+	var result []promql.Series
+	for _, ref := range b.postings.selectRefs(matchers) {
+		s := b.series[ref]
+
+		var points []promql.Point
+		for _, meta := range s.chunks {
+			if meta.maxT < mint || meta.minT > maxt {
+				continue
+			}
+			data := make([]byte, meta.length)
+			if _, err := b.chunks.ReadAt(data, int64(meta.offset)); err != nil {
+				return nil, fmt.Errorf("failed to read chunk in %s: %v", b.dir, err)
+			}
+			points = appendChunkPoints(points, loadXORChunk(data), mint, maxt)
+		}
+		if len(points) > 0 {
+			result = append(result, promql.Series{Labels: s.labels, Points: points})
+		}
+	}
+	return result, nil
+}
+
+func (b *block) close() error {
+	return b.chunks.Close()
+}
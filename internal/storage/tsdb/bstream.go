@@ -0,0 +1,100 @@
+package tsdb
+
+import "io"
+
+// bstream is an append-only bit stream. count is the number of bits still
+// free in the last byte of stream.
+type bstream struct {
+	stream []byte
+	count  uint8
+}
+
+func (b *bstream) bytes() []byte {
+	return b.stream
+}
+
+func (b *bstream) writeBit(bit bool) {
+	if b.count == 0 {
+		b.stream = append(b.stream, 0)
+		b.count = 8
+	}
+
+	i := len(b.stream) - 1
+	if bit {
+		b.stream[i] |= 1 << (b.count - 1)
+	}
+	b.count--
+}
+
+func (b *bstream) writeByte(byt byte) {
+	if b.count == 0 {
+		b.stream = append(b.stream, byt)
+		return
+	}
+
+	i := len(b.stream) - 1
+	b.stream[i] |= byt >> (8 - b.count)
+	b.stream = append(b.stream, byt<<b.count)
+}
+
+// writeBits writes the nbits least significant bits of u, most significant first.
+func (b *bstream) writeBits(u uint64, nbits int) {
+	u <<= 64 - uint(nbits)
+	for nbits >= 8 {
+		b.writeByte(byte(u >> 56))
+		u <<= 8
+		nbits -= 8
+	}
+	for nbits > 0 {
+		b.writeBit((u >> 63) == 1)
+		u <<= 1
+		nbits--
+	}
+}
+
+type bstreamReader struct {
+	stream []byte
+	pos    int // bit offset into stream
+}
+
+func newBReader(b []byte) bstreamReader {
+	return bstreamReader{stream: b}
+}
+
+func (r *bstreamReader) readBit() (bool, error) {
+	if r.pos >= len(r.stream)*8 {
+		return false, io.EOF
+	}
+	bit := r.stream[r.pos/8]&(0x80>>uint(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+// ReadByte implements io.ByteReader so varints can be read from the stream.
+func (r *bstreamReader) ReadByte() (byte, error) {
+	v, err := r.readBits(8)
+	return byte(v), err
+}
+
+func (r *bstreamReader) readBits(nbits int) (uint64, error) {
+	if r.pos+nbits > len(r.stream)*8 {
+		return 0, io.EOF
+	}
+
+	var u uint64
+	for nbits > 0 {
+		// Consume whole bytes when aligned, otherwise the rest of the current byte.
+		offset := r.pos % 8
+		avail := 8 - offset
+		take := avail
+		if nbits < take {
+			take = nbits
+		}
+		byt := r.stream[r.pos/8]
+		bits := (byt >> uint(avail-take)) & (1<<uint(take) - 1)
+		u = u<<uint(take) | uint64(bits)
+		r.pos += take
+		nbits -= take
+	}
+	return u, nil
+}
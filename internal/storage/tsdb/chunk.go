@@ -0,0 +1,315 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// maxChunkSamples bounds a chunk so the sample count fits the header and a
+// query never decodes more than it has to.
+const maxChunkSamples = 1024
+
+var errChunkFull = errors.New("chunk is full")
+
+// xorChunk holds samples compressed as in Facebook's Gorilla paper:
+// timestamps are delta-of-delta encoded and values are XORed with their
+// predecessor. The first two bytes hold the sample count.
+type xorChunk struct {
+	b bstream
+}
+
+func newXORChunk() *xorChunk {
+	return &xorChunk{b: bstream{stream: make([]byte, 2, 128)}}
+}
+
+// loadXORChunk wraps an encoded chunk read back from a block.
+func loadXORChunk(data []byte) *xorChunk {
+	return &xorChunk{b: bstream{stream: data}}
+}
+
+func (c *xorChunk) bytes() []byte {
+	return c.b.bytes()
+}
+
+func (c *xorChunk) numSamples() int {
+	return int(binary.BigEndian.Uint16(c.b.bytes()))
+}
+
+func (c *xorChunk) iterator() *xorIterator {
+	return &xorIterator{br: newBReader(c.b.bytes()[2:]), numTotal: uint16(c.numSamples()), leading: 0xff}
+}
+
+// appender returns an appender continuing after the last sample in the chunk.
+func (c *xorChunk) appender() (*xorAppender, error) {
+	it := c.iterator()
+	for it.next() {
+	}
+	if it.err != nil {
+		return nil, it.err
+	}
+	// A loaded chunk does not know how many bits of its last byte are used.
+	c.b.count = uint8(len(c.b.stream)*8 - 16 - it.br.pos)
+
+	a := &xorAppender{
+		c:        c,
+		t:        it.t,
+		v:        it.v,
+		tDelta:   it.tDelta,
+		leading:  it.leading,
+		trailing: it.trailing,
+	}
+	return a, nil
+}
+
+type xorAppender struct {
+	c *xorChunk
+
+	t      int64
+	v      float64
+	tDelta uint64
+
+	leading  uint8
+	trailing uint8
+}
+
+func (a *xorAppender) append(t int64, v float64) error {
+	num := a.c.numSamples()
+	if num >= maxChunkSamples {
+		return errChunkFull
+	}
+
+	b := &a.c.b
+	var tDelta uint64
+
+	switch num {
+	case 0:
+		buf := make([]byte, binary.MaxVarintLen64)
+		for _, byt := range buf[:binary.PutVarint(buf, t)] {
+			b.writeByte(byt)
+		}
+		b.writeBits(math.Float64bits(v), 64)
+	case 1:
+		tDelta = uint64(t - a.t)
+		buf := make([]byte, binary.MaxVarintLen64)
+		for _, byt := range buf[:binary.PutUvarint(buf, tDelta)] {
+			b.writeByte(byt)
+		}
+		a.writeVDelta(v)
+	default:
+		tDelta = uint64(t - a.t)
+		dod := int64(tDelta - a.tDelta)
+
+		switch {
+		case dod == 0:
+			b.writeBit(false)
+		case bitRange(dod, 14):
+			b.writeBits(0b10, 2)
+			b.writeBits(uint64(dod), 14)
+		case bitRange(dod, 17):
+			b.writeBits(0b110, 3)
+			b.writeBits(uint64(dod), 17)
+		case bitRange(dod, 20):
+			b.writeBits(0b1110, 4)
+			b.writeBits(uint64(dod), 20)
+		default:
+			b.writeBits(0b1111, 4)
+			b.writeBits(uint64(dod), 64)
+		}
+		a.writeVDelta(v)
+	}
+
+	a.t = t
+	a.v = v
+	a.tDelta = tDelta
+	binary.BigEndian.PutUint16(a.c.b.bytes(), uint16(num+1))
+	return nil
+}
+
+// bitRange reports whether x fits in a signed integer of nbits bits.
+func bitRange(x int64, nbits uint8) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+func (a *xorAppender) writeVDelta(v float64) {
+	b := &a.c.b
+	delta := math.Float64bits(v) ^ math.Float64bits(a.v)
+
+	if delta == 0 {
+		b.writeBit(false)
+		return
+	}
+	b.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(delta))
+	trailing := uint8(bits.TrailingZeros64(delta))
+
+	// Clamp so the count fits in 5 bits.
+	if leading >= 32 {
+		leading = 31
+	}
+
+	if a.leading != 0xff && leading >= a.leading && trailing >= a.trailing {
+		// The meaningful bits fit inside the previous window.
+		b.writeBit(false)
+		b.writeBits(delta>>a.trailing, 64-int(a.leading)-int(a.trailing))
+		return
+	}
+
+	a.leading, a.trailing = leading, trailing
+
+	b.writeBit(true)
+	b.writeBits(uint64(leading), 5)
+
+	// 64 significant bits do not fit in 6 bits; they are written as 0,
+	// which can never occur otherwise because delta != 0.
+	sigbits := 64 - leading - trailing
+	b.writeBits(uint64(sigbits), 6)
+	b.writeBits(delta>>trailing, int(sigbits))
+}
+
+type xorIterator struct {
+	br       bstreamReader
+	numTotal uint16
+	numRead  uint16
+
+	t      int64
+	v      float64
+	tDelta uint64
+
+	leading  uint8
+	trailing uint8
+
+	err error
+}
+
+func (it *xorIterator) at() (int64, float64) {
+	return it.t, it.v
+}
+
+func (it *xorIterator) next() bool {
+	if it.err != nil || it.numRead == it.numTotal {
+		return false
+	}
+
+	switch it.numRead {
+	case 0:
+		t, err := binary.ReadVarint(&it.br)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		v, err := it.br.readBits(64)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.t = t
+		it.v = math.Float64frombits(v)
+	case 1:
+		tDelta, err := binary.ReadUvarint(&it.br)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.tDelta = tDelta
+		it.t += int64(tDelta)
+		if !it.readValue() {
+			return false
+		}
+	default:
+		// Count the leading ones (at most four) to find the dod bucket.
+		var prefix uint8
+		for i := 0; i < 4; i++ {
+			bit, err := it.br.readBit()
+			if err != nil {
+				it.err = err
+				return false
+			}
+			if !bit {
+				break
+			}
+			prefix++
+		}
+
+		var size int
+		switch prefix {
+		case 0:
+		case 1:
+			size = 14
+		case 2:
+			size = 17
+		case 3:
+			size = 20
+		case 4:
+			size = 64
+		}
+
+		var dod int64
+		if size > 0 {
+			raw, err := it.br.readBits(size)
+			if err != nil {
+				it.err = err
+				return false
+			}
+			dod = int64(raw)
+			if size < 64 && raw > 1<<(size-1) {
+				// Sign-extend.
+				dod = int64(raw) - 1<<size
+			}
+		}
+
+		it.tDelta = uint64(int64(it.tDelta) + dod)
+		it.t += int64(it.tDelta)
+		if !it.readValue() {
+			return false
+		}
+	}
+
+	it.numRead++
+	return true
+}
+
+func (it *xorIterator) readValue() bool {
+	bit, err := it.br.readBit()
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if !bit {
+		return true
+	}
+
+	bit, err = it.br.readBit()
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if bit {
+		leading, err := it.br.readBits(5)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		sigbits, err := it.br.readBits(6)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		it.leading = uint8(leading)
+		it.trailing = uint8(64 - leading - sigbits)
+	}
+
+	sigbits := 64 - int(it.leading) - int(it.trailing)
+	raw, err := it.br.readBits(sigbits)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.v = math.Float64frombits(math.Float64bits(it.v) ^ raw<<it.trailing)
+	return true
+}
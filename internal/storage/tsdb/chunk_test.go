@@ -0,0 +1,144 @@
+package tsdb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBstreamRoundTrip(t *testing.T) {
+	writes := []struct {
+		u     uint64
+		nbits int
+	}{
+		{1, 1}, {0, 1}, {0b101, 3}, {0xab, 8}, {0x1234, 13}, {math.MaxUint64, 64}, {0, 7}, {1<<63 | 1, 64}, {0x5, 4},
+	}
+	var b bstream
+	for _, w := range writes {
+		b.writeBits(w.u, w.nbits)
+	}
+	b.writeByte(0xc3)
+	b.writeBit(true)
+
+	r := newBReader(b.bytes())
+	for i, w := range writes {
+		got, err := r.readBits(w.nbits)
+		if err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+		if got != w.u {
+			t.Errorf("write %d: read %#x, want %#x", i, got, w.u)
+		}
+	}
+	if byt, err := r.ReadByte(); err != nil || byt != 0xc3 {
+		t.Errorf("byte: read %#x, %v; want 0xc3", byt, err)
+	}
+	if bit, err := r.readBit(); err != nil || !bit {
+		t.Errorf("last bit: read %v, %v; want true", bit, err)
+	}
+	// Only padding is left in the last byte
+	if _, err := r.readBits(8); err == nil {
+		t.Errorf("read past the end of the stream")
+	}
+}
+
+type chunkSample struct {
+	t int64
+	v float64
+}
+
+func TestXORChunkRoundTrip(t *testing.T) {
+	tests := map[string][]chunkSample{
+		"regular":    {{1000, 1}, {2000, 2}, {3000, 3}, {4000, 4}, {5000, 5}},
+		"one sample": {{-5, 42}},
+		"irregular":  {{0, 0.5}, {15, 0.25}, {16, 100}, {10016, -3.75}, {10017, 1e300}, {1 << 40, 1e-300}},
+		// Every dod bucket, up to one that needs 64 bits
+		"large jumps":      {{0, 1}, {1, 1}, {8192, 1}, {8192 + 65536 + 8192, 1}, {1 << 22, 1}, {1 << 50, 1}, {1<<50 + 1, 1}},
+		"equal timestamps": {{1000, 1}, {1000, 2}, {1000, 2}, {2000, 3}, {2000, 4}},
+		"negative deltas":  {{5000, 1}, {4000, 2}, {4500, 3}, {-100000, 4}, {1 << 45, 5}, {-(1 << 45), 6}},
+		"special values": {
+			{0, math.NaN()}, {1, math.NaN()}, {2, 1}, {3, math.Inf(1)}, {4, math.Inf(-1)},
+			{5, math.Copysign(0, -1)}, {6, 0}, {7, math.MaxFloat64}, {8, math.SmallestNonzeroFloat64}, {9, math.NaN()},
+		},
+	}
+	// Delta-of-deltas at the edges of each bucket
+	edges := []chunkSample{{0, 0}, {1000, 0}}
+	delta := int64(1000)
+	for _, dod := range []int64{8192, -8191, 8193, -8192, 65536, -65535, 65537, 524288, -524287, 524289, -524288} {
+		delta += dod
+		edges = append(edges, chunkSample{edges[len(edges)-1].t + delta, float64(dod)})
+	}
+	tests["bucket edges"] = edges
+
+	for name, samples := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newXORChunk()
+			app, err := c.appender()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range samples {
+				if err := app.append(s.t, s.v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkChunk(t, c, samples)
+
+			// A chunk read back from a block continues where it left off
+			loaded := loadXORChunk(append([]byte(nil), c.bytes()...))
+			app, err = loaded.appender()
+			if err != nil {
+				t.Fatal(err)
+			}
+			more := append(samples, chunkSample{samples[len(samples)-1].t + 60000, 7}, chunkSample{samples[len(samples)-1].t + 120000, math.NaN()})
+			for _, s := range more[len(samples):] {
+				if err := app.append(s.t, s.v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkChunk(t, loaded, more)
+		})
+	}
+}
+
+func checkChunk(t *testing.T, c *xorChunk, want []chunkSample) {
+	t.Helper()
+	if n := c.numSamples(); n != len(want) {
+		t.Fatalf("chunk has %d samples, want %d", n, len(want))
+	}
+	it := c.iterator()
+	for i, w := range want {
+		if !it.next() {
+			t.Fatalf("iterator stopped after %d samples: %v", i, it.err)
+		}
+		ts, v := it.at()
+		// Compare bits so NaN and -0 count as round-tripped
+		if ts != w.t || math.Float64bits(v) != math.Float64bits(w.v) {
+			t.Errorf("sample %d: got (%d, %v), want (%d, %v)", i, ts, v, w.t, w.v)
+		}
+	}
+	if it.next() {
+		t.Errorf("iterator returned more than %d samples", len(want))
+	}
+	if it.err != nil {
+		t.Errorf("iterator: %v", it.err)
+	}
+}
+
+func TestXORChunkFull(t *testing.T) {
+	c := newXORChunk()
+	app, err := c.appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxChunkSamples; i++ {
+		if err := app.append(int64(i)*1000, float64(i%10)); err != nil {
+			t.Fatalf("sample %d: %v", i, err)
+		}
+	}
+	if err := app.append(maxChunkSamples*1000, 0); err != errChunkFull {
+		t.Errorf("append to a full chunk: got %v, want %v", err, errChunkFull)
+	}
+	if n := c.numSamples(); n != maxChunkSamples {
+		t.Errorf("full chunk has %d samples, want %d", n, maxChunkSamples)
+	}
+}
@@ -0,0 +1,393 @@
+// Package tsdb is an embedded, append-only time series engine for host
+// metrics. Snapshots are written to a write-ahead log, appended to an
+// in-memory head block and, once the head's time partition is complete,
+// persisted as an immutable block of Gorilla-compressed chunks with an
+// inverted label index. Whole blocks are deleted once they fall out of the
+// retention window.
+package tsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"Golem/internal/metrics"
+	"Golem/internal/promql"
+)
+
+const (
+	DefaultBlockDuration = 2 * time.Hour
+	DefaultRetention     = 15 * 24 * time.Hour
+)
+
+type Options struct {
+	// BlockDuration is the length of the time partition covered by a block.
+	BlockDuration time.Duration
+	// Retention is how long blocks are kept after their last sample.
+	Retention time.Duration
+	// NoSync skips fsync after each WAL write, trading durability of the
+	// last few snapshots for write throughput.
+	NoSync bool
+}
+
+// DB implements storage.MetricStorage and promql.Queryable.
+type DB struct {
+	dir  string
+	opts Options
+
+	mu     sync.RWMutex
+	wal    *wal
+	head   *head
+	blocks []*block
+	latest *metrics.SystemMetrics
+}
+
+// Open opens or creates a database in dir, replaying the WAL into the head.
+func Open(dir string, opts Options) (*DB, error) {
+	if opts.BlockDuration <= 0 {
+		opts.BlockDuration = DefaultBlockDuration
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultRetention
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create tsdb directory: %v", err)
+	}
+
+	db := &DB{dir: dir, opts: opts, head: newHead()}
+	if err := db.loadBlocks(); err != nil {
+		db.closeBlocks()
+		return nil, err
+	}
+
+	w, records, err := openWAL(filepath.Join(dir, "wal"), opts.NoSync)
+	if err != nil {
+		db.closeBlocks()
+		return nil, fmt.Errorf("failed to open WAL: %v", err)
+	}
+	db.wal = w
+
+	if err := db.replay(records); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to replay WAL: %v", err)
+	}
+	db.applyRetention(db.maxTime())
+	return db, nil
+}
+
+func (db *DB) loadBlocks() error {
+	entries, err := os.ReadDir(db.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(db.dir, e.Name())
+		if !e.IsDir() || e.Name() == "wal" {
+			continue
+		}
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			// Left behind by a crash while writing a block.
+			os.RemoveAll(path)
+			continue
+		}
+
+		b, err := openBlock(path)
+		if err != nil {
+			return fmt.Errorf("failed to open block %s: %v", e.Name(), err)
+		}
+		db.blocks = append(db.blocks, b)
+	}
+
+	sort.Slice(db.blocks, func(i, j int) bool { return db.blocks[i].meta.MinTime < db.blocks[j].meta.MinTime })
+	return nil
+}
+
+func (db *DB) replay(records []walRecord) error {
+	var pending []walRecord
+	cut := false
+
+	for _, rec := range records {
+		var m metrics.SystemMetrics
+		if err := json.Unmarshal(rec.payload, &m); err != nil {
+			return err
+		}
+
+		switch rec.typ {
+		case recordLatest:
+			db.setLatest(m)
+		case recordSnapshot:
+			t := m.Timestamp.UnixMilli()
+			if t <= db.maxTime() {
+				// Already persisted in a block before a crash.
+				db.setLatest(m)
+				continue
+			}
+			didCut, err := db.cutIfNeeded(t)
+			if err != nil {
+				return err
+			}
+			if didCut {
+				cut = true
+				pending = pending[:0]
+			}
+			db.head.appendSamples(t, m.Samples(), db.opts.BlockDuration.Milliseconds())
+			db.setLatest(m)
+			pending = append(pending, rec)
+		}
+	}
+
+	if !cut {
+		return nil
+	}
+	// The head was cut while replaying, so the WAL still holds samples that
+	// are now in a block. Rewrite it with what is left in the head.
+	if len(pending) == 0 {
+		rec, err := db.latestRecord()
+		if err != nil {
+			return err
+		}
+		pending = append(pending, rec)
+	}
+	return db.wal.reset(pending)
+}
+
+func (db *DB) setLatest(m metrics.SystemMetrics) {
+	if db.latest == nil || !m.Timestamp.Before(db.latest.Timestamp) {
+		db.latest = &m
+	}
+}
+
+func (db *DB) latestRecord() (walRecord, error) {
+	payload, err := json.Marshal(db.latest)
+	if err != nil {
+		return walRecord{}, err
+	}
+	return walRecord{typ: recordLatest, payload: payload}, nil
+}
+
+// maxTime returns the timestamp of the newest stored sample, or -1.
+func (db *DB) maxTime() int64 {
+	maxT := int64(-1)
+	if len(db.blocks) > 0 {
+		maxT = db.blocks[len(db.blocks)-1].meta.MaxTime
+	}
+	if !db.head.empty() && db.head.maxT > maxT {
+		maxT = db.head.maxT
+	}
+	return maxT
+}
+
+// cutIfNeeded persists the head as a block when t falls outside its time
+// partition, then applies retention.
+func (db *DB) cutIfNeeded(t int64) (bool, error) {
+	if db.head.empty() || t < db.head.partitionEnd {
+		return false, nil
+	}
+
+	path, err := writeBlock(db.dir, db.head)
+	if err != nil {
+		return false, fmt.Errorf("failed to write block: %v", err)
+	}
+	b, err := openBlock(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open block: %v", err)
+	}
+	db.blocks = append(db.blocks, b)
+	db.head = newHead()
+
+	db.applyRetention(t)
+	return true, nil
+}
+
+// applyRetention deletes every block whose newest sample is older than the
+// retention window ending at now.
+func (db *DB) applyRetention(now int64) {
+	cutoff := now - db.opts.Retention.Milliseconds()
+
+	kept := db.blocks[:0]
+	for _, b := range db.blocks {
+		if b.meta.MaxTime >= cutoff {
+			kept = append(kept, b)
+			continue
+		}
+		b.close()
+		if err := os.RemoveAll(b.dir); err != nil {
+			log.Printf("Failed to delete expired block %s: %v", b.dir, err)
+			continue
+		}
+	}
+	db.blocks = kept
+}
+
+func (db *DB) StoreMetrics(m metrics.SystemMetrics) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := m.Timestamp.UnixMilli()
+	if t <= db.maxTime() {
+		return fmt.Errorf("out of order snapshot at %v", m.Timestamp)
+	}
+
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %v", err)
+	}
+
+	cut, err := db.cutIfNeeded(t)
+	if err != nil {
+		return err
+	}
+	if cut {
+		rec, err := db.latestRecord()
+		if err != nil {
+			return fmt.Errorf("failed to marshal metrics: %v", err)
+		}
+		if err := db.wal.reset([]walRecord{rec}); err != nil {
+			return fmt.Errorf("failed to truncate WAL: %v", err)
+		}
+	}
+
+	if err := db.wal.log(walRecord{typ: recordSnapshot, payload: payload}); err != nil {
+		return fmt.Errorf("failed to write WAL: %v", err)
+	}
+	db.head.appendSamples(t, m.Samples(), db.opts.BlockDuration.Milliseconds())
+	db.setLatest(m)
+	return nil
+}
+
+func (db *DB) GetLatestMetrics() (metrics.SystemMetrics, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.latest == nil {
+		return metrics.SystemMetrics{}, nil
+	}
+	return *db.latest, nil
+}
+
+func (db *DB) GetMetricsHistory(duration time.Duration) ([]metrics.SystemMetrics, error) {
+	now := time.Now()
+	snapshots, err := db.GetMetricsRange(now.Add(-duration), now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Newest first, matching SQLiteStorage.
+	for i, j := 0, len(snapshots)-1; i < j; i, j = i+1, j-1 {
+		snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
+	}
+	return snapshots, nil
+}
+
+// GetMetricsRange rebuilds snapshots from the stored series. Only the latest
+// snapshot carries the full process list; the others list the processes
+// with open file descriptors, and only those.
+func (db *DB) GetMetricsRange(from, to time.Time) ([]metrics.SystemMetrics, error) {
+	series, err := db.Select(from, to, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	byTime := make(map[int64][]metrics.Sample)
+	for _, s := range series {
+		for _, p := range s.Points {
+			byTime[p.T] = append(byTime[p.T], metrics.Sample{Labels: s.Labels, Value: p.V})
+		}
+	}
+
+	times := make([]int64, 0, len(byTime))
+	for t := range byTime {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	latest, _ := db.GetLatestMetrics()
+
+	snapshots := make([]metrics.SystemMetrics, 0, len(times))
+	for _, t := range times {
+		if t == latest.Timestamp.UnixMilli() {
+			snapshots = append(snapshots, latest)
+			continue
+		}
+		snapshots = append(snapshots, metrics.SnapshotFromSamples(time.UnixMilli(t), byTime[t]))
+	}
+	return snapshots, nil
+}
+
+// Select implements promql.Queryable using the label index of every block
+// overlapping the window.
+func (db *DB) Select(mint, maxt time.Time, matchers []*promql.Matcher) ([]promql.Series, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	from, to := mint.UnixMilli(), maxt.UnixMilli()
+
+	merged := make(map[string]*promql.Series)
+	add := func(series []promql.Series) {
+		for _, s := range series {
+			key := s.Labels.Key()
+			if existing, ok := merged[key]; ok {
+				existing.Points = append(existing.Points, s.Points...)
+				continue
+			}
+			s := s
+			merged[key] = &s
+		}
+	}
+
+	// Blocks are disjoint and sorted, and the head comes after all of
+	// them, so points stay in time order.
+	for _, b := range db.blocks {
+		series, err := b.selectSeries(from, to, matchers)
+		if err != nil {
+			return nil, err
+		}
+		add(series)
+	}
+	add(db.head.selectSeries(from, to, matchers))
+
+	result := make([]promql.Series, 0, len(merged))
+	for _, s := range merged {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Labels.Key() < result[j].Labels.Key() })
+	return result, nil
+}
+
+// Blocks returns the metadata of the persisted blocks, oldest first.
+func (db *DB) Blocks() []BlockMeta {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	metas := make([]BlockMeta, len(db.blocks))
+	for i, b := range db.blocks {
+		metas[i] = b.meta
+	}
+	return metas
+}
+
+func (db *DB) closeBlocks() {
+	for _, b := range db.blocks {
+		b.close()
+	}
+}
+
+// Close closes the WAL and blocks. The head is not persisted as a block;
+// it is rebuilt from the WAL on the next Open.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.closeBlocks()
+	if db.wal != nil {
+		return db.wal.close()
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package tsdb_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Golem/internal/metrics"
+	"Golem/internal/storage"
+	"Golem/internal/storage/storagetest"
+	"Golem/internal/storage/tsdb"
+)
+
+func TestMetricStorage(t *testing.T) {
+	storagetest.TestMetricStorage(t, func() (storage.MetricStorage, error) {
+		return tsdb.Open(t.TempDir(), tsdb.Options{NoSync: true})
+	})
+}
+
+// base is on an hour boundary a day ago, well within the default retention
+var base = time.Now().Add(-24 * time.Hour).Truncate(time.Hour)
+
+func open(t *testing.T, dir string, opts tsdb.Options) *tsdb.DB {
+	t.Helper()
+	db, err := tsdb.Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// store writes a snapshot every step from base, numbering them by their
+// used memory percentage
+func store(t *testing.T, db *tsdb.DB, from, n int, step time.Duration) {
+	t.Helper()
+	for i := from; i < from+n; i++ {
+		m := metrics.SystemMetrics{Timestamp: base.Add(time.Duration(i) * step), Memory: metrics.MemoryMetrics{UsedPercent: float64(i)}}
+		if err := db.StoreMetrics(m); err != nil {
+			t.Fatalf("snapshot %d: %v", i, err)
+		}
+	}
+}
+
+// checkSnapshots fails unless db holds exactly snapshots first to last,
+// one every step from base
+func checkSnapshots(t *testing.T, db *tsdb.DB, first, last int, step time.Duration) {
+	t.Helper()
+	got, err := db.GetMetricsRange(base.Add(-time.Hour), base.Add(time.Duration(last+1)*step))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != last-first+1 {
+		t.Fatalf("got %d snapshots, want %d", len(got), last-first+1)
+	}
+	for i, m := range got {
+		want := first + i
+		if !m.Timestamp.Equal(base.Add(time.Duration(want)*step)) || m.Memory.UsedPercent != float64(want) {
+			t.Errorf("snapshot %d: got %v with %v%%, want %v with %d%%", i, m.Timestamp, m.Memory.UsedPercent, base.Add(time.Duration(want)*step), want)
+		}
+	}
+	latest, err := db.GetLatestMetrics()
+	if err != nil || latest.Memory.UsedPercent != float64(last) {
+		t.Errorf("latest is %v%%, %v; want %d%%", latest.Memory.UsedPercent, err, last)
+	}
+}
+
+func TestWALReplayAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	crashed := open(t, dir, tsdb.Options{})
+	// Never closed, as if Golem was killed
+	t.Cleanup(func() { crashed.Close() })
+	store(t, crashed, 0, 10, time.Minute)
+
+	db := open(t, dir, tsdb.Options{})
+	defer db.Close()
+	checkSnapshots(t, db, 0, 9, time.Minute)
+	if blocks := db.Blocks(); len(blocks) != 0 {
+		t.Errorf("replay wrote %d blocks, want the head left in the WAL", len(blocks))
+	}
+}
+
+func TestWALTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	db := open(t, dir, tsdb.Options{})
+	store(t, db, 0, 3, time.Minute)
+	db.Close()
+
+	segments, err := filepath.Glob(filepath.Join(dir, "wal", "*"))
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("WAL segments %v, %v; want one", segments, err)
+	}
+	segment := segments[0]
+	info, err := os.Stat(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A snapshot record whose header promises 256 bytes, cut off by a crash
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 0, 0, 1, 0, 0xde, 0xad, 0xbe, 0xef, '{', '"'})
+	f.Close()
+
+	db = open(t, dir, tsdb.Options{})
+	checkSnapshots(t, db, 0, 2, time.Minute)
+	if after, err := os.Stat(segment); err != nil || after.Size() != info.Size() {
+		t.Errorf("segment is %v bytes after replay, want the torn record truncated to %d", after.Size(), info.Size())
+	}
+
+	// Records written after the truncation replay too
+	store(t, db, 3, 2, time.Minute)
+	db.Close()
+	db = open(t, dir, tsdb.Options{})
+	defer db.Close()
+	checkSnapshots(t, db, 0, 4, time.Minute)
+}
+
+func TestHeadCutIntoBlocks(t *testing.T) {
+	dir := t.TempDir()
+	opts := tsdb.Options{BlockDuration: time.Hour}
+	db := open(t, dir, opts)
+	// 2.5 hours of snapshots fill two blocks and part of the head
+	store(t, db, 0, 16, 10*time.Minute)
+
+	blocks := db.Blocks()
+	if len(blocks) != 2 {
+		t.Fatalf("got %d blocks, want 2", len(blocks))
+	}
+	for i, b := range blocks {
+		start := base.Add(time.Duration(i) * time.Hour).UnixMilli()
+		if b.MinTime != start || b.MaxTime != start+50*60*1000 || b.NumSamples == 0 {
+			t.Errorf("block %d: got %+v, want 6 snapshots from %d", i, b, start)
+		}
+	}
+	checkSnapshots(t, db, 0, 15, 10*time.Minute)
+	db.Close()
+
+	db = open(t, dir, opts)
+	if reopened := db.Blocks(); len(reopened) != 2 || reopened[0] != blocks[0] || reopened[1] != blocks[1] {
+		t.Errorf("after reopening: blocks %+v, want %+v", reopened, blocks)
+	}
+	checkSnapshots(t, db, 0, 15, 10*time.Minute)
+
+	// A cut that the process does not live past is replayed from the WAL
+	store(t, db, 16, 8, 10*time.Minute)
+	db2 := open(t, dir, opts)
+	defer db2.Close()
+	db.Close()
+	if n := len(db2.Blocks()); n != 3 {
+		t.Errorf("after a crash past a cut: got %d blocks, want 3", n)
+	}
+	checkSnapshots(t, db2, 0, 23, 10*time.Minute)
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	opts := tsdb.Options{BlockDuration: time.Hour, Retention: 2 * time.Hour}
+	db := open(t, dir, opts)
+	// Six hours, cut into five blocks and the head
+	store(t, db, 0, 36, 10*time.Minute)
+
+	// The newest sample is at 5h50m, so blocks ending before 3h50m are gone
+	blocks := db.Blocks()
+	if len(blocks) != 2 {
+		t.Fatalf("got %d blocks, want the 2 ending within the retention: %+v", len(blocks), blocks)
+	}
+	if blocks[0].MinTime != base.Add(3*time.Hour).UnixMilli() {
+		t.Errorf("oldest block starts at %v, want 3h", time.UnixMilli(blocks[0].MinTime).Sub(base))
+	}
+	dirs, err := filepath.Glob(filepath.Join(dir, "*-*"))
+	if err != nil || len(dirs) != 2 {
+		t.Errorf("block directories %v, %v; want 2", dirs, err)
+	}
+	checkSnapshots(t, db, 18, 35, 10*time.Minute)
+	db.Close()
+
+	// Shorter retention applies on open
+	opts.Retention = time.Hour
+	db = open(t, dir, opts)
+	defer db.Close()
+	if blocks := db.Blocks(); len(blocks) != 1 || blocks[0].MinTime != base.Add(4*time.Hour).UnixMilli() {
+		t.Errorf("after reopening with 1h retention: blocks %+v, want the one from 4h", blocks)
+	}
+	checkSnapshots(t, db, 24, 35, 10*time.Minute)
+}
+
+func openMetrics(dir string) (storage.MetricStorage, error) {
+	return tsdb.Open(dir, tsdb.Options{})
+}
+
+func BenchmarkWrite(b *testing.B) {
+	storagetest.BenchmarkWrite(b, openMetrics)
+}
+
+func BenchmarkRangeQuery(b *testing.B) {
+	storagetest.BenchmarkRangeQuery(b, 3600, openMetrics)
+}
@@ -0,0 +1,135 @@
+package tsdb
+
+import (
+	"sort"
+	"sync"
+
+	"Golem/internal/metrics"
+	"Golem/internal/promql"
+)
+
+// memSeries is a series in the head. Only the last chunk is appended to.
+type memSeries struct {
+	ref    uint32
+	labels metrics.Labels
+	chunks []*xorChunk
+	app    *xorAppender
+	minT   int64
+	maxT   int64
+}
+
+func (s *memSeries) append(t int64, v float64) {
+	if s.app != nil && t <= s.maxT {
+		// Out of order or duplicate; the first value wins.
+		return
+	}
+
+	if s.app == nil {
+		s.minT = t
+	}
+	if s.app == nil || s.app.append(t, v) == errChunkFull {
+		c := newXORChunk()
+		s.chunks = append(s.chunks, c)
+		s.app, _ = c.appender()
+		s.app.append(t, v)
+	}
+	s.maxT = t
+}
+
+// head is the in-memory block receiving appends for the current time
+// partition [minT, maxT], which ends before partitionEnd.
+type head struct {
+	mu           sync.RWMutex
+	series       map[string]*memSeries
+	byRef        []*memSeries
+	postings     *postings
+	minT         int64
+	maxT         int64
+	partitionEnd int64
+	numSamples   int
+}
+
+func newHead() *head {
+	return &head{
+		series:   make(map[string]*memSeries),
+		postings: newPostings(),
+	}
+}
+
+func (h *head) empty() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.numSamples == 0
+}
+
+// appendSamples adds one snapshot's samples at t. The first append fixes
+// the partition the head covers.
+func (h *head) appendSamples(t int64, samples []metrics.Sample, blockDuration int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.numSamples == 0 {
+		h.minT = t
+		h.partitionEnd = (t/blockDuration + 1) * blockDuration
+	}
+	if t > h.maxT || h.numSamples == 0 {
+		h.maxT = t
+	}
+
+	for _, sample := range samples {
+		key := sample.Labels.Key()
+		s, ok := h.series[key]
+		if !ok {
+			s = &memSeries{ref: uint32(len(h.byRef)), labels: sample.Labels.Copy()}
+			h.series[key] = s
+			h.byRef = append(h.byRef, s)
+			h.postings.add(s.ref, s.labels)
+		}
+		s.append(t, sample.Value)
+		h.numSamples++
+	}
+}
+
+// selectSeries returns the points in [mint, maxt] of the series matching
+// matchers, sorted by labels.
+func (h *head) selectSeries(mint, maxt int64, matchers []*promql.Matcher) []promql.Series {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.numSamples == 0 || maxt < h.minT || mint > h.maxT {
+		return nil
+	}
+
+	var result []promql.Series
+	for _, ref := range h.postings.selectRefs(matchers) {
+		s := h.byRef[ref]
+		if s.maxT < mint || s.minT > maxt {
+			continue
+		}
+
+		var points []promql.Point
+		for _, c := range s.chunks {
+			points = appendChunkPoints(points, c, mint, maxt)
+		}
+		if len(points) > 0 {
+			result = append(result, promql.Series{Labels: s.labels, Points: points})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Labels.Key() < result[j].Labels.Key() })
+	return result
+}
+
+func appendChunkPoints(points []promql.Point, c *xorChunk, mint, maxt int64) []promql.Point {
+	it := c.iterator()
+	for it.next() {
+		t, v := it.at()
+		if t > maxt {
+			break
+		}
+		if t >= mint {
+			points = append(points, promql.Point{T: t, V: v})
+		}
+	}
+	return points
+}
@@ -0,0 +1,138 @@
+package tsdb
+
+import (
+	"sort"
+
+	"Golem/internal/metrics"
+	"Golem/internal/promql"
+)
+
+// postings is an inverted index from label pairs to the sorted references of
+// the series carrying them.
+type postings struct {
+	m   map[string]map[string][]uint32
+	all []uint32
+}
+
+func newPostings() *postings {
+	return &postings{m: make(map[string]map[string][]uint32)}
+}
+
+// add indexes a series. References must be added in increasing order.
+func (p *postings) add(ref uint32, labels metrics.Labels) {
+	for name, value := range labels {
+		values, ok := p.m[name]
+		if !ok {
+			values = make(map[string][]uint32)
+			p.m[name] = values
+		}
+		values[value] = append(values[value], ref)
+	}
+	p.all = append(p.all, ref)
+}
+
+// selectRefs returns the sorted references of the series matching every matcher.
+func (p *postings) selectRefs(matchers []*promql.Matcher) []uint32 {
+	result := p.all
+	for _, m := range matchers {
+		var refs []uint32
+		if m.Matches("") {
+			// Series without the label match too, so subtract the
+			// series whose value does not match instead.
+			var exclude []uint32
+			for value, list := range p.m[m.Name] {
+				if !m.Matches(value) {
+					exclude = union(exclude, list)
+				}
+			}
+			refs = subtract(result, exclude)
+		} else if m.Type == promql.MatchEqual {
+			refs = intersect(result, p.m[m.Name][m.Value])
+		} else {
+			var include []uint32
+			for value, list := range p.m[m.Name] {
+				if m.Matches(value) {
+					include = union(include, list)
+				}
+			}
+			refs = intersect(result, include)
+		}
+
+		result = refs
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+func intersect(a, b []uint32) []uint32 {
+	var out []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func union(a, b []uint32) []uint32 {
+	out := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+func subtract(a, b []uint32) []uint32 {
+	var out []uint32
+	j := 0
+	for _, ref := range a {
+		for j < len(b) && b[j] < ref {
+			j++
+		}
+		if j < len(b) && b[j] == ref {
+			continue
+		}
+		out = append(out, ref)
+	}
+	return out
+}
+
+// sortedLabelPairs returns the index's label pairs in a stable order for
+// serialization.
+func (p *postings) sortedLabelPairs() [][2]string {
+	var pairs [][2]string
+	for name, values := range p.m {
+		for value := range values {
+			pairs = append(pairs, [2]string{name, value})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	return pairs
+}
@@ -0,0 +1,193 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+const (
+	// recordSnapshot holds a snapshot that belongs in the head.
+	recordSnapshot byte = 1
+	// recordLatest holds the most recent snapshot after the head was cut,
+	// so GetLatestMetrics survives a restart with an empty head.
+	recordLatest byte = 2
+
+	recordHeaderSize = 9
+)
+
+type walRecord struct {
+	typ     byte
+	payload []byte
+}
+
+// wal is a segmented write-ahead log. Each record is framed as
+// type (1 byte) | length (4 bytes) | CRC32-C of payload (4 bytes) | payload.
+// Segments are named by increasing sequence number.
+type wal struct {
+	dir    string
+	seq    int
+	f      *os.File
+	noSync bool
+}
+
+func segmentName(seq int) string {
+	return fmt.Sprintf("%08d", seq)
+}
+
+func listSegments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var seqs []int
+	for _, e := range entries {
+		seq, err := strconv.Atoi(e.Name())
+		if err != nil || e.IsDir() {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	return seqs, nil
+}
+
+// openWAL opens the log in dir and returns the records of every segment.
+// A torn record at the end of the last segment, left by a crash mid-write,
+// is truncated away.
+func openWAL(dir string, noSync bool) (*wal, []walRecord, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	seqs, err := listSegments(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var records []walRecord
+	for i, seq := range seqs {
+		path := filepath.Join(dir, segmentName(seq))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		recs, valid := decodeRecords(data)
+		records = append(records, recs...)
+		if valid < len(data) {
+			if i != len(seqs)-1 {
+				return nil, nil, fmt.Errorf("corrupt WAL segment %s at offset %d", path, valid)
+			}
+			log.Printf("Truncating torn WAL record in %s at offset %d", path, valid)
+			if err := os.Truncate(path, int64(valid)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	w := &wal{dir: dir, noSync: noSync}
+	if len(seqs) == 0 {
+		w.seq = 1
+	} else {
+		w.seq = seqs[len(seqs)-1]
+	}
+	w.f, err = os.OpenFile(filepath.Join(dir, segmentName(w.seq)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w, records, nil
+}
+
+// decodeRecords returns the intact records in data and the length of the
+// valid prefix.
+func decodeRecords(data []byte) ([]walRecord, int) {
+	var records []walRecord
+	offset := 0
+	for len(data)-offset >= recordHeaderSize {
+		typ := data[offset]
+		length := int(binary.BigEndian.Uint32(data[offset+1:]))
+		sum := binary.BigEndian.Uint32(data[offset+5:])
+
+		start := offset + recordHeaderSize
+		if len(data)-start < length {
+			break
+		}
+		payload := data[start : start+length]
+		if crc32.Checksum(payload, castagnoli) != sum {
+			break
+		}
+
+		records = append(records, walRecord{typ: typ, payload: payload})
+		offset = start + length
+	}
+	return records, offset
+}
+
+func encodeRecord(rec walRecord) []byte {
+	buf := make([]byte, recordHeaderSize, recordHeaderSize+len(rec.payload))
+	buf[0] = rec.typ
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(rec.payload)))
+	binary.BigEndian.PutUint32(buf[5:], crc32.Checksum(rec.payload, castagnoli))
+	return append(buf, rec.payload...)
+}
+
+func (w *wal) log(rec walRecord) error {
+	if _, err := w.f.Write(encodeRecord(rec)); err != nil {
+		return err
+	}
+	if w.noSync {
+		return nil
+	}
+	return w.f.Sync()
+}
+
+// reset starts a new segment holding only records and removes every older
+// segment. It is called once the head has been persisted as a block.
+func (w *wal) reset(records []walRecord) error {
+	next := w.seq + 1
+	path := filepath.Join(w.dir, segmentName(next))
+
+	var data []byte
+	for _, rec := range records {
+		data = append(data, encodeRecord(rec)...)
+	}
+	if err := writeFileSync(path, data); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.f.Close()
+	w.f = f
+	w.seq = next
+
+	seqs, err := listSegments(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		if seq < next {
+			if err := os.Remove(filepath.Join(w.dir, segmentName(seq))); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *wal) close() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
@@ -0,0 +1,228 @@
+// Package systemd reads the state of systemd units with systemctl.
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Unit is the state of one unit. MemoryCurrent and CPUUsage are 0 when the
+// unit has no resource accounting.
+type Unit struct {
+	Name        string
+	Description string
+	// LoadState is loaded, not-found, masked or error
+	LoadState string
+	// ActiveState is active, reloading, inactive, failed, activating or
+	// deactivating
+	ActiveState string
+	SubState    string
+	// Result is success, or why the unit last failed
+	Result        string
+	Restarts      int
+	MainPID       int
+	MemoryCurrent uint64
+	// CPUUsage is in nanoseconds
+	CPUUsage uint64
+}
+
+// Failed reports whether the unit is in the failed state
+func (u Unit) Failed() bool {
+	return u.ActiveState == "failed"
+}
+
+// Found reports whether systemd knows the unit
+func (u Unit) Found() bool {
+	return u.LoadState != "not-found"
+}
+
+// Client runs systemctl
+type Client struct {
+	// Systemctl is the command run, "systemctl" if empty
+	Systemctl string
+}
+
+// NewClient returns a client running systemctl at path
+func NewClient(path string) *Client {
+	return &Client{Systemctl: path}
+}
+
+// Booted reports whether the host runs systemd, the way sd_booted does
+func Booted() bool {
+	_, err := os.Stat("/run/systemd/system")
+	return err == nil
+}
+
+// properties are the unit properties read by Show, in Unit field order
+var properties = []string{"Id", "Description", "LoadState", "ActiveState", "SubState", "Result", "NRestarts", "MainPID", "MemoryCurrent", "CPUUsageNSec"}
+
+// IsPattern reports whether name is a glob rather than a unit name
+func IsPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// unitTypes are the unit name suffixes systemd knows
+var unitTypes = map[string]bool{
+	".service": true, ".socket": true, ".device": true, ".mount": true, ".automount": true, ".swap": true,
+	".target": true, ".path": true, ".timer": true, ".slice": true, ".scope": true,
+}
+
+// UnitName adds .service to a name without a unit type suffix, as
+// systemctl does
+func UnitName(name string) string {
+	if unitTypes[path.Ext(name)] || strings.HasSuffix(name, "*") {
+		return name
+	}
+	return name + ".service"
+}
+
+// Units returns the units named by names, which may be globs such as
+// worker@*.service. A glob matches the units systemd has loaded; a plain
+// name is returned even when the unit does not exist, with LoadState
+// not-found.
+func (c *Client) Units(ctx context.Context, names ...string) ([]Unit, error) {
+	var patterns, exact []string
+	for _, name := range names {
+		name = UnitName(name)
+		if IsPattern(name) {
+			patterns = append(patterns, name)
+		} else {
+			exact = append(exact, name)
+		}
+	}
+	if len(patterns) > 0 {
+		matched, err := c.ListUnits(ctx, patterns...)
+		if err != nil {
+			return nil, err
+		}
+		exact = append(exact, matched...)
+	}
+	return c.Show(ctx, dedupe(exact)...)
+}
+
+// ListUnits returns the names of the loaded units matching the patterns
+func (c *Client) ListUnits(ctx context.Context, patterns ...string) ([]string, error) {
+	args := append([]string{"list-units", "--all", "--plain", "--no-legend", "--no-pager", "--full", "--"}, patterns...)
+	out, err := c.run(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list units: %v", err)
+	}
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// Some versions mark failed units with a bullet even with --plain.
+		fields := strings.Fields(strings.TrimLeft(scanner.Text(), "●* "))
+		if len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names, nil
+}
+
+// Show returns the state of the named units, in order
+func (c *Client) Show(ctx context.Context, names ...string) ([]Unit, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	args := append([]string{"show", "--no-pager", "--property=" + strings.Join(properties, ","), "--"}, names...)
+	out, err := c.run(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show units: %v", err)
+	}
+	return parseShow(out), nil
+}
+
+// parseShow parses blocks of Property=value lines, one per unit, separated
+// by blank lines
+func parseShow(out []byte) []Unit {
+	var units []Unit
+	var u *Unit
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			u = nil
+			continue
+		}
+		if u == nil {
+			units = append(units, Unit{})
+			u = &units[len(units)-1]
+		}
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "Id":
+			u.Name = value
+		case "Description":
+			u.Description = value
+		case "LoadState":
+			u.LoadState = value
+		case "ActiveState":
+			u.ActiveState = value
+		case "SubState":
+			u.SubState = value
+		case "Result":
+			u.Result = value
+		case "NRestarts":
+			u.Restarts, _ = strconv.Atoi(value)
+		case "MainPID":
+			u.MainPID, _ = strconv.Atoi(value)
+		case "MemoryCurrent":
+			u.MemoryCurrent = accounted(value)
+		case "CPUUsageNSec":
+			u.CPUUsage = accounted(value)
+		}
+	}
+	return units
+}
+
+// accounted parses a resource counter, which is "[not set]" or the largest
+// uint64 without accounting
+func accounted(value string) uint64 {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || n == ^uint64(0) {
+		return 0
+	}
+	return n
+}
+
+func (c *Client) run(ctx context.Context, args ...string) ([]byte, error) {
+	systemctl := c.Systemctl
+	if systemctl == "" {
+		systemctl = "systemctl"
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, systemctl, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, firstLine(msg))
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func dedupe(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	out := names[:0]
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -12,6 +12,21 @@ const showLoginLink = document.getElementById("show-login");
 
 // Event Listeners
 document.addEventListener("DOMContentLoaded", function () {
+  // Single sign-on returns the token in the URL fragment, and mailed
+  // links carry a password reset or email verification token there
+  const fragment = new URLSearchParams(window.location.hash.slice(1));
+  const ssoToken = fragment.get("token");
+  if (ssoToken) {
+    localStorage.setItem("authToken", ssoToken);
+    history.replaceState(null, "", window.location.pathname);
+  }
+  if (fragment.get("reset") || fragment.get("verify")) {
+    history.replaceState(null, "", window.location.pathname);
+    if (fragment.get("reset")) resetPassword(fragment.get("reset"));
+    if (fragment.get("verify")) verifyEmail(fragment.get("verify"));
+  }
+  showSSOLogin();
+
   // Check for existing auth token
   const token = localStorage.getItem("authToken");
   if (token) {
@@ -32,6 +47,13 @@ document.addEventListener("DOMContentLoaded", function () {
     registerForm.style.display = "block";
   });
 
+  document
+    .getElementById("forgot-password")
+    .addEventListener("click", function (e) {
+      e.preventDefault();
+      forgotPassword();
+    });
+
   showLoginLink.addEventListener("click", function (e) {
     e.preventDefault();
     registerForm.style.display = "none";
@@ -91,7 +113,11 @@ async function handleLogin(e) {
     });
 
     if (response.ok) {
-      const data = await response.json();
+      let data = await response.json();
+      if (data.mfa_token) {
+        data = await completeMFA(data);
+        if (!data) return;
+      }
       authToken = data.token;
       localStorage.setItem("authToken", authToken);
       setCurrentUser(data.user);
@@ -106,11 +132,120 @@ async function handleLogin(e) {
   }
 }
 
+// completeMFA asks for a code from the user's authenticator app, setting
+// one up first if their role requires it, and returns the login response
+async function completeMFA(challenge) {
+  const post = async (path, body) => {
+    const response = await fetch(path, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body),
+    });
+    if (!response.ok) {
+      alert(await response.text());
+      return null;
+    }
+    return response.json();
+  };
+
+  let message = "Enter the code from your authenticator app, or a recovery code:";
+  if (challenge.mfa_required === "enroll") {
+    const enrollment = await post("/api/auth/login/mfa/enroll", {
+      mfa_token: challenge.mfa_token,
+    });
+    if (!enrollment) return null;
+    message =
+      "Your role requires two-factor authentication. Add this account to your " +
+      "authenticator app with the key " +
+      enrollment.secret +
+      " (or open " +
+      enrollment.otpauth_uri +
+      "), then enter the code it shows:";
+  }
+  const code = prompt(message);
+  if (!code) return null;
+
+  const data = await post("/api/auth/login/mfa", {
+    mfa_token: challenge.mfa_token,
+    code: code.trim(),
+  });
+  if (data && data.recovery_codes) {
+    alert(
+      "Save these recovery codes. Each can be used once instead of a code:\n\n" +
+        data.recovery_codes.join("\n"),
+    );
+  }
+  return data;
+}
+
+// forgotPassword asks for a reset link to be mailed
+async function forgotPassword() {
+  const login = prompt("Enter your email address or username:");
+  if (!login) return;
+  const body = login.includes("@") ? { email: login } : { username: login };
+  const response = await fetch("/api/auth/password/forgot", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  });
+  if (response.status === 404) {
+    alert("Password reset is not enabled. Ask your Golem administrator.");
+  } else if (!response.ok) {
+    alert(await response.text());
+  } else {
+    alert("If the account exists, a reset link is on its way to its email address.");
+  }
+}
+
+// resetPassword sets a new password with the token from a reset link
+async function resetPassword(token) {
+  const password = prompt("Choose a new password:");
+  if (!password) return;
+  const response = await fetch("/api/auth/password/reset", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ token, password }),
+  });
+  if (!response.ok) {
+    const error = await response.text();
+    alert(error);
+    // A password the policy rejects leaves the link usable
+    if (error.startsWith("weak password")) resetPassword(token);
+    return;
+  }
+  alert("Your password was changed. Please login.");
+}
+
+// verifyEmail confirms the address a verification link was sent to
+async function verifyEmail(token) {
+  const response = await fetch("/api/auth/email/verify", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ token }),
+  });
+  alert(response.ok ? "Your email address is verified." : await response.text());
+}
+
+async function showSSOLogin() {
+  try {
+    const response = await fetch("/api/auth/oidc");
+    if (!response.ok) return;
+    const sso = await response.json();
+    const link = document.querySelector("#sso-login a");
+    link.href = sso.login_url;
+    link.textContent = "Sign in with " + sso.name;
+    document.getElementById("sso-login").style.display = "block";
+  } catch (error) {
+    console.error("Error checking for SSO:", error);
+  }
+}
+
 async function handleRegister(e) {
   e.preventDefault();
   const username = document.getElementById("reg-username").value;
   const email = document.getElementById("reg-email").value;
   const password = document.getElementById("reg-password").value;
+  const invitation = document.getElementById("reg-invitation").value;
 
   try {
     const response = await fetch("/api/auth/register", {
@@ -118,7 +253,7 @@ async function handleRegister(e) {
       headers: {
         "Content-Type": "application/json",
       },
-      body: JSON.stringify({ username, email, password }),
+      body: JSON.stringify({ username, email, password, invitation }),
     });
 
     if (response.ok) {